@@ -4,6 +4,7 @@ go 1.13
 
 require (
 	github.com/Cryptocurrencies-AI/go-binance v1.0.2-0.20210121071504-98c7d8ef4d8a
+	github.com/DATA-DOG/go-sqlmock v1.5.0
 	github.com/StackExchange/wmi v0.0.0-20210224194228-fe8f1750fd46 // indirect
 	github.com/andybalholm/brotli v1.0.3 // indirect
 	github.com/aws/aws-sdk-go v1.38.51 // indirect
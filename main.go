@@ -25,6 +25,7 @@ func main() {
 	defer stop()
 	go func() {
 		<-ctx.Done()
+		service.GetStrategyService().Flush()
 		log.Println("Brute shutdown.")
 		os.Exit(0)
 	}()
@@ -34,6 +34,10 @@ func RunServer(wg *sync.WaitGroup) {
 	router.GET("/healthz", Healthz)
 	router.POST("/createOrder", CreateOrder)
 	router.POST("/cancelOrder", CancelOrder)
+	router.POST("/webhook/:token", Webhook)
+	router.GET("/strategies/:id/timeline", Timeline)
+	router.POST("/strategies/:id/rebuild", RebuildState)
+	router.POST("/strategies/:id/restore", RestoreStrategy)
 	log.Info("Listening on port :8080")
 	if err := fasthttp.ListenAndServe(*addr, router.Handler); err != nil {
 		wg.Done()
@@ -74,6 +78,72 @@ func CancelOrder(ctx *fasthttp.RequestCtx) {
 	_, _ = fmt.Fprint(ctx, string(jsonStr))
 }
 
+// Webhook is a handler to pass an external trading signal to service instance to spawn a smart trade from the template the token belongs to.
+func Webhook(ctx *fasthttp.RequestCtx) {
+	token, _ := ctx.UserValue("token").(string)
+	response := service.GetStrategyService().ProcessWebhook(token, ctx.PostBody(), ctx.RemoteIP().String())
+	if response.Status != "OK" {
+		ctx.SetStatusCode(fasthttp.StatusBadRequest)
+	}
+	jsonStr, err := json.Marshal(response)
+	if err != nil {
+		log.Error("", zap.Error(err))
+	}
+	_, _ = fmt.Fprint(ctx, string(jsonStr))
+}
+
+// Timeline is a handler to return journal entries of a strategy, after the sequence number given by `after` if any.
+func Timeline(ctx *fasthttp.RequestCtx) {
+	id, _ := ctx.UserValue("id").(string)
+	after, _ := ctx.QueryArgs().GetUint("after")
+	if after < 0 {
+		after = 0
+	}
+	response := service.GetStrategyService().GetTimeline(id, int64(after))
+	if response.Status != "OK" {
+		ctx.SetStatusCode(fasthttp.StatusBadRequest)
+	}
+	jsonStr, err := json.Marshal(response)
+	if err != nil {
+		log.Error("", zap.Error(err))
+	}
+	ctx.SetContentType("application/json")
+	_, _ = fmt.Fprint(ctx, string(jsonStr))
+}
+
+// RebuildState is a handler to rebuild strategy state from its journal, saving it with `apply=true`.
+func RebuildState(ctx *fasthttp.RequestCtx) {
+	id, _ := ctx.UserValue("id").(string)
+	apply := ctx.QueryArgs().GetBool("apply")
+	log.Info("incoming rebuild", zap.String("id", id), zap.Bool("apply", apply))
+	response := service.GetStrategyService().RebuildState(id, apply)
+	if response.Status != "OK" {
+		ctx.SetStatusCode(fasthttp.StatusBadRequest)
+	}
+	jsonStr, err := json.Marshal(response)
+	if err != nil {
+		log.Error("", zap.Error(err))
+	}
+	ctx.SetContentType("application/json")
+	_, _ = fmt.Fprint(ctx, string(jsonStr))
+}
+
+// RestoreStrategy is a handler to restore strategy archived with its orders and journal.
+func RestoreStrategy(ctx *fasthttp.RequestCtx) {
+	id, _ := ctx.UserValue("id").(string)
+	log.Info("incoming restore", zap.String("id", id))
+	response := service.GetStrategyService().RestoreStrategy(id)
+	if response.Status != "OK" {
+		ctx.SetStatusCode(fasthttp.StatusBadRequest)
+	}
+	jsonStr, err := json.Marshal(response)
+	if err != nil {
+		log.Error("", zap.Error(err))
+	}
+	ctx.SetContentType("application/json")
+	_, _ = fmt.Fprint(ctx, string(jsonStr))
+}
+
 func Index(ctx *fasthttp.RequestCtx) {
 	fmt.Fprintf(ctx, "Hello, world!\n\n")
 
@@ -0,0 +1,99 @@
+package service
+
+import (
+	"os"
+	"strconv"
+	"time"
+
+	"gitlab.com/crypto_project/core/strategy_service/src/service/interfaces"
+	"gitlab.com/crypto_project/core/strategy_service/src/sources/mongodb/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.uber.org/zap"
+)
+
+const (
+	// defaultArchiveAfterDays is how long after the end strategies archived if ARCHIVE_AFTER_DAYS is not set.
+	defaultArchiveAfterDays = 30
+	archivePeriod           = time.Hour
+	archiveBatch            = 500
+)
+
+// An ArchiveResponse holds how many documents restored from archive.
+type ArchiveResponse struct {
+	Status   string               `json:"status"`
+	Msg      string               `json:"msg,omitempty"`
+	Restored models.ArchiveCounts `json:"restored"`
+}
+
+// archiveAfter returns how long after the end finished strategies are archived, zero disables archiving.
+func archiveAfter() time.Duration {
+	days, err := strconv.Atoi(os.Getenv("ARCHIVE_AFTER_DAYS"))
+	if err != nil {
+		days = defaultArchiveAfterDays
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// runArchiving archives finished strategies periodically if the state management keeps the archive. Instances may run
+// it together as moving strategies is idempotent.
+func (ss *StrategyService) runArchiving() {
+	store, ok := ss.stateMgmt.(interfaces.IArchiveStore)
+	age := archiveAfter()
+	if !ok || age <= 0 {
+		return
+	}
+	ss.log.Info("starting archiving", zap.Duration("age", age))
+	ticker := time.NewTicker(archivePeriod)
+	defer ticker.Stop()
+	for {
+		ss.archive(store, time.Now().Add(-age))
+		<-ticker.C
+	}
+}
+
+// archive moves strategies ended before the time given in batches until all of them moved.
+func (ss *StrategyService) archive(store interfaces.IArchiveStore, endedBefore time.Time) {
+	t1 := time.Now()
+	var total models.ArchiveCounts
+	for {
+		counts, err := store.ArchiveStrategies(endedBefore, archiveBatch)
+		total.Add(counts)
+		if err != nil {
+			ss.log.Error("can't archive strategies", zap.Error(err))
+			ss.statsd.Inc("strategy_service.archive.error")
+			break
+		}
+		if counts.Strategies < archiveBatch {
+			break
+		}
+	}
+	ss.statsd.Gauge("strategy_service.archive.strategies", total.Strategies)
+	ss.statsd.Gauge("strategy_service.archive.orders", total.Orders)
+	ss.statsd.Gauge("strategy_service.archive.journal_entries", total.JournalEntries)
+	ss.statsd.TimingDuration("strategy_service.archive", time.Since(t1))
+	ss.log.Info("strategies archived",
+		zap.Int64("strategies", total.Strategies),
+		zap.Int64("orders", total.Orders),
+		zap.Int64("journal entries", total.JournalEntries),
+	)
+}
+
+// RestoreStrategy moves the strategy given back from archive with its orders and journal, e.g. on user request.
+func (ss *StrategyService) RestoreStrategy(strategyHex string) ArchiveResponse {
+	store, ok := ss.stateMgmt.(interfaces.IArchiveStore)
+	if !ok {
+		return ArchiveResponse{Status: "ERR", Msg: "archive is not kept"}
+	}
+	strategyId, err := primitive.ObjectIDFromHex(strategyHex)
+	if err != nil {
+		return ArchiveResponse{Status: "ERR", Msg: "malformed strategy id"}
+	}
+	counts, err := store.RestoreStrategy(&strategyId)
+	if err != nil {
+		ss.statsd.Inc("strategy_service.archive.restore_error")
+		return ArchiveResponse{Status: "ERR", Msg: err.Error(), Restored: counts}
+	}
+	ss.statsd.Inc("strategy_service.archive.restored")
+	ss.statsd.Gauge("strategy_service.archive.restored_orders", counts.Orders)
+	return ArchiveResponse{Status: "OK", Restored: counts}
+}
@@ -0,0 +1,80 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-redsync/redsync/v4"
+	"gitlab.com/crypto_project/core/strategy_service/src/service/copytrading"
+	"gitlab.com/crypto_project/core/strategy_service/src/sources/mongodb"
+	"gitlab.com/crypto_project/core/strategy_service/src/sources/mongodb/models"
+	"gitlab.com/crypto_project/core/strategy_service/src/sources/mongodb/schema"
+	"gitlab.com/crypto_project/core/strategy_service/src/sources/redis"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.uber.org/zap"
+)
+
+// copyTradingReloadPeriod is how often copy trading configurations are re-read, in lock extensions.
+const copyTradingReloadPeriod = 20
+
+// RunCopyTrading copies leader strategies to followers in the single service instance holding the copy trading lock.
+func (ss *StrategyService) RunCopyTrading() {
+	rs := redis.GetRedsync()
+	mutex := rs.NewMutex("strategy_service:copy_trading",
+		redsync.WithTries(1),
+		redsync.WithExpiry(10*time.Second),
+	)
+	for {
+		if err := mutex.Lock(); err != nil {
+			time.Sleep(10 * time.Second) // another instance copies strategies
+			continue
+		}
+		ss.log.Info("copy trading lock taken, copying strategies in this instance")
+		ctx, cancel := context.WithCancel(context.Background())
+		ss.copyTrading = copytrading.NewEngine(ss.copyTradingStore)
+		ss.copyTrading.SetCopyTradings(ss.copyTradingStore.GetEnabledCopyTradings())
+		ss.statsd.Gauge("strategy_service.copied_leaders", int64(ss.copyTrading.Count()))
+		go ss.WatchCopiedStrategies(ctx)
+		for i := 1; ; i++ {
+			time.Sleep(3 * time.Second)
+			if ok, err := mutex.Extend(); !ok || err != nil {
+				ss.log.Error("copy trading lock extension",
+					zap.Bool("success", ok),
+					zap.Error(err),
+				)
+				break
+			}
+			if i%copyTradingReloadPeriod == 0 {
+				ss.copyTrading.SetCopyTradings(ss.copyTradingStore.GetEnabledCopyTradings())
+				ss.statsd.Gauge("strategy_service.copied_leaders", int64(ss.copyTrading.Count()))
+			}
+		}
+		cancel()
+	}
+}
+
+// WatchCopiedStrategies subscribes to strategies updates to copy leader strategies and track the copies until the
+// context is done. The watch is resumed after interruptions, by the next instance taking the lock as well.
+func (ss *StrategyService) WatchCopiedStrategies(ctx context.Context) {
+	ss.log.Info("watching for copied strategies in the storage")
+	watch := mongodb.ResumableWatch{
+		Name:       "copied_strategies",
+		Shared:     true,
+		Collection: mongodb.GetCollection("core_strategies"),
+		Pipeline: mongo.Pipeline{{{
+			Key:   "$match",
+			Value: bson.M{"operationType": bson.M{"$in": []string{"insert", "update", "replace"}}},
+		}}},
+		Statsd: &ss.statsd,
+		Handle: func(cs *mongo.ChangeStream) {
+			var event models.MongoStrategyUpdateEvent
+			if err := schema.DecodeStrategyEvent(cs.Current, &event); err != nil {
+				ss.log.Error("copied strategy event decode", zap.Error(err))
+				return
+			}
+			ss.copyTrading.OnStrategyUpdate(&event.FullDocument, event.OperationType == "insert")
+		},
+	}
+	watch.RunUntil(ctx)
+}
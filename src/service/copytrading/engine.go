@@ -0,0 +1,315 @@
+package copytrading
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"gitlab.com/crypto_project/core/strategy_service/src/logging"
+	"gitlab.com/crypto_project/core/strategy_service/src/service/interfaces"
+	"gitlab.com/crypto_project/core/strategy_service/src/service/strategies/smart_order"
+	"gitlab.com/crypto_project/core/strategy_service/src/sources/mongodb/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.uber.org/zap"
+)
+
+var log interfaces.ILogger
+
+func init() {
+	logger, _ := logging.GetZapLogger()
+	log = logger.With(zap.String("logger", "copytrading"))
+}
+
+// An Engine mirrors smart trades created for leader accounts onto follower keys and keeps the copies consistent with
+// leader edits, pauses and cancels.
+type Engine struct {
+	Store        interfaces.ICopyTradingStore
+	copyTradings map[string]*models.MongoCopyTrading // by leader account id
+	conditions   map[string]string                   // last conditions seen by leader strategy id, to detect edits
+	mux          sync.Mutex
+}
+
+// NewEngine instantiates copy trading engine with the store given.
+func NewEngine(store interfaces.ICopyTradingStore) *Engine {
+	return &Engine{
+		Store:        store,
+		copyTradings: map[string]*models.MongoCopyTrading{},
+		conditions:   map[string]string{},
+	}
+}
+
+// SetCopyTradings replaces copy trading configurations watched.
+func (e *Engine) SetCopyTradings(copyTradings []models.MongoCopyTrading) {
+	e.mux.Lock()
+	defer e.mux.Unlock()
+	e.copyTradings = map[string]*models.MongoCopyTrading{}
+	for i := range copyTradings {
+		copyTrading := copyTradings[i]
+		if !copyTrading.Enabled {
+			continue
+		}
+		e.copyTradings[copyTrading.LeaderAccountId.Hex()] = &copyTrading
+	}
+}
+
+// Count returns how much leader accounts are copied.
+func (e *Engine) Count() int {
+	e.mux.Lock()
+	defer e.mux.Unlock()
+	return len(e.copyTradings)
+}
+
+// OnStrategyUpdate copies a leader smart trade just inserted to followers, propagates leader updates to the copies
+// and tracks divergence of the copies. Edits made while the engine didn't watch the leader are not propagated.
+func (e *Engine) OnStrategyUpdate(strategy *models.MongoStrategy, inserted bool) {
+	if strategy.ID == nil || strategy.Conditions == nil {
+		return
+	}
+	if strategy.Conditions.LeaderStrategyId != nil { // a copy filled or closed
+		if leader := e.Store.GetStrategy(strategy.Conditions.LeaderStrategyId); leader != nil {
+			e.Store.SaveCopyDivergence(Divergence(leader, strategy))
+		}
+		return
+	}
+	if strategy.AccountId == nil || strategy.Type != 1 || strategy.Conditions.TemplateToken != "" {
+		return // only smart trades are copied, templates are not traded
+	}
+	id := strategy.ID.Hex()
+	conditions, _ := json.Marshal(strategy.Conditions)
+	e.mux.Lock()
+	copyTrading := e.copyTradings[strategy.AccountId.Hex()]
+	lastConditions, seen := e.conditions[id]
+	if isTerminal(stateOf(strategy)) {
+		delete(e.conditions, id)
+	} else if copyTrading != nil {
+		e.conditions[id] = string(conditions)
+	}
+	e.mux.Unlock()
+	if copyTrading == nil {
+		return
+	}
+
+	copies := map[string]*models.MongoStrategy{}
+	for _, follower := range e.Store.GetFollowerStrategies(strategy.ID) {
+		follower := follower
+		if follower.AccountId == nil {
+			continue
+		}
+		copies[follower.AccountId.Hex()] = &follower
+	}
+	if inserted {
+		e.copyToFollowers(copyTrading, strategy, copies)
+		return
+	}
+	edited := seen && lastConditions != string(conditions)
+	for _, follower := range copies {
+		e.propagate(strategy, follower, edited)
+		e.Store.SaveCopyDivergence(Divergence(strategy, follower))
+	}
+}
+
+// copyToFollowers creates copies of the leader strategy for enabled followers not having one yet.
+func (e *Engine) copyToFollowers(copyTrading *models.MongoCopyTrading, leader *models.MongoStrategy, copies map[string]*models.MongoStrategy) {
+	for _, follower := range copyTrading.Followers {
+		if !follower.Enabled || follower.KeyId == *leader.AccountId || copies[follower.KeyId.Hex()] != nil {
+			continue
+		}
+		leaderEquity, followerEquity := 0.0, 0.0
+		if follower.ScaleByEquity {
+			leaderEquity, followerEquity = e.equities(copyTrading, leader, follower)
+		}
+		strategy, err := Clone(leader, follower, Scale(follower, leaderEquity, followerEquity))
+		if err != nil {
+			log.Warn("can't copy strategy",
+				zap.String("leader", leader.ID.Hex()),
+				zap.String("follower", follower.KeyId.Hex()),
+				zap.Error(err),
+			)
+			continue
+		}
+		e.Store.CreateStrategy(strategy) // picked up by the strategies watch
+		log.Info("strategy copied",
+			zap.String("leader", leader.ID.Hex()),
+			zap.String("strategy", strategy.ID.Hex()),
+			zap.Float64("scale", strategy.Conditions.CopyScale),
+		)
+	}
+}
+
+// propagate cancels, edits, pauses or resumes the copy after the leader strategy. Copies ended by themselves are left.
+func (e *Engine) propagate(leader *models.MongoStrategy, follower *models.MongoStrategy, edited bool) {
+	if isTerminal(stateOf(follower)) {
+		return
+	}
+	if stateOf(leader) == smart_order.Canceled {
+		// the copy runtime owns the rest of the state, only the state itself is set
+		e.Store.DisableStrategy(follower.ID)
+		e.Store.UpdateState(follower.ID, &models.MongoStrategyState{State: smart_order.Canceled})
+		log.Info("copy canceled after leader", zap.String("strategy", follower.ID.Hex()))
+		return
+	}
+	if edited {
+		conditions, err := CopyConditions(leader, *follower.AccountId, follower.Conditions.CopyScale)
+		if err == nil {
+			e.Store.UpdateConditions(follower.ID, conditions)
+			log.Info("copy edited after leader", zap.String("strategy", follower.ID.Hex()))
+		}
+	}
+	if leader.Enabled != follower.Enabled && !isTerminal(stateOf(leader)) {
+		if leader.Enabled {
+			e.Store.EnableStrategy(follower.ID)
+		} else {
+			e.Store.DisableStrategy(follower.ID)
+		}
+		log.Info("copy enabled after leader",
+			zap.String("strategy", follower.ID.Hex()),
+			zap.Bool("enabled", leader.Enabled),
+		)
+	}
+}
+
+// equities returns free balances of the leader and the follower keys in the quote asset of the leader pair. Equities
+// configured are taken for balances unknown.
+func (e *Engine) equities(copyTrading *models.MongoCopyTrading, leader *models.MongoStrategy, follower *models.MongoFollower) (float64, float64) {
+	leaderEquity, followerEquity := copyTrading.LeaderEquity, follower.Equity
+	quoteAsset := leader.Conditions.Pair[strings.LastIndex(leader.Conditions.Pair, "_")+1:]
+	if balance := e.Store.GetKeyBalances(leader.AccountId)[quoteAsset]; balance > 0 {
+		leaderEquity = balance
+	}
+	if balance := e.Store.GetKeyBalances(&follower.KeyId)[quoteAsset]; balance > 0 {
+		followerEquity = balance
+	}
+	return leaderEquity, followerEquity
+}
+
+// Scale returns a multiplier of leader amounts for the follower: ratio of follower equity to leader equity if scaled by
+// equity and both equities known, the fixed multiplier otherwise, 1 if not set.
+func Scale(follower *models.MongoFollower, leaderEquity float64, followerEquity float64) float64 {
+	if follower.ScaleByEquity && followerEquity > 0 && leaderEquity > 0 {
+		return followerEquity / leaderEquity
+	}
+	if follower.Multiplier > 0 {
+		return follower.Multiplier
+	}
+	return 1
+}
+
+// Clone returns a new strategy copying the leader smart trade for the follower key and owner with amounts scaled.
+func Clone(leader *models.MongoStrategy, follower *models.MongoFollower, scale float64) (*models.MongoStrategy, error) {
+	keyId := follower.KeyId
+	conditions, err := CopyConditions(leader, keyId, scale)
+	if err != nil {
+		return nil, err
+	}
+	id := primitive.NewObjectID()
+	return &models.MongoStrategy{
+		ID:          &id,
+		Type:        leader.Type,
+		Enabled:     leader.Enabled,
+		AccountId:   &keyId,
+		Conditions:  conditions,
+		State:       &models.MongoStrategyState{},
+		TriggerWhen: leader.TriggerWhen,
+		Expiration:  leader.Expiration,
+		OwnerId:     follower.OwnerId,
+		CreatedAt:   time.Now(),
+	}, nil
+}
+
+// CopyConditions returns a deep copy of leader conditions linked to the leader for the key given. Absolute amounts
+// are scaled, the ones in percents are left as is. Hedging and template links of the leader are not copied.
+func CopyConditions(leader *models.MongoStrategy, keyId primitive.ObjectID, scale float64) (*models.MongoStrategyCondition, error) {
+	if leader.Conditions == nil || leader.Conditions.EntryOrder == nil {
+		return nil, fmt.Errorf("leader has no entry order")
+	}
+	if scale <= 0 {
+		return nil, fmt.Errorf("bad scale %v", scale)
+	}
+	jsonStr, err := json.Marshal(leader.Conditions)
+	if err != nil {
+		return nil, err
+	}
+	var conditions models.MongoStrategyCondition
+	if err := json.Unmarshal(jsonStr, &conditions); err != nil {
+		return nil, err
+	}
+	conditions.AccountId = &keyId
+	conditions.LeaderStrategyId = leader.ID
+	conditions.CopyScale = scale
+	conditions.KeyAssetId = nil
+	conditions.MakerOrderId = nil
+	conditions.Hedging = false
+	conditions.HedgeKeyId = nil
+	conditions.HedgeStrategyId = nil
+	conditions.TemplateToken = ""
+	conditions.CreatedByTemplate = false
+	conditions.TemplateStrategyId = nil
+
+	conditions.EntryOrder.Amount *= scale
+	if conditions.EntryOrder.Amount == 0 {
+		return nil, fmt.Errorf("amount scaled to zero")
+	}
+	for _, levels := range [][]*models.MongoEntryPoint{conditions.EntryLevels, conditions.ExitLevels} {
+		for _, level := range levels {
+			if level.Type == 0 { // absolute amount
+				level.Amount *= scale
+			}
+		}
+	}
+	return &conditions, nil
+}
+
+// Divergence returns fill and profit divergence of the follower copy from the leader strategy.
+func Divergence(leader *models.MongoStrategy, follower *models.MongoStrategy) models.MongoCopyDivergence {
+	divergence := models.MongoCopyDivergence{
+		FollowerStrategyId: follower.ID,
+		LeaderStrategyId:   leader.ID,
+		KeyId:              follower.AccountId,
+		Scale:              follower.Conditions.CopyScale,
+		LeaderState:        stateOf(leader),
+		FollowerState:      stateOf(follower),
+		UpdatedAt:          time.Now(),
+	}
+	if leader.State == nil || follower.State == nil {
+		return divergence
+	}
+	if leader.State.EntryPrice > 0 && follower.State.EntryPrice > 0 {
+		divergence.EntrySlippage = (follower.State.EntryPrice - leader.State.EntryPrice) / leader.State.EntryPrice * 100
+		if leader.Conditions.EntryOrder != nil && leader.Conditions.EntryOrder.Side == "sell" {
+			divergence.EntrySlippage = -divergence.EntrySlippage // a lower price is worse to enter short
+		}
+	}
+	divergence.ExitedDivergence = exitedPercentage(follower) - exitedPercentage(leader)
+	divergence.LeaderProfit = leader.State.ReceivedProfitAmount
+	divergence.FollowerProfit = follower.State.ReceivedProfitAmount
+	divergence.ProfitDivergence = follower.State.ReceivedProfitPercentage - leader.State.ReceivedProfitPercentage
+	return divergence
+}
+
+// exitedPercentage returns executed exit amount in percents of entry amount.
+func exitedPercentage(strategy *models.MongoStrategy) float64 {
+	if strategy.Conditions.EntryOrder == nil || strategy.Conditions.EntryOrder.Amount == 0 {
+		return 0
+	}
+	return math.Min(strategy.State.ExecutedAmount/strategy.Conditions.EntryOrder.Amount*100, 100)
+}
+
+// stateOf returns state of the strategy, empty if not set yet.
+func stateOf(strategy *models.MongoStrategy) string {
+	if strategy.State == nil {
+		return ""
+	}
+	return strategy.State.State
+}
+
+// isTerminal returns true if a smart trade in the state given is done and won't trade anymore.
+func isTerminal(state string) bool {
+	switch state {
+	case smart_order.End, smart_order.Canceled, smart_order.Timeout, smart_order.Error:
+		return true
+	}
+	return false
+}
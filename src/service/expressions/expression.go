@@ -0,0 +1,73 @@
+// Package expressions implements a small safe language of strategy conditions, e.g.
+//
+//	close > ema(50, 15m) && spread_pct < 0.1
+//
+// An expression is compiled once and evaluated on each tick against an environment providing variables and
+// indicators values. Expressions have no side effects, no loops and a limited nesting, so evaluation is cheap.
+package expressions
+
+import (
+	"errors"
+	"fmt"
+)
+
+// maxLength limits expression source length.
+const maxLength = 1024
+
+// ErrNotReady is returned by evaluation if an indicator has not enough bars yet.
+var ErrNotReady = errors.New("indicator is not ready")
+
+// A Call identifies an indicator requested by expression, e.g. bb(20, 2, 1h).upper.
+type Call struct {
+	Name      string
+	Params    []float64
+	Timeframe string // empty if not given
+	Output    string // main output if empty
+}
+
+// An Env provides values an expression is evaluated against.
+type Env interface {
+	Variable(name string) (float64, error)
+	Indicator(call Call) (value float64, ready bool, error error)
+}
+
+// An Expression is a compiled boolean expression.
+type Expression struct {
+	Source string
+	root   node
+}
+
+// Compile parses and validates source of a boolean expression with variables given known.
+func Compile(source string, variables []string) (*Expression, error) {
+	if len(source) > maxLength {
+		return nil, fmt.Errorf("expression is longer than %d", maxLength)
+	}
+	tokens, err := lex(source)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens, variables: map[string]bool{}}
+	for _, name := range variables {
+		p.variables[name] = true
+	}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokenEnd {
+		return nil, p.unexpected("an operator")
+	}
+	if root.kind() != kindBool {
+		return nil, fmt.Errorf("expression should be a condition, not a %s", root.kind())
+	}
+	return &Expression{Source: source, root: root}, nil
+}
+
+// Evaluate returns true if the expression holds in the environment, ErrNotReady if any indicator needed is not ready.
+func (e *Expression) Evaluate(env Env) (bool, error) {
+	value, err := e.root.eval(env)
+	if err != nil {
+		return false, err
+	}
+	return value != 0, nil
+}
@@ -0,0 +1,78 @@
+package expressions
+
+import (
+	"fmt"
+	"strconv"
+	"unicode"
+)
+
+type tokenKind int
+
+const (
+	tokenEnd tokenKind = iota
+	tokenNumber
+	tokenTimeframe // number followed by unit, e.g. 15m
+	tokenIdent
+	tokenOperator
+)
+
+type token struct {
+	kind  tokenKind
+	text  string
+	value float64
+	pos   int
+}
+
+// operators longer first, so <= is not taken for <
+var operators = []string{"&&", "||", "==", "!=", "<=", ">=", "<", ">", "!", "+", "-", "*", "/", "(", ")", ",", "."}
+
+// lex splits source to tokens ending with tokenEnd.
+func lex(source string) ([]token, error) {
+	var tokens []token
+	runes := []rune(source)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case unicode.IsDigit(r) || r == '.' && i+1 < len(runes) && unicode.IsDigit(runes[i+1]):
+			start := i
+			for i < len(runes) && (unicode.IsDigit(runes[i]) || runes[i] == '.') {
+				i++
+			}
+			number := string(runes[start:i])
+			value, err := strconv.ParseFloat(number, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid number %q at %d", number, start)
+			}
+			if i < len(runes) && unicode.IsLetter(runes[i]) {
+				for i < len(runes) && unicode.IsLetter(runes[i]) {
+					i++
+				}
+				tokens = append(tokens, token{kind: tokenTimeframe, text: string(runes[start:i]), pos: start})
+				continue
+			}
+			tokens = append(tokens, token{kind: tokenNumber, text: number, value: value, pos: start})
+		case unicode.IsLetter(r) || r == '_':
+			start := i
+			for i < len(runes) && (unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i]) || runes[i] == '_') {
+				i++
+			}
+			tokens = append(tokens, token{kind: tokenIdent, text: string(runes[start:i]), pos: start})
+		default:
+			matched := false
+			for _, operator := range operators {
+				if i+len(operator) <= len(runes) && string(runes[i:i+len(operator)]) == operator {
+					tokens = append(tokens, token{kind: tokenOperator, text: operator, pos: i})
+					i += len(operator)
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				return nil, fmt.Errorf("unexpected %q at %d", r, i)
+			}
+		}
+	}
+	return append(tokens, token{kind: tokenEnd, pos: len(runes)}), nil
+}
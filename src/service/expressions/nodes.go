@@ -0,0 +1,200 @@
+package expressions
+
+import (
+	"errors"
+	"math"
+)
+
+type kind int
+
+const (
+	kindNumber kind = iota
+	kindBool
+)
+
+func (k kind) String() string {
+	if k == kindBool {
+		return "boolean"
+	}
+	return "number"
+}
+
+// A node is evaluated to a number, booleans are represented as 1 and 0 since operands types are checked at parsing.
+type node interface {
+	kind() kind
+	eval(env Env) (float64, error)
+}
+
+var errDivisionByZero = errors.New("division by zero")
+
+func fromBool(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+type number float64
+
+func (n number) kind() kind                { return kindNumber }
+func (n number) eval(Env) (float64, error) { return float64(n), nil }
+
+type boolean bool
+
+func (b boolean) kind() kind                { return kindBool }
+func (b boolean) eval(Env) (float64, error) { return fromBool(bool(b)), nil }
+
+type variable string
+
+func (v variable) kind() kind { return kindNumber }
+func (v variable) eval(env Env) (float64, error) {
+	return env.Variable(string(v))
+}
+
+type indicatorCall struct {
+	call Call
+}
+
+func (c *indicatorCall) kind() kind { return kindNumber }
+func (c *indicatorCall) eval(env Env) (float64, error) {
+	value, ready, err := env.Indicator(c.call)
+	if err != nil {
+		return 0, err
+	}
+	if !ready {
+		return 0, ErrNotReady
+	}
+	return value, nil
+}
+
+type function struct {
+	minArgs int
+	maxArgs int // 0 means any
+	apply   func(args []float64) float64
+}
+
+var functions = map[string]function{
+	"abs": {minArgs: 1, maxArgs: 1, apply: func(args []float64) float64 { return math.Abs(args[0]) }},
+	"min": {minArgs: 1, apply: func(args []float64) float64 {
+		result := args[0]
+		for _, arg := range args[1:] {
+			result = math.Min(result, arg)
+		}
+		return result
+	}},
+	"max": {minArgs: 1, apply: func(args []float64) float64 {
+		result := args[0]
+		for _, arg := range args[1:] {
+			result = math.Max(result, arg)
+		}
+		return result
+	}},
+}
+
+type functionCall struct {
+	name string
+	args []node
+}
+
+func (c *functionCall) kind() kind { return kindNumber }
+func (c *functionCall) eval(env Env) (float64, error) {
+	args := make([]float64, len(c.args))
+	for i, arg := range c.args {
+		value, err := arg.eval(env)
+		if err != nil {
+			return 0, err
+		}
+		args[i] = value
+	}
+	return functions[c.name].apply(args), nil
+}
+
+type arithmetic struct {
+	operator    string
+	left, right node
+}
+
+func (a *arithmetic) kind() kind { return kindNumber }
+func (a *arithmetic) eval(env Env) (float64, error) {
+	left, err := a.left.eval(env)
+	if err != nil {
+		return 0, err
+	}
+	right, err := a.right.eval(env)
+	if err != nil {
+		return 0, err
+	}
+	switch a.operator {
+	case "+":
+		return left + right, nil
+	case "-":
+		return left - right, nil
+	case "*":
+		return left * right, nil
+	}
+	if right == 0 {
+		return 0, errDivisionByZero
+	}
+	return left / right, nil
+}
+
+type comparison struct {
+	operator    string
+	left, right node
+}
+
+func (c *comparison) kind() kind { return kindBool }
+func (c *comparison) eval(env Env) (float64, error) {
+	left, err := c.left.eval(env)
+	if err != nil {
+		return 0, err
+	}
+	right, err := c.right.eval(env)
+	if err != nil {
+		return 0, err
+	}
+	switch c.operator {
+	case "<":
+		return fromBool(left < right), nil
+	case "<=":
+		return fromBool(left <= right), nil
+	case ">":
+		return fromBool(left > right), nil
+	case ">=":
+		return fromBool(left >= right), nil
+	case "==":
+		return fromBool(left == right), nil
+	}
+	return fromBool(left != right), nil
+}
+
+// logical operators are short-circuit, so indicators on the right side are not requested if not needed.
+type logical struct {
+	operator    string
+	left, right node
+}
+
+func (l *logical) kind() kind { return kindBool }
+func (l *logical) eval(env Env) (float64, error) {
+	left, err := l.left.eval(env)
+	if err != nil {
+		return 0, err
+	}
+	if l.operator == "&&" && left == 0 || l.operator == "||" && left != 0 {
+		return left, nil
+	}
+	return l.right.eval(env)
+}
+
+type not struct {
+	operand node
+}
+
+func (n *not) kind() kind { return kindBool }
+func (n *not) eval(env Env) (float64, error) {
+	value, err := n.operand.eval(env)
+	if err != nil {
+		return 0, err
+	}
+	return fromBool(value == 0), nil
+}
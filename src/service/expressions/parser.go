@@ -0,0 +1,334 @@
+package expressions
+
+import (
+	"fmt"
+
+	"gitlab.com/crypto_project/core/strategy_service/src/service/indicators"
+	"gitlab.com/crypto_project/core/strategy_service/src/sources/candles"
+)
+
+// maxDepth limits nesting of an expression to keep evaluation cheap.
+const maxDepth = 32
+
+// parser is a recursive descent parser of the grammar, from the lowest precedence:
+//
+//	or        = and { "||" and }
+//	and       = not { "&&" not }
+//	not       = "!" not | compare
+//	compare   = sum [ ( "<" | "<=" | ">" | ">=" | "==" | "!=" ) sum ]
+//	sum       = product { ( "+" | "-" ) product }
+//	product   = unary { ( "*" | "/" ) unary }
+//	unary     = "-" unary | primary
+//	primary   = number | "true" | "false" | variable | function | indicator | "(" or ")"
+//	function  = name "(" [ sum { "," sum } ] ")"
+//	indicator = name "(" [ arg { "," arg } ] ")" [ "." output ], where arg is a number or a timeframe going last
+type parser struct {
+	tokens    []token
+	pos       int
+	depth     int
+	variables map[string]bool
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEnd {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) accept(operator string) bool {
+	if t := p.peek(); t.kind == tokenOperator && t.text == operator {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) expect(operator string) error {
+	if !p.accept(operator) {
+		return p.unexpected(fmt.Sprintf("%q", operator))
+	}
+	return nil
+}
+
+func (p *parser) unexpected(expected string) error {
+	t := p.peek()
+	if t.kind == tokenEnd {
+		return fmt.Errorf("expected %s at the end", expected)
+	}
+	return fmt.Errorf("expected %s at %d, got %q", expected, t.pos, t.text)
+}
+
+// typed checks node is of the type expected by operator.
+func (p *parser) typed(n node, expected kind, operator string) error {
+	if n.kind() != expected {
+		return fmt.Errorf("operator %q expects %s operands", operator, expected)
+	}
+	return nil
+}
+
+func (p *parser) parseOr() (node, error) {
+	p.depth++
+	defer func() { p.depth-- }()
+	if p.depth > maxDepth {
+		return nil, fmt.Errorf("expression nested too deep")
+	}
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("||") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.typed(left, kindBool, "||"); err != nil {
+			return nil, err
+		}
+		if err := p.typed(right, kindBool, "||"); err != nil {
+			return nil, err
+		}
+		left = &logical{operator: "||", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (node, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("&&") {
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.typed(left, kindBool, "&&"); err != nil {
+			return nil, err
+		}
+		if err := p.typed(right, kindBool, "&&"); err != nil {
+			return nil, err
+		}
+		left = &logical{operator: "&&", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseNot() (node, error) {
+	if p.accept("!") {
+		operand, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.typed(operand, kindBool, "!"); err != nil {
+			return nil, err
+		}
+		return &not{operand: operand}, nil
+	}
+	return p.parseCompare()
+}
+
+func (p *parser) parseCompare() (node, error) {
+	left, err := p.parseSum()
+	if err != nil {
+		return nil, err
+	}
+	t := p.peek()
+	if t.kind != tokenOperator {
+		return left, nil
+	}
+	switch t.text {
+	case "<", "<=", ">", ">=", "==", "!=":
+		p.next()
+		right, err := p.parseSum()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.typed(left, kindNumber, t.text); err != nil {
+			return nil, err
+		}
+		if err := p.typed(right, kindNumber, t.text); err != nil {
+			return nil, err
+		}
+		return &comparison{operator: t.text, left: left, right: right}, nil
+	}
+	return left, nil
+}
+
+func (p *parser) parseSum() (node, error) {
+	left, err := p.parseProduct()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t := p.peek()
+		if t.kind != tokenOperator || t.text != "+" && t.text != "-" {
+			return left, nil
+		}
+		p.next()
+		right, err := p.parseProduct()
+		if err != nil {
+			return nil, err
+		}
+		if left, err = p.arithmetic(t.text, left, right); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (p *parser) parseProduct() (node, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t := p.peek()
+		if t.kind != tokenOperator || t.text != "*" && t.text != "/" {
+			return left, nil
+		}
+		p.next()
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		if left, err = p.arithmetic(t.text, left, right); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (p *parser) arithmetic(operator string, left, right node) (node, error) {
+	if err := p.typed(left, kindNumber, operator); err != nil {
+		return nil, err
+	}
+	if err := p.typed(right, kindNumber, operator); err != nil {
+		return nil, err
+	}
+	return &arithmetic{operator: operator, left: left, right: right}, nil
+}
+
+func (p *parser) parseUnary() (node, error) {
+	if p.accept("-") {
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.typed(operand, kindNumber, "-"); err != nil {
+			return nil, err
+		}
+		return &arithmetic{operator: "-", left: number(0), right: operand}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *parser) parsePrimary() (node, error) {
+	t := p.peek()
+	switch {
+	case t.kind == tokenNumber:
+		p.next()
+		return number(t.value), nil
+	case t.kind == tokenOperator && t.text == "(":
+		p.next()
+		n, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		return n, p.expect(")")
+	case t.kind == tokenIdent:
+		p.next()
+		if p.accept("(") {
+			if _, ok := functions[t.text]; ok {
+				return p.parseFunction(t)
+			}
+			return p.parseIndicator(t)
+		}
+		if t.text == "true" || t.text == "false" {
+			return boolean(t.text == "true"), nil
+		}
+		if !p.variables[t.text] {
+			return nil, fmt.Errorf("unknown variable %q at %d", t.text, t.pos)
+		}
+		return variable(t.text), nil
+	}
+	return nil, p.unexpected("a number, variable or function")
+}
+
+// parseFunction parses arguments after the opening parenthesis of a function call.
+func (p *parser) parseFunction(name token) (node, error) {
+	function := functions[name.text]
+	var args []node
+	for !p.accept(")") {
+		if len(args) > 0 {
+			if err := p.expect(","); err != nil {
+				return nil, err
+			}
+		}
+		arg, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.typed(arg, kindNumber, name.text); err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+	}
+	if len(args) < function.minArgs || function.maxArgs > 0 && len(args) > function.maxArgs {
+		return nil, fmt.Errorf("wrong number of arguments of %q at %d", name.text, name.pos)
+	}
+	return &functionCall{name: name.text, args: args}, nil
+}
+
+// parseIndicator parses constant arguments after the opening parenthesis of an indicator call.
+func (p *parser) parseIndicator(name token) (node, error) {
+	var params []float64
+	timeframe := ""
+	for !p.accept(")") {
+		if len(params) > 0 || timeframe != "" {
+			if timeframe != "" {
+				return nil, fmt.Errorf("timeframe should be the last argument of %q", name.text)
+			}
+			if err := p.expect(","); err != nil {
+				return nil, err
+			}
+		}
+		negative := p.accept("-")
+		t := p.next()
+		switch {
+		case t.kind == tokenNumber && negative:
+			params = append(params, -t.value)
+		case t.kind == tokenNumber:
+			params = append(params, t.value)
+		case t.kind == tokenTimeframe && !negative:
+			if _, ok := candles.Timeframes[t.text]; !ok {
+				return nil, fmt.Errorf("unknown timeframe %q at %d", t.text, t.pos)
+			}
+			timeframe = t.text
+		default:
+			p.pos--
+			return nil, p.unexpected("a number or timeframe argument")
+		}
+	}
+	output := ""
+	if p.accept(".") {
+		t := p.next()
+		if t.kind != tokenIdent {
+			p.pos--
+			return nil, p.unexpected("an indicator output")
+		}
+		output = t.text
+	}
+	// indicators take constant params, so instance is checked for output once here
+	indicator, err := indicators.New(name.text, params)
+	if err != nil {
+		return nil, fmt.Errorf("%v at %d", err, name.pos)
+	}
+	if _, ok := indicator.Value(output); !ok {
+		return nil, fmt.Errorf("unknown output %q of indicator %q at %d", output, name.text, name.pos)
+	}
+	return &indicatorCall{call: Call{Name: name.text, Params: params, Timeframe: timeframe, Output: output}}, nil
+}
@@ -0,0 +1,70 @@
+package indicators
+
+import "gitlab.com/crypto_project/core/strategy_service/src/service/interfaces"
+
+// A Bollinger is Bollinger bands of closes, a simple moving average with bands at deviations of standard deviation.
+type Bollinger struct {
+	closes     window
+	deviations float64
+}
+
+func NewBollinger(period int, deviations float64) *Bollinger {
+	return &Bollinger{closes: window{size: period}, deviations: deviations}
+}
+
+func (bb *Bollinger) Update(candle interfaces.Candle) {
+	bb.closes.add(candle.Close)
+}
+
+func (bb *Bollinger) Ready() bool {
+	return bb.closes.full()
+}
+
+func (bb *Bollinger) Value(output string) (float64, bool) {
+	middle := bb.closes.mean()
+	switch output {
+	case "", "middle":
+		return middle, true
+	case "upper":
+		return middle + bb.deviations*bb.closes.std(), true
+	case "lower":
+		return middle - bb.deviations*bb.closes.std(), true
+	}
+	return 0, false
+}
+
+func (bb *Bollinger) Warmup() int {
+	return bb.closes.size
+}
+
+// A VWAP is a volume weighted average of typical prices over period bars. It is never ready over bars without volume,
+// e.g. of a feed not giving volume, since a plain average of prices would pass for VWAP.
+type VWAP struct {
+	weighted window
+	volumes  window
+}
+
+func NewVWAP(period int) *VWAP {
+	return &VWAP{weighted: window{size: period}, volumes: window{size: period}}
+}
+
+func (vwap *VWAP) Update(candle interfaces.Candle) {
+	typical := (candle.High + candle.Low + candle.Close) / 3
+	vwap.weighted.add(typical * candle.Volume)
+	vwap.volumes.add(candle.Volume)
+}
+
+func (vwap *VWAP) Ready() bool {
+	return vwap.volumes.full() && vwap.volumes.sum > 0
+}
+
+func (vwap *VWAP) Value(output string) (float64, bool) {
+	if vwap.volumes.sum <= 0 {
+		return mainOutput(output, 0)
+	}
+	return mainOutput(output, vwap.weighted.sum/vwap.volumes.sum)
+}
+
+func (vwap *VWAP) Warmup() int {
+	return vwap.volumes.size
+}
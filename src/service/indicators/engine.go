@@ -0,0 +1,96 @@
+package indicators
+
+import (
+	"fmt"
+	"sync"
+
+	"gitlab.com/crypto_project/core/strategy_service/src/service/interfaces"
+)
+
+// historySize is a count of bars requested to warm up a new indicator.
+const historySize = 500
+
+// catchUpSize is a count of the last bars requested to update an indicator, indicator is warmed up again if more
+// bars closed since the last update.
+const catchUpSize = 10
+
+// A Spec identifies an indicator instance shared by strategies.
+type Spec struct {
+	Name       string
+	Params     []float64
+	Pair       string
+	Exchange   string
+	MarketType int64
+	Timeframe  string
+}
+
+func (spec Spec) key() string {
+	return fmt.Sprintf("%s:%v:%s:%s:%d:%s", spec.Name, spec.Params, spec.Exchange, spec.Pair, spec.MarketType, spec.Timeframe)
+}
+
+// An Engine caches indicators by spec and updates them with bars closed since the last request.
+type Engine struct {
+	DataFeed   interfaces.IDataFeed
+	mux        sync.Mutex
+	indicators map[string]*cached
+}
+
+type cached struct {
+	mux       sync.Mutex
+	indicator Indicator
+	lastAt    int64 // the last bar accounted open time
+}
+
+var engines sync.Map // <IDataFeed, *Engine>
+
+// GetEngine returns the engine shared by strategies using the data feed given.
+func GetEngine(dataFeed interfaces.IDataFeed) *Engine {
+	engine, _ := engines.LoadOrStore(dataFeed, &Engine{DataFeed: dataFeed, indicators: map[string]*cached{}})
+	return engine.(*Engine)
+}
+
+// Value returns the indicator output by spec calculated over closed bars, false if the indicator is not ready yet.
+func (e *Engine) Value(spec Spec, output string) (float64, bool, error) {
+	c, err := e.get(spec)
+	if err != nil {
+		return 0, false, err
+	}
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	candles := e.DataFeed.GetCandles(spec.Pair, spec.Exchange, spec.MarketType, spec.Timeframe, catchUpSize)
+	if len(candles) > 0 && c.lastAt > 0 && candles[0].Timestamp > c.lastAt {
+		// missed some bars, start over
+		c.indicator, _ = New(spec.Name, spec.Params)
+		c.lastAt = 0
+	}
+	if c.lastAt == 0 {
+		candles = e.DataFeed.GetCandles(spec.Pair, spec.Exchange, spec.MarketType, spec.Timeframe, historySize)
+	}
+	for _, candle := range candles {
+		if candle.Timestamp > c.lastAt {
+			c.indicator.Update(candle)
+			c.lastAt = candle.Timestamp
+		}
+	}
+	value, ok := c.indicator.Value(output)
+	if !ok {
+		return 0, false, fmt.Errorf("unknown output %q of indicator %q", output, spec.Name)
+	}
+	return value, c.indicator.Ready(), nil
+}
+
+func (e *Engine) get(spec Spec) (*cached, error) {
+	key := spec.key()
+	e.mux.Lock()
+	defer e.mux.Unlock()
+	if c, ok := e.indicators[key]; ok {
+		return c, nil
+	}
+	indicator, err := New(spec.Name, spec.Params)
+	if err != nil {
+		return nil, err
+	}
+	c := &cached{indicator: indicator}
+	e.indicators[key] = c
+	return c, nil
+}
@@ -0,0 +1,61 @@
+package indicators
+
+import (
+	"fmt"
+
+	"gitlab.com/crypto_project/core/strategy_service/src/service/interfaces"
+)
+
+// An Indicator consumes closed bars one by one oldest first and calculates its outputs incrementally.
+type Indicator interface {
+	// Update accounts the next closed bar.
+	Update(candle interfaces.Candle)
+	// Ready returns true if enough bars accounted for the outputs to be meaningful.
+	Ready() bool
+	// Value returns the output by name, empty name means the main output. False if there is no such output.
+	Value(output string) (float64, bool)
+	// Warmup returns count of bars needed to be ready.
+	Warmup() int
+}
+
+// New instantiates an indicator by name with params given, missing params are set to common defaults:
+//
+//	sma, ema [period=20]
+//	rsi [period=14]
+//	macd [fast=12, slow=26, signal=9] with outputs macd (main), signal and histogram
+//	bb [period=20, deviations=2] with outputs middle (main), upper and lower
+//	atr [period=14]
+//	vwap [period=20]
+func New(name string, params []float64) (Indicator, error) {
+	param := func(i int, def float64) float64 {
+		if i < len(params) && params[i] > 0 {
+			return params[i]
+		}
+		return def
+	}
+	switch name {
+	case "sma":
+		return NewSMA(int(param(0, 20))), nil
+	case "ema":
+		return NewEMA(int(param(0, 20))), nil
+	case "rsi":
+		return NewRSI(int(param(0, 14))), nil
+	case "macd":
+		return NewMACD(int(param(0, 12)), int(param(1, 26)), int(param(2, 9))), nil
+	case "bb":
+		return NewBollinger(int(param(0, 20)), param(1, 2)), nil
+	case "atr":
+		return NewATR(int(param(0, 14))), nil
+	case "vwap":
+		return NewVWAP(int(param(0, 20))), nil
+	}
+	return nil, fmt.Errorf("unknown indicator %q", name)
+}
+
+// mainOutput returns the value if output is empty, false otherwise.
+func mainOutput(output string, value float64) (float64, bool) {
+	if output != "" {
+		return 0, false
+	}
+	return value, true
+}
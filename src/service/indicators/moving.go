@@ -0,0 +1,109 @@
+package indicators
+
+import (
+	"math"
+
+	"gitlab.com/crypto_project/core/strategy_service/src/service/interfaces"
+)
+
+// A window keeps the last size values with their sum.
+type window struct {
+	size   int
+	values []float64
+	sum    float64
+}
+
+func (w *window) add(value float64) {
+	w.values = append(w.values, value)
+	w.sum += value
+	if len(w.values) > w.size {
+		w.sum -= w.values[0]
+		w.values = w.values[1:]
+	}
+}
+
+func (w *window) full() bool {
+	return w.size > 0 && len(w.values) >= w.size
+}
+
+func (w *window) mean() float64 {
+	if len(w.values) == 0 {
+		return 0
+	}
+	return w.sum / float64(len(w.values))
+}
+
+// std returns population standard deviation of the values.
+func (w *window) std() float64 {
+	if len(w.values) == 0 {
+		return 0
+	}
+	mean := w.mean()
+	variance := 0.0
+	for _, value := range w.values {
+		variance += (value - mean) * (value - mean)
+	}
+	return math.Sqrt(variance / float64(len(w.values)))
+}
+
+// A SMA is a simple moving average of closes.
+type SMA struct {
+	closes window
+}
+
+func NewSMA(period int) *SMA {
+	return &SMA{closes: window{size: period}}
+}
+
+func (sma *SMA) Update(candle interfaces.Candle) {
+	sma.closes.add(candle.Close)
+}
+
+func (sma *SMA) Ready() bool {
+	return sma.closes.full()
+}
+
+func (sma *SMA) Value(output string) (float64, bool) {
+	return mainOutput(output, sma.closes.mean())
+}
+
+func (sma *SMA) Warmup() int {
+	return sma.closes.size
+}
+
+// An EMA is an exponential moving average of closes seeded by simple average of the first period closes.
+type EMA struct {
+	period int
+	count  int
+	value  float64
+}
+
+func NewEMA(period int) *EMA {
+	return &EMA{period: period}
+}
+
+func (ema *EMA) Update(candle interfaces.Candle) {
+	ema.add(candle.Close)
+}
+
+func (ema *EMA) add(value float64) {
+	ema.count++
+	if ema.count <= ema.period {
+		ema.value += (value - ema.value) / float64(ema.count) // running mean while seeding
+		return
+	}
+	k := 2 / float64(ema.period+1)
+	ema.value = value*k + ema.value*(1-k)
+}
+
+func (ema *EMA) Ready() bool {
+	return ema.period > 0 && ema.count >= ema.period
+}
+
+func (ema *EMA) Value(output string) (float64, bool) {
+	return mainOutput(output, ema.value)
+}
+
+func (ema *EMA) Warmup() int {
+	return ema.period
+}
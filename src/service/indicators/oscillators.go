@@ -0,0 +1,102 @@
+package indicators
+
+import "gitlab.com/crypto_project/core/strategy_service/src/service/interfaces"
+
+// A RSI is a relative strength index with Wilder's smoothing of gains and losses.
+type RSI struct {
+	period    int
+	count     int
+	prevClose float64
+	avgGain   float64
+	avgLoss   float64
+}
+
+func NewRSI(period int) *RSI {
+	return &RSI{period: period}
+}
+
+func (rsi *RSI) Update(candle interfaces.Candle) {
+	rsi.count++
+	if rsi.count == 1 {
+		rsi.prevClose = candle.Close
+		return
+	}
+	change := candle.Close - rsi.prevClose
+	rsi.prevClose = candle.Close
+	gain, loss := 0.0, 0.0
+	if change > 0 {
+		gain = change
+	} else {
+		loss = -change
+	}
+	changes := rsi.count - 1
+	if changes <= rsi.period {
+		rsi.avgGain += (gain - rsi.avgGain) / float64(changes)
+		rsi.avgLoss += (loss - rsi.avgLoss) / float64(changes)
+		return
+	}
+	rsi.avgGain = (rsi.avgGain*float64(rsi.period-1) + gain) / float64(rsi.period)
+	rsi.avgLoss = (rsi.avgLoss*float64(rsi.period-1) + loss) / float64(rsi.period)
+}
+
+func (rsi *RSI) Ready() bool {
+	return rsi.period > 0 && rsi.count > rsi.period
+}
+
+func (rsi *RSI) Value(output string) (float64, bool) {
+	if rsi.avgLoss == 0 {
+		return mainOutput(output, 100)
+	}
+	return mainOutput(output, 100-100/(1+rsi.avgGain/rsi.avgLoss))
+}
+
+func (rsi *RSI) Warmup() int {
+	return rsi.period + 1
+}
+
+// A MACD is a difference of fast and slow EMAs of closes with its signal EMA.
+type MACD struct {
+	fast   *EMA
+	slow   *EMA
+	signal *EMA
+}
+
+func NewMACD(fast, slow, signal int) *MACD {
+	return &MACD{fast: NewEMA(fast), slow: NewEMA(slow), signal: NewEMA(signal)}
+}
+
+func (macd *MACD) Update(candle interfaces.Candle) {
+	macd.fast.Update(candle)
+	macd.slow.Update(candle)
+	if macd.fast.Ready() && macd.slow.Ready() {
+		macd.signal.add(macd.line())
+	}
+}
+
+func (macd *MACD) line() float64 {
+	return macd.fast.value - macd.slow.value
+}
+
+func (macd *MACD) Ready() bool {
+	return macd.signal.Ready()
+}
+
+func (macd *MACD) Value(output string) (float64, bool) {
+	switch output {
+	case "", "macd":
+		return macd.line(), true
+	case "signal":
+		return macd.signal.value, true
+	case "histogram":
+		return macd.line() - macd.signal.value, true
+	}
+	return 0, false
+}
+
+func (macd *MACD) Warmup() int {
+	slowest := macd.slow.period
+	if macd.fast.period > slowest {
+		slowest = macd.fast.period
+	}
+	return slowest + macd.signal.period - 1
+}
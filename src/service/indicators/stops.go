@@ -0,0 +1,65 @@
+package indicators
+
+import (
+	"math"
+
+	"gitlab.com/crypto_project/core/strategy_service/src/service/interfaces"
+)
+
+// ChandelierExit returns the highest high of the last period candles less multiplier ATRs for a long position, the
+// lowest low plus multiplier ATRs for a short one, 0 if there are less than period+1 candles.
+func ChandelierExit(candles []interfaces.Candle, period int, multiplier float64, long bool) float64 {
+	atr := ATR(candles, period)
+	if atr == 0 {
+		return 0
+	}
+	highest, lowest := math.Inf(-1), math.Inf(1)
+	for _, candle := range candles[len(candles)-period:] {
+		highest = math.Max(highest, candle.High)
+		lowest = math.Min(lowest, candle.Low)
+	}
+	if long {
+		return highest - multiplier*atr
+	}
+	return lowest + multiplier*atr
+}
+
+// ParabolicSAR returns parabolic stop and reverse for the candle following the candles given, starting in the trend
+// of the position, with acceleration factor growing by step up to max step on each new extreme point. The stop is on
+// the other side of price if the trend reversed. It returns 0 if there are less than 2 candles.
+func ParabolicSAR(candles []interfaces.Candle, step, maxStep float64, long bool) float64 {
+	if len(candles) < 2 {
+		return 0
+	}
+	af := step
+	sar, ep := candles[0].Low, candles[0].High
+	if !long {
+		sar, ep = candles[0].High, candles[0].Low
+	}
+	for i := 1; i < len(candles); i++ {
+		sar += af * (ep - sar)
+		prev := candles[i-1]
+		if i > 1 {
+			prev.Low = math.Min(prev.Low, candles[i-2].Low)
+			prev.High = math.Max(prev.High, candles[i-2].High)
+		}
+		candle := candles[i]
+		if long {
+			sar = math.Min(sar, prev.Low)
+			if candle.Low < sar {
+				long, sar, ep, af = false, ep, candle.Low, step
+			} else if candle.High > ep {
+				ep, af = candle.High, math.Min(af+step, maxStep)
+			}
+			continue
+		}
+		sar = math.Max(sar, prev.High)
+		if candle.High > sar {
+			long, sar, ep, af = true, ep, candle.High, step
+		} else if candle.Low < ep {
+			ep, af = candle.Low, math.Min(af+step, maxStep)
+		}
+	}
+	sar += af * (ep - sar)
+	return sar
+}
@@ -0,0 +1,93 @@
+// Package indicators calculates technical indicators over OHLCV bars.
+package indicators
+
+import (
+	"math"
+
+	"gitlab.com/crypto_project/core/strategy_service/src/service/interfaces"
+)
+
+// ATR returns average true range of the candles given with Wilder's smoothing over period, 0 if there are less than
+// period+1 candles.
+func ATR(candles []interfaces.Candle, period int) float64 {
+	if period <= 0 || len(candles) < period+1 {
+		return 0
+	}
+	atr := 0.0
+	for i := 1; i < len(candles); i++ {
+		tr := TrueRange(candles[i], candles[i-1].Close)
+		if i <= period {
+			atr += tr / float64(period)
+			continue
+		}
+		atr = (atr*float64(period-1) + tr) / float64(period)
+	}
+	return atr
+}
+
+// TrueRange returns the candle range extended to the previous close.
+func TrueRange(candle interfaces.Candle, prevClose float64) float64 {
+	return math.Max(candle.High, prevClose) - math.Min(candle.Low, prevClose)
+}
+
+// RealizedVolatility returns standard deviation of close to close returns of the last period candles in price units
+// of the last close, 0 if there are less than period+1 candles.
+func RealizedVolatility(candles []interfaces.Candle, period int) float64 {
+	if period <= 1 || len(candles) < period+1 {
+		return 0
+	}
+	candles = candles[len(candles)-period-1:]
+	returns := make([]float64, 0, period)
+	mean := 0.0
+	for i := 1; i < len(candles); i++ {
+		if candles[i-1].Close == 0 {
+			return 0
+		}
+		r := candles[i].Close/candles[i-1].Close - 1
+		returns = append(returns, r)
+		mean += r / float64(period)
+	}
+	variance := 0.0
+	for _, r := range returns {
+		variance += (r - mean) * (r - mean) / float64(period-1)
+	}
+	return math.Sqrt(variance) * candles[len(candles)-1].Close
+}
+
+// An AverageTrueRange is ATR calculated incrementally.
+type AverageTrueRange struct {
+	period    int
+	count     int
+	prevClose float64
+	value     float64
+}
+
+func NewATR(period int) *AverageTrueRange {
+	return &AverageTrueRange{period: period}
+}
+
+func (atr *AverageTrueRange) Update(candle interfaces.Candle) {
+	atr.count++
+	if atr.count > 1 {
+		tr := TrueRange(candle, atr.prevClose)
+		ranges := atr.count - 1
+		if ranges <= atr.period {
+			atr.value += (tr - atr.value) / float64(ranges)
+		} else {
+			atr.value = (atr.value*float64(atr.period-1) + tr) / float64(atr.period)
+		}
+	}
+	atr.prevClose = candle.Close
+}
+
+func (atr *AverageTrueRange) Ready() bool {
+	return atr.period > 0 && atr.count > atr.period
+}
+
+func (atr *AverageTrueRange) Value(output string) (float64, bool) {
+	return mainOutput(output, atr.value)
+}
+
+func (atr *AverageTrueRange) Warmup() int {
+	return atr.period + 1
+}
@@ -0,0 +1,7 @@
+package interfaces
+
+// A Candle is an OHLCV bar of some timeframe opened at Timestamp in unix seconds.
+type Candle struct {
+	Timestamp                      int64
+	Open, High, Low, Close, Volume float64
+}
@@ -0,0 +1,9 @@
+package interfaces
+
+// FundingData describes a perpetual futures funding, NextFundingTime is in unix milliseconds.
+type FundingData struct {
+	MarkPrice       float64 `json:"markPrice,float"`
+	IndexPrice      float64 `json:"indexPrice,float"`
+	FundingRate     float64 `json:"fundingRate,float"`
+	NextFundingTime int64   `json:"nextFundingTime"`
+}
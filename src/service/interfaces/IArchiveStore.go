@@ -0,0 +1,17 @@
+package interfaces
+
+import (
+	"time"
+
+	"gitlab.com/crypto_project/core/strategy_service/src/sources/mongodb/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// IArchiveStore moves finished strategies together with their orders and journal to archive and back.
+type IArchiveStore interface {
+	// ArchiveStrategies archives up to limit disabled strategies ended, canceled, timed out or errored before the time
+	// given.
+	ArchiveStrategies(endedBefore time.Time, limit int64) (models.ArchiveCounts, error)
+	// RestoreStrategy moves the strategy archived back, it's left disabled.
+	RestoreStrategy(strategyId *primitive.ObjectID) (models.ArchiveCounts, error)
+}
@@ -0,0 +1,8 @@
+package interfaces
+
+// ICandleRecorder is implemented by data feeds building candles from the price stream, candles of a pair are
+// recorded only once asked for.
+type ICandleRecorder interface {
+	// RecordCandles starts recording candles of the pair, backfilling the history where the exchange provides it.
+	RecordCandles(pair string, exchange string, marketType int64)
+}
@@ -0,0 +1,19 @@
+package interfaces
+
+import (
+	"gitlab.com/crypto_project/core/strategy_service/src/sources/mongodb/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type ICopyTradingStore interface {
+	GetEnabledCopyTradings() []models.MongoCopyTrading
+	GetFollowerStrategies(leaderStrategyId *primitive.ObjectID) []models.MongoStrategy
+	GetStrategy(strategyId *primitive.ObjectID) *models.MongoStrategy
+	CreateStrategy(strategy *models.MongoStrategy) *models.MongoStrategy
+	UpdateConditions(strategyId *primitive.ObjectID, conditions *models.MongoStrategyCondition)
+	UpdateState(strategyId *primitive.ObjectID, state *models.MongoStrategyState)
+	EnableStrategy(strategyId *primitive.ObjectID)
+	DisableStrategy(strategyId *primitive.ObjectID)
+	SaveCopyDivergence(divergence models.MongoCopyDivergence)
+	GetKeyBalances(keyId *primitive.ObjectID) map[string]float64
+}
@@ -3,4 +3,6 @@ package interfaces
 type IDataFeed interface {
 	GetPriceForPairAtExchange(pair string, exchange string, marketType int64) *OHLCV
 	GetSpreadForPairAtExchange(pair string, exchange string, marketType int64) *SpreadData
+	GetFundingForPairAtExchange(pair string, exchange string) *FundingData
+	GetCandles(pair string, exchange string, marketType int64, timeframe string, n int) []Candle
 }
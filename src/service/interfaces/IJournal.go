@@ -0,0 +1,25 @@
+package interfaces
+
+import (
+	"gitlab.com/crypto_project/core/strategy_service/src/sources/mongodb/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// IJournal records a strategy timeline.
+type IJournal interface {
+	Transition(source string, destination string, trigger string, price float64, state *models.MongoStrategyState)
+	OrderPlaced(orderId string, step string, side string, orderType string, amount float64, price float64)
+	OrderUpdated(order *models.MongoOrder)
+	ConditionsEdited(conditions *models.MongoStrategyCondition)
+	// OrderHistory returns steps of orders journaled as placed and whether each was journaled filled or canceled.
+	OrderHistory() (steps map[string]string, updated map[string]bool)
+}
+
+// IJournalStore keeps strategy journal entries.
+type IJournalStore interface {
+	// AppendJournalEntry fails if the entry sequence number is taken already.
+	AppendJournalEntry(entry *models.MongoJournalEntry) error
+	// GetJournal returns entries with sequence numbers greater than given in order.
+	GetJournal(strategyId *primitive.ObjectID, afterSeq int64) []models.MongoJournalEntry
+	GetLastJournalSeq(strategyId *primitive.ObjectID) int64
+}
@@ -0,0 +1,15 @@
+package interfaces
+
+import (
+	"gitlab.com/crypto_project/core/strategy_service/src/sources/mongodb/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// IQuotaStore keeps quotas of owners and accounts and finds strategies counted by them.
+type IQuotaStore interface {
+	// GetQuota returns quota set for the owner or account given, nil if not set.
+	GetQuota(subjectId *primitive.ObjectID) *models.MongoQuota
+	// GetActiveStrategies returns enabled strategies with the field given, models.QuotaOwner or models.QuotaAccount, set
+	// to the id.
+	GetActiveStrategies(field string, subjectId *primitive.ObjectID) []*models.MongoStrategy
+}
@@ -0,0 +1,7 @@
+package interfaces
+
+// ISchemaStore upgrades strategies stored in older schema versions.
+type ISchemaStore interface {
+	// MigrateStrategies upgrades up to limit strategies returning how many found and how many saved upgraded.
+	MigrateStrategies(limit int64) (found int64, migrated int64, err error)
+}
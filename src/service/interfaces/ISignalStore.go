@@ -0,0 +1,13 @@
+package interfaces
+
+import (
+	"gitlab.com/crypto_project/core/strategy_service/src/sources/mongodb/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type ISignalStore interface {
+	GetEnabledSignals() []models.MongoSignal
+	SaveSignalTrigger(signal *models.MongoSignal, event models.MongoSignalEvent)
+	DisableSignal(signalId primitive.ObjectID)
+	EnableStrategiesBySignal(signalId primitive.ObjectID) int64
+}
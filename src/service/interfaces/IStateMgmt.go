@@ -13,6 +13,7 @@ type IStateMgmt interface {
 	UpdateOrders(strategyId *primitive.ObjectID, state *models.MongoStrategyState)
 	UpdateExecutedAmount(strategyId *primitive.ObjectID, state *models.MongoStrategyState)
 	GetPosition(strategyId *primitive.ObjectID, symbol string)
+	GetStrategy(strategyId *primitive.ObjectID) *models.MongoStrategy
 	GetOrder(orderId string) *models.MongoOrder
 	GetOrderById(orderId *primitive.ObjectID) *models.MongoOrder
 	SubscribeToOrder(orderId string, onOrderStatusUpdate func(order *models.MongoOrder)) error
@@ -20,6 +21,7 @@ type IStateMgmt interface {
 	DisableStrategy(strategyId *primitive.ObjectID)
 	EnableStrategy(strategyId *primitive.ObjectID)
 	GetMarketPrecision(pair string, marketType int64) (int64, int64)
+	GetKeyBalances(keyId *primitive.ObjectID) map[string]float64
 	AnyActiveStrats(strategy *models.MongoStrategy) bool
 	InitOrdersWatch()
 	SavePNL(templateStrategyId *primitive.ObjectID, profitAmount float64)
@@ -0,0 +1,15 @@
+package interfaces
+
+import (
+	"gitlab.com/crypto_project/core/strategy_service/src/sources/mongodb/models"
+)
+
+// IStateStore is a state management feeding the service runtime by itself, without mongodb collections and change
+// streams. Strategy watchers are told whether the update enabled the strategy, created it enabled or updated it from
+// disabled.
+type IStateStore interface {
+	IStateMgmt
+	GetMarkets() map[int64][]string
+	GetEnabledStrategies() []*models.MongoStrategy
+	WatchStrategies(onStrategyUpdate func(strategy *models.MongoStrategy, enabled bool))
+}
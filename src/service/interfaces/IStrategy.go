@@ -16,4 +16,5 @@ type IStrategy interface {
 	GetSingleton() ICreateRequest
 	GetStatsd() IStatsClient
 	GetLogger() ILogger
+	GetJournal() IJournal
 }
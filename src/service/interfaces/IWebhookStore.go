@@ -0,0 +1,11 @@
+package interfaces
+
+import (
+	"gitlab.com/crypto_project/core/strategy_service/src/sources/mongodb/models"
+)
+
+type IWebhookStore interface {
+	GetTemplateByToken(token string) *models.MongoStrategy
+	RegisterWebhookNonce(nonce string) bool
+	SaveWebhookEvent(event models.MongoWebhookEvent)
+}
@@ -0,0 +1,261 @@
+package journal
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"gitlab.com/crypto_project/core/strategy_service/src/logging"
+	"gitlab.com/crypto_project/core/strategy_service/src/service/interfaces"
+	"gitlab.com/crypto_project/core/strategy_service/src/service/strategies/smart_order"
+	"gitlab.com/crypto_project/core/strategy_service/src/sources/mongodb/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.uber.org/zap"
+)
+
+var log interfaces.ILogger
+
+func init() {
+	logger, _ := logging.GetZapLogger()
+	log = logger.With(zap.String("logger", "journal"))
+}
+
+// A Journal appends timeline events of a strategy to the store numbering them in sequence. Events are dropped if the
+// store is not set. Events are queued and saved in the background in the order they happened, so the runtime doesn't
+// wait for the store.
+type Journal struct {
+	strategyId primitive.ObjectID
+	store      interfaces.IJournalStore
+	seq        int64
+	loaded     bool // whether the last sequence number read from the store
+	pending    []*models.MongoJournalEntry
+	draining   bool // whether pending entries are being saved
+	mux        sync.Mutex
+	drained    *sync.Cond
+}
+
+// New instantiates journal of the strategy given, the store may be nil.
+func New(strategyId primitive.ObjectID, store interfaces.IJournalStore) *Journal {
+	j := &Journal{strategyId: strategyId, store: store}
+	j.drained = sync.NewCond(&j.mux)
+	return j
+}
+
+// Transition records a state machine transition with a snapshot of the state it led to.
+func (j *Journal) Transition(source string, destination string, trigger string, price float64, state *models.MongoStrategyState) {
+	j.append(&models.MongoJournalEntry{
+		Type:        models.JournalTransition,
+		Source:      source,
+		Destination: destination,
+		Trigger:     trigger,
+		Price:       price,
+		State:       copyState(state),
+	})
+}
+
+// OrderPlaced records an order placed for the step given, e.g. entry or stop-loss.
+func (j *Journal) OrderPlaced(orderId string, step string, side string, orderType string, amount float64, price float64) {
+	j.append(&models.MongoJournalEntry{
+		Type:      models.JournalOrder,
+		OrderId:   orderId,
+		Step:      step,
+		Side:      side,
+		OrderType: orderType,
+		Amount:    amount,
+		Price:     price,
+	})
+}
+
+// OrderUpdated records an order filled or canceled.
+func (j *Journal) OrderUpdated(order *models.MongoOrder) {
+	j.append(&models.MongoJournalEntry{
+		Type:      models.JournalFill,
+		OrderId:   order.OrderId,
+		Side:      order.Side,
+		OrderType: order.Type,
+		Status:    order.Status,
+		Amount:    order.Filled,
+		Average:   order.Average,
+	})
+}
+
+// ConditionsEdited records conditions edited.
+func (j *Journal) ConditionsEdited(conditions *models.MongoStrategyCondition) {
+	j.append(&models.MongoJournalEntry{
+		Type:       models.JournalConditions,
+		Conditions: copyConditions(conditions),
+	})
+}
+
+// OrderHistory returns steps orders were placed for by order id and orders updated, i.e. seen filled or canceled
+// by the runtime. Maps are empty if the store is not set. Entries queued are saved first.
+func (j *Journal) OrderHistory() (map[string]string, map[string]bool) {
+	steps, updated := map[string]string{}, map[string]bool{}
+	if j == nil || j.store == nil {
+		return steps, updated
+	}
+	j.Flush()
+	for _, entry := range j.store.GetJournal(&j.strategyId, 0) {
+		switch entry.Type {
+		case models.JournalOrder:
+			steps[entry.OrderId] = entry.Step
+		case models.JournalFill:
+			updated[entry.OrderId] = true
+		}
+	}
+	return steps, updated
+}
+
+// Flush waits for entries queued to be saved.
+func (j *Journal) Flush() {
+	if j == nil || j.store == nil {
+		return
+	}
+	j.mux.Lock()
+	for j.draining {
+		j.drained.Wait()
+	}
+	j.mux.Unlock()
+}
+
+// append queues the entry to be saved, saving is started unless it's running already.
+func (j *Journal) append(entry *models.MongoJournalEntry) {
+	if j == nil || j.store == nil {
+		return
+	}
+	entry.ID = primitive.NewObjectID()
+	entry.StrategyId = j.strategyId
+	entry.At = time.Now().UnixNano() / int64(time.Millisecond)
+	j.mux.Lock()
+	defer j.mux.Unlock()
+	j.pending = append(j.pending, entry)
+	if !j.draining {
+		j.draining = true
+		go j.drain()
+	}
+}
+
+// drain saves entries queued in order until the queue is empty. Only one drain runs at a time, so the sequence number
+// is changed by it only.
+func (j *Journal) drain() {
+	for {
+		j.mux.Lock()
+		entries := j.pending
+		j.pending = nil
+		if len(entries) == 0 {
+			j.draining = false
+			j.drained.Broadcast()
+			j.mux.Unlock()
+			return
+		}
+		j.mux.Unlock()
+		for _, entry := range entries {
+			j.save(entry)
+		}
+	}
+}
+
+// save numbers the entry and saves it. A sequence number taken by another instance run the strategy before makes
+// the journal to re-read the last one and retry once.
+func (j *Journal) save(entry *models.MongoJournalEntry) {
+	var err error
+	for attempt := 0; attempt < 2; attempt++ {
+		if !j.loaded || attempt > 0 {
+			j.seq = j.store.GetLastJournalSeq(&j.strategyId)
+			j.loaded = true
+		}
+		entry.Seq = j.seq + 1
+		if err = j.store.AppendJournalEntry(entry); err == nil {
+			j.seq = entry.Seq
+			return
+		}
+	}
+	log.Error("can't append journal entry",
+		zap.String("strategy", j.strategyId.Hex()),
+		zap.String("type", entry.Type),
+		zap.Error(err),
+	)
+}
+
+// Rebuild replays journal entries and returns the state and conditions they lead to. The state is the snapshot of the
+// last transition with orders placed after it, fills are taken into account by the snapshots of following transitions.
+// An error is returned if sequence numbers have a gap, the state rebuilt up to the gap is returned with it.
+func Rebuild(entries []models.MongoJournalEntry) (*models.MongoStrategyState, *models.MongoStrategyCondition, error) {
+	sorted := append([]models.MongoJournalEntry{}, entries...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Seq < sorted[j].Seq })
+	state := &models.MongoStrategyState{}
+	var conditions *models.MongoStrategyCondition
+	for i, entry := range sorted {
+		if i > 0 && entry.Seq != sorted[i-1].Seq+1 {
+			return state, conditions, fmt.Errorf("sequence gap after %v", sorted[i-1].Seq)
+		}
+		switch entry.Type {
+		case models.JournalTransition:
+			if entry.State != nil {
+				state = copyState(entry.State)
+			}
+			state.State = entry.Destination
+		case models.JournalOrder:
+			if entry.Step != smart_order.Canceled {
+				state.Orders = addOnce(state.Orders, entry.OrderId)
+			}
+			switch entry.Step {
+			case smart_order.WaitForEntry:
+				state.WaitForEntryIds = addOnce(state.WaitForEntryIds, entry.OrderId)
+			case smart_order.Stoploss:
+				state.StopLossOrderIds = addOnce(state.StopLossOrderIds, entry.OrderId)
+			case "ForcedLoss":
+				state.ForcedLossOrderIds = addOnce(state.ForcedLossOrderIds, entry.OrderId)
+			case smart_order.TakeProfit:
+				state.TakeProfitOrderIds = addOnce(state.TakeProfitOrderIds, entry.OrderId)
+			}
+		case models.JournalConditions:
+			conditions = copyConditions(entry.Conditions)
+		}
+	}
+	return state, conditions, nil
+}
+
+func addOnce(ids []string, id string) []string {
+	for _, known := range ids {
+		if known == id {
+			return ids
+		}
+	}
+	return append(ids, id)
+}
+
+// copyState returns a deep copy of the state to not share slices with the runtime changing it.
+func copyState(state *models.MongoStrategyState) *models.MongoStrategyState {
+	if state == nil {
+		return nil
+	}
+	var copied models.MongoStrategyState
+	raw, err := bson.Marshal(state)
+	if err == nil {
+		err = bson.Unmarshal(raw, &copied)
+	}
+	if err != nil {
+		log.Error("can't copy state", zap.Error(err))
+		copied = *state
+	}
+	return &copied
+}
+
+func copyConditions(conditions *models.MongoStrategyCondition) *models.MongoStrategyCondition {
+	if conditions == nil {
+		return nil
+	}
+	var copied models.MongoStrategyCondition
+	raw, err := bson.Marshal(conditions)
+	if err == nil {
+		err = bson.Unmarshal(raw, &copied)
+	}
+	if err != nil {
+		log.Error("can't copy conditions", zap.Error(err))
+		copied = *conditions
+	}
+	return &copied
+}
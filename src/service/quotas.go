@@ -0,0 +1,50 @@
+package service
+
+import (
+	"os"
+	"reflect"
+	"strconv"
+
+	"gitlab.com/crypto_project/core/strategy_service/src/service/quotas"
+	"gitlab.com/crypto_project/core/strategy_service/src/service/strategies/smart_order"
+	"gitlab.com/crypto_project/core/strategy_service/src/sources/mongodb/models"
+	"go.uber.org/zap"
+)
+
+// quotaDefaults returns limits of owners and accounts without quota set in the store, unset or zero is unlimited.
+func quotaDefaults() models.MongoQuota {
+	maxActiveStrategies, _ := strconv.ParseInt(os.Getenv("QUOTA_MAX_ACTIVE_STRATEGIES"), 10, 64)
+	maxNotional, _ := strconv.ParseFloat(os.Getenv("QUOTA_MAX_NOTIONAL"), 64)
+	maxOrdersPerMinute, _ := strconv.ParseInt(os.Getenv("QUOTA_MAX_ORDERS_PER_MINUTE"), 10, 64)
+	return models.MongoQuota{
+		MaxActiveStrategies: maxActiveStrategies,
+		MaxNotional:         maxNotional,
+		MaxOrdersPerMinute:  maxOrdersPerMinute,
+	}
+}
+
+// rejectStrategy disables the strategy exceeding a quota or with invalid conditions and sets the error state with the
+// reason shown to the user.
+func (ss *StrategyService) rejectStrategy(strategy *models.MongoStrategy, err error) {
+	ss.log.Warn("strategy rejected",
+		zap.String("strategy", strategy.ID.Hex()),
+		zap.Error(err),
+	)
+	strategy.Enabled = false
+	if strategy.State == nil {
+		strategy.State = &models.MongoStrategyState{}
+	}
+	strategy.State.State = smart_order.Error
+	strategy.State.Msg = err.Error()
+	ss.stateMgmt.DisableStrategy(strategy.ID)
+	ss.stateMgmt.UpdateState(strategy.ID, strategy.State)
+}
+
+// canEdit reports whether the update may change conditions of the strategy running. Updates without editor set come
+// from services and are trusted, user edits are accepted from the owner only.
+func canEdit(running *models.MongoStrategy, update *models.MongoStrategy) bool {
+	if update.EditedBy == nil || reflect.DeepEqual(running.Conditions, update.Conditions) {
+		return true
+	}
+	return quotas.CanManage(running, update.EditedBy, nil)
+}
@@ -0,0 +1,19 @@
+package quotas
+
+import (
+	"gitlab.com/crypto_project/core/strategy_service/src/sources/mongodb/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// CanManage reports whether a requester may cancel or edit the strategy. A strategy with owner is managed by the owner
+// only, users it's shared with may see it but not manage. Requests without owner, e.g. from services trading by a key,
+// may manage strategies of the key given.
+func CanManage(strategy *models.MongoStrategy, ownerId *primitive.ObjectID, keyId *primitive.ObjectID) bool {
+	if strategy == nil {
+		return false
+	}
+	if ownerId != nil && !ownerId.IsZero() {
+		return !strategy.OwnerId.IsZero() && strategy.OwnerId == *ownerId
+	}
+	return keyId != nil && strategy.AccountId != nil && *strategy.AccountId == *keyId
+}
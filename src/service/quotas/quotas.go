@@ -0,0 +1,188 @@
+// Package quotas limits strategies and orders of owners and accounts and checks who may manage a strategy.
+package quotas
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"gitlab.com/crypto_project/core/strategy_service/src/service/interfaces"
+	"gitlab.com/crypto_project/core/strategy_service/src/sources/mongodb/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Limits quotas set.
+const (
+	LimitActiveStrategies = "active strategies"
+	LimitNotional         = "notional"
+	LimitOrdersPerMinute  = "orders per minute"
+)
+
+// A Rejection is returned for a request exceeding a quota, its message is given to the user.
+type Rejection struct {
+	Subject string // owner or account
+	Limit   string
+	Max     float64
+	Value   float64 // value the request would lead to
+}
+
+func (r *Rejection) Error() string {
+	return fmt.Sprintf("%v quota exceeded: %v %g of %g allowed", r.Subject, r.Limit, r.Value, r.Max)
+}
+
+// A subject is an owner or an account quotas applied to.
+type subject struct {
+	name  string
+	field string
+	id    primitive.ObjectID
+}
+
+// An Enforcer checks requests against quotas of owners and accounts. Active strategies and notional are counted over
+// strategies in the store, orders per minute are counted by the instance. A nil Enforcer allows everything.
+type Enforcer struct {
+	Store    interfaces.IQuotaStore // may be nil, then only orders are counted
+	Defaults models.MongoQuota      // limits of owners and accounts without quota set
+	DataFeed interfaces.IDataFeed   // prices entries without price, may be nil
+	Statsd   interfaces.IStatsClient
+	orders   map[primitive.ObjectID][]time.Time // recent orders by subject
+	mux      sync.Mutex
+}
+
+// NewEnforcer instantiates enforcer of quotas in the store given with defaults for subjects without quota set.
+func NewEnforcer(store interfaces.IQuotaStore, defaults models.MongoQuota, dataFeed interfaces.IDataFeed, statsd interfaces.IStatsClient) *Enforcer {
+	return &Enforcer{
+		Store:    store,
+		Defaults: defaults,
+		DataFeed: dataFeed,
+		Statsd:   statsd,
+		orders:   map[primitive.ObjectID][]time.Time{},
+	}
+}
+
+// CheckStrategy returns a Rejection if enabling the strategy exceeds active strategies or notional quota of its owner
+// or account. The strategy is counted once whether it's stored enabled already or not.
+func (e *Enforcer) CheckStrategy(strategy *models.MongoStrategy) error {
+	if e == nil {
+		return nil
+	}
+	for _, s := range subjects(strategy.OwnerId, strategy.AccountId) {
+		quota := e.quota(&s.id)
+		if quota.MaxActiveStrategies == 0 && quota.MaxNotional == 0 {
+			continue
+		}
+		var active []*models.MongoStrategy
+		if e.Store != nil {
+			active = e.Store.GetActiveStrategies(s.field, &s.id)
+		}
+		count := int64(1)
+		notional := e.Notional(strategy)
+		for _, other := range active {
+			if other.ID != nil && strategy.ID != nil && *other.ID == *strategy.ID {
+				continue
+			}
+			count++
+			notional += e.Notional(other)
+		}
+		if quota.MaxActiveStrategies > 0 && count > quota.MaxActiveStrategies {
+			return e.reject(s, LimitActiveStrategies, float64(quota.MaxActiveStrategies), float64(count))
+		}
+		if quota.MaxNotional > 0 && notional > quota.MaxNotional {
+			return e.reject(s, LimitNotional, quota.MaxNotional, notional)
+		}
+	}
+	return nil
+}
+
+// CheckOrder returns a Rejection if an order exceeds orders per minute quota of the owner or account given, otherwise
+// the order is counted. Either id may be nil.
+func (e *Enforcer) CheckOrder(ownerId *primitive.ObjectID, accountId *primitive.ObjectID) error {
+	if e == nil {
+		return nil
+	}
+	owner := primitive.NilObjectID
+	if ownerId != nil {
+		owner = *ownerId
+	}
+	checked := subjects(owner, accountId)
+	limits := make([]int64, len(checked))
+	for i, s := range checked {
+		limits[i] = e.quota(&s.id).MaxOrdersPerMinute
+	}
+	now := time.Now()
+	e.mux.Lock()
+	defer e.mux.Unlock()
+	for i, s := range checked {
+		recent := e.recentOrders(s.id, now)
+		if limits[i] > 0 && int64(len(recent)) >= limits[i] {
+			return e.reject(s, LimitOrdersPerMinute, float64(limits[i]), float64(len(recent)+1))
+		}
+	}
+	for _, s := range checked {
+		e.orders[s.id] = append(e.orders[s.id], now)
+	}
+	return nil
+}
+
+// Notional returns entry amount of the strategy in quote currency priced by entry price, entry order price or market,
+// 0 for relative amounts or if price is unknown.
+func (e *Enforcer) Notional(strategy *models.MongoStrategy) float64 {
+	if strategy.Conditions == nil || strategy.Conditions.EntryOrder == nil || strategy.Conditions.EntryOrder.Type == 1 {
+		return 0
+	}
+	price := strategy.Conditions.EntryOrder.Price
+	if strategy.State != nil && strategy.State.EntryPrice > 0 {
+		price = strategy.State.EntryPrice
+	}
+	if price == 0 && e.DataFeed != nil {
+		ohlcv := e.DataFeed.GetPriceForPairAtExchange(strategy.Conditions.Pair, strategy.Conditions.Exchange, strategy.Conditions.MarketType)
+		if ohlcv != nil {
+			price = ohlcv.Close
+		}
+	}
+	return strategy.Conditions.EntryOrder.Amount * price
+}
+
+// quota returns quota set for the subject or defaults.
+func (e *Enforcer) quota(subjectId *primitive.ObjectID) models.MongoQuota {
+	if e.Store != nil {
+		if quota := e.Store.GetQuota(subjectId); quota != nil {
+			return *quota
+		}
+	}
+	return e.Defaults
+}
+
+// recentOrders returns orders of the subject within the last minute forgetting older ones, the lock should be held.
+func (e *Enforcer) recentOrders(subjectId primitive.ObjectID, now time.Time) []time.Time {
+	recent := e.orders[subjectId]
+	i := 0
+	for i < len(recent) && now.Sub(recent[i]) >= time.Minute {
+		i++
+	}
+	recent = recent[i:]
+	if len(recent) == 0 {
+		delete(e.orders, subjectId)
+	} else {
+		e.orders[subjectId] = recent
+	}
+	return recent
+}
+
+func (e *Enforcer) reject(s subject, limit string, max float64, value float64) error {
+	if e.Statsd != nil {
+		e.Statsd.Inc("quotas.rejected")
+	}
+	return &Rejection{Subject: s.name, Limit: limit, Max: max, Value: value}
+}
+
+// subjects returns the owner and the account set.
+func subjects(ownerId primitive.ObjectID, accountId *primitive.ObjectID) []subject {
+	var set []subject
+	if !ownerId.IsZero() {
+		set = append(set, subject{name: "owner", field: models.QuotaOwner, id: ownerId})
+	}
+	if accountId != nil && !accountId.IsZero() {
+		set = append(set, subject{name: "account", field: models.QuotaAccount, id: *accountId})
+	}
+	return set
+}
@@ -0,0 +1,36 @@
+package quotas
+
+import (
+	"gitlab.com/crypto_project/core/strategy_service/src/service/interfaces"
+	"gitlab.com/crypto_project/core/strategy_service/src/sources/mongodb/models"
+	"gitlab.com/crypto_project/core/strategy_service/src/trading/orders"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// A Trading places orders of a strategy counting them against orders per minute quotas of the strategy owner and
+// account. Orders exceeding a quota are rejected without placing, exit orders are placed always so positions can be
+// closed and protected, in hedge mode as well where they are not reduce-only.
+type Trading struct {
+	interfaces.ITrading
+	Enforcer  *Enforcer
+	OwnerId   primitive.ObjectID
+	AccountId *primitive.ObjectID
+}
+
+// Trading returns trading of the strategy given checking orders it places, the trading given if nothing is enforced.
+func (e *Enforcer) Trading(trading interfaces.ITrading, strategy *models.MongoStrategy) interfaces.ITrading {
+	if e == nil || trading == nil {
+		return trading
+	}
+	return &Trading{ITrading: trading, Enforcer: e, OwnerId: strategy.OwnerId, AccountId: strategy.AccountId}
+}
+
+// CreateOrder places the order if it's within quotas, otherwise returns an error response with the rejection.
+func (t *Trading) CreateOrder(request orders.CreateOrderRequest) orders.OrderResponse {
+	if !request.Exit {
+		if err := t.Enforcer.CheckOrder(&t.OwnerId, t.AccountId); err != nil {
+			return orders.OrderResponse{Status: "ERR", Data: orders.OrderResponseData{Msg: err.Error()}}
+		}
+	}
+	return t.ITrading.CreateOrder(request)
+}
@@ -0,0 +1,40 @@
+package service
+
+import (
+	"time"
+
+	"gitlab.com/crypto_project/core/strategy_service/src/service/interfaces"
+	"gitlab.com/crypto_project/core/strategy_service/src/sources/mongodb/schema"
+	"go.uber.org/zap"
+)
+
+const migrationBatch = 500
+
+// runSchemaMigration upgrades strategies stored in older schema versions in batches once, strategies loaded meanwhile
+// are upgraded on load.
+func (ss *StrategyService) runSchemaMigration() {
+	store, ok := ss.stateMgmt.(interfaces.ISchemaStore)
+	if !ok {
+		return
+	}
+	t1 := time.Now()
+	var total int64
+	for {
+		found, migrated, err := store.MigrateStrategies(migrationBatch)
+		total += migrated
+		if err != nil {
+			ss.log.Error("can't migrate strategies", zap.Error(err))
+			ss.statsd.Inc("strategy_service.schema_migration.error")
+			break
+		}
+		if found < migrationBatch || migrated == 0 {
+			break
+		}
+	}
+	ss.statsd.Gauge("strategy_service.schema_migration.migrated", total)
+	ss.statsd.TimingDuration("strategy_service.schema_migration", time.Since(t1))
+	ss.log.Info("strategies migrated",
+		zap.Int64("count", total),
+		zap.Int64("schema version", schema.CurrentVersion()),
+	)
+}
@@ -0,0 +1,127 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-redsync/redsync/v4"
+	"gitlab.com/crypto_project/core/strategy_service/src/service/signals"
+	"gitlab.com/crypto_project/core/strategy_service/src/sources/mongodb"
+	"gitlab.com/crypto_project/core/strategy_service/src/sources/mongodb/models"
+	"gitlab.com/crypto_project/core/strategy_service/src/sources/redis"
+	"gitlab.com/crypto_project/core/strategy_service/src/trading/orders"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+)
+
+// RunSignals evaluates signals in the single service instance holding the signals lock.
+func (ss *StrategyService) RunSignals() {
+	rs := redis.GetRedsync()
+	mutex := rs.NewMutex("strategy_service:signals",
+		redsync.WithTries(1),
+		redsync.WithExpiry(10*time.Second),
+	)
+	for {
+		if err := mutex.Lock(); err != nil {
+			time.Sleep(10 * time.Second) // another instance evaluates signals
+			continue
+		}
+		ss.log.Info("signals lock taken, evaluating signals in this instance")
+		ctx, cancel := context.WithCancel(context.Background())
+		engine := signals.NewEngine(ss.dataFeed, ss.onSignalTriggered, ss.onSignalExpired)
+		for _, signal := range ss.signalStore.GetEnabledSignals() {
+			engine.Upsert(signal)
+		}
+		ss.signals = engine
+		ss.statsd.Gauge("strategy_service.active_signals", int64(engine.Count()))
+		go engine.Run(ctx, 1*time.Second)
+		go ss.WatchSignals(ctx, engine)
+		for {
+			time.Sleep(3 * time.Second)
+			if ok, err := mutex.Extend(); !ok || err != nil {
+				ss.log.Error("signals lock extension",
+					zap.Bool("success", ok),
+					zap.Error(err),
+				)
+				break
+			}
+		}
+		cancel()
+	}
+}
+
+// WatchSignals subscribes to signals updates to keep the engine given consistent with persistent storage until context
+// done. The engine is passed rather than read from the service as the next lock taken replaces it.
+func (ss *StrategyService) WatchSignals(ctx context.Context, engine *signals.Engine) {
+	ss.log.Info("watching for signals in the storage")
+	coll := mongodb.GetCollection("core_signals")
+	cs, err := coll.Watch(ctx, mongo.Pipeline{}, options.ChangeStream().SetFullDocument(options.UpdateLookup))
+	if err != nil {
+		ss.log.Error("can't watch for signals", zap.Error(err))
+		return
+	}
+	defer cs.Close(ctx)
+	for cs.Next(ctx) {
+		var event struct {
+			FullDocument models.MongoSignal `bson:"fullDocument"`
+			DocumentKey  struct {
+				ID primitive.ObjectID `bson:"_id"`
+			} `bson:"documentKey"`
+			Operation string `bson:"operationType"`
+		}
+		if err := cs.Decode(&event); err != nil {
+			ss.log.Error("signal event decode", zap.Error(err))
+			continue
+		}
+		if event.Operation == "delete" {
+			engine.Remove(event.DocumentKey.ID.Hex())
+			continue
+		}
+		engine.Upsert(event.FullDocument)
+	}
+	ss.log.Warn("signals watch ended", zap.Error(cs.Err()))
+}
+
+// onSignalTriggered enables strategies linked to the signal and creates a new order if the signal describes one.
+func (ss *StrategyService) onSignalTriggered(signal *models.MongoSignal, price float64) {
+	ss.statsd.Inc("strategy_service.signal_triggered")
+	event := signal.Events[len(signal.Events)-1]
+	go ss.signalStore.SaveSignalTrigger(signal, event)
+
+	enabled := ss.signalStore.EnableStrategiesBySignal(signal.Id)
+	ss.log.Info("enabled strategies by signal",
+		zap.String("signal", signal.Id.Hex()),
+		zap.Int64("count", enabled),
+	)
+
+	condition := signal.Condition
+	if condition.KeyId == nil || condition.Side == "" || condition.Amount == 0 {
+		return
+	}
+	reduceOnly := false
+	response := ss.CreateOrder(orders.CreateOrderRequest{
+		KeyId: condition.KeyId,
+		KeyParams: orders.Order{
+			Symbol:       condition.Pair,
+			MarketType:   condition.MarketType,
+			Side:         condition.Side,
+			Amount:       condition.Amount,
+			Price:        price,
+			ReduceOnly:   &reduceOnly,
+			PositionSide: "BOTH",
+		},
+	})
+	ss.log.Info("order created by signal",
+		zap.String("signal", signal.Id.Hex()),
+		zap.String("status", response.Status),
+		zap.String("orderId", response.Data.OrderId),
+	)
+}
+
+// onSignalExpired disables expired signal in persistent storage.
+func (ss *StrategyService) onSignalExpired(signal *models.MongoSignal) {
+	ss.statsd.Inc("strategy_service.signal_expired")
+	go ss.signalStore.DisableSignal(signal.Id)
+}
@@ -0,0 +1,215 @@
+package signals
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+
+	"gitlab.com/crypto_project/core/strategy_service/src/logging"
+	"gitlab.com/crypto_project/core/strategy_service/src/service/interfaces"
+	"gitlab.com/crypto_project/core/strategy_service/src/sources/mongodb/models"
+	"go.uber.org/zap"
+)
+
+var log interfaces.ILogger
+
+func init() {
+	logger, _ := logging.GetZapLogger()
+	log = logger.With(zap.String("logger", "signals"))
+}
+
+// pricePoint is a price observed at the moment given in unix seconds.
+type pricePoint struct {
+	T     int64
+	Price float64
+}
+
+// watchedSignal keeps a signal together with the price history required to evaluate it.
+type watchedSignal struct {
+	Signal    *models.MongoSignal
+	LastPrice float64
+	History   []pricePoint
+}
+
+// An Engine watches signals and evaluates their conditions against the data feed.
+type Engine struct {
+	DataFeed  interfaces.IDataFeed
+	OnTrigger func(signal *models.MongoSignal, price float64) // called on each signal triggered
+	OnExpire  func(signal *models.MongoSignal)                // called once signal expired
+	signals   map[string]*watchedSignal
+	mux       sync.Mutex
+}
+
+// NewEngine instantiates signal engine with data feed and trigger callback given.
+func NewEngine(df interfaces.IDataFeed, onTrigger func(signal *models.MongoSignal, price float64), onExpire func(signal *models.MongoSignal)) *Engine {
+	return &Engine{
+		DataFeed:  df,
+		OnTrigger: onTrigger,
+		OnExpire:  onExpire,
+		signals:   map[string]*watchedSignal{},
+	}
+}
+
+// Upsert adds signal to watch or updates conditions of the one already watched. Percent change signals without
+// window are not watched as they can never trigger.
+func (e *Engine) Upsert(signal models.MongoSignal) {
+	e.mux.Lock()
+	defer e.mux.Unlock()
+	id := signal.Id.Hex()
+	if signal.Enabled && signal.MonType.SigType == models.SignalTypePercentChange && window(&signal) <= 0 {
+		log.Warn("percent change signal without window ignored", zap.String("id", id))
+		signal.Enabled = false
+	}
+	if !signal.Enabled {
+		delete(e.signals, id)
+		return
+	}
+	if ws, ok := e.signals[id]; ok {
+		ws.Signal = &signal // price history is kept for the updated conditions
+		return
+	}
+	e.signals[id] = &watchedSignal{Signal: &signal}
+}
+
+// Remove stops watching for the signal with id given.
+func (e *Engine) Remove(id string) {
+	e.mux.Lock()
+	delete(e.signals, id)
+	e.mux.Unlock()
+}
+
+// Count returns how much signals the engine watches.
+func (e *Engine) Count() int {
+	e.mux.Lock()
+	defer e.mux.Unlock()
+	return len(e.signals)
+}
+
+// Run evaluates watched signals each period given until context done.
+func (e *Engine) Run(ctx context.Context, period time.Duration) {
+	log.Info("starting signals evaluation", zap.Duration("period", period))
+	ticker := time.NewTicker(period)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			e.Check(time.Now().Unix())
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Check evaluates all the watched signals at the moment given in unix seconds. Signals are evaluated under the lock
+// so updates received meanwhile apply to the next check, callbacks get copies and are called after the lock released.
+func (e *Engine) Check(now int64) {
+	var expired, triggered []models.MongoSignal
+	var prices []float64
+	e.mux.Lock()
+	for id, ws := range e.signals {
+		signal := ws.Signal
+		if signal.Expiration.IsExpired(now) {
+			log.Info("signal expired", zap.String("id", id))
+			delete(e.signals, id)
+			expired = append(expired, *signal)
+			continue
+		}
+		ok, price := e.evaluate(ws, now)
+		if !ok {
+			continue
+		}
+		if signal.TriggerWhen.Period > 0 && signal.LastTrigger > 0 && now-signal.LastTrigger < signal.TriggerWhen.Period {
+			continue // cool down between repeated triggers
+		}
+		signal.LastTrigger = now
+		signal.Events = append(signal.Events, models.MongoSignalEvent{T: now, Data: price})
+		if !signal.OpenEnded {
+			signal.Enabled = false
+			delete(e.signals, id)
+		}
+		log.Info("signal triggered",
+			zap.String("id", id),
+			zap.String("type", signal.MonType.SigType),
+			zap.Float64("price", price),
+		)
+		copied := *signal
+		copied.Events = append([]models.MongoSignalEvent{}, signal.Events...)
+		triggered = append(triggered, copied)
+		prices = append(prices, price)
+	}
+	e.mux.Unlock()
+
+	for i := range expired {
+		if e.OnExpire != nil {
+			e.OnExpire(&expired[i])
+		}
+	}
+	for i := range triggered {
+		if e.OnTrigger != nil {
+			e.OnTrigger(&triggered[i], prices[i])
+		}
+	}
+}
+
+// evaluate returns true if signal condition met with the last price seen, the lock should be held.
+func (e *Engine) evaluate(ws *watchedSignal, now int64) (bool, float64) {
+	condition := ws.Signal.Condition
+	switch ws.Signal.MonType.SigType {
+	case models.SignalTypePrice:
+		ohlcv := e.DataFeed.GetPriceForPairAtExchange(condition.Pair, condition.Exchange, condition.MarketType)
+		if ohlcv == nil {
+			return false, 0
+		}
+		price := ohlcv.Close
+		lastPrice := ws.LastPrice
+		ws.LastPrice = price
+		if lastPrice == 0 {
+			return false, price
+		}
+		crossedUp := lastPrice < condition.TargetPrice && price >= condition.TargetPrice
+		crossedDown := lastPrice > condition.TargetPrice && price <= condition.TargetPrice
+		return crossedUp || crossedDown, price
+	case models.SignalTypePercentChange:
+		ohlcv := e.DataFeed.GetPriceForPairAtExchange(condition.Pair, condition.Exchange, condition.MarketType)
+		if ohlcv == nil || condition.PercentChange == 0 {
+			return false, 0
+		}
+		price := ohlcv.Close
+		ws.History = append(ws.History, pricePoint{T: now, Price: price})
+		period := window(ws.Signal)
+		for len(ws.History) > 1 && now-ws.History[1].T >= period {
+			ws.History = ws.History[1:] // keep the single oldest point within the window
+		}
+		oldest := ws.History[0]
+		if oldest.Price == 0 || now-oldest.T < period {
+			return false, price
+		}
+		change := (price/oldest.Price - 1) * 100
+		if condition.PercentChange > 0 {
+			return change >= condition.PercentChange, price
+		}
+		return change <= condition.PercentChange, price
+	case models.SignalTypeSpread:
+		spread := e.DataFeed.GetSpreadForPairAtExchange(condition.Pair, condition.Exchange, condition.MarketType)
+		if spread == nil || spread.BestBid == 0 {
+			return false, 0
+		}
+		spreadPercentage := math.Abs(spread.BestAsk-spread.BestBid) / spread.BestBid * 100
+		return spreadPercentage >= condition.Spread, spread.BestBid
+	default:
+		log.Warn("signal type not supported",
+			zap.String("id", ws.Signal.Id.Hex()),
+			zap.String("type", ws.Signal.MonType.SigType),
+		)
+		return false, 0
+	}
+}
+
+// window returns seconds percent change of the signal is measured over, the trigger period for signals saved without.
+func window(signal *models.MongoSignal) int64 {
+	if signal.Condition.Window > 0 {
+		return signal.Condition.Window
+	}
+	return signal.TriggerWhen.Period
+}
@@ -0,0 +1,123 @@
+package service
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/go-redsync/redsync/v4"
+	"gitlab.com/crypto_project/core/strategy_service/src/service/interfaces"
+	"gitlab.com/crypto_project/core/strategy_service/src/sources/eventDriven/mysql"
+	"gitlab.com/crypto_project/core/strategy_service/src/sources/memory"
+	"gitlab.com/crypto_project/core/strategy_service/src/sources/mongodb/models"
+	"gitlab.com/crypto_project/core/strategy_service/src/sources/redis"
+	statsd_client "gitlab.com/crypto_project/core/strategy_service/src/statsd"
+	"go.uber.org/zap"
+)
+
+// State stores selected with STATE_STORE environment variable, mongodb if not set.
+const (
+	StateStoreMemory = "memory"
+	StateStoreMysql  = "mysql"
+)
+
+// defaultWriteBehindMs is how often state updates buffered are written to mongodb if STATE_WRITE_BEHIND_MS is not set.
+const defaultWriteBehindMs = 200
+
+// writeBehindPeriod returns how often state updates buffered are written to mongodb, zero disables buffering.
+func writeBehindPeriod() time.Duration {
+	ms, err := strconv.Atoi(os.Getenv("STATE_WRITE_BEHIND_MS"))
+	if err != nil {
+		ms = defaultWriteBehindMs
+	}
+	return time.Duration(ms) * time.Millisecond
+}
+
+// Flush writes state updates buffered, e.g. before the instance exits.
+func (ss *StrategyService) Flush() {
+	if flusher, ok := ss.stateMgmt.(interface{ Flush() }); ok {
+		flusher.Flush()
+	}
+}
+
+// redsync returns settlement locks of the state store if it keeps them by itself, redis ones otherwise.
+func (ss *StrategyService) redsync() *redsync.Redsync {
+	if locker, ok := ss.stateMgmt.(interface{ Redsync() *redsync.Redsync }); ok {
+		return locker.Redsync()
+	}
+	return redis.GetRedsync()
+}
+
+// newStateStore returns state management selected with STATE_STORE environment variable, nil for mongodb. The
+// in-memory state is seeded with the JSON fixture at STATE_FIXTURE path if set.
+func newStateStore(statsd *statsd_client.StatsdClient) interfaces.IStateStore {
+	switch os.Getenv("STATE_STORE") {
+	case StateStoreMemory:
+		sm := memory.NewStateMgmt()
+		if path := os.Getenv("STATE_FIXTURE"); path != "" {
+			fixture, err := memory.ReadFixture(path)
+			if err == nil {
+				err = sm.Load(fixture)
+			}
+			if err != nil {
+				log.Fatalf("state fixture loading failed, %s", err.Error())
+			}
+		}
+		return sm
+	case StateStoreMysql:
+		return mysql.NewStateMgmt(&mysql.SQLConn{}, statsd)
+	}
+	return nil
+}
+
+// initFromStore settles enabled strategies from the state store and watches it for strategies updates instead of
+// mongodb change streams. Markets known to the store are processed. Positions, signals and copy trading watches need
+// mongodb, so they are not run.
+func (ss *StrategyService) initFromStore(sm interfaces.IStateStore, isLocalBuild bool) {
+	t1 := time.Now()
+	for marketType, pairs := range sm.GetMarkets() {
+		if ss.pairs[int8(marketType)] == nil {
+			ss.pairs[int8(marketType)] = map[string]struct{}{}
+		}
+		for _, pair := range pairs {
+			ss.pairs[int8(marketType)][pair] = struct{}{}
+		}
+	}
+	accountId := os.Getenv("ACCOUNT_ID")
+	var strategiesAdded int64 = 0
+	for _, model := range sm.GetEnabledStrategies() {
+		if model.Conditions == nil {
+			continue
+		}
+		if isLocalBuild && (model.AccountId == nil || model.AccountId.Hex() != accountId) {
+			continue
+		}
+		if _, ok := ss.pairs[int8(model.Conditions.MarketType)][model.Conditions.Pair]; !ok {
+			continue // skip a foreign pair
+		}
+		strategy := GetStrategy(model, ss.dataFeed, ss.trading, ss.stateMgmt, &ss.statsd, ss)
+		if ok, err := strategy.Settle(); !ok || err != nil {
+			continue
+		}
+		ss.log.Info("adding existing strategy", zap.String("ObjectID", model.ID.String()))
+		ss.strategies[model.ID.String()] = strategy
+		ss.recordCandles(model)
+		go strategy.Start()
+		strategiesAdded++
+	}
+	ss.statsd.Gauge("strategy_service.strategies_added_on_init", strategiesAdded)
+	ss.statsd.Gauge("strategy_service.active_strategies", int64(len(ss.strategies)))
+	ss.log.Info("strategies settled on init from state store", zap.Int64("count", strategiesAdded))
+
+	go ss.stateMgmt.InitOrdersWatch()
+	sm.WatchStrategies(func(strategy *models.MongoStrategy, enabled bool) {
+		ss.processStrategyUpdate(strategy, enabled, isLocalBuild, accountId)
+	})
+	go ss.runReporting()
+	go ss.runIsFullTracking()
+
+	dt := time.Since(t1)
+	ss.statsd.TimingDuration("strategy_service.init", dt)
+	ss.log.Info("init from state store complete, ready to settle strategies", zap.Duration("elapsed while init", dt))
+}
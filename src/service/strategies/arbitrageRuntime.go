@@ -0,0 +1,29 @@
+package strategies
+
+import (
+	"gitlab.com/crypto_project/core/strategy_service/src/service/interfaces"
+	"gitlab.com/crypto_project/core/strategy_service/src/service/strategies/arbitrage_order"
+	"gitlab.com/crypto_project/core/strategy_service/src/sources/mongodb/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// RunArbitrageOrder starts a cross exchange arbitrage runtime for the strategy with given interfaces to market data and trading API.
+func RunArbitrageOrder(strategy *Strategy, df interfaces.IDataFeed, td interfaces.ITrading, st interfaces.IStatsClient, keyId *primitive.ObjectID) interfaces.IStrategyRuntime {
+	if strategy.Model.State == nil {
+		strategy.Model.State = &models.MongoStrategyState{}
+	}
+	arbitrage := strategy.Model.Conditions.Arbitrage
+	if arbitrage == nil || arbitrage.SecondExchange == "" || arbitrage.SecondExchange == strategy.Model.Conditions.Exchange ||
+		arbitrage.Amount <= 0 || keyId == nil {
+		strategy.Log.Error("arbitrage conditions or key not specified")
+		strategy.Model.State.State = arbitrage_order.Error
+		strategy.Model.State.Msg = "arbitrage conditions or key not specified"
+		strategy.StateMgmt.UpdateState(strategy.Model.ID, strategy.Model.State)
+		strategy.StateMgmt.DisableStrategy(strategy.Model.ID)
+		return nil
+	}
+	runtime := arbitrage_order.New(strategy, df, td, st, keyId, strategy.StateMgmt)
+	go runtime.Start()
+
+	return runtime
+}
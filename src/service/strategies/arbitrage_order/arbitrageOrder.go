@@ -0,0 +1,226 @@
+package arbitrage_order
+
+import (
+	"context"
+	"reflect"
+	"time"
+
+	"github.com/qmuntal/stateless"
+	"gitlab.com/crypto_project/core/strategy_service/src/service/interfaces"
+	"gitlab.com/crypto_project/core/strategy_service/src/service/strategies/legs"
+	"gitlab.com/crypto_project/core/strategy_service/src/sources/mongodb/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.uber.org/zap"
+)
+
+const (
+	WaitForSpread = "WaitForSpread"
+	WaitLegs      = "WaitLegs"
+	End           = legs.End
+	Canceled      = legs.Canceled
+	Error         = legs.Error
+)
+
+const (
+	TriggerSpread       = "Spread"
+	CheckExistingOrders = legs.CheckExistingOrders
+)
+
+// Defaults for arbitrage conditions not set.
+const (
+	defaultLegTimeout = 10
+	loopPeriod        = 300 * time.Millisecond
+)
+
+// An ArbitrageOrder buys a pair at one exchange and sells it at the other one while the spread between them
+// exceeds fees and the profit wanted.
+type ArbitrageOrder struct {
+	legs.Runtime
+	SecondKeyId *primitive.ObjectID
+}
+
+// New instantiates arbitrage order runtime with the strategy given.
+func New(strategy interfaces.IStrategy, DataFeed interfaces.IDataFeed, TradingAPI interfaces.ITrading, Statsd interfaces.IStatsClient, keyId *primitive.ObjectID, stateMgmt interfaces.IStateMgmt) *ArbitrageOrder {
+	model := strategy.GetModel()
+	arbitrage := model.Conditions.Arbitrage
+	if arbitrage.LegTimeout == 0 {
+		arbitrage.LegTimeout = defaultLegTimeout
+	}
+	if model.State.Inventories == nil {
+		model.State.Inventories = map[string]float64{}
+	}
+	ao := &ArbitrageOrder{
+		Runtime: legs.Runtime{
+			Strategy:    strategy,
+			DataFeed:    DataFeed,
+			ExchangeApi: TradingAPI,
+			Statsd:      Statsd,
+			KeyId:       keyId,
+			StateMgmt:   stateMgmt,
+			Name:        "arbitrage_order",
+			LoopPeriod:  loopPeriod,
+		},
+		SecondKeyId: keyId,
+	}
+	if arbitrage.SecondKeyId != nil {
+		ao.SecondKeyId = arbitrage.SecondKeyId
+	}
+	_, amountPrecision := stateMgmt.GetMarketPrecision(model.Conditions.Pair, model.Conditions.MarketType)
+	ao.Loop = ao.processEventLoop
+	ao.LegTimeout = func() int64 { return ao.Strategy.GetModel().Conditions.Arbitrage.LegTimeout }
+	ao.AmountPrecision = func(leg *models.MongoLeg) int64 { return amountPrecision }
+	// balanced inventory is left as is on stop since it's hedged between exchanges
+	ao.OnStop = func() {
+		if _, err := ao.UnwindImbalance(false); err != nil {
+			ao.Strategy.GetModel().State.Msg = err.Error()
+		}
+	}
+
+	State := ao.NewStateMachine(legs.InitState(model, WaitForSpread))
+	State.SetTriggerParameters(TriggerSpread, reflect.TypeOf(Opportunity{}))
+
+	/*
+		Arbitrage order life cycle:
+			1) wait for the spread between exchanges net of fees to exceed min profit within inventory limits
+			2) buy at the cheap exchange and sell at the expensive one, wait for both legs filled or unwind imbalance
+			3) account profit and inventories, end or start over if continue if ended set
+	*/
+
+	State.Configure(WaitForSpread).
+		Permit(TriggerSpread, WaitLegs, ao.checkSpread)
+
+	State.Configure(WaitLegs).
+		PermitDynamic(CheckExistingOrders, ao.exitLegs, ao.CheckLegsDone).
+		OnEntryFrom(TriggerSpread, ao.enterLegs)
+
+	State.Configure(End)
+	State.Configure(Error)
+
+	_ = State.Activate()
+	ao.RestoreOrders()
+	return ao
+}
+
+// processEventLoop compares spreads of both exchanges and supplies the best opportunity for state transition attempt.
+func (ao *ArbitrageOrder) processEventLoop() {
+	model := ao.Strategy.GetModel()
+	arbitrage := model.Conditions.Arbitrage
+	spread := ao.DataFeed.GetSpreadForPairAtExchange(model.Conditions.Pair, model.Conditions.Exchange, model.Conditions.MarketType)
+	secondSpread := ao.DataFeed.GetSpreadForPairAtExchange(model.Conditions.Pair, arbitrage.SecondExchange, model.Conditions.MarketType)
+	opportunity := FindOpportunity(model.Conditions.Exchange, spread, arbitrage.Fee, arbitrage.SecondExchange, secondSpread, arbitrage.SecondFee)
+	if opportunity == nil {
+		return
+	}
+
+	ao.Lock()
+	defer ao.Unlock()
+	_ = ao.State.Fire(TriggerSpread, *opportunity)
+}
+
+// checkSpread is a guard returns true if the opportunity is profitable enough and fits inventory limits.
+func (ao *ArbitrageOrder) checkSpread(ctx context.Context, args ...interface{}) bool {
+	opportunity := args[0].(Opportunity)
+	model := ao.Strategy.GetModel()
+	arbitrage := model.Conditions.Arbitrage
+	if arbitrage.MinProfit <= 0 || opportunity.Profit < arbitrage.MinProfit {
+		return false
+	}
+	inventories := model.State.Inventories
+	if !WithinInventory(inventories[opportunity.BuyExchange], arbitrage.Amount, ao.maxInventory(opportunity.BuyExchange)) ||
+		!WithinInventory(inventories[opportunity.SellExchange], -arbitrage.Amount, ao.maxInventory(opportunity.SellExchange)) {
+		ao.Statsd.Inc("arbitrage_order.inventory_limit")
+		return false
+	}
+	return true
+}
+
+// enterLegs buys at the cheap exchange and sells at the expensive one.
+func (ao *ArbitrageOrder) enterLegs(ctx context.Context, args ...interface{}) error {
+	opportunity := args[0].(Opportunity)
+	model := ao.Strategy.GetModel()
+	ao.Strategy.GetLogger().Info("entering arbitrage",
+		zap.String("buy exchange", opportunity.BuyExchange),
+		zap.Float64("buy price", opportunity.BuyPrice),
+		zap.String("sell exchange", opportunity.SellExchange),
+		zap.Float64("sell price", opportunity.SellPrice),
+		zap.Float64("profit", opportunity.Profit),
+	)
+	model.State.Legs = []*models.MongoLeg{{
+		Pair:       model.Conditions.Pair,
+		Exchange:   opportunity.BuyExchange,
+		MarketType: model.Conditions.MarketType,
+		Side:       "buy",
+		Amount:     model.Conditions.Arbitrage.Amount,
+		KeyId:      ao.keyId(opportunity.BuyExchange),
+	}, {
+		Pair:       model.Conditions.Pair,
+		Exchange:   opportunity.SellExchange,
+		MarketType: model.Conditions.MarketType,
+		Side:       "sell",
+		Amount:     model.Conditions.Arbitrage.Amount,
+		KeyId:      ao.keyId(opportunity.SellExchange),
+	}}
+	ao.EnterLegs(WaitLegs)
+	return nil
+}
+
+// exitLegs unwinds legs imbalance if any, accounts profit and inventories of the balanced amount.
+func (ao *ArbitrageOrder) exitLegs(ctx context.Context, args ...interface{}) (stateless.State, error) {
+	model := ao.Strategy.GetModel()
+	fraction, err := ao.UnwindImbalance(false)
+	if err != nil {
+		model.State.Msg = err.Error()
+		return Error, nil
+	}
+	if fraction > 0 {
+		buy, sell := model.State.Legs[0], model.State.Legs[1]
+		amount := buy.Amount * fraction
+		profit := sell.EntryPrice*amount*(1-ao.fee(sell.Exchange)) - buy.EntryPrice*amount*(1+ao.fee(buy.Exchange))
+		model.State.ReceivedProfitAmount += profit
+		model.State.Inventories[buy.Exchange] += amount
+		model.State.Inventories[sell.Exchange] -= amount
+		model.State.Iteration += 1
+		model.State.Msg = ""
+		ao.Strategy.GetLogger().Info("arbitrage done",
+			zap.Float64("amount", amount),
+			zap.Float64("profit", profit),
+		)
+		ao.Statsd.Inc("arbitrage_order.done")
+	} else if model.State.Msg == "" {
+		model.State.Msg = "legs not filled"
+	}
+	model.State.Legs = nil
+	if fraction == 0 {
+		return ao.Retry(WaitForSpread), nil
+	}
+	if !model.Conditions.ContinueIfEnded {
+		return End, nil
+	}
+	return WaitForSpread, nil
+}
+
+// keyId returns the key trading at the exchange given.
+func (ao *ArbitrageOrder) keyId(exchange string) *primitive.ObjectID {
+	if exchange == ao.Strategy.GetModel().Conditions.Arbitrage.SecondExchange {
+		return ao.SecondKeyId
+	}
+	return ao.KeyId
+}
+
+// fee returns taker fee rate at the exchange given.
+func (ao *ArbitrageOrder) fee(exchange string) float64 {
+	arbitrage := ao.Strategy.GetModel().Conditions.Arbitrage
+	if exchange == arbitrage.SecondExchange {
+		return arbitrage.SecondFee
+	}
+	return arbitrage.Fee
+}
+
+// maxInventory returns inventory limit at the exchange given.
+func (ao *ArbitrageOrder) maxInventory(exchange string) float64 {
+	arbitrage := ao.Strategy.GetModel().Conditions.Arbitrage
+	if exchange == arbitrage.SecondExchange {
+		return arbitrage.SecondMaxInventory
+	}
+	return arbitrage.MaxInventory
+}
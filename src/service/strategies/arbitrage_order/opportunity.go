@@ -0,0 +1,58 @@
+package arbitrage_order
+
+import (
+	"math"
+
+	"gitlab.com/crypto_project/core/strategy_service/src/service/interfaces"
+)
+
+// An Opportunity describes buying at one exchange best ask and selling at the other exchange best bid.
+type Opportunity struct {
+	BuyExchange  string
+	SellExchange string
+	BuyPrice     float64
+	SellPrice    float64
+	Profit       float64 // sell proceeds net of fees minus buy cost with fees relative to buy cost
+}
+
+// FindOpportunity returns the more profitable direction of trade between two exchanges spreads given with their fee
+// rates, nil if any spread is empty.
+func FindOpportunity(exchange string, spread *interfaces.SpreadData, fee float64, secondExchange string, secondSpread *interfaces.SpreadData, secondFee float64) *Opportunity {
+	if spread == nil || secondSpread == nil || spread.BestAsk <= 0 || spread.BestBid <= 0 ||
+		secondSpread.BestAsk <= 0 || secondSpread.BestBid <= 0 {
+		return nil
+	}
+	buyFirst := &Opportunity{
+		BuyExchange:  exchange,
+		SellExchange: secondExchange,
+		BuyPrice:     spread.BestAsk,
+		SellPrice:    secondSpread.BestBid,
+		Profit:       NetProfit(spread.BestAsk, fee, secondSpread.BestBid, secondFee),
+	}
+	buySecond := &Opportunity{
+		BuyExchange:  secondExchange,
+		SellExchange: exchange,
+		BuyPrice:     secondSpread.BestAsk,
+		SellPrice:    spread.BestBid,
+		Profit:       NetProfit(secondSpread.BestAsk, secondFee, spread.BestBid, fee),
+	}
+	if buySecond.Profit > buyFirst.Profit {
+		return buySecond
+	}
+	return buyFirst
+}
+
+// NetProfit returns profit of buying and selling a unit net of fees relative to buy cost.
+func NetProfit(buyPrice, buyFee, sellPrice, sellFee float64) float64 {
+	cost := buyPrice * (1 + buyFee)
+	return (sellPrice*(1-sellFee) - cost) / cost
+}
+
+// WithinInventory returns true if the inventory changed by delta stays within max absolute inventory, 0 max means
+// no limit. A change reducing the inventory is always allowed.
+func WithinInventory(inventory, delta, max float64) bool {
+	if max <= 0 {
+		return true
+	}
+	return math.Abs(inventory+delta) <= max+1e-9 || math.Abs(inventory+delta) < math.Abs(inventory)
+}
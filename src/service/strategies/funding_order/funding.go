@@ -0,0 +1,22 @@
+package funding_order
+
+import (
+	"gitlab.com/crypto_project/core/strategy_service/src/service/interfaces"
+	"gitlab.com/crypto_project/core/strategy_service/src/sources/mongodb/models"
+)
+
+// AccrueFunding accounts funding paid to the short amount given if the funding time passed since the last update
+// and remembers the rate expected at the next funding time. Returns the payment accounted, 0 if no funding passed.
+func AccrueFunding(state *models.MongoStrategyState, funding *interfaces.FundingData, shortAmount float64) float64 {
+	if funding == nil || funding.NextFundingTime == 0 {
+		return 0
+	}
+	payment := 0.0
+	if state.NextFundingTime > 0 && funding.NextFundingTime > state.NextFundingTime {
+		payment = state.FundingRate * funding.MarkPrice * shortAmount // short receives positive rate
+		state.FundingPNL += payment
+	}
+	state.NextFundingTime = funding.NextFundingTime
+	state.FundingRate = funding.FundingRate
+	return payment
+}
@@ -0,0 +1,290 @@
+package funding_order
+
+import (
+	"context"
+	"reflect"
+	"time"
+
+	"github.com/qmuntal/stateless"
+	"gitlab.com/crypto_project/core/strategy_service/src/service/interfaces"
+	"gitlab.com/crypto_project/core/strategy_service/src/service/strategies/legs"
+	"gitlab.com/crypto_project/core/strategy_service/src/sources/mongodb/models"
+	"gitlab.com/crypto_project/core/strategy_service/src/trading/orders"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.uber.org/zap"
+)
+
+const (
+	WaitForEntry  = "WaitForEntry"
+	WaitEntryLegs = "WaitEntryLegs"
+	InEntry       = "InEntry"
+	WaitExitLegs  = "WaitExitLegs"
+	End           = legs.End
+	Canceled      = legs.Canceled
+	Error         = legs.Error
+)
+
+const (
+	TriggerFunding      = "Funding"
+	CheckExistingOrders = legs.CheckExistingOrders
+)
+
+// Defaults for funding conditions not set.
+const (
+	defaultLegTimeout      = 30
+	defaultCollateralAsset = "USDT"
+	loopPeriod             = 1 * time.Second
+)
+
+// Legs indexes in the strategy state.
+const (
+	spotLeg    = 0
+	futuresLeg = 1
+)
+
+// A FundingOrder buys spot and shorts perpetual futures of the same asset to collect funding while its rate is high.
+type FundingOrder struct {
+	legs.Runtime
+	SpotKeyId        *primitive.ObjectID
+	FuturesKeyId     *primitive.ObjectID
+	AmountPrecisions map[int64]int64 // by leg market type
+}
+
+// New instantiates funding order runtime with the strategy given.
+func New(strategy interfaces.IStrategy, DataFeed interfaces.IDataFeed, TradingAPI interfaces.ITrading, Statsd interfaces.IStatsClient, keyId *primitive.ObjectID, stateMgmt interfaces.IStateMgmt) *FundingOrder {
+	model := strategy.GetModel()
+	funding := model.Conditions.Funding
+	if funding.LegTimeout == 0 {
+		funding.LegTimeout = defaultLegTimeout
+	}
+	if funding.CollateralAsset == "" {
+		funding.CollateralAsset = defaultCollateralAsset
+	}
+	fo := &FundingOrder{
+		Runtime: legs.Runtime{
+			Strategy:    strategy,
+			DataFeed:    DataFeed,
+			ExchangeApi: TradingAPI,
+			Statsd:      Statsd,
+			KeyId:       keyId,
+			StateMgmt:   stateMgmt,
+			Name:        "funding_order",
+			LoopPeriod:  loopPeriod,
+			ExitState:   WaitExitLegs,
+		},
+		SpotKeyId:        keyId,
+		FuturesKeyId:     keyId,
+		AmountPrecisions: map[int64]int64{},
+	}
+	fo.Loop = fo.processEventLoop
+	fo.LegTimeout = func() int64 { return fo.Strategy.GetModel().Conditions.Funding.LegTimeout }
+	fo.AmountPrecision = func(leg *models.MongoLeg) int64 { return fo.AmountPrecisions[leg.MarketType] }
+	fo.OnStop = fo.CloseLegs // collateral stays at futures key until legs closed, so it's not transferred back here
+	if funding.SpotKeyId != nil {
+		fo.SpotKeyId = funding.SpotKeyId
+	}
+	if funding.FuturesKeyId != nil {
+		fo.FuturesKeyId = funding.FuturesKeyId
+	}
+	for _, marketType := range []int64{0, 1} {
+		_, amountPrecision := stateMgmt.GetMarketPrecision(model.Conditions.Pair, marketType)
+		fo.AmountPrecisions[marketType] = amountPrecision
+	}
+
+	State := fo.NewStateMachine(legs.InitState(model, WaitForEntry))
+	State.SetTriggerParameters(TriggerFunding, reflect.TypeOf(interfaces.FundingData{}))
+
+	/*
+		Funding order life cycle:
+			1) wait for the funding rate to reach entry rate
+			2) transfer collateral to futures key, buy spot and short futures, wait for both legs filled or unwind imbalance
+			3) collect funding until the rate falls to exit rate
+			4) close both legs, transfer collateral back and end or start over if continue if ended set
+	*/
+
+	State.Configure(WaitForEntry).
+		Permit(TriggerFunding, WaitEntryLegs, fo.checkEntry)
+
+	State.Configure(WaitEntryLegs).
+		PermitDynamic(CheckExistingOrders, fo.exitEntryLegs, fo.CheckLegsDone).
+		OnEntryFrom(TriggerFunding, fo.enterEntryLegs)
+
+	State.Configure(InEntry).
+		Permit(TriggerFunding, WaitExitLegs, fo.checkExit)
+
+	State.Configure(WaitExitLegs).
+		PermitDynamic(CheckExistingOrders, fo.exitExitLegs, fo.CheckLegsDone).
+		OnEntry(fo.enterExitLegs)
+
+	State.Configure(End)
+	State.Configure(Error)
+
+	_ = State.Activate()
+	fo.RestoreOrders()
+	return fo
+}
+
+// processEventLoop accrues funding passed while in entry and supplies funding data for state transition attempt.
+func (fo *FundingOrder) processEventLoop() {
+	model := fo.Strategy.GetModel()
+	funding := fo.DataFeed.GetFundingForPairAtExchange(model.Conditions.Pair, model.Conditions.Exchange)
+	if funding == nil || funding.NextFundingTime == 0 {
+		return
+	}
+
+	fo.Lock()
+	defer fo.Unlock()
+	shortAmount := 0.0
+	if fo.CurrentState() == InEntry && len(model.State.Legs) > futuresLeg {
+		shortAmount = model.State.Legs[futuresLeg].Filled - model.State.Legs[futuresLeg].Closed
+	}
+	if payment := AccrueFunding(model.State, funding, shortAmount); payment != 0 {
+		fo.Strategy.GetLogger().Info("funding accrued",
+			zap.Float64("payment", payment),
+			zap.Float64("funding pnl", model.State.FundingPNL),
+		)
+		fo.Statsd.Inc("funding_order.funding_accrued")
+		fo.StateMgmt.UpdateStrategyState(model.ID, model.State)
+	}
+	_ = fo.State.Fire(TriggerFunding, *funding)
+}
+
+// checkEntry is a guard returns true if the funding rate is high enough to enter.
+func (fo *FundingOrder) checkEntry(ctx context.Context, args ...interface{}) bool {
+	funding := args[0].(interfaces.FundingData)
+	entryRate := fo.Strategy.GetModel().Conditions.Funding.EntryRate
+	return entryRate > 0 && funding.FundingRate >= entryRate
+}
+
+// enterEntryLegs transfers collateral to futures key, buys spot and shorts futures.
+func (fo *FundingOrder) enterEntryLegs(ctx context.Context, args ...interface{}) error {
+	funding := args[0].(interfaces.FundingData)
+	model := fo.Strategy.GetModel()
+	model.State.Legs = nil
+	fo.Strategy.GetLogger().Info("entering funding arbitrage",
+		zap.Float64("funding rate", funding.FundingRate),
+		zap.Float64("mark price", funding.MarkPrice),
+	)
+	if fo.transferCollateral(true) {
+		model.State.Legs = []*models.MongoLeg{{
+			Pair:       model.Conditions.Pair,
+			Exchange:   model.Conditions.Exchange,
+			MarketType: 0,
+			Side:       "buy",
+			Amount:     model.Conditions.Funding.Amount,
+			KeyId:      fo.SpotKeyId,
+		}, {
+			Pair:       model.Conditions.Pair,
+			Exchange:   model.Conditions.Exchange,
+			MarketType: 1,
+			Side:       "sell",
+			Amount:     model.Conditions.Funding.Amount,
+			KeyId:      fo.FuturesKeyId,
+		}}
+		fo.EnterLegs(WaitEntryLegs)
+		return nil
+	}
+	fo.AfterLegsPlaced(WaitEntryLegs)
+	return nil
+}
+
+// exitEntryLegs unwinds legs imbalance if any and selects the next state.
+func (fo *FundingOrder) exitEntryLegs(ctx context.Context, args ...interface{}) (stateless.State, error) {
+	model := fo.Strategy.GetModel()
+	fraction, err := fo.UnwindImbalance(true)
+	if err != nil {
+		model.State.Msg = err.Error()
+		return Error, nil
+	}
+	if fraction == 0 {
+		model.State.Legs = nil
+		if model.State.Msg == "" {
+			model.State.Msg = "legs not filled"
+		}
+		return fo.Retry(WaitForEntry), nil
+	}
+	model.State.Msg = ""
+	return InEntry, nil
+}
+
+// checkExit is a guard returns true if the funding rate fell to exit rate.
+func (fo *FundingOrder) checkExit(ctx context.Context, args ...interface{}) bool {
+	funding := args[0].(interfaces.FundingData)
+	model := fo.Strategy.GetModel()
+	if len(model.State.Legs) == 0 {
+		return true
+	}
+	if funding.FundingRate <= model.Conditions.Funding.ExitRate {
+		fo.Strategy.GetLogger().Info("funding rate fell", zap.Float64("funding rate", funding.FundingRate))
+		return true
+	}
+	return false
+}
+
+// enterExitLegs places orders to close legs amount not closed yet.
+func (fo *FundingOrder) enterExitLegs(ctx context.Context, args ...interface{}) error {
+	fo.ExitLegs(WaitExitLegs)
+	return nil
+}
+
+// exitExitLegs retries to close legs not closed or transfers collateral back and ends the round.
+// Legs PNL goes to received profit, funding is accounted in funding PNL separately.
+func (fo *FundingOrder) exitExitLegs(ctx context.Context, args ...interface{}) (stateless.State, error) {
+	model := fo.Strategy.GetModel()
+	if !fo.LegsClosed() {
+		fo.Statsd.Inc("funding_order.exit_retry")
+		return WaitExitLegs, nil
+	}
+	pnl := legs.PNL(model.State.Legs)
+	model.State.ReceivedProfitAmount += pnl
+	fo.Strategy.GetLogger().Info("funding arbitrage closed",
+		zap.Float64("legs pnl", pnl),
+		zap.Float64("funding pnl", model.State.FundingPNL),
+	)
+	fo.transferCollateral(false)
+	if model.Conditions.ContinueIfEnded {
+		model.State.Legs = nil
+		model.State.Iteration += 1
+		return WaitForEntry, nil
+	}
+	return End, nil
+}
+
+// transferCollateral moves collateral from spot to futures key on entry or back on exit. Returns false if transfer
+// to futures failed and legs should not be entered.
+func (fo *FundingOrder) transferCollateral(toFutures bool) bool {
+	model := fo.Strategy.GetModel()
+	funding := model.Conditions.Funding
+	request := orders.TransferRequest{
+		FromKeyId:  fo.SpotKeyId,
+		ToKeyId:    fo.FuturesKeyId,
+		Symbol:     funding.CollateralAsset,
+		MarketType: 1,
+		Amount:     funding.Collateral - model.State.CollateralTransferred,
+	}
+	if !toFutures {
+		request.FromKeyId, request.ToKeyId = fo.FuturesKeyId, fo.SpotKeyId
+		request.MarketType = 0
+		request.Amount = model.State.CollateralTransferred
+	}
+	if request.Amount <= 0 {
+		return true
+	}
+	response := fo.ExchangeApi.Transfer(request)
+	if response.Status != "OK" {
+		fo.Strategy.GetLogger().Error("can't transfer collateral",
+			zap.Bool("to futures", toFutures),
+			zap.Float64("amount", request.Amount),
+			zap.String("msg", response.Data.Msg),
+		)
+		model.State.Msg = response.Data.Msg
+		fo.Statsd.Inc("funding_order.transfer_error")
+		return false
+	}
+	if toFutures {
+		model.State.CollateralTransferred += request.Amount
+	} else {
+		model.State.CollateralTransferred = 0
+	}
+	return true
+}
@@ -0,0 +1,166 @@
+// Package legs runs multi-leg strategies, e.g. pairs trade or funding arbitrage, and contains helpers they share.
+package legs
+
+import (
+	"math"
+
+	"gitlab.com/crypto_project/core/strategy_service/src/service/interfaces"
+	"gitlab.com/crypto_project/core/strategy_service/src/sources/mongodb/models"
+	"gitlab.com/crypto_project/core/strategy_service/src/trading/orders"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// BalanceLegs returns the fraction of requested amount filled by all the legs and an excess filled by each leg
+// above this fraction, the excess should be unwound to keep position neutral. Amounts being unwound already are not
+// counted as filled.
+func BalanceLegs(legs []*models.MongoLeg) (float64, []float64) {
+	if len(legs) == 0 {
+		return 0, nil
+	}
+	fraction := 1.0
+	for _, leg := range legs {
+		if leg.Amount == 0 {
+			return 0, make([]float64, len(legs))
+		}
+		fraction = math.Min(fraction, (leg.Filled-leg.Unwinding)/leg.Amount)
+	}
+	excess := make([]float64, len(legs))
+	for i, leg := range legs {
+		excess[i] = leg.Filled - leg.Unwinding - leg.Amount*fraction
+	}
+	return fraction, excess
+}
+
+// Entered returns the leg amount entered and neither closed nor being unwound.
+func Entered(leg *models.MongoLeg) float64 {
+	return leg.Filled - leg.Closed - leg.Unwinding
+}
+
+// PNL returns realized profit of closed legs amount in quote currency.
+func PNL(legs []*models.MongoLeg) float64 {
+	pnl := 0.0
+	for _, leg := range legs {
+		diff := leg.ExitPrice - leg.EntryPrice
+		if leg.Side == "sell" {
+			diff = -diff
+		}
+		pnl += diff * leg.Closed
+	}
+	return pnl
+}
+
+// AllDone returns true if no leg waits for an order.
+func AllDone(legs []*models.MongoLeg) bool {
+	for _, leg := range legs {
+		if leg.OrderId != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// Fill accounts the order executed for the leg waited for it, closing defines if the order entered or exited the leg.
+// Returns false if no leg waited for the order.
+func Fill(legs []*models.MongoLeg, order models.MongoOrder, closing bool) bool {
+	for _, leg := range legs {
+		if order.OrderId == "" || leg.OrderId != order.OrderId {
+			continue
+		}
+		leg.OrderId = ""
+		if order.Filled <= 0 {
+			return true
+		}
+		if closing {
+			leg.ExitPrice = WeightedPrice(leg.ExitPrice, leg.Closed, order.Average, order.Filled)
+			leg.Closed += order.Filled
+		} else {
+			leg.EntryPrice = WeightedPrice(leg.EntryPrice, leg.Filled, order.Average, order.Filled)
+			leg.Filled += order.Filled
+		}
+		return true
+	}
+	return false
+}
+
+// Unwind subtracts amount filled by the unwind order executed or canceled from the leg waited for it. Returns false if
+// no leg waited for the order.
+func Unwind(legs []*models.MongoLeg, order models.MongoOrder) bool {
+	for _, leg := range legs {
+		if order.OrderId == "" || leg.UnwindOrderId != order.OrderId {
+			continue
+		}
+		leg.UnwindOrderId = ""
+		leg.Unwinding = 0
+		leg.Filled -= order.Filled
+		return true
+	}
+	return false
+}
+
+// PlaceOrder places market order for the leg with the leg key or the key given if the leg has no own one. Reduce-only
+// orders are placed as exits, on spot as well.
+func PlaceOrder(trading interfaces.ITrading, keyId *primitive.ObjectID, leg *models.MongoLeg, side string, amount float64, reduceOnly bool) orders.OrderResponse {
+	if leg.KeyId != nil {
+		keyId = leg.KeyId
+	}
+	exit := reduceOnly
+	if leg.MarketType == 0 {
+		reduceOnly = false // not supported by spot
+	}
+	return trading.CreateOrder(orders.CreateOrderRequest{
+		KeyId: keyId,
+		Exit:  exit,
+		KeyParams: orders.Order{
+			Symbol:       leg.Pair,
+			MarketType:   leg.MarketType,
+			Side:         side,
+			Amount:       amount,
+			ReduceOnly:   &reduceOnly,
+			Type:         "market",
+			PositionSide: "BOTH",
+		},
+	})
+}
+
+// CancelOrders cancels orders legs wait for.
+func CancelOrders(trading interfaces.ITrading, keyId *primitive.ObjectID, legs []*models.MongoLeg) {
+	for _, leg := range legs {
+		if leg.OrderId == "" {
+			continue
+		}
+		legKeyId := keyId
+		if leg.KeyId != nil {
+			legKeyId = leg.KeyId
+		}
+		trading.CancelOrder(orders.CancelOrderRequest{
+			KeyId: legKeyId,
+			KeyParams: orders.CancelOrderRequestParams{
+				OrderId:    leg.OrderId,
+				MarketType: leg.MarketType,
+				Pair:       leg.Pair,
+			},
+		})
+	}
+}
+
+// OppositeSide returns the side to close position opened by the side given.
+func OppositeSide(side string) string {
+	if side == "buy" {
+		return "sell"
+	}
+	return "buy"
+}
+
+// WeightedPrice returns average price of two fills.
+func WeightedPrice(price, amount, addPrice, addAmount float64) float64 {
+	if amount+addAmount == 0 {
+		return 0
+	}
+	return (price*amount + addPrice*addAmount) / (amount + addAmount)
+}
+
+// FloorAmount floors the amount to precision given.
+func FloorAmount(amount float64, precision int64) float64 {
+	rank := math.Pow(10, float64(precision))
+	return math.Floor(amount*rank+1e-9) / rank
+}
@@ -0,0 +1,387 @@
+package legs
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/qmuntal/stateless"
+	"gitlab.com/crypto_project/core/strategy_service/src/service/interfaces"
+	"gitlab.com/crypto_project/core/strategy_service/src/sources/mongodb/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.uber.org/zap"
+)
+
+// States every legs runtime ends in.
+const (
+	End      = "End"
+	Canceled = "Canceled"
+	Error    = "Error"
+)
+
+// CheckExistingOrders is fired with each leg order executed or canceled, and with an empty order once legs
+// orders failed to be placed.
+const CheckExistingOrders = "CheckExistingOrders"
+
+const (
+	defaultLegTimeout = 30
+	// MaxFailedRounds is how many legs rounds in a row may place no order before the strategy stops with error.
+	MaxFailedRounds = 5
+	// unwindAttempts is how many times an order unwinding leg excess is placed before giving up.
+	unwindAttempts = 3
+)
+
+// A Runtime runs a strategy trading legs: the event loop, legs orders with timeouts and order callbacks serialized
+// with state transitions, and stop. Strategies embed it, configure its state machine and set the hooks.
+type Runtime struct {
+	Strategy        interfaces.IStrategy
+	State           *stateless.StateMachine
+	KeyId           *primitive.ObjectID
+	DataFeed        interfaces.IDataFeed
+	ExchangeApi     interfaces.ITrading
+	Statsd          interfaces.IStatsClient
+	StateMgmt       interfaces.IStateMgmt
+	StopLock        bool
+	Name            string                           // metrics prefix, e.g. pairs_order
+	LoopPeriod      time.Duration                    // how often Loop called
+	Loop            func()                           // supplies market data for state transition attempt
+	LegTimeout      func() int64                     // seconds legs orders waited for before cancel, default if not set
+	AmountPrecision func(leg *models.MongoLeg) int64 // amount precision of the leg market
+	ExitState       string                           // orders executed in this state close legs rather than enter
+	OnStop          func()                           // closes or unwinds legs entered if stopped before end, under lock
+	OnOrder         func(order models.MongoOrder)    // accounts order executed instead of firing the state, under lock
+	legsRound       int                              // incremented on each legs orders placement to match timeouts
+	failedRounds    int                              // legs rounds in a row placed no order
+	mux             sync.Mutex                       // serializes state machine firing from the loop and order callbacks
+}
+
+// InitState returns the state to resume the strategy in, the initial one if it's new or ended to start over.
+func InitState(model *models.MongoStrategy, initial string) string {
+	if model.State.State != "" && !(model.State.State == End && model.Conditions.ContinueIfEnded) {
+		return model.State.State
+	}
+	return initial
+}
+
+// NewStateMachine instantiates state machine in the state given logging transitions, the strategy configures it.
+func (r *Runtime) NewStateMachine(initState string) *stateless.StateMachine {
+	state := stateless.NewStateMachineWithMode(initState, 1)
+	state.OnTransitioned(func(ctx context.Context, tr stateless.Transition) {
+		r.Strategy.GetLogger().Info("legs state transition",
+			zap.String("runtime", r.Name),
+			zap.String("trigger", fmt.Sprintf("%v", tr.Trigger)),
+			zap.String("source", fmt.Sprintf("%v", tr.Source)),
+			zap.String("dest", fmt.Sprintf("%v", tr.Destination)),
+		)
+		r.Strategy.GetJournal().Transition(fmt.Sprintf("%v", tr.Source), fmt.Sprintf("%v", tr.Destination),
+			fmt.Sprintf("%v", tr.Trigger), 0, r.Strategy.GetModel().State)
+	})
+	state.SetTriggerParameters(CheckExistingOrders, reflect.TypeOf(models.MongoOrder{}))
+	r.State = state
+	return state
+}
+
+// RestoreOrders subscribes to legs orders placed before restart.
+func (r *Runtime) RestoreOrders() {
+	for _, leg := range r.Strategy.GetModel().State.Legs {
+		if leg.OrderId != "" {
+			r.WaitForOrder(leg.OrderId)
+		}
+		if leg.UnwindOrderId != "" {
+			r.WaitForOrder(leg.UnwindOrderId)
+		}
+	}
+}
+
+// CurrentState returns the state machine state.
+func (r *Runtime) CurrentState() string {
+	state, _ := r.State.State(context.Background())
+	return state.(string)
+}
+
+// Lock serializes the caller with state transitions, e.g. to fire the state from the loop.
+func (r *Runtime) Lock() {
+	r.mux.Lock()
+}
+
+// Unlock releases the lock taken by Lock.
+func (r *Runtime) Unlock() {
+	r.mux.Unlock()
+}
+
+// Start runs the event loop until the strategy ended or disabled.
+func (r *Runtime) Start() {
+	r.Statsd.Inc(r.Name + ".start")
+	state := r.CurrentState()
+	lastValidityCheckAt := time.Now().Add(-1 * time.Second)
+	for state != End && state != Canceled && state != Error {
+		if time.Since(lastValidityCheckAt) > 2*time.Second {
+			if valid, err := r.Strategy.GetSettlementMutex().Valid(); !valid || err != nil {
+				r.Strategy.GetLogger().Error("invalid settlement mutex, breaking event loop",
+					zap.Bool("mutex valid", valid),
+					zap.Error(err),
+				)
+				break
+			}
+			lastValidityCheckAt = time.Now()
+		}
+		if !r.Strategy.GetModel().Enabled {
+			break
+		}
+		r.Loop()
+		time.Sleep(r.LoopPeriod)
+		state = r.CurrentState()
+	}
+	r.Stop()
+	r.Strategy.GetLogger().Info("stopped legs runtime",
+		zap.String("runtime", r.Name),
+		zap.String("state", state),
+	)
+}
+
+// Stop cancels orders waited and lets the strategy close legs entered if it stopped before end.
+func (r *Runtime) Stop() {
+	if r.StopLock {
+		return
+	}
+	r.StopLock = true
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	model := r.Strategy.GetModel()
+	state := r.CurrentState()
+	if state != End {
+		r.CancelLegOrders()
+		if r.OnStop != nil {
+			r.OnStop()
+		}
+		if state != Error {
+			model.State.State = Canceled
+		}
+		r.Statsd.Inc(r.Name + ".canceled")
+	}
+	r.StateMgmt.UpdateStrategyState(model.ID, model.State)
+	r.StateMgmt.DisableStrategy(model.ID)
+}
+
+// CheckLegsDone is a guard returns true if no leg waits for an order.
+func (r *Runtime) CheckLegsDone(ctx context.Context, args ...interface{}) bool {
+	return AllDone(r.Strategy.GetModel().State.Legs)
+}
+
+// LegsClosed returns true if no leg has amount entered left to close.
+func (r *Runtime) LegsClosed() bool {
+	for _, leg := range r.Strategy.GetModel().State.Legs {
+		if FloorAmount(Entered(leg), r.AmountPrecision(leg)) > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// EnterLegs places orders entering legs and waits for them in the state given.
+func (r *Runtime) EnterLegs(state string) {
+	for _, leg := range r.Strategy.GetModel().State.Legs {
+		leg.OrderId = r.PlaceLegOrder(leg, leg.Side, leg.Amount, false)
+	}
+	r.AfterLegsPlaced(state)
+}
+
+// ExitLegs places orders closing legs amount not closed yet and waits for them in the state given.
+func (r *Runtime) ExitLegs(state string) {
+	for _, leg := range r.Strategy.GetModel().State.Legs {
+		if amount := Entered(leg); amount > 0 {
+			leg.OrderId = r.PlaceLegOrder(leg, OppositeSide(leg.Side), amount, true)
+		}
+	}
+	r.AfterLegsPlaced(state)
+}
+
+// CloseLegs places orders closing legs amount entered without waiting for them, e.g. on stop.
+func (r *Runtime) CloseLegs() {
+	for _, leg := range r.Strategy.GetModel().State.Legs {
+		if amount := Entered(leg); amount > 0 {
+			r.PlaceLegOrder(leg, OppositeSide(leg.Side), amount, true)
+		}
+	}
+}
+
+// UnwindImbalance places orders unwinding legs filled above the fraction filled by all of them and returns the
+// fraction, so legs are left balanced. Excess is subtracted from a leg once its unwind order filled. An error is
+// returned if an unwind order failed to be placed, the excess is left open then.
+func (r *Runtime) UnwindImbalance(reduceOnly bool) (float64, error) {
+	fraction, excess := BalanceLegs(r.Strategy.GetModel().State.Legs)
+	for i, leg := range r.Strategy.GetModel().State.Legs {
+		amount := FloorAmount(excess[i], r.AmountPrecision(leg))
+		if amount <= 0 {
+			continue
+		}
+		r.Strategy.GetLogger().Warn("unwinding leg imbalance",
+			zap.String("pair", leg.Pair),
+			zap.String("exchange", leg.Exchange),
+			zap.Int64("market type", leg.MarketType),
+			zap.Float64("excess", amount),
+			zap.Float64("balanced fraction", fraction),
+		)
+		r.Statsd.Inc(r.Name + ".leg_imbalance")
+		orderId := ""
+		for attempt := 0; attempt < unwindAttempts && orderId == ""; attempt++ {
+			orderId = r.PlaceLegOrder(leg, OppositeSide(leg.Side), amount, reduceOnly)
+		}
+		if orderId == "" {
+			r.Statsd.Inc(r.Name + ".unwind_error")
+			return fraction, fmt.Errorf("can't unwind %v %v excess: %v", amount, leg.Pair, r.Strategy.GetModel().State.Msg)
+		}
+		leg.UnwindOrderId = orderId
+		leg.Unwinding = amount
+	}
+	return fraction, nil
+}
+
+// Retry returns the state to enter again from after legs not filled, or Error once legs orders failed to be placed
+// too many rounds in a row, e.g. rejected for insufficient balance.
+func (r *Runtime) Retry(next string) string {
+	if r.failedRounds < MaxFailedRounds {
+		return next
+	}
+	model := r.Strategy.GetModel()
+	model.State.Msg = fmt.Sprintf("legs orders failed %v times in a row: %v", r.failedRounds, model.State.Msg)
+	r.Strategy.GetLogger().Error("giving up legs", zap.String("runtime", r.Name), zap.String("msg", model.State.Msg))
+	r.Statsd.Inc(r.Name + ".failed")
+	return Error
+}
+
+// AfterLegsPlaced persists legs and schedules legs orders cancel if not filled in time. If no order placed the state
+// is resolved after the timeout growing with each such round in a row.
+func (r *Runtime) AfterLegsPlaced(state string) {
+	model := r.Strategy.GetModel()
+	model.State.State = state
+	r.StateMgmt.UpdateStrategyState(model.ID, model.State)
+	r.legsRound += 1
+	round := r.legsRound
+	timeout := r.legTimeout()
+	if AllDone(model.State.Legs) {
+		if r.failedRounds < MaxFailedRounds {
+			r.failedRounds += 1
+		}
+		backoff := timeout * time.Duration(r.failedRounds)
+		r.Statsd.Inc(r.Name + ".legs_not_placed")
+		go func() {
+			time.Sleep(backoff)
+			r.FireOrder(models.MongoOrder{})
+		}()
+		return
+	}
+	r.failedRounds = 0
+	go func() {
+		time.Sleep(timeout)
+		r.mux.Lock()
+		defer r.mux.Unlock()
+		if r.CurrentState() != state || round != r.legsRound || AllDone(r.Strategy.GetModel().State.Legs) {
+			return
+		}
+		r.Strategy.GetLogger().Warn("legs timeout, canceling orders", zap.String("runtime", r.Name), zap.String("state", state))
+		r.Statsd.Inc(r.Name + ".leg_timeout")
+		r.CancelLegOrders() // canceled orders reported to callback resolve the imbalance
+	}()
+}
+
+func (r *Runtime) legTimeout() time.Duration {
+	seconds := int64(0)
+	if r.LegTimeout != nil {
+		seconds = r.LegTimeout()
+	}
+	if seconds <= 0 {
+		seconds = defaultLegTimeout
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// PlaceLegOrder places market order for the leg and returns its id or empty string on failure.
+func (r *Runtime) PlaceLegOrder(leg *models.MongoLeg, side string, amount float64, reduceOnly bool) string {
+	amount = FloorAmount(amount, r.AmountPrecision(leg))
+	if amount <= 0 {
+		return ""
+	}
+	response := PlaceOrder(r.ExchangeApi, r.KeyId, leg, side, amount, reduceOnly)
+	if response.Status != "OK" || response.Data.OrderId == "" {
+		r.Strategy.GetLogger().Error("can't place leg order",
+			zap.String("pair", leg.Pair),
+			zap.String("exchange", leg.Exchange),
+			zap.Int64("market type", leg.MarketType),
+			zap.String("side", side),
+			zap.Float64("amount", amount),
+			zap.String("msg", response.Data.Msg),
+		)
+		r.Strategy.GetModel().State.Msg = response.Data.Msg
+		r.Statsd.Inc(r.Name + ".leg_order_error")
+		return ""
+	}
+	r.Strategy.GetJournal().OrderPlaced(response.Data.OrderId, r.CurrentState(), side, "market", amount, 0)
+	r.WaitForOrder(response.Data.OrderId)
+	return response.Data.OrderId
+}
+
+// WaitForOrder subscribes to the leg order updates.
+func (r *Runtime) WaitForOrder(orderId string) {
+	_ = r.StateMgmt.SubscribeToOrder(orderId, r.orderCallback)
+}
+
+// orderCallback supplies leg order executed or canceled for the state transition attempt.
+func (r *Runtime) orderCallback(order *models.MongoOrder) {
+	if order == nil || order.OrderId == "" || !(order.Status == "filled" || order.Status == "canceled") {
+		return
+	}
+	r.Strategy.GetJournal().OrderUpdated(order)
+	go r.FireOrder(*order) // callback may be called synchronously while firing
+}
+
+// FireOrder accounts the leg order executed and fires the state with it, persisting the state changed. Unwind orders
+// are accounted only.
+func (r *Runtime) FireOrder(order models.MongoOrder) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	if model := r.Strategy.GetModel(); Unwind(model.State.Legs, order) {
+		r.StateMgmt.UpdateStrategyState(model.ID, model.State)
+		return
+	}
+	if r.OnOrder != nil {
+		r.OnOrder(order)
+		return
+	}
+	model := r.Strategy.GetModel()
+	Fill(model.State.Legs, order, r.ExitState != "" && r.CurrentState() == r.ExitState)
+	if err := r.State.Fire(CheckExistingOrders, order); err != nil {
+		r.Strategy.GetLogger().Debug("fire state error", zap.Error(err))
+		return
+	}
+	model.State.State = r.CurrentState()
+	r.StateMgmt.UpdateStrategyState(model.ID, model.State)
+}
+
+// CancelLegOrders cancels orders legs wait for.
+func (r *Runtime) CancelLegOrders() {
+	CancelOrders(r.ExchangeApi, r.KeyId, r.Strategy.GetModel().State.Legs)
+}
+
+func (r *Runtime) PlaceOrder(price, amount float64, step string) {}
+
+func (r *Runtime) TryCancelAllOrders(orderIds []string) {
+	r.CancelLegOrders()
+}
+
+func (r *Runtime) TryCancelAllOrdersConsistently(orderIds []string) {
+	r.CancelLegOrders()
+}
+
+func (r *Runtime) SetSelectedExitTarget(selectedExitTarget int) {}
+
+func (r *Runtime) IsOrderExistsInMap(orderId string) bool {
+	for _, leg := range r.Strategy.GetModel().State.Legs {
+		if leg.OrderId == orderId {
+			return true
+		}
+	}
+	return false
+}
@@ -2,6 +2,7 @@ package makeronly_order
 
 import (
 	"context"
+	"fmt"
 	"github.com/qmuntal/stateless"
 	"gitlab.com/crypto_project/core/strategy_service/src/service/interfaces"
 	"gitlab.com/crypto_project/core/strategy_service/src/sources/mongodb/models"
@@ -145,6 +146,10 @@ func NewMakerOnlyOrder(strategy interfaces.IStrategy, DataFeed interfaces.IDataF
 	}
 
 	State := stateless.NewStateMachineWithMode(initState, 1)
+	State.OnTransitioned(func(ctx context.Context, tr stateless.Transition) {
+		PO.Strategy.GetJournal().Transition(fmt.Sprintf("%v", tr.Source), fmt.Sprintf("%v", tr.Destination),
+			fmt.Sprintf("%v", tr.Trigger), PO.Strategy.GetModel().State.EntryPrice, PO.Strategy.GetModel().State)
+	})
 	// define triggers and input types:
 	State.SetTriggerParameters(TriggerSpread, reflect.TypeOf(interfaces.SpreadData{}))
 
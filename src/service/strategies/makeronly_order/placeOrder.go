@@ -57,6 +57,7 @@ func (mo *MakerOnlyOrder) PlaceOrder(anything, amount float64, step string) {
 
 		orderId = response.Data.OrderId
 		if orderId != "" {
+			mo.Strategy.GetJournal().OrderPlaced(orderId, step, order.Side, order.Type, order.Amount, order.Price)
 			mo.OrdersMux.Lock()
 			mo.OrdersMap[response.Data.OrderId] = true
 			mo.OrdersMux.Unlock()
@@ -27,6 +27,7 @@ func (mo *MakerOnlyOrder) orderCallback(order *models.MongoOrder) {
 		return
 	}
 	mo.OrdersMux.Unlock()
+	mo.Strategy.GetJournal().OrderUpdated(order)
 	if order.Status == "filled" {
 		log.Println("in waitOrder")
 		state := mo.Strategy.GetModel().State
@@ -0,0 +1,27 @@
+package strategies
+
+import (
+	"gitlab.com/crypto_project/core/strategy_service/src/service/interfaces"
+	"gitlab.com/crypto_project/core/strategy_service/src/service/strategies/pairs_order"
+	"gitlab.com/crypto_project/core/strategy_service/src/sources/mongodb/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// RunPairsOrder starts a pairs trade runtime for the strategy with given interfaces to market data and trading API.
+func RunPairsOrder(strategy *Strategy, df interfaces.IDataFeed, td interfaces.ITrading, st interfaces.IStatsClient, keyId *primitive.ObjectID) interfaces.IStrategyRuntime {
+	if strategy.Model.State == nil {
+		strategy.Model.State = &models.MongoStrategyState{}
+	}
+	if strategy.Model.Conditions.Pairs == nil || strategy.Model.Conditions.Pairs.SecondPair == "" || keyId == nil {
+		strategy.Log.Error("pairs conditions or key not specified")
+		strategy.Model.State.State = pairs_order.Error
+		strategy.Model.State.Msg = "pairs conditions or key not specified"
+		strategy.StateMgmt.UpdateState(strategy.Model.ID, strategy.Model.State)
+		strategy.StateMgmt.DisableStrategy(strategy.Model.ID)
+		return nil
+	}
+	runtime := pairs_order.New(strategy, df, td, st, keyId, strategy.StateMgmt)
+	go runtime.Start()
+
+	return runtime
+}
@@ -0,0 +1,242 @@
+package pairs_order
+
+import (
+	"context"
+	"math"
+	"reflect"
+	"time"
+
+	"github.com/qmuntal/stateless"
+	"gitlab.com/crypto_project/core/strategy_service/src/service/interfaces"
+	"gitlab.com/crypto_project/core/strategy_service/src/service/strategies/legs"
+	"gitlab.com/crypto_project/core/strategy_service/src/sources/mongodb/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.uber.org/zap"
+)
+
+const (
+	WaitForEntry  = "WaitForEntry"
+	WaitEntryLegs = "WaitEntryLegs"
+	InEntry       = "InEntry"
+	WaitExitLegs  = "WaitExitLegs"
+	End           = legs.End
+	Canceled      = legs.Canceled
+	Error         = legs.Error
+)
+
+const (
+	TriggerTrade        = "Trade"
+	CheckExistingOrders = legs.CheckExistingOrders
+)
+
+// Defaults for pairs conditions not set.
+const (
+	defaultWindow       = 60
+	defaultSamplePeriod = 60
+	defaultLegTimeout   = 30
+	loopPeriod          = 500 * time.Millisecond
+)
+
+// A PairsOrder trades two correlated symbols by the ratio of their prices deviation from the rolling mean.
+type PairsOrder struct {
+	legs.Runtime
+	Stats            RollingStats
+	LastSampleAt     int64
+	AmountPrecisions map[string]int64 // by leg pair
+}
+
+// New instantiates pairs order runtime with the strategy given.
+func New(strategy interfaces.IStrategy, DataFeed interfaces.IDataFeed, TradingAPI interfaces.ITrading, Statsd interfaces.IStatsClient, keyId *primitive.ObjectID, stateMgmt interfaces.IStateMgmt) *PairsOrder {
+	model := strategy.GetModel()
+	pairs := model.Conditions.Pairs
+	if pairs.Window == 0 {
+		pairs.Window = defaultWindow
+	}
+	if pairs.SamplePeriod == 0 {
+		pairs.SamplePeriod = defaultSamplePeriod
+	}
+	if pairs.LegTimeout == 0 {
+		pairs.LegTimeout = defaultLegTimeout
+	}
+	po := &PairsOrder{
+		Runtime: legs.Runtime{
+			Strategy:    strategy,
+			DataFeed:    DataFeed,
+			ExchangeApi: TradingAPI,
+			Statsd:      Statsd,
+			KeyId:       keyId,
+			StateMgmt:   stateMgmt,
+			Name:        "pairs_order",
+			LoopPeriod:  loopPeriod,
+			ExitState:   WaitExitLegs,
+		},
+		Stats:            RollingStats{Window: pairs.Window, Values: model.State.RatioWindow},
+		AmountPrecisions: map[string]int64{},
+	}
+	po.Loop = func() { po.processEventLoop(time.Now().Unix()) }
+	po.LegTimeout = func() int64 { return po.Strategy.GetModel().Conditions.Pairs.LegTimeout }
+	po.AmountPrecision = func(leg *models.MongoLeg) int64 { return po.AmountPrecisions[leg.Pair] }
+	po.OnStop = po.CloseLegs
+	for _, pair := range []string{model.Conditions.Pair, pairs.SecondPair} {
+		_, amountPrecision := stateMgmt.GetMarketPrecision(pair, model.Conditions.MarketType)
+		po.AmountPrecisions[pair] = amountPrecision
+	}
+
+	State := po.NewStateMachine(legs.InitState(model, WaitForEntry))
+	State.SetTriggerParameters(TriggerTrade, reflect.TypeOf(0.0))
+
+	/*
+		Pairs order life cycle:
+			1) wait for the ratio z-score to deviate by entry deviation
+			2) buy undervalued leg and sell overvalued one, wait for both legs filled or unwind imbalance
+			3) wait for the ratio to revert to mean or stop deviation
+			4) close both legs and end or start over if continue if ended set
+	*/
+
+	State.Configure(WaitForEntry).
+		Permit(TriggerTrade, WaitEntryLegs, po.checkEntry)
+
+	State.Configure(WaitEntryLegs).
+		PermitDynamic(CheckExistingOrders, po.exitEntryLegs, po.CheckLegsDone).
+		OnEntryFrom(TriggerTrade, po.enterEntryLegs)
+
+	State.Configure(InEntry).
+		Permit(TriggerTrade, WaitExitLegs, po.checkExit)
+
+	State.Configure(WaitExitLegs).
+		PermitDynamic(CheckExistingOrders, po.exitExitLegs, po.CheckLegsDone).
+		OnEntry(po.enterExitLegs)
+
+	State.Configure(End)
+	State.Configure(Error)
+
+	_ = State.Activate()
+	po.RestoreOrders()
+	return po
+}
+
+// processEventLoop samples the ratio of legs prices and supplies its z-score for state transition attempt.
+func (po *PairsOrder) processEventLoop(now int64) {
+	model := po.Strategy.GetModel()
+	first := po.DataFeed.GetPriceForPairAtExchange(model.Conditions.Pair, model.Conditions.Exchange, model.Conditions.MarketType)
+	second := po.DataFeed.GetPriceForPairAtExchange(model.Conditions.Pairs.SecondPair, model.Conditions.Exchange, model.Conditions.MarketType)
+	if first == nil || second == nil || second.Close == 0 {
+		return
+	}
+	ratio := first.Close / second.Close
+
+	po.Lock()
+	defer po.Unlock()
+	if now-po.LastSampleAt >= model.Conditions.Pairs.SamplePeriod {
+		po.Stats.Add(ratio)
+		po.LastSampleAt = now
+		model.State.RatioWindow = po.Stats.Values
+	}
+	if !po.Stats.Ready() {
+		return
+	}
+	_ = po.State.Fire(TriggerTrade, po.Stats.ZScore(ratio))
+}
+
+// checkEntry is a guard returns true if the ratio deviated enough to enter.
+func (po *PairsOrder) checkEntry(ctx context.Context, args ...interface{}) bool {
+	z := args[0].(float64)
+	deviation := po.Strategy.GetModel().Conditions.Pairs.EntryDeviation
+	return deviation > 0 && math.Abs(z) >= deviation
+}
+
+// enterEntryLegs buys the undervalued leg and sells the overvalued one.
+func (po *PairsOrder) enterEntryLegs(ctx context.Context, args ...interface{}) error {
+	z := args[0].(float64)
+	model := po.Strategy.GetModel()
+	firstSide := "buy" // the ratio is low so the first leg is cheap
+	if z > 0 {
+		firstSide = "sell"
+	}
+	model.State.Legs = []*models.MongoLeg{{
+		Pair:       model.Conditions.Pair,
+		Exchange:   model.Conditions.Exchange,
+		MarketType: model.Conditions.MarketType,
+		Side:       firstSide,
+		Amount:     model.Conditions.Pairs.Amount,
+	}, {
+		Pair:       model.Conditions.Pairs.SecondPair,
+		Exchange:   model.Conditions.Exchange,
+		MarketType: model.Conditions.MarketType,
+		Side:       legs.OppositeSide(firstSide),
+		Amount:     model.Conditions.Pairs.SecondAmount,
+	}}
+	po.Strategy.GetLogger().Info("entering pairs",
+		zap.Float64("z-score", z),
+		zap.String("first leg side", firstSide),
+	)
+	po.EnterLegs(WaitEntryLegs)
+	return nil
+}
+
+// exitEntryLegs unwinds legs imbalance if any and selects the next state.
+func (po *PairsOrder) exitEntryLegs(ctx context.Context, args ...interface{}) (stateless.State, error) {
+	model := po.Strategy.GetModel()
+	fraction, err := po.UnwindImbalance(true)
+	if err != nil {
+		model.State.Msg = err.Error()
+		return Error, nil
+	}
+	if fraction == 0 {
+		model.State.Legs = nil
+		if model.State.Msg == "" {
+			model.State.Msg = "legs not filled"
+		}
+		return po.Retry(WaitForEntry), nil
+	}
+	model.State.Msg = ""
+	return InEntry, nil
+}
+
+// checkExit is a guard returns true if the ratio reverted to mean or went to stop.
+func (po *PairsOrder) checkExit(ctx context.Context, args ...interface{}) bool {
+	z := args[0].(float64)
+	model := po.Strategy.GetModel()
+	pairs := model.Conditions.Pairs
+	if len(model.State.Legs) == 0 {
+		return true
+	}
+	sign := 1.0 // first leg bought at negative z-score
+	if model.State.Legs[0].Side == "sell" {
+		sign = -1.0
+	}
+	if sign*z >= -pairs.ExitDeviation {
+		po.Strategy.GetLogger().Info("pairs ratio reverted", zap.Float64("z-score", z))
+		return true
+	}
+	if pairs.StopDeviation > 0 && sign*z <= -pairs.StopDeviation {
+		po.Strategy.GetLogger().Info("pairs ratio stop", zap.Float64("z-score", z))
+		po.Statsd.Inc("pairs_order.stop")
+		return true
+	}
+	return false
+}
+
+// enterExitLegs places orders to close legs amount not closed yet.
+func (po *PairsOrder) enterExitLegs(ctx context.Context, args ...interface{}) error {
+	po.ExitLegs(WaitExitLegs)
+	return nil
+}
+
+// exitExitLegs retries to close legs not closed or ends the round.
+func (po *PairsOrder) exitExitLegs(ctx context.Context, args ...interface{}) (stateless.State, error) {
+	model := po.Strategy.GetModel()
+	if !po.LegsClosed() {
+		po.Statsd.Inc("pairs_order.exit_retry")
+		return WaitExitLegs, nil
+	}
+	pnl := legs.PNL(model.State.Legs)
+	model.State.ReceivedProfitAmount += pnl
+	po.Strategy.GetLogger().Info("pairs closed", zap.Float64("pnl", pnl))
+	if model.Conditions.ContinueIfEnded {
+		model.State.Legs = nil
+		model.State.Iteration += 1
+		return WaitForEntry, nil
+	}
+	return End, nil
+}
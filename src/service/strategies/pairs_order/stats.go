@@ -0,0 +1,56 @@
+package pairs_order
+
+import "math"
+
+// A RollingStats keeps the last Window samples to calculate mean and standard deviation over them.
+type RollingStats struct {
+	Window int
+	Values []float64
+}
+
+// Add appends the value dropping the oldest one if window is full.
+func (rs *RollingStats) Add(value float64) {
+	rs.Values = append(rs.Values, value)
+	if len(rs.Values) > rs.Window {
+		rs.Values = rs.Values[len(rs.Values)-rs.Window:]
+	}
+}
+
+// Ready returns true if the window is full.
+func (rs *RollingStats) Ready() bool {
+	return rs.Window > 1 && len(rs.Values) >= rs.Window
+}
+
+// Mean returns arithmetic mean of the samples.
+func (rs *RollingStats) Mean() float64 {
+	if len(rs.Values) == 0 {
+		return 0
+	}
+	sum := 0.0
+	for _, value := range rs.Values {
+		sum += value
+	}
+	return sum / float64(len(rs.Values))
+}
+
+// Std returns population standard deviation of the samples.
+func (rs *RollingStats) Std() float64 {
+	if len(rs.Values) == 0 {
+		return 0
+	}
+	mean := rs.Mean()
+	sum := 0.0
+	for _, value := range rs.Values {
+		sum += (value - mean) * (value - mean)
+	}
+	return math.Sqrt(sum / float64(len(rs.Values)))
+}
+
+// ZScore returns how much standard deviations the value is away from the mean, 0 if deviation is 0.
+func (rs *RollingStats) ZScore(value float64) float64 {
+	std := rs.Std()
+	if std == 0 {
+		return 0
+	}
+	return (value - rs.Mean()) / std
+}
@@ -0,0 +1,34 @@
+package strategies
+
+import (
+	"gitlab.com/crypto_project/core/strategy_service/src/service/interfaces"
+	"gitlab.com/crypto_project/core/strategy_service/src/service/strategies/rebalance_order"
+	"gitlab.com/crypto_project/core/strategy_service/src/sources/mongodb/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.uber.org/zap"
+)
+
+// RunRebalanceOrder starts a portfolio rebalancing runtime for the strategy with given interfaces to market data and trading API.
+func RunRebalanceOrder(strategy *Strategy, df interfaces.IDataFeed, td interfaces.ITrading, st interfaces.IStatsClient, keyId *primitive.ObjectID) interfaces.IStrategyRuntime {
+	if strategy.Model.State == nil {
+		strategy.Model.State = &models.MongoStrategyState{}
+	}
+	msg := ""
+	if rebalance := strategy.Model.Conditions.Rebalance; rebalance == nil || keyId == nil {
+		msg = "rebalance conditions or key not specified"
+	} else if err := rebalance_order.ValidateTargets(rebalance.Targets); err != nil {
+		msg = err.Error()
+	}
+	if msg != "" {
+		strategy.Log.Error("can't run rebalance order", zap.String("msg", msg))
+		strategy.Model.State.State = rebalance_order.Error
+		strategy.Model.State.Msg = msg
+		strategy.StateMgmt.UpdateState(strategy.Model.ID, strategy.Model.State)
+		strategy.StateMgmt.DisableStrategy(strategy.Model.ID)
+		return nil
+	}
+	runtime := rebalance_order.New(strategy, df, td, st, keyId, strategy.StateMgmt)
+	go runtime.Start()
+
+	return runtime
+}
@@ -0,0 +1,107 @@
+package rebalance_order
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"gitlab.com/crypto_project/core/strategy_service/src/sources/mongodb/models"
+)
+
+// Weights returns weights of target assets in percents of their total value in quote asset, and the total value.
+// Prices are in quote asset, the quote asset itself is priced at 1 if not given.
+func Weights(targets []*models.MongoRebalanceTarget, quoteAsset string, balances, prices map[string]float64) (map[string]float64, float64) {
+	values := map[string]float64{}
+	total := 0.0
+	for _, target := range targets {
+		price, ok := prices[target.Asset]
+		if !ok && target.Asset == quoteAsset {
+			price = 1
+		}
+		values[target.Asset] = balances[target.Asset] * price
+		total += values[target.Asset]
+	}
+	weights := map[string]float64{}
+	for asset, value := range values {
+		if total > 0 {
+			weights[asset] = value / total * 100
+		}
+	}
+	return weights, total
+}
+
+// Drift returns the largest absolute difference of asset weight from its target weight in percentage points.
+func Drift(targets []*models.MongoRebalanceTarget, weights map[string]float64) float64 {
+	drift := 0.0
+	for _, target := range targets {
+		drift = math.Max(drift, math.Abs(weights[target.Asset]-target.Weight))
+	}
+	return drift
+}
+
+// Plan returns legs trading target assets against quote asset to bring their values to target weights of the total
+// value. Trades less than min notional are skipped. Sells go first to free quote asset for buys.
+func Plan(targets []*models.MongoRebalanceTarget, quoteAsset string, balances, prices map[string]float64, total, minNotional float64) []*models.MongoLeg {
+	var plan []*models.MongoLeg
+	for _, target := range targets {
+		price := prices[target.Asset]
+		if target.Asset == quoteAsset || price <= 0 {
+			continue
+		}
+		diff := target.Weight/100*total - balances[target.Asset]*price
+		if diff == 0 || math.Abs(diff) < minNotional {
+			continue
+		}
+		side := "buy"
+		if diff < 0 {
+			side = "sell"
+		}
+		plan = append(plan, &models.MongoLeg{
+			Pair:   target.Asset + "_" + quoteAsset,
+			Side:   side,
+			Amount: math.Abs(diff) / price,
+		})
+	}
+	sort.SliceStable(plan, func(i, j int) bool {
+		return plan[i].Side == "sell" && plan[j].Side == "buy"
+	})
+	return plan
+}
+
+// SliceAmount returns amount of the next twap slice splitting remaining amount evenly between slices left, but not
+// less than min notional at the price given. It returns 0 if the remaining amount is below min notional.
+func SliceAmount(remaining float64, slicesLeft int64, price, minNotional float64) float64 {
+	if remaining <= 0 || remaining*price < minNotional {
+		return 0
+	}
+	if slicesLeft <= 1 {
+		return remaining
+	}
+	amount := remaining / float64(slicesLeft)
+	if amount*price < minNotional {
+		amount = minNotional / price
+	}
+	if remaining-amount < minNotional/price { // the rest would be too small to trade
+		return remaining
+	}
+	return amount
+}
+
+// ValidateTargets returns an error if target weights don't sum up to 100 percents or an asset repeats.
+func ValidateTargets(targets []*models.MongoRebalanceTarget) error {
+	sum := 0.0
+	seen := map[string]bool{}
+	for _, target := range targets {
+		asset := strings.ToUpper(target.Asset)
+		if asset == "" || target.Weight < 0 || seen[asset] {
+			return fmt.Errorf("bad target %v %v", target.Asset, target.Weight)
+		}
+		seen[asset] = true
+		sum += target.Weight
+	}
+	if sum < 99.99 || sum > 100.01 {
+		return fmt.Errorf("target weights sum up to %v", sum)
+	}
+	return nil
+}
@@ -0,0 +1,339 @@
+package rebalance_order
+
+import (
+	"context"
+	"reflect"
+	"time"
+
+	"gitlab.com/crypto_project/core/strategy_service/src/service/interfaces"
+	"gitlab.com/crypto_project/core/strategy_service/src/service/strategies/legs"
+	"gitlab.com/crypto_project/core/strategy_service/src/sources/mongodb/models"
+	"gitlab.com/crypto_project/core/strategy_service/src/trading/orders"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.uber.org/zap"
+)
+
+const (
+	WaitForRebalance = "WaitForRebalance"
+	Rebalancing      = "Rebalancing"
+	Canceled         = legs.Canceled
+	Error            = legs.Error
+)
+
+const (
+	TriggerCheck = "Check"
+)
+
+// Execution of child orders.
+const (
+	ExecutionTwap      = "twap"
+	ExecutionMakerOnly = "maker-only"
+)
+
+// Defaults for rebalance conditions not set.
+const (
+	defaultQuoteAsset   = "USDT"
+	defaultMinNotional  = 10
+	defaultTwapSlices   = 5
+	defaultTwapInterval = 60
+	balancesCheckPeriod = 10 * time.Second
+	loopPeriod          = 1 * time.Second
+)
+
+// A RebalanceOrder keeps spot assets of the key at target weights of the portfolio value trading them against the
+// quote asset with twap or maker-only child orders.
+type RebalanceOrder struct {
+	legs.Runtime
+	AmountPrecisions map[string]int64   // by pair
+	checkedAt        time.Time          // balances read last time
+	plan             []*models.MongoLeg // trades planned by the check to rebalance with
+}
+
+// New instantiates rebalance order runtime with the strategy given.
+func New(strategy interfaces.IStrategy, DataFeed interfaces.IDataFeed, TradingAPI interfaces.ITrading, Statsd interfaces.IStatsClient, keyId *primitive.ObjectID, stateMgmt interfaces.IStateMgmt) *RebalanceOrder {
+	model := strategy.GetModel()
+	ro := &RebalanceOrder{
+		Runtime: legs.Runtime{
+			Strategy:    strategy,
+			DataFeed:    DataFeed,
+			ExchangeApi: TradingAPI,
+			Statsd:      Statsd,
+			KeyId:       keyId,
+			StateMgmt:   stateMgmt,
+			Name:        "rebalance_order",
+			LoopPeriod:  loopPeriod,
+		},
+		AmountPrecisions: map[string]int64{},
+	}
+	ro.Loop = func() { ro.processEventLoop(time.Now()) }
+	ro.AmountPrecision = func(leg *models.MongoLeg) int64 { return ro.amountPrecision(leg.Pair) }
+	ro.OnOrder = ro.fillOrder // legs are resolved by the event loop, child orders are accounted only
+
+	State := ro.NewStateMachine(legs.InitState(model, WaitForRebalance))
+	State.SetTriggerParameters(TriggerCheck, reflect.TypeOf(time.Time{}))
+
+	/*
+		Rebalance order life cycle:
+			1) read balances and prices, wait for the schedule or weights drifted farther than the band
+			2) sell assets above target weights, then buy the ones below with twap slices or maker-only orders
+			3) wait for the schedule again once all the trades done
+	*/
+
+	State.Configure(WaitForRebalance).
+		Permit(TriggerCheck, Rebalancing, ro.checkRebalance).
+		OnEntryFrom(TriggerCheck, ro.exitRebalancing)
+
+	State.Configure(Rebalancing).
+		Permit(TriggerCheck, WaitForRebalance, ro.checkRebalanced).
+		OnEntryFrom(TriggerCheck, ro.enterRebalancing)
+
+	State.Configure(Error)
+
+	_ = State.Activate()
+	ro.RestoreOrders()
+	return ro
+}
+
+// conditions returns rebalance conditions with defaults for the ones not set, conditions may be reloaded any time.
+func (ro *RebalanceOrder) conditions() models.MongoRebalanceConditions {
+	conditions := *ro.Strategy.GetModel().Conditions.Rebalance
+	if conditions.QuoteAsset == "" {
+		conditions.QuoteAsset = defaultQuoteAsset
+	}
+	if conditions.MinNotional == 0 {
+		conditions.MinNotional = defaultMinNotional
+	}
+	if conditions.Execution == "" {
+		conditions.Execution = ExecutionTwap
+	}
+	if conditions.Execution == ExecutionMakerOnly {
+		conditions.TwapSlices = 1 // a single order for a leg, placed again if canceled not filled
+	} else if conditions.TwapSlices == 0 {
+		conditions.TwapSlices = defaultTwapSlices
+	}
+	if conditions.TwapInterval == 0 {
+		conditions.TwapInterval = defaultTwapInterval
+	}
+	return conditions
+}
+
+// processEventLoop places child orders due while rebalancing and supplies the time for state transition attempt.
+func (ro *RebalanceOrder) processEventLoop(now time.Time) {
+	ro.Lock()
+	defer ro.Unlock()
+	model := ro.Strategy.GetModel()
+	state := ro.CurrentState()
+	if state == Rebalancing {
+		ro.placeSlices(now)
+	}
+	_ = ro.State.Fire(TriggerCheck, now)
+	if newState := ro.CurrentState(); newState != state {
+		model.State.State = newState
+		ro.StateMgmt.UpdateStrategyState(model.ID, model.State)
+	}
+}
+
+// checkRebalance is a guard returns true if rebalance is scheduled by now or weights drifted farther than the band,
+// and there is something to trade. Balances are read once in a while only.
+func (ro *RebalanceOrder) checkRebalance(ctx context.Context, args ...interface{}) bool {
+	now := args[0].(time.Time)
+	if now.Sub(ro.checkedAt) < balancesCheckPeriod {
+		return false
+	}
+	ro.checkedAt = now
+	model := ro.Strategy.GetModel()
+	conditions := ro.conditions()
+	if len(conditions.Targets) == 0 {
+		return false
+	}
+	prices := map[string]float64{conditions.QuoteAsset: 1}
+	for _, target := range conditions.Targets {
+		if target.Asset == conditions.QuoteAsset {
+			continue
+		}
+		ohlcv := ro.DataFeed.GetPriceForPairAtExchange(target.Asset+"_"+conditions.QuoteAsset, model.Conditions.Exchange, 0)
+		if ohlcv == nil || ohlcv.Close <= 0 {
+			return false // can't value the portfolio
+		}
+		prices[target.Asset] = ohlcv.Close
+	}
+	balances := ro.StateMgmt.GetKeyBalances(ro.KeyId)
+	if balances == nil {
+		return false
+	}
+	weights, total := Weights(conditions.Targets, conditions.QuoteAsset, balances, prices)
+	model.State.RebalanceDrift = Drift(conditions.Targets, weights)
+	isScheduled := conditions.Period > 0 && now.Unix()-model.State.RebalancedAt >= conditions.Period
+	isDrifted := conditions.Band > 0 && model.State.RebalanceDrift >= conditions.Band
+	if !isScheduled && !isDrifted {
+		return false
+	}
+	ro.plan = nil
+	for _, leg := range Plan(conditions.Targets, conditions.QuoteAsset, balances, prices, total, conditions.MinNotional) {
+		leg.Amount = legs.FloorAmount(leg.Amount, ro.amountPrecision(leg.Pair))
+		if leg.Amount > 0 {
+			leg.Exchange = model.Conditions.Exchange
+			ro.plan = append(ro.plan, leg)
+		}
+	}
+	if len(ro.plan) == 0 {
+		model.State.RebalancedAt = now.Unix() // already balanced
+		ro.StateMgmt.UpdateStrategyState(model.ID, model.State)
+		return false
+	}
+	ro.Strategy.GetLogger().Info("rebalancing",
+		zap.Float64("drift", model.State.RebalanceDrift),
+		zap.Float64("total", total),
+		zap.Bool("scheduled", isScheduled),
+		zap.Int("trades", len(ro.plan)),
+	)
+	return true
+}
+
+// enterRebalancing takes trades planned as legs of the round.
+func (ro *RebalanceOrder) enterRebalancing(ctx context.Context, args ...interface{}) error {
+	model := ro.Strategy.GetModel()
+	model.State.Legs = ro.plan
+	model.State.RebalanceSliceAt = 0
+	model.State.Msg = ""
+	ro.plan = nil
+	ro.Statsd.Inc("rebalance_order.rebalance")
+	return nil
+}
+
+// checkRebalanced is a guard returns true if all the legs are done.
+func (ro *RebalanceOrder) checkRebalanced(ctx context.Context, args ...interface{}) bool {
+	for _, leg := range ro.Strategy.GetModel().State.Legs {
+		if !ro.isLegDone(leg) {
+			return false
+		}
+	}
+	return true
+}
+
+// exitRebalancing marks the round done.
+func (ro *RebalanceOrder) exitRebalancing(ctx context.Context, args ...interface{}) error {
+	now := args[0].(time.Time)
+	model := ro.Strategy.GetModel()
+	model.State.RebalancedAt = now.Unix()
+	model.State.Iteration += 1
+	ro.Strategy.GetLogger().Info("rebalanced", zap.Int("iteration", model.State.Iteration))
+	ro.checkedAt = time.Time{} // measure the drift left
+	return nil
+}
+
+// isLegDone returns true if the leg waits for no order and its amount not filled yet can't be traded.
+func (ro *RebalanceOrder) isLegDone(leg *models.MongoLeg) bool {
+	return leg.OrderId == "" && legs.FloorAmount(leg.Amount-leg.Filled, ro.amountPrecision(leg.Pair)) <= 0
+}
+
+// placeSlices places the next child order for each leg of the current phase not waiting for an order, once due.
+// Sells go before buys to free quote asset. Legs are given up after twice as much orders as slices, e.g. if orders
+// are rejected, and so are remainders less than min notional.
+func (ro *RebalanceOrder) placeSlices(now time.Time) {
+	model := ro.Strategy.GetModel()
+	if now.Unix() < model.State.RebalanceSliceAt {
+		return
+	}
+	conditions := ro.conditions()
+	var phase []*models.MongoLeg
+	for _, side := range []string{"sell", "buy"} {
+		for _, leg := range model.State.Legs {
+			if leg.Side == side && !ro.isLegDone(leg) {
+				phase = append(phase, leg)
+			}
+		}
+		if len(phase) > 0 {
+			break
+		}
+	}
+	for _, leg := range phase {
+		if leg.OrderId != "" {
+			continue
+		}
+		ohlcv := ro.DataFeed.GetPriceForPairAtExchange(leg.Pair, leg.Exchange, 0)
+		if ohlcv == nil {
+			continue // wait for the price
+		}
+		remaining := leg.Amount - leg.Filled
+		amount := 0.0
+		if leg.Orders < 2*conditions.TwapSlices {
+			amount = SliceAmount(remaining, conditions.TwapSlices-leg.Orders, ohlcv.Close, conditions.MinNotional)
+			amount = legs.FloorAmount(amount, ro.amountPrecision(leg.Pair))
+		}
+		if amount <= 0 {
+			ro.Strategy.GetLogger().Warn("giving up rebalance leg",
+				zap.String("pair", leg.Pair),
+				zap.Float64("remaining", remaining),
+				zap.Int64("orders", leg.Orders),
+			)
+			leg.Amount = leg.Filled
+			continue
+		}
+		leg.Orders += 1
+		leg.OrderId = ro.placeLegOrder(leg, amount, conditions.Execution)
+	}
+	model.State.RebalanceSliceAt = now.Unix() + conditions.TwapInterval
+	ro.StateMgmt.UpdateStrategyState(model.ID, model.State)
+}
+
+// placeLegOrder places market order or maker-only order for the leg and returns the order id, empty if failed.
+func (ro *RebalanceOrder) placeLegOrder(leg *models.MongoLeg, amount float64, execution string) string {
+	var response orders.OrderResponse
+	if execution == ExecutionMakerOnly {
+		reduceOnly := false
+		model := ro.Strategy.GetModel()
+		response = ro.Strategy.GetSingleton().CreateOrder(orders.CreateOrderRequest{
+			KeyId:    ro.KeyId,
+			OwnerId:  &model.OwnerId,
+			ParentId: model.ID,
+			KeyParams: orders.Order{
+				Symbol:       leg.Pair,
+				MarketType:   0,
+				Side:         leg.Side,
+				Amount:       amount,
+				ReduceOnly:   &reduceOnly,
+				Type:         ExecutionMakerOnly,
+				PositionSide: "BOTH",
+			},
+		})
+	} else {
+		response = legs.PlaceOrder(ro.ExchangeApi, ro.KeyId, leg, leg.Side, amount, false)
+	}
+	if response.Status != "OK" || response.Data.OrderId == "" {
+		ro.Strategy.GetLogger().Error("can't place rebalance order",
+			zap.String("pair", leg.Pair),
+			zap.String("side", leg.Side),
+			zap.Float64("amount", amount),
+			zap.String("msg", response.Data.Msg),
+		)
+		ro.Strategy.GetModel().State.Msg = response.Data.Msg
+		ro.Statsd.Inc("rebalance_order.order_error")
+		return ""
+	}
+	orderType := "market"
+	if execution == ExecutionMakerOnly {
+		orderType = ExecutionMakerOnly
+	}
+	ro.Strategy.GetJournal().OrderPlaced(response.Data.OrderId, ro.CurrentState(), leg.Side, orderType, amount, 0)
+	ro.WaitForOrder(response.Data.OrderId)
+	return response.Data.OrderId
+}
+
+// amountPrecision returns amount precision of the spot pair.
+func (ro *RebalanceOrder) amountPrecision(pair string) int64 {
+	precision, ok := ro.AmountPrecisions[pair]
+	if !ok {
+		_, precision = ro.StateMgmt.GetMarketPrecision(pair, 0)
+		ro.AmountPrecisions[pair] = precision
+	}
+	return precision
+}
+
+// fillOrder accounts child order executed.
+func (ro *RebalanceOrder) fillOrder(order models.MongoOrder) {
+	model := ro.Strategy.GetModel()
+	if legs.Fill(model.State.Legs, order, false) {
+		ro.StateMgmt.UpdateStrategyState(model.ID, model.State)
+	}
+}
@@ -32,9 +32,9 @@ func (sm *SmartOrder) placeMultiEntryOrders(stopLoss bool) {
 		} else {
 			currentAmount = model.Conditions.EntryOrder.Amount / 100 * target.Amount
 			if model.Conditions.EntryOrder.Side == "buy" {
-				currentPrice = currentPrice * (100 - target.Price/model.Conditions.Leverage) / 100
+				currentPrice = currentPrice * (100 - target.Price/sm.leverage()) / 100
 			} else {
-				currentPrice = currentPrice * (100 + target.Price/model.Conditions.Leverage) / 100
+				currentPrice = currentPrice * (100 + target.Price/sm.leverage()) / 100
 			}
 		}
 
@@ -130,9 +130,9 @@ func (sm *SmartOrder) getLastTargetPrice(model *models.MongoStrategy) float64 {
 				currentPrice = target.Price
 			} else {
 				if model.Conditions.EntryOrder.Side == "buy" {
-					currentPrice = currentPrice * (100 - target.Price/model.Conditions.Leverage) / 100
+					currentPrice = currentPrice * (100 - target.Price/sm.leverage()) / 100
 				} else {
-					currentPrice = currentPrice * (100 + target.Price/model.Conditions.Leverage) / 100
+					currentPrice = currentPrice * (100 + target.Price/sm.leverage()) / 100
 				}
 			}
 		}
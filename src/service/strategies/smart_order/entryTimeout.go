@@ -95,9 +95,9 @@ func (sm *SmartOrder) checkTimeouts() {
 					activatePrice := sm.Strategy.GetModel().Conditions.EntryOrder.ActivatePrice
 					side := sm.Strategy.GetModel().Conditions.EntryOrder.Side
 					if side == "sell" {
-						activatePrice = activatePrice * (1 - sm.Strategy.GetModel().Conditions.ActivationMoveStep/100/sm.Strategy.GetModel().Conditions.Leverage)
+						activatePrice = activatePrice * (1 - sm.Strategy.GetModel().Conditions.ActivationMoveStep/100/sm.leverage())
 					} else {
-						activatePrice = activatePrice * (1 + sm.Strategy.GetModel().Conditions.ActivationMoveStep/100/sm.Strategy.GetModel().Conditions.Leverage)
+						activatePrice = activatePrice * (1 + sm.Strategy.GetModel().Conditions.ActivationMoveStep/100/sm.leverage())
 					}
 					sm.Strategy.GetLogger().Info("changed activate price",
 						zap.Float64("from", sm.Strategy.GetModel().Conditions.EntryOrder.ActivatePrice),
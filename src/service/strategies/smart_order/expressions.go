@@ -0,0 +1,147 @@
+package smart_order
+
+import (
+	"fmt"
+
+	"gitlab.com/crypto_project/core/strategy_service/src/service/expressions"
+	"gitlab.com/crypto_project/core/strategy_service/src/service/indicators"
+	"gitlab.com/crypto_project/core/strategy_service/src/service/interfaces"
+	"gitlab.com/crypto_project/core/strategy_service/src/sources/mongodb/models"
+	"go.uber.org/zap"
+)
+
+// defaultExpressionTimeframe is used for indicators called in expressions without timeframe.
+const defaultExpressionTimeframe = "1h"
+
+// ExpressionVariables are variables available in condition expressions:
+//
+//	open, high, low, close, volume - the current price tick
+//	bid, ask, spread_pct           - the best prices and spread relative to the mid price in percents
+//	entry_price, profit_pct        - the position entry price and profit with leverage in percents, zero before entry
+//	executed_amount                - the amount exited already
+var ExpressionVariables = []string{
+	"open", "high", "low", "close", "volume",
+	"bid", "ask", "spread_pct",
+	"entry_price", "profit_pct",
+	"executed_amount",
+}
+
+// ValidateConditions returns an error telling why the smart order of the model can't start, e.g. an expression or
+// schedule given is invalid, to reject the strategy before it's started.
+func ValidateConditions(model *models.MongoStrategy) error {
+	if model.Conditions == nil {
+		return nil
+	}
+	if err := (&SmartOrder{}).compileExpressions(model.Conditions); err != nil {
+		return err
+	}
+	_, err := NewSchedule(model.Conditions.Schedule, model.Expiration)
+	return err
+}
+
+// compileExpressions parses and validates condition expressions of the strategy.
+func (sm *SmartOrder) compileExpressions(conditions *models.MongoStrategyCondition) error {
+	for _, expression := range []struct {
+		source string
+		target **expressions.Expression
+	}{
+		{conditions.EntryExpression, &sm.EntryExpression},
+		{conditions.TakeProfitExpression, &sm.TakeProfitExpression},
+		{conditions.StopLossExpression, &sm.StopLossExpression},
+	} {
+		if expression.source == "" {
+			continue
+		}
+		compiled, err := expressions.Compile(expression.source, ExpressionVariables)
+		if err != nil {
+			return fmt.Errorf("invalid expression %q: %v", expression.source, err)
+		}
+		*expression.target = compiled
+	}
+	return nil
+}
+
+// holds returns true if the expression holds on the price tick, a nil expression always holds.
+// An expression with indicators not ready yet or with data missing doesn't hold.
+func (sm *SmartOrder) holds(expression *expressions.Expression, ohlcv interfaces.OHLCV) bool {
+	if expression == nil {
+		return true
+	}
+	held, err := expression.Evaluate(&expressionEnv{sm: sm, ohlcv: ohlcv})
+	if err == expressions.ErrNotReady {
+		return false
+	}
+	if err != nil {
+		sm.Strategy.GetLogger().Error("can't evaluate expression",
+			zap.String("expression", expression.Source),
+			zap.Error(err),
+		)
+		sm.Statsd.Inc("smart_order.expression_error")
+		return false
+	}
+	return held
+}
+
+// expressionEnv provides values of the smart order to evaluate expressions, spread is requested once needed.
+type expressionEnv struct {
+	sm     *SmartOrder
+	ohlcv  interfaces.OHLCV
+	spread *interfaces.SpreadData
+}
+
+func (env *expressionEnv) Variable(name string) (float64, error) {
+	model := env.sm.Strategy.GetModel()
+	switch name {
+	case "open":
+		return env.ohlcv.Open, nil
+	case "high":
+		return env.ohlcv.High, nil
+	case "low":
+		return env.ohlcv.Low, nil
+	case "close":
+		return env.ohlcv.Close, nil
+	case "volume":
+		return env.ohlcv.Volume, nil
+	case "bid", "ask", "spread_pct":
+		if env.spread == nil {
+			env.spread = env.sm.DataFeed.GetSpreadForPairAtExchange(model.Conditions.Pair, env.sm.ExchangeName, model.Conditions.MarketType)
+		}
+		if env.spread == nil || env.spread.BestBid <= 0 || env.spread.BestAsk <= 0 {
+			return 0, expressions.ErrNotReady
+		}
+		switch name {
+		case "bid":
+			return env.spread.BestBid, nil
+		case "ask":
+			return env.spread.BestAsk, nil
+		}
+		mid := (env.spread.BestAsk + env.spread.BestBid) / 2
+		return (env.spread.BestAsk - env.spread.BestBid) / mid * 100, nil
+	case "entry_price":
+		return model.State.EntryPrice, nil
+	case "profit_pct":
+		if model.State.EntryPrice == 0 {
+			return 0, nil
+		}
+		return -StopLossPercentage(model.Conditions.EntryOrder.Side, model.State.EntryPrice, env.ohlcv.Close, env.sm.leverage()), nil
+	case "executed_amount":
+		return model.State.ExecutedAmount, nil
+	}
+	return 0, fmt.Errorf("unknown variable %q", name)
+}
+
+func (env *expressionEnv) Indicator(call expressions.Call) (float64, bool, error) {
+	model := env.sm.Strategy.GetModel()
+	timeframe := call.Timeframe
+	if timeframe == "" {
+		timeframe = defaultExpressionTimeframe
+	}
+	return indicators.GetEngine(env.sm.DataFeed).Value(indicators.Spec{
+		Name:       call.Name,
+		Params:     call.Params,
+		Pair:       model.Conditions.Pair,
+		Exchange:   env.sm.ExchangeName,
+		MarketType: model.Conditions.MarketType,
+		Timeframe:  timeframe,
+	}, call.Output)
+}
@@ -0,0 +1,50 @@
+package smart_order
+
+import (
+	"gitlab.com/crypto_project/core/strategy_service/src/service/indicators"
+	"gitlab.com/crypto_project/core/strategy_service/src/sources/mongodb/models"
+	"go.uber.org/zap"
+)
+
+// checkEntryIndicators returns true if all entry indicator conditions are met, indicators not ready yet are not met.
+func (sm *SmartOrder) checkEntryIndicators() bool {
+	model := sm.Strategy.GetModel()
+	engine := indicators.GetEngine(sm.DataFeed)
+	for _, condition := range model.Conditions.EntryIndicators {
+		value, ready, err := engine.Value(indicators.Spec{
+			Name:       condition.Indicator,
+			Params:     condition.Params,
+			Pair:       model.Conditions.Pair,
+			Exchange:   sm.ExchangeName,
+			MarketType: model.Conditions.MarketType,
+			Timeframe:  condition.Timeframe,
+		}, condition.Output)
+		if err != nil {
+			sm.Strategy.GetLogger().Error("can't evaluate entry indicator",
+				zap.String("indicator", condition.Indicator),
+				zap.Error(err),
+			)
+			sm.Statsd.Inc("smart_order.indicator_error")
+			return false
+		}
+		if !ready || !CompareIndicator(condition, value) {
+			return false
+		}
+	}
+	return true
+}
+
+// CompareIndicator returns true if the indicator value meets the condition, false for unknown operator.
+func CompareIndicator(condition *models.MongoIndicatorCondition, value float64) bool {
+	switch condition.Operator {
+	case "<":
+		return value < condition.Value
+	case "<=":
+		return value <= condition.Value
+	case ">":
+		return value > condition.Value
+	case ">=":
+		return value >= condition.Value
+	}
+	return false
+}
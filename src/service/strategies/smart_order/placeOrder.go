@@ -125,8 +125,13 @@ func (sm *SmartOrder) PlaceOrder(price, amount float64, step string) {
 		baseAmount = model.Conditions.EntryOrder.Amount - model.State.ExecutedAmount
 		side = oppositeSide
 
-		if model.Conditions.StopLossPrice > 0 {
-			orderPrice = model.Conditions.StopLossPrice
+		stopLossPrice := model.Conditions.StopLossPrice
+		if locked, ok := sm.ladderStopLoss(); ok && stopLossPrice > 0 &&
+			locked < StopLossPercentage(model.Conditions.EntryOrder.Side, model.State.EntryPrice, stopLossPrice, leverage) {
+			stopLossPrice = 0 // stop ladder locked closer
+		}
+		if stopLossPrice > 0 {
+			orderPrice = stopLossPrice
 			if isFutures {
 				orderType = prefix + model.Conditions.StopLossType
 			} else {
@@ -161,7 +166,7 @@ func (sm *SmartOrder) PlaceOrder(price, amount float64, step string) {
 		if model.Conditions.TimeoutLoss == 0 {
 			orderType = model.Conditions.StopLossType
 			isStopOrdersSupport := isFutures // || orderType == "limit"
-			stopLoss := model.Conditions.StopLoss
+			stopLoss := sm.stopLossPercentage()
 			if side == "sell" {
 				orderPrice = model.State.EntryPrice * (1 - stopLoss/100/leverage)
 			} else {
@@ -412,6 +417,9 @@ func (sm *SmartOrder) PlaceOrder(price, amount float64, step string) {
 			} else {
 				orderPrice = model.State.TrailingEntryPrice * (1 + target.EntryDeviation/100/leverage)
 			}
+			if target.TrailingMode != "" && sm.SelectedExitTarget < len(model.State.TrailingExitStops) {
+				orderPrice = model.State.TrailingExitStops[sm.SelectedExitTarget]
+			}
 			if model.Conditions.TakeProfitExternal { // TV alert?
 				orderPrice = model.Conditions.TrailingExitPrice
 			}
@@ -427,6 +435,7 @@ func (sm *SmartOrder) PlaceOrder(price, amount float64, step string) {
 		} else {
 			baseAmount = sm.getLastTargetAmount()
 		}
+		baseAmount = sm.withoutTimeExited(sm.SelectedExitTarget, baseAmount)
 
 		if len(model.Conditions.EntryLevels) > 0 {
 			baseAmount = sm.getAveragingEntryAmount(model, sm.SelectedEntryTarget)
@@ -434,6 +443,12 @@ func (sm *SmartOrder) PlaceOrder(price, amount float64, step string) {
 		//log.Print("take profit price, orderPrice in the end", price, orderPrice)
 		// model.State.ExecutedAmount += amount
 		break
+	case TimeExit:
+		reduceOnly = true
+		side = oppositeSide
+		baseAmount = amount
+		orderType = "market"
+		break
 	case Canceled:
 		currentState, _ := sm.State.State(context.TODO())
 		thereIsNoEntryToExit := (currentState == WaitForEntry && model.State.Amount == 0) || currentState == TrailingEntry ||
@@ -463,6 +478,9 @@ func (sm *SmartOrder) PlaceOrder(price, amount float64, step string) {
 		if step == TakeProfit && len(sm.Strategy.GetModel().Conditions.ExitLevels) > 1 { // split targets
 			baseAmount = baseAmount - sm.Strategy.GetModel().State.Commission*
 				sm.Strategy.GetModel().Conditions.ExitLevels[sm.SelectedExitTarget].Amount/100.0
+		} else if step == TimeExit { // part of the position
+			baseAmount = baseAmount - sm.Strategy.GetModel().State.Commission*
+				baseAmount/sm.Strategy.GetModel().Conditions.EntryOrder.Amount
 		} else {
 			baseAmount = baseAmount - sm.Strategy.GetModel().State.Commission
 		}
@@ -494,6 +512,7 @@ func (sm *SmartOrder) PlaceOrder(price, amount float64, step string) {
 		}
 		request := orders.CreateOrderRequest{
 			KeyId: sm.KeyId,
+			Exit:  reduceOnly, // set by exit and protective steps, kept in hedge mode
 			KeyParams: orders.Order{
 				Symbol:     model.Conditions.Pair,
 				MarketType: model.Conditions.MarketType,
@@ -559,6 +578,8 @@ func (sm *SmartOrder) PlaceOrder(price, amount float64, step string) {
 		)
 		var response orders.OrderResponse
 		if request.KeyParams.Type == "maker-only" {
+			request.OwnerId = &model.OwnerId
+			request.ParentId = model.ID
 			response = sm.Strategy.GetSingleton().CreateOrder(request)
 		} else {
 			response = sm.ExchangeApi.CreateOrder(request)
@@ -571,6 +592,7 @@ func (sm *SmartOrder) PlaceOrder(price, amount float64, step string) {
 		)
 		if response.Status == "OK" && response.Data.OrderId != "0" && response.Data.OrderId != "" {
 			sm.IsWaitingForOrder.Store(step, true)
+			sm.Strategy.GetJournal().OrderPlaced(response.Data.OrderId, step, side, request.KeyParams.Type, baseAmount, orderPrice)
 			if ifShouldCancelPreviousOrder {
 				// cancel existing order if there is such ( and its not TrailingEntry )
 				if len(model.State.ExecutedOrders) > 0 && step != TrailingEntry {
@@ -0,0 +1,92 @@
+package smart_order
+
+import (
+	"go.uber.org/zap"
+)
+
+// recoverOrders restores tracking of orders placed before the runtime started, e.g. by another instance or before
+// restart. Orders still open are waited for again. Orders filled or canceled while the strategy was unowned are
+// applied in the order placed. Those journaled as placed are applied unless journaled as updated, orders missing in
+// the journal, e.g. placed before journaling, are applied unless the state saved moved past the step already.
+func (sm *SmartOrder) recoverOrders() {
+	model := sm.Strategy.GetModel()
+	if model.State == nil || len(model.State.Orders) == 0 {
+		return
+	}
+	switch model.State.State {
+	case "", End, Canceled, Timeout, Error:
+		return
+	}
+	journaledSteps, updated := sm.Strategy.GetJournal().OrderHistory()
+	steps := map[string]string{}
+	for orderId, step := range journaledSteps {
+		steps[orderId] = step
+	}
+	for _, orderId := range model.State.WaitForEntryIds {
+		steps[orderId] = WaitForEntry
+	}
+	for _, orderId := range model.State.StopLossOrderIds {
+		steps[orderId] = Stoploss
+	}
+	for _, orderId := range model.State.ForcedLossOrderIds {
+		steps[orderId] = "ForcedLoss"
+	}
+	for _, orderId := range model.State.TakeProfitOrderIds {
+		steps[orderId] = TakeProfit
+	}
+
+	// ids of orders of past iterations are left in the lists by step, state orders are reset on each iteration
+	orderIds := append([]string{}, model.State.Orders...)
+	for _, orderId := range orderIds {
+		step, ok := steps[orderId]
+		if !ok || orderId == "" || orderId == "0" {
+			sm.Strategy.GetLogger().Warn("can't recover order of unknown step", zap.String("orderId", orderId))
+			sm.Statsd.Inc("smart_order.recovery.unknown_step")
+			continue
+		}
+		order := sm.StateMgmt.GetOrder(orderId)
+		if order != nil && (order.Status == "filled" || order.Status == "canceled") {
+			if _, placed := journaledSteps[orderId]; updated[orderId] || !placed && appliedByState(step, model.State.State) {
+				continue
+			}
+			sm.Strategy.GetLogger().Info("applying order updated while unowned",
+				zap.String("orderId", orderId),
+				zap.String("step", step),
+				zap.String("status", order.Status),
+			)
+			sm.Statsd.Inc("smart_order.recovery.applied")
+			sm.OrdersMux.Lock()
+			sm.OrdersMap[orderId] = true
+			sm.OrdersMux.Unlock()
+			sm.StatusByOrderId.Store(orderId, step)
+			sm.orderCallback(order)
+			continue
+		}
+		sm.Strategy.GetLogger().Info("waiting for order placed before start",
+			zap.String("orderId", orderId),
+			zap.String("step", step),
+		)
+		sm.Statsd.Inc("smart_order.recovery.open")
+		sm.OrdersMux.Lock()
+		sm.OrdersMap[orderId] = true
+		sm.OrdersMux.Unlock()
+		sm.IsWaitingForOrder.Store(step, true)
+		if step == WaitForEntry {
+			sm.IsEntryOrderPlaced = true
+		}
+		go sm.waitForOrder(orderId, step)
+	}
+}
+
+// appliedByState tells whether an update of the order placed for the step is applied to the state given already.
+// Entry orders are applied once the strategy stopped waiting for entry, stop-loss orders close the strategy when
+// applied. Take-profit targets may be filled partially, so they are taken as applied to not apply a fill twice.
+func appliedByState(step string, state string) bool {
+	switch step {
+	case WaitForEntry:
+		return state != WaitForEntry && state != TrailingEntry
+	case Stoploss, "ForcedLoss":
+		return false
+	}
+	return true
+}
@@ -0,0 +1,186 @@
+package smart_order
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"gitlab.com/crypto_project/core/strategy_service/src/sources/mongodb/models"
+	"go.uber.org/zap"
+)
+
+// A Schedule restricts smart order entry and exit by calendar time in UTC.
+type Schedule struct {
+	windows       []window
+	weekdays      map[time.Weekday]bool
+	cancelEntryAt int64
+	forceExitAt   int64
+}
+
+// window is a daily time range in minutes since midnight.
+type window struct {
+	from, to int
+}
+
+// NewSchedule returns a schedule by conditions and expiration, nil if nothing restricts the smart order. Expiration
+// not open ended both cancels entry and forces exit.
+func NewSchedule(conditions *models.MongoScheduleConditions, expiration models.ExpirationSchema) (*Schedule, error) {
+	s := &Schedule{}
+	if conditions != nil {
+		for _, w := range conditions.EntryWindows {
+			from, err := parseTimeOfDay(w.From)
+			if err != nil {
+				return nil, err
+			}
+			to, err := parseTimeOfDay(w.To)
+			if err != nil {
+				return nil, err
+			}
+			s.windows = append(s.windows, window{from: from, to: to})
+		}
+		for _, weekday := range conditions.EntryWeekdays {
+			if weekday < 0 || weekday > 6 {
+				return nil, fmt.Errorf("invalid weekday %d", weekday)
+			}
+			if s.weekdays == nil {
+				s.weekdays = map[time.Weekday]bool{}
+			}
+			s.weekdays[time.Weekday(weekday)] = true
+		}
+		s.cancelEntryAt = conditions.CancelEntryAt
+		s.forceExitAt = conditions.ForceExitAt
+	}
+	if !expiration.OpenEnded && expiration.ExpirationTimestamp > 0 {
+		s.cancelEntryAt = earliest(s.cancelEntryAt, expiration.ExpirationTimestamp)
+		s.forceExitAt = earliest(s.forceExitAt, expiration.ExpirationTimestamp)
+	}
+	if s.windows == nil && s.weekdays == nil && s.cancelEntryAt == 0 && s.forceExitAt == 0 {
+		return nil, nil
+	}
+	return s, nil
+}
+
+// parseTimeOfDay returns minutes since midnight of time in HH:MM format.
+func parseTimeOfDay(value string) (int, error) {
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of day %q, HH:MM expected", value)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// earliest returns the earliest of timestamps set.
+func earliest(timestamp, other int64) int64 {
+	if timestamp == 0 || other < timestamp {
+		return other
+	}
+	return timestamp
+}
+
+// RestrictsEntry returns true if entry is allowed at some times only.
+func (s *Schedule) RestrictsEntry() bool {
+	return s != nil && (s.windows != nil || s.weekdays != nil || s.cancelEntryAt > 0)
+}
+
+// EntryAllowed returns true if entry may be placed at the time given.
+func (s *Schedule) EntryAllowed(t time.Time) bool {
+	if s == nil {
+		return true
+	}
+	if s.EntryCanceled(t) {
+		return false
+	}
+	t = t.UTC()
+	if s.weekdays != nil && !s.weekdays[t.Weekday()] {
+		return false
+	}
+	if s.windows == nil {
+		return true
+	}
+	minutes := t.Hour()*60 + t.Minute()
+	for _, w := range s.windows {
+		if w.from <= w.to && minutes >= w.from && minutes < w.to ||
+			w.from > w.to && (minutes >= w.from || minutes < w.to) {
+			return true
+		}
+	}
+	return false
+}
+
+// EntryCanceled returns true if entry not done yet should be canceled by the time given.
+func (s *Schedule) EntryCanceled(t time.Time) bool {
+	return s != nil && s.cancelEntryAt > 0 && t.Unix() >= s.cancelEntryAt
+}
+
+// ExitForced returns true if position should be closed by the time given.
+func (s *Schedule) ExitForced(t time.Time) bool {
+	return s != nil && s.forceExitAt > 0 && t.Unix() >= s.forceExitAt
+}
+
+// checkSchedule cancels the entry or closes the position once the schedule says so. The smart order is disabled,
+// so orders are canceled and position is closed at market on stop. Entry orders open out of entry windows are
+// canceled with the smart order kept waiting for entry.
+func (sm *SmartOrder) checkSchedule(now time.Time) {
+	if sm.Schedule == nil {
+		return
+	}
+	model := sm.Strategy.GetModel()
+	state, _ := sm.State.State(context.TODO())
+	switch state {
+	case WaitForEntry, TrailingEntry:
+		if !sm.Schedule.EntryCanceled(now) {
+			if !sm.Schedule.EntryAllowed(now) {
+				sm.cancelEntryOrders()
+			}
+			return
+		}
+		sm.Strategy.GetLogger().Info("entry canceled by schedule")
+		sm.Statsd.Inc("smart_order.schedule_entry_canceled")
+		model.State.State = Canceled
+	case End, Canceled, Timeout, Error:
+		return
+	default:
+		if !sm.Schedule.ExitForced(now) {
+			return
+		}
+		sm.Strategy.GetLogger().Info("exit forced by schedule",
+			zap.String("state", fmt.Sprintf("%v", state)),
+		)
+		sm.Statsd.Inc("smart_order.schedule_exit_forced")
+	}
+	model.Enabled = false
+	sm.StateMgmt.UpdateState(model.ID, model.State)
+	sm.StateMgmt.DisableStrategy(model.ID)
+}
+
+// cancelEntryOrders cancels entry orders not filled yet once the entry window closed, entry is placed again once the
+// next window opens. Orders filled partially are left to be filled.
+func (sm *SmartOrder) cancelEntryOrders() {
+	var orderIds []string
+	sm.StatusByOrderId.Range(func(orderId, step interface{}) bool {
+		if step != WaitForEntry && step != TrailingEntry {
+			return true
+		}
+		if order := sm.StateMgmt.GetOrder(orderId.(string)); order != nil && order.Filled > 0 {
+			return true
+		}
+		orderIds = append(orderIds, orderId.(string))
+		return true
+	})
+	if len(orderIds) == 0 {
+		return
+	}
+	sm.OrdersMux.Lock()
+	for _, orderId := range orderIds {
+		sm.StatusByOrderId.Delete(orderId)
+		delete(sm.OrdersMap, orderId) // canceled by schedule, not by the exchange or user
+	}
+	sm.OrdersMux.Unlock()
+	sm.IsWaitingForOrder.Store(WaitForEntry, false)
+	sm.Strategy.GetModel().State.TrailingEntryPrice = 0
+	sm.Strategy.GetLogger().Info("entry orders canceled out of schedule",
+		zap.Strings("orderIds", orderIds),
+	)
+	sm.Statsd.Inc("smart_order.schedule_entry_orders_canceled")
+	sm.TryCancelAllOrdersConsistently(orderIds)
+}
@@ -13,6 +13,7 @@ import (
 	"time"
 
 	"github.com/qmuntal/stateless"
+	"gitlab.com/crypto_project/core/strategy_service/src/service/expressions"
 	"gitlab.com/crypto_project/core/strategy_service/src/service/interfaces"
 	"gitlab.com/crypto_project/core/strategy_service/src/sources/mongodb/models"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -64,7 +65,7 @@ type SmartOrder struct {
 	ExchangeApi             interfaces.ITrading
 	Statsd                  interfaces.IStatsClient
 	StateMgmt               interfaces.IStateMgmt
-	IsWaitingForOrder       sync.Map // TODO: this must be filled on start of SM if not first start (e.g. restore the state by checking order statuses)
+	IsWaitingForOrder       sync.Map // by step, restored on start from orders placed before
 	IsEntryOrderPlaced      bool     // we need it for case when response from createOrder was returned after entryTimeout was executed
 	OrdersMap               map[string]bool
 	StatusByOrderId         sync.Map
@@ -73,10 +74,19 @@ type SmartOrder struct {
 	Lock                    bool
 	StopLock                bool
 	LastTrailingTimestamp   int64
+	LastVolatilityCheckAt   int64
+	LastPrice               float64       // close price of the last tick processed, journaled with transitions
+	TrailingStopsCheckedAt  map[int]int64 // by exit target, candles based trailing stops are checked periodically
+	EntryExpression         *expressions.Expression
+	TakeProfitExpression    *expressions.Expression
+	StopLossExpression      *expressions.Expression
+	Schedule                *Schedule
 	SelectedExitTarget      int // number of current order
 	SelectedEntryTarget     int // represents what amount of targets executed for the SM by averaging
 	OrdersMux               sync.Mutex
+	StopLossMux             sync.Mutex // serializes stop-loss orders replacement
 	StopMux                 sync.Mutex
+	recovered               bool // whether orders placed before start recovered, it's done once per runtime
 }
 
 const (
@@ -104,25 +114,52 @@ func (sm *SmartOrder) toFixed(n float64, precision int64, mode int) float64 {
 	}
 }
 
+// leverage returns leverage of conditions percentages are divided by, 1 if it's not set, e.g. by conditions edited.
+func (sm *SmartOrder) leverage() float64 {
+	return math.Max(sm.Strategy.GetModel().Conditions.Leverage, 1)
+}
+
 // New instantiates new smart order with given strategy.
 func New(strategy interfaces.IStrategy, DataFeed interfaces.IDataFeed, TradingAPI interfaces.ITrading, Statsd interfaces.IStatsClient, keyId *primitive.ObjectID, stateMgmt interfaces.IStateMgmt) *SmartOrder {
 
 	sm := &SmartOrder{
-		Strategy:           strategy,
-		DataFeed:           DataFeed,
-		ExchangeApi:        TradingAPI,
-		Statsd:             Statsd,
-		KeyId:              keyId,
-		StateMgmt:          stateMgmt,
-		Lock:               false,
-		SelectedExitTarget: 0,
-		OrdersMap:          map[string]bool{},
+		Strategy:               strategy,
+		DataFeed:               DataFeed,
+		ExchangeApi:            TradingAPI,
+		Statsd:                 Statsd,
+		KeyId:                  keyId,
+		StateMgmt:              stateMgmt,
+		Lock:                   false,
+		SelectedExitTarget:     0,
+		OrdersMap:              map[string]bool{},
+		TrailingStopsCheckedAt: map[int]int64{},
 	}
 
 	initState := WaitForEntry
 	pricePrecision, amountPrecision := stateMgmt.GetMarketPrecision(strategy.GetModel().Conditions.Pair, strategy.GetModel().Conditions.MarketType)
 	sm.QuantityPricePrecision = pricePrecision
 	sm.QuantityAmountPrecision = amountPrecision
+	// restore levels in volatility units converted at entry before restart
+	if strategy.GetModel().State != nil {
+		sm.applyVolatilityLevels()
+	}
+	err := sm.compileExpressions(strategy.GetModel().Conditions)
+	if err == nil {
+		sm.Schedule, err = NewSchedule(strategy.GetModel().Conditions.Schedule, strategy.GetModel().Expiration)
+	}
+	if err != nil {
+		strategy.GetLogger().Error("can't start smart order", zap.Error(err))
+		sm.Statsd.Inc("smart_order.conditions_invalid")
+		model := strategy.GetModel()
+		if model.State == nil {
+			model.State = &models.MongoStrategyState{}
+		}
+		model.Enabled = false
+		model.State.State = Error
+		model.State.Msg = err.Error()
+		stateMgmt.DisableStrategy(model.ID)
+		stateMgmt.UpdateState(model.ID, model.State)
+	}
 	// if state is not empty but if its in the end and open ended, then we skip state value, since want to start over
 	if strategy.GetModel().State != nil && strategy.GetModel().State.State != "" && !(strategy.GetModel().State.State == End && strategy.GetModel().Conditions.ContinueIfEnded == true) {
 		initState = strategy.GetModel().State.State
@@ -135,6 +172,8 @@ func New(strategy interfaces.IStrategy, DataFeed interfaces.IDataFeed, TradingAP
 			zap.String("source", fmt.Sprintf("%v", tr.Source)),
 			zap.String("dest", fmt.Sprintf("%v", tr.Destination)),
 		)
+		sm.Strategy.GetJournal().Transition(fmt.Sprintf("%v", tr.Source), fmt.Sprintf("%v", tr.Destination),
+			fmt.Sprintf("%v", tr.Trigger), sm.LastPrice, sm.Strategy.GetModel().State)
 	})
 
 	// define triggers and input types:
@@ -252,7 +291,7 @@ func (sm *SmartOrder) checkIfPlaceOrderInstantlyOnStart() {
 	isFirstRunSoOrdersListsAreEmpty := (len(sm.Strategy.GetModel().State.Orders) +
 		len(sm.Strategy.GetModel().State.ExecutedOrders)) == 0
 	if isFirstRunSoStateIsEmpty && isFirstRunSoOrdersListsAreEmpty && model.Enabled &&
-		!model.Conditions.EntrySpreadHunter && !isMultiEntry {
+		!model.Conditions.EntrySpreadHunter && !isMultiEntry && !sm.hasEntryConditions() {
 		entryIsNotTrailing := model.Conditions.EntryOrder.ActivatePrice == 0
 		if entryIsNotTrailing { // then we must know exact price
 			sm.IsWaitingForOrder.Store(WaitForEntry, true)
@@ -302,6 +341,11 @@ func (sm *SmartOrder) exitWaitEntry(ctx context.Context, args ...interface{}) (s
 	return InEntry, nil
 }
 
+// hasEntryConditions returns true if entry waits for schedule, indicators or expression, entry is placed once met.
+func (sm *SmartOrder) hasEntryConditions() bool {
+	return sm.Schedule.RestrictsEntry() || len(sm.Strategy.GetModel().Conditions.EntryIndicators) > 0 || sm.EntryExpression != nil
+}
+
 func (sm *SmartOrder) checkWaitEntry(ctx context.Context, args ...interface{}) bool {
 	isWaitingForOrder, ok := sm.IsWaitingForOrder.Load(WaitForEntry)
 	if ok && isWaitingForOrder.(bool) {
@@ -315,6 +359,16 @@ func (sm *SmartOrder) checkWaitEntry(ctx context.Context, args ...interface{}) b
 	}
 	currentOHLCV := args[0].(interfaces.OHLCV)
 	model := sm.Strategy.GetModel()
+	if sm.hasEntryConditions() {
+		if !sm.Schedule.EntryAllowed(time.Now()) || !sm.checkEntryIndicators() || !sm.holds(sm.EntryExpression, currentOHLCV) {
+			return false
+		}
+		if model.Conditions.EntryOrder.ActivatePrice == 0 { // conditions met, place entry as it's done on start
+			sm.IsWaitingForOrder.Store(WaitForEntry, true)
+			sm.PlaceOrder(model.Conditions.EntryOrder.Price, 0.0, WaitForEntry)
+			return false
+		}
+	}
 	conditionPrice := model.Conditions.EntryOrder.Price
 	isInstantMarketOrder := model.Conditions.EntryOrder.ActivatePrice == 0 && model.Conditions.EntryOrder.OrderType == "market"
 	if model.Conditions.EntryOrder.ActivatePrice == -1 || isInstantMarketOrder {
@@ -361,8 +415,12 @@ func (sm *SmartOrder) enterEntry(ctx context.Context, args ...interface{}) error
 	if currentOHLCV, ok := args[0].(interfaces.OHLCV); ok {
 		sm.Strategy.GetModel().State.EntryPrice = currentOHLCV.Close
 	}
+	if sm.Strategy.GetModel().State.EnteredAt == 0 {
+		sm.Strategy.GetModel().State.EnteredAt = time.Now().Unix()
+	}
 	sm.Strategy.GetModel().State.State = InEntry
 	sm.Strategy.GetModel().State.TrailingEntryPrice = 0
+	sm.enterVolatility()
 	sm.Strategy.GetModel().State.ExecutedOrders = []string{}
 	go sm.StateMgmt.UpdateState(sm.Strategy.GetModel().ID, sm.Strategy.GetModel().State)
 
@@ -426,6 +484,15 @@ func (sm *SmartOrder) checkProfit(ctx context.Context, args ...interface{}) bool
 	}
 
 	currentOHLCV := args[0].(interfaces.OHLCV)
+	if sm.TakeProfitExpression != nil && model.State.ExecutedAmount < model.Conditions.EntryOrder.Amount {
+		currentState, _ := sm.State.State(ctx)
+		if currentState == InEntry && sm.holds(sm.TakeProfitExpression, currentOHLCV) {
+			model.State.Amount = model.Conditions.EntryOrder.Amount - model.State.ExecutedAmount
+			model.State.State = TakeProfit
+			sm.StateMgmt.UpdateState(model.ID, model.State)
+			return true
+		}
+	}
 	if model.Conditions.TimeoutIfProfitable > 0 {
 		isProfitable := (model.Conditions.EntryOrder.Side == "buy" && model.State.EntryPrice < currentOHLCV.Close) ||
 			(model.Conditions.EntryOrder.Side == "sell" && model.State.EntryPrice > currentOHLCV.Close)
@@ -449,7 +516,7 @@ func (sm *SmartOrder) checkProfit(ctx context.Context, args ...interface{}) bool
 		case "buy":
 			for i, level := range model.Conditions.ExitLevels {
 				if model.State.ReachedTargetCount < i+1 && level.ActivatePrice == 0 {
-					if level.Type == 1 && currentOHLCV.Close >= (model.State.EntryPrice*(100+level.Price/model.Conditions.Leverage)/100) ||
+					if level.Type == 1 && currentOHLCV.Close >= (model.State.EntryPrice*(100+level.Price/sm.leverage())/100) ||
 						level.Type == 0 && currentOHLCV.Close >= level.Price {
 						model.State.ReachedTargetCount += 1
 						if level.Type == 0 {
@@ -468,7 +535,7 @@ func (sm *SmartOrder) checkProfit(ctx context.Context, args ...interface{}) bool
 		case "sell":
 			for i, level := range model.Conditions.ExitLevels {
 				if model.State.ReachedTargetCount < i+1 && level.ActivatePrice == 0 {
-					if level.Type == 1 && currentOHLCV.Close <= (model.State.EntryPrice*((100-level.Price/model.Conditions.Leverage)/100)) ||
+					if level.Type == 1 && currentOHLCV.Close <= (model.State.EntryPrice*((100-level.Price/sm.leverage())/100)) ||
 						level.Type == 0 && currentOHLCV.Close <= level.Price {
 						model.State.ReachedTargetCount += 1
 						if level.Type == 0 {
@@ -531,8 +598,8 @@ func (sm *SmartOrder) checkLoss(ctx context.Context, args ...interface{}) bool {
 	if isTrailingHedgeOrder {
 		return false
 	}
-	stopLoss := model.Conditions.StopLoss / model.Conditions.Leverage
-	forcedLoss := model.Conditions.ForcedLoss / model.Conditions.Leverage
+	stopLoss := sm.stopLossPercentage() / sm.leverage()
+	forcedLoss := model.Conditions.ForcedLoss / sm.leverage()
 	currentState := model.State.State
 	stateFromStateMachine, _ := sm.State.State(ctx)
 
@@ -546,6 +613,13 @@ func (sm *SmartOrder) checkLoss(ctx context.Context, args ...interface{}) bool {
 		return true
 	}
 
+	if sm.StopLossExpression != nil && currentState == InEntry && sm.holds(sm.StopLossExpression, currentOHLCV) {
+		model.State.Amount = model.Conditions.EntryOrder.Amount - model.State.ExecutedAmount
+		model.State.State = Stoploss
+		sm.StateMgmt.UpdateState(model.ID, model.State)
+		return model.State.StopLossAt == 0
+	}
+
 	// try exit on timeout
 	if model.Conditions.TimeoutWhenLoss > 0 && !forcedSLWithAlert {
 		isLoss := (model.Conditions.EntryOrder.Side == "buy" && model.State.EntryPrice > currentOHLCV.Close) || (model.Conditions.EntryOrder.Side == "sell" && model.State.EntryPrice < currentOHLCV.Close)
@@ -739,6 +813,12 @@ func (sm *SmartOrder) Start() {
 	state, _ := sm.State.State(context.Background())
 	localState := sm.Strategy.GetModel().State.State
 	sm.Statsd.Inc("smart_order.start")
+	if !sm.recovered {
+		sm.recovered = true
+		sm.recoverOrders()
+		state, _ = sm.State.State(ctx)
+		localState = sm.Strategy.GetModel().State.State
+	}
 	var lastValidityCheckAt = time.Now().Add(-1 * time.Second)
 	for state != End && localState != End && state != Canceled && state != Timeout {
 		if time.Since(lastValidityCheckAt) > 2*time.Second { // TODO: remove magic number
@@ -752,6 +832,7 @@ func (sm *SmartOrder) Start() {
 			}
 			lastValidityCheckAt = time.Now()
 		}
+		sm.checkSchedule(time.Now())
 		if sm.Strategy.GetModel().Enabled == false {
 			state, _ = sm.State.State(ctx)
 			break
@@ -850,9 +931,14 @@ func (sm *SmartOrder) Stop() {
 		stateModel.ExecutedAmount = 0
 		stateModel.Amount = 0
 		stateModel.Orders = []string{}
+		stateModel.StopLadderStep = 0
+		stateModel.ExitTargetsFilled = 0
+		stateModel.EnteredAt = 0
+		stateModel.TimeExitsDone = 0
+		stateModel.TimeExitedAmount = 0
 		stateModel.Iteration += 1
-		sm.StateMgmt.UpdateState(model.ID, stateModel)
-		sm.StateMgmt.UpdateExecutedAmount(model.ID, stateModel)
+		// the state is saved whole, so orders of the iteration ended are not recovered on start
+		sm.StateMgmt.UpdateStrategyState(model.ID, stateModel)
 		sm.StateMgmt.SaveStrategyConditions(model)
 		_ = sm.State.Fire(Restart)
 		//_ = sm.onStart(nil)
@@ -873,11 +959,19 @@ func (sm *SmartOrder) processEventLoop() {
 	currentOHLCVp := sm.DataFeed.GetPriceForPairAtExchange(sm.Strategy.GetModel().Conditions.Pair, sm.ExchangeName, sm.Strategy.GetModel().Conditions.MarketType)
 	if currentOHLCVp != nil {
 		currentOHLCV := *currentOHLCVp
+		sm.LastPrice = currentOHLCV.Close
 		state, err := sm.State.State(context.TODO())
 		err = sm.State.FireCtx(context.TODO(), TriggerTrade, currentOHLCV)
 		if err == nil {
 			return
 		}
+		if state == InEntry {
+			sm.trailVolatilityStop()
+		}
+		if state == InEntry || state == TakeProfit {
+			sm.climbStopLadder(currentOHLCV.Close)
+			sm.checkTimeExits(currentOHLCV.Close, time.Now())
+		}
 		if state == InEntry || state == TakeProfit || state == Stoploss || state == HedgeLoss {
 			err = sm.State.FireCtx(context.TODO(), CheckLossTrade, currentOHLCV)
 			if err == nil {
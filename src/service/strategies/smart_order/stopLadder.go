@@ -0,0 +1,65 @@
+package smart_order
+
+import (
+	"gitlab.com/crypto_project/core/strategy_service/src/sources/mongodb/models"
+	"go.uber.org/zap"
+)
+
+// climbStopLadder moves stop-loss by stop ladder steps reached by profit or filled targets at the close price given,
+// stop-loss order placed at exchange is replaced to the new price.
+func (sm *SmartOrder) climbStopLadder(close float64) {
+	model := sm.Strategy.GetModel()
+	ladder := model.Conditions.StopLadder
+	if len(ladder) == 0 || model.State.EntryPrice == 0 {
+		return
+	}
+	profit := -StopLossPercentage(model.Conditions.EntryOrder.Side, model.State.EntryPrice, close, sm.leverage())
+	reached := model.State.StopLadderStep
+	for reached < int64(len(ladder)) && StopLadderStepReached(ladder[reached], profit, model.State.ExitTargetsFilled) {
+		reached += 1
+	}
+	if reached == model.State.StopLadderStep {
+		return
+	}
+	stopLoss := sm.stopLossPercentage()
+	model.State.StopLadderStep = reached
+	sm.Strategy.GetLogger().Info("stop-loss moved by ladder",
+		zap.Int64("step", reached),
+		zap.Float64("profit", profit),
+		zap.Float64("stop loss", sm.stopLossPercentage()),
+	)
+	sm.Statsd.Inc("smart_order.stop_ladder_moved")
+	sm.StateMgmt.UpdateState(model.ID, model.State)
+	if sm.stopLossPercentage() < stopLoss {
+		go sm.replaceStopLoss()
+	}
+}
+
+// stopLossPercentage returns stop-loss percentage with leverage the smart order exits at, the one locked by the last
+// stop ladder step reached if it's closer than stop-loss of conditions. Negative stop-loss locks a profit.
+func (sm *SmartOrder) stopLossPercentage() float64 {
+	model := sm.Strategy.GetModel()
+	if locked, ok := sm.ladderStopLoss(); ok && locked < model.Conditions.StopLoss {
+		return locked
+	}
+	return model.Conditions.StopLoss
+}
+
+// ladderStopLoss returns stop-loss percentage locked by the last stop ladder step reached, false if there is no such.
+func (sm *SmartOrder) ladderStopLoss() (float64, bool) {
+	model := sm.Strategy.GetModel()
+	step := model.State.StopLadderStep
+	if step == 0 || step > int64(len(model.Conditions.StopLadder)) {
+		return 0, false
+	}
+	return -model.Conditions.StopLadder[step-1].Stop, true
+}
+
+// StopLadderStepReached returns true if the profit percentage with leverage or the count of filled take-profit targets
+// reach the step.
+func StopLadderStepReached(step *models.MongoStopLadderStep, profit float64, targetsFilled int64) bool {
+	if step.AfterTarget > 0 && targetsFilled >= step.AfterTarget {
+		return true
+	}
+	return step.Profit > 0 && profit >= step.Profit
+}
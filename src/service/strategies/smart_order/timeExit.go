@@ -0,0 +1,124 @@
+package smart_order
+
+import (
+	"math"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// TimeExit is a step of a partial exit by time.
+const TimeExit = "TimeExit"
+
+// checkTimeExits closes a part of the position by the next time exit once it's due, and if required, the position is
+// profitable at the close price given. Exits are done in order, the last one closes the rest of the position.
+func (sm *SmartOrder) checkTimeExits(close float64, now time.Time) {
+	model := sm.Strategy.GetModel()
+	exits := model.Conditions.TimeExits
+	done := model.State.TimeExitsDone
+	if done >= int64(len(exits)) || model.State.EnteredAt == 0 || model.State.EntryPrice == 0 {
+		return
+	}
+	exit := exits[done]
+	dueAt := exit.At
+	if exit.After > 0 {
+		dueAt = model.State.EnteredAt + exit.After
+	}
+	if dueAt == 0 || now.Unix() < dueAt {
+		return
+	}
+	if exit.IfProfitable {
+		if StopLossPercentage(model.Conditions.EntryOrder.Side, model.State.EntryPrice, close, sm.leverage()) >= 0 {
+			return // not in profit, wait for it
+		}
+	}
+	remaining := model.Conditions.EntryOrder.Amount - model.State.ExecutedAmount
+	amount := model.Conditions.EntryOrder.Amount * exit.Amount / 100
+	isLast := done == int64(len(exits))-1
+	if isLast || exit.Amount == 0 || amount > remaining {
+		amount = remaining
+	}
+	model.State.TimeExitsDone += 1
+	if amount > 0 {
+		model.State.TimeExitedAmount += amount
+		model.State.ReachedTargetCount = sm.targetsTimeExited(model.State.ReachedTargetCount)
+	}
+	sm.StateMgmt.UpdateState(model.ID, model.State)
+	if amount <= 0 {
+		return
+	}
+	sm.Strategy.GetLogger().Info("time exit",
+		zap.Int64("exit", done),
+		zap.Float64("amount", amount),
+		zap.Float64("remaining", remaining),
+		zap.Int("reachedTargetCount", model.State.ReachedTargetCount),
+	)
+	sm.Statsd.Inc("smart_order.time_exit")
+	replaceTakeProfits := false
+	if model.Conditions.MarketType == 0 && len(model.State.TakeProfitOrderIds) > 0 {
+		// take-profit orders lock the balance on spot, they're replaced for the rest of the position after the exit
+		takeProfitOrderIds := model.State.TakeProfitOrderIds
+		model.State.TakeProfitOrderIds = nil
+		sm.OrdersMux.Lock()
+		for _, orderId := range takeProfitOrderIds {
+			delete(sm.OrdersMap, orderId) // canceled orders shouldn't affect the state
+		}
+		sm.OrdersMux.Unlock()
+		sm.TryCancelAllOrdersConsistently(takeProfitOrderIds)
+		sm.SelectedExitTarget = sm.targetsTimeExited(sm.SelectedExitTarget)
+		replaceTakeProfits = amount < remaining && sm.SelectedExitTarget < len(model.Conditions.ExitLevels)
+	}
+	go func() {
+		sm.PlaceOrder(0, amount, TimeExit)
+		if replaceTakeProfits {
+			sm.PlaceOrder(0, 0.0, TakeProfit)
+		}
+	}()
+}
+
+// targetAmount returns the amount of the take-profit target given, the last target takes the rest of the entry.
+func (sm *SmartOrder) targetAmount(i int) float64 {
+	model := sm.Strategy.GetModel()
+	if i >= len(model.Conditions.ExitLevels)-1 {
+		return sm.getLastTargetAmount()
+	}
+	amount := model.Conditions.ExitLevels[i].Amount
+	if model.Conditions.ExitLevels[i].Type == 1 {
+		if amount == 0 {
+			amount = 100
+		}
+		amount = model.Conditions.EntryOrder.Amount * (amount / 100)
+	}
+	return amount
+}
+
+// targetsTimeExited returns the count of take-profit targets closed by time exits entirely, but not less than the
+// count given. Targets are taken in order, so exits by time close the nearest ones first.
+func (sm *SmartOrder) targetsTimeExited(count int) int {
+	exited := sm.Strategy.GetModel().State.TimeExitedAmount
+	levels := len(sm.Strategy.GetModel().Conditions.ExitLevels)
+	covered := 0.0
+	for i := 0; i < levels; i++ {
+		covered += sm.targetAmount(i)
+		if covered > exited+1e-9 {
+			return int(math.Max(float64(count), float64(i)))
+		}
+	}
+	return int(math.Max(float64(count), float64(levels)))
+}
+
+// withoutTimeExited reduces the amount of the take-profit target given by the part of it closed by time exits.
+func (sm *SmartOrder) withoutTimeExited(i int, amount float64) float64 {
+	exited := sm.Strategy.GetModel().State.TimeExitedAmount
+	if exited <= 0 {
+		return amount
+	}
+	start := 0.0
+	for j := 0; j < i; j++ {
+		start += sm.targetAmount(j)
+	}
+	if overlap := exited - start; overlap > 0 {
+		amount = math.Max(amount-overlap, 0)
+	}
+	return amount
+}
@@ -2,11 +2,21 @@ package smart_order
 
 import (
 	"context"
+	"gitlab.com/crypto_project/core/strategy_service/src/service/indicators"
 	"gitlab.com/crypto_project/core/strategy_service/src/service/interfaces"
+	"gitlab.com/crypto_project/core/strategy_service/src/sources/mongodb/models"
 	"go.uber.org/zap"
 	"time"
 )
 
+// Defaults for trailing exit modes parameters not set.
+const (
+	defaultChandelierPeriod     = 22
+	defaultChandelierMultiplier = 3.0
+	defaultSARStep              = 0.02
+	defaultSARMaxStep           = 0.2
+)
+
 func (sm *SmartOrder) enterTrailingEntry(ctx context.Context, args ...interface{}) error {
 	sm.Strategy.GetModel().State.State = TrailingEntry
 	sm.StateMgmt.UpdateState(sm.Strategy.GetModel().ID, sm.Strategy.GetModel().State)
@@ -18,6 +28,9 @@ func (sm *SmartOrder) checkTrailingEntry(ctx context.Context, args ...interface{
 	//if ok && isWaitingForOrder.(bool) {
 	//	return false
 	//}
+	if !sm.Schedule.EntryAllowed(time.Now()) {
+		return false
+	}
 	currentOHLCV := args[0].(interfaces.OHLCV)
 	edgePrice := sm.Strategy.GetModel().State.TrailingEntryPrice
 	activateTrailing := false
@@ -29,7 +42,7 @@ func (sm *SmartOrder) checkTrailingEntry(ctx context.Context, args ...interface{
 		activateTrailing = true
 	}
 	// log.Print(currentOHLCV.Close, edgePrice, currentOHLCV.Close/edgePrice-1)
-	deviation := sm.Strategy.GetModel().Conditions.EntryOrder.EntryDeviation / sm.Strategy.GetModel().Conditions.Leverage
+	deviation := sm.Strategy.GetModel().Conditions.EntryOrder.EntryDeviation / sm.leverage()
 	side := sm.Strategy.GetModel().Conditions.EntryOrder.Side
 	isSpotMarketEntry := sm.Strategy.GetModel().Conditions.MarketType == 0 && sm.Strategy.GetModel().Conditions.EntryOrder.OrderType == "market"
 	switch side {
@@ -73,8 +86,8 @@ func (sm *SmartOrder) checkTrailingProfit(ctx context.Context, args ...interface
 			isTrailingTarget := target.ActivatePrice != 0
 			if isTrailingTarget {
 				isActivated := i < len(model.State.TrailingExitPrices)
-				deviation := target.EntryDeviation / 100 / model.Conditions.Leverage
-				activateDeviation := target.ActivatePrice / 100 / model.Conditions.Leverage
+				deviation := target.EntryDeviation / 100 / sm.leverage()
+				activateDeviation := target.ActivatePrice / 100 / sm.leverage()
 
 				activatePrice := target.ActivatePrice
 				if target.Type == 1 {
@@ -98,7 +111,15 @@ func (sm *SmartOrder) checkTrailingProfit(ctx context.Context, args ...interface
 					model.State.TrailingExitPrices[i] = currentOHLCV.Close
 					edgePrice = model.State.TrailingExitPrices[i]
 
-					go sm.placeTrailingOrder(edgePrice, time.Now().UnixNano(), i, side, false, TakeProfit)
+					if target.TrailingMode == "" {
+						go sm.placeTrailingOrder(edgePrice, time.Now().UnixNano(), i, side, false, TakeProfit)
+					}
+				}
+				if target.TrailingMode != "" {
+					if sm.checkTrailingExitStop(i, target, edgePrice, currentOHLCV.Close) {
+						return true
+					}
+					continue
 				}
 
 				deviationFromEdge := (edgePrice/currentOHLCV.Close - 1) * 100
@@ -120,8 +141,8 @@ func (sm *SmartOrder) checkTrailingProfit(ctx context.Context, args ...interface
 			isTrailingTarget := target.ActivatePrice != 0
 			if isTrailingTarget {
 				isActivated := i < len(sm.Strategy.GetModel().State.TrailingExitPrices)
-				deviation := target.EntryDeviation / 100 / sm.Strategy.GetModel().Conditions.Leverage
-				activateDeviation := target.ActivatePrice / 100 / sm.Strategy.GetModel().Conditions.Leverage
+				deviation := target.EntryDeviation / 100 / sm.leverage()
+				activateDeviation := target.ActivatePrice / 100 / sm.leverage()
 
 				activatePrice := target.ActivatePrice
 				if target.Type == 1 {
@@ -146,7 +167,15 @@ func (sm *SmartOrder) checkTrailingProfit(ctx context.Context, args ...interface
 					sm.Strategy.GetModel().State.TrailingExitPrices[i] = currentOHLCV.Close
 					edgePrice = sm.Strategy.GetModel().State.TrailingExitPrices[i]
 
-					go sm.placeTrailingOrder(edgePrice, time.Now().UnixNano(), i, side, false, TakeProfit)
+					if target.TrailingMode == "" {
+						go sm.placeTrailingOrder(edgePrice, time.Now().UnixNano(), i, side, false, TakeProfit)
+					}
+				}
+				if target.TrailingMode != "" {
+					if sm.checkTrailingExitStop(i, target, edgePrice, currentOHLCV.Close) {
+						return true
+					}
+					continue
 				}
 
 				deviationFromEdge := (currentOHLCV.Close/edgePrice - 1) * 100
@@ -168,6 +197,102 @@ func (sm *SmartOrder) checkTrailingProfit(ctx context.Context, args ...interface
 	return false
 }
 
+// checkTrailingExitStop moves stop price of the trailing exit target with trailing mode, stop order is replaced by the
+// trailing order plumbing on futures. On spot market exit is placed once the close price given crosses the stop,
+// it returns true then.
+func (sm *SmartOrder) checkTrailingExitStop(i int, target *models.MongoEntryPoint, edgePrice, close float64) bool {
+	model := sm.Strategy.GetModel()
+	side := model.Conditions.EntryOrder.Side
+	if sm.trailExitStop(i, target, edgePrice) {
+		sm.Strategy.GetLogger().Info("trailing exit stop moved",
+			zap.String("mode", target.TrailingMode),
+			zap.Int("target", i),
+			zap.Float64("stop price", model.State.TrailingExitStops[i]),
+		)
+		go sm.placeTrailingOrder(edgePrice, time.Now().UnixNano(), i, side, false, TakeProfit)
+	}
+	stopPrice := model.State.TrailingExitStops[i]
+	didCrossStopPrice := side == "buy" && close <= stopPrice || side == "sell" && close >= stopPrice
+	isSpotMarketOrder := target.OrderType == "market" && model.Conditions.MarketType == 0
+	if stopPrice > 0 && didCrossStopPrice && isSpotMarketOrder {
+		model.State.State = TakeProfit
+		sm.PlaceOrder(edgePrice, 0.0, TakeProfit)
+		return true
+	}
+	return false
+}
+
+// trailExitStop calculates stop price of the trailing exit target by its trailing mode, the stop is kept in the state
+// if it's closer to price than the one kept. It returns true if the stop moved.
+func (sm *SmartOrder) trailExitStop(i int, target *models.MongoEntryPoint, edgePrice float64) bool {
+	model := sm.Strategy.GetModel()
+	for len(model.State.TrailingExitStops) <= i {
+		model.State.TrailingExitStops = append(model.State.TrailingExitStops, 0)
+	}
+	long := model.Conditions.EntryOrder.Side == "buy"
+	stopPrice := 0.0
+	switch target.TrailingMode {
+	case "giveback":
+		if target.TrailingMultiplier > 0 {
+			stopPrice = model.State.EntryPrice + (edgePrice-model.State.EntryPrice)*(1-target.TrailingMultiplier/100)
+		}
+	case "chandelier", "sar":
+		now := time.Now().Unix()
+		if now-sm.TrailingStopsCheckedAt[i] < volatilityCheckPeriod && model.State.TrailingExitStops[i] > 0 {
+			return false
+		}
+		sm.TrailingStopsCheckedAt[i] = now
+		stopPrice = sm.candlesTrailingStop(target, long)
+	default:
+		sm.Strategy.GetLogger().Warn("unknown trailing mode", zap.String("mode", target.TrailingMode))
+	}
+	if stopPrice <= 0 { // not enough candles yet, trail by entry deviation from the edge price
+		deviation := target.EntryDeviation / 100 / sm.leverage()
+		if long {
+			stopPrice = edgePrice * (1 - deviation)
+		} else {
+			stopPrice = edgePrice * (1 + deviation)
+		}
+	}
+	keptStopPrice := model.State.TrailingExitStops[i]
+	if keptStopPrice > 0 && (long && stopPrice <= keptStopPrice || !long && stopPrice >= keptStopPrice) {
+		return false
+	}
+	model.State.TrailingExitStops[i] = stopPrice
+	return true
+}
+
+// candlesTrailingStop returns chandelier or parabolic SAR stop of the pair candles, 0 if there are not enough candles.
+func (sm *SmartOrder) candlesTrailingStop(target *models.MongoEntryPoint, long bool) float64 {
+	model := sm.Strategy.GetModel()
+	timeframe := target.TrailingTimeframe
+	if timeframe == "" {
+		timeframe = defaultVolatilityTimeframe
+	}
+	if target.TrailingMode == "sar" {
+		step, maxStep := target.TrailingStep, target.TrailingMaxStep
+		if step <= 0 {
+			step = defaultSARStep
+		}
+		if maxStep <= 0 {
+			maxStep = defaultSARMaxStep
+		}
+		candles := sm.DataFeed.GetCandles(model.Conditions.Pair, sm.ExchangeName, model.Conditions.MarketType, timeframe, int(1/step)*5)
+		return indicators.ParabolicSAR(candles, step, maxStep, long)
+	}
+	period := int(target.TrailingPeriod)
+	if period <= 0 {
+		period = defaultChandelierPeriod
+	}
+	multiplier := target.TrailingMultiplier
+	if multiplier <= 0 {
+		multiplier = defaultChandelierMultiplier
+	}
+	// ATR smoothing converges on a few periods of history
+	candles := sm.DataFeed.GetCandles(model.Conditions.Pair, sm.ExchangeName, model.Conditions.MarketType, timeframe, 3*period+1)
+	return indicators.ChandelierExit(candles, period, multiplier, long)
+}
+
 func (sm *SmartOrder) placeTrailingOrder(newTrailingPrice float64, trailingCheckAt int64, i int, entrySide string, isEntry bool, step string) {
 	sm.Strategy.GetModel().State.TrailingCheckAt = trailingCheckAt
 	time.Sleep(2 * time.Second)
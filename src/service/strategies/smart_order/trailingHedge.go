@@ -118,9 +118,9 @@ func (sm *SmartOrder) checkLossHedge(ctx context.Context, args ...interface{}) b
 			winStrategyProfitPercentage := ((strategy.State.ExitPrice/strategy.State.EntryPrice)*100 - 100) * strategy.Conditions.Leverage * sideCoefficient
 			winStrategyProfitPercentage = winStrategyProfitPercentage - (fee * model.Conditions.Leverage)
 
-			zeroProfitPrice := model.State.EntryPrice * (1 - winStrategyProfitPercentage/100/model.Conditions.Leverage)
+			zeroProfitPrice := model.State.EntryPrice * (1 - winStrategyProfitPercentage/100/sm.leverage())
 			if model.Conditions.EntryOrder.Side == "sell" {
-				zeroProfitPrice = model.State.EntryPrice * (1 + winStrategyProfitPercentage/100/model.Conditions.Leverage)
+				zeroProfitPrice = model.State.EntryPrice * (1 + winStrategyProfitPercentage/100/sm.leverage())
 			}
 
 			sm.StateMgmt.EnableHedgeLossStrategy(model.ID)
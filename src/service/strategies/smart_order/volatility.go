@@ -0,0 +1,198 @@
+package smart_order
+
+import (
+	"time"
+
+	"gitlab.com/crypto_project/core/strategy_service/src/service/indicators"
+	"gitlab.com/crypto_project/core/strategy_service/src/service/interfaces"
+	"go.uber.org/zap"
+)
+
+// Defaults for volatility conditions not set.
+const (
+	defaultVolatilityTimeframe = "15m"
+	defaultVolatilityPeriod    = 14
+	defaultVolatilityFallback  = 1.0
+	volatilityLevelType        = 2
+	volatilityCheckPeriod      = 10 // seconds between trailing checks, candles close not so often
+)
+
+// measureVolatility returns volatility in price units by volatility conditions and the last closed candle,
+// zero volatility if there are not enough candles.
+func (sm *SmartOrder) measureVolatility() (float64, interfaces.Candle) {
+	model := sm.Strategy.GetModel()
+	conditions := model.Conditions.Volatility
+	timeframe := conditions.Timeframe
+	if timeframe == "" {
+		timeframe = defaultVolatilityTimeframe
+	}
+	period := int(conditions.Period)
+	if period <= 0 {
+		period = defaultVolatilityPeriod
+	}
+	// ATR smoothing converges on a few periods of history
+	candles := sm.DataFeed.GetCandles(model.Conditions.Pair, sm.ExchangeName, model.Conditions.MarketType, timeframe, 3*period+1)
+	if len(candles) == 0 {
+		return 0, interfaces.Candle{}
+	}
+	last := candles[len(candles)-1]
+	if conditions.Mode == "stddev" {
+		return indicators.RealizedVolatility(candles, period), last
+	}
+	return indicators.ATR(candles, period), last
+}
+
+// enterVolatility measures volatility at entry and converts levels given in volatility units.
+func (sm *SmartOrder) enterVolatility() {
+	model := sm.Strategy.GetModel()
+	if model.Conditions.Volatility == nil || model.State.EntryPrice == 0 {
+		return
+	}
+	volatility, last := sm.measureVolatility()
+	if volatility == 0 {
+		fallback := model.Conditions.Volatility.Fallback
+		if fallback <= 0 {
+			fallback = defaultVolatilityFallback
+		}
+		volatility = model.State.EntryPrice * fallback / 100
+		sm.Strategy.GetLogger().Warn("not enough candles to measure volatility, using fallback",
+			zap.Float64("fallback", fallback),
+		)
+		sm.Statsd.Inc("smart_order.volatility_not_ready")
+	}
+	model.State.Volatility = volatility
+	model.State.VolatilityStopPrice = 0
+	model.State.VolatilityTrailedAt = last.Timestamp
+	sm.applyVolatilityLevels()
+	sm.Strategy.GetLogger().Info("volatility levels applied",
+		zap.Float64("volatility", volatility),
+		zap.Float64("stop loss", model.Conditions.StopLoss),
+		zap.Float64("forced loss", model.Conditions.ForcedLoss),
+	)
+}
+
+// applyVolatilityLevels converts levels given in volatility units measured at entry to percentages relative to entry
+// price the smart order works with. Conversion is repeatable, e.g. after restart, since volatility units are kept.
+func (sm *SmartOrder) applyVolatilityLevels() {
+	model := sm.Strategy.GetModel()
+	conditions := model.Conditions.Volatility
+	volatility := model.State.Volatility
+	if conditions == nil || volatility == 0 || model.State.EntryPrice == 0 {
+		return
+	}
+	leverage := sm.leverage()
+	toPercentage := func(units float64) float64 {
+		return units * volatility / model.State.EntryPrice * 100 * leverage
+	}
+	if conditions.StopLoss > 0 {
+		model.Conditions.StopLoss = toPercentage(conditions.StopLoss)
+	}
+	if conditions.ForcedLoss > 0 {
+		model.Conditions.ForcedLoss = toPercentage(conditions.ForcedLoss)
+	}
+	if model.State.VolatilityStopPrice > 0 {
+		model.Conditions.StopLoss = StopLossPercentage(model.Conditions.EntryOrder.Side, model.State.EntryPrice, model.State.VolatilityStopPrice, leverage)
+	}
+	for _, level := range model.Conditions.ExitLevels {
+		if level.Type == volatilityLevelType {
+			level.VolatilityUnits = level.Price
+		}
+		if level.VolatilityUnits > 0 {
+			level.Price = toPercentage(level.VolatilityUnits)
+			level.Type = 1
+		}
+	}
+}
+
+// trailVolatilityStop moves stop-loss towards price by trailing distance in volatility units on each closed candle,
+// stop-loss order placed at exchange is replaced to the new price.
+func (sm *SmartOrder) trailVolatilityStop() {
+	model := sm.Strategy.GetModel()
+	conditions := model.Conditions.Volatility
+	if conditions == nil || conditions.Trailing <= 0 || model.State.EntryPrice == 0 {
+		return
+	}
+	now := time.Now().Unix()
+	if now-sm.LastVolatilityCheckAt < volatilityCheckPeriod {
+		return
+	}
+	sm.LastVolatilityCheckAt = now
+	volatility, last := sm.measureVolatility()
+	if volatility == 0 || last.Timestamp <= model.State.VolatilityTrailedAt {
+		return
+	}
+	model.State.VolatilityTrailedAt = last.Timestamp
+	stopPrice := TrailStopPrice(model.Conditions.EntryOrder.Side, model.State.VolatilityStopPrice, last.Close, conditions.Trailing*volatility)
+	if stopPrice == model.State.VolatilityStopPrice {
+		return
+	}
+	if model.State.VolatilityStopPrice == 0 && model.Conditions.StopLoss > 0 {
+		if StopLossPercentage(model.Conditions.EntryOrder.Side, model.State.EntryPrice, stopPrice, sm.leverage()) >= model.Conditions.StopLoss {
+			return // initial stop-loss is closer yet
+		}
+	}
+	model.State.VolatilityStopPrice = stopPrice
+	sm.applyVolatilityLevels()
+	sm.Strategy.GetLogger().Info("stop-loss trailed by volatility",
+		zap.Float64("stop price", stopPrice),
+		zap.Float64("stop loss", model.Conditions.StopLoss),
+	)
+	sm.Statsd.Inc("smart_order.volatility_trailed")
+	sm.StateMgmt.UpdateState(model.ID, model.State)
+
+	go sm.replaceStopLoss()
+}
+
+// replaceStopLoss places stop-loss order at the current stop-loss and cancels orders it replaces once placed, so the
+// position is never left without stop-loss. Orders are left as is if the new one is not placed.
+func (sm *SmartOrder) replaceStopLoss() {
+	model := sm.Strategy.GetModel()
+	isSpot := model.Conditions.MarketType == 0
+	if isSpot || model.Conditions.StopLossExternal {
+		return // stop-loss is checked on price updates
+	}
+	sm.StopLossMux.Lock()
+	defer sm.StopLossMux.Unlock()
+	stopLossOrderIds := model.State.StopLossOrderIds
+	if len(stopLossOrderIds) == 0 {
+		return
+	}
+	model.State.StopLossOrderIds = nil
+	sm.PlaceOrder(0, 0.0, Stoploss)
+	if len(model.State.StopLossOrderIds) == 0 {
+		model.State.StopLossOrderIds = stopLossOrderIds
+		sm.Strategy.GetLogger().Warn("stop-loss not replaced")
+		sm.Statsd.Inc("smart_order.stop_loss_not_replaced")
+		return
+	}
+	sm.OrdersMux.Lock()
+	for _, orderId := range stopLossOrderIds {
+		delete(sm.OrdersMap, orderId) // replaced orders cancellation shouldn't affect the state
+	}
+	sm.OrdersMux.Unlock()
+	sm.TryCancelAllOrdersConsistently(stopLossOrderIds)
+}
+
+// TrailStopPrice returns stop price moved to distance from the close price if it's closer than the stop price given,
+// a zero stop price is always moved.
+func TrailStopPrice(side string, stopPrice, close, distance float64) float64 {
+	if side == "buy" {
+		if candidate := close - distance; candidate > stopPrice {
+			return candidate
+		}
+		return stopPrice
+	}
+	if candidate := close + distance; stopPrice == 0 || candidate < stopPrice {
+		return candidate
+	}
+	return stopPrice
+}
+
+// StopLossPercentage returns stop-loss percentage with leverage of the position entered by side at entry price to
+// exit at stop price, negative if the stop price locks a profit.
+func StopLossPercentage(side string, entryPrice, stopPrice, leverage float64) float64 {
+	if side == "buy" {
+		return (1 - stopPrice/entryPrice) * 100 * leverage
+	}
+	return (stopPrice/entryPrice - 1) * 100 * leverage
+}
@@ -40,6 +40,7 @@ func (sm *SmartOrder) orderCallback(order *models.MongoOrder) {
 		return
 	}
 	sm.OrdersMux.Unlock()
+	sm.Strategy.GetJournal().OrderUpdated(order)
 
 	sm.Strategy.GetLogger().Info("before firing CheckExistingOrders")
 	err := sm.State.Fire(CheckExistingOrders, *order)
@@ -161,6 +162,7 @@ func (sm *SmartOrder) checkExistingOrders(ctx context.Context, args ...interface
 			model.State.ExitPrice = order.Average
 			if order.Filled > 0 {
 				model.State.ExecutedAmount += order.Filled
+				model.State.ExitTargetsFilled += 1
 			}
 			if model.Conditions.MarketType == 0 {
 				amount = amount - sm.Strategy.GetModel().State.Commission
@@ -237,6 +239,21 @@ func (sm *SmartOrder) checkExistingOrders(ctx context.Context, args ...interface
 			if model.State.ExecutedAmount >= amount {
 				return true
 			}
+		case TimeExit:
+			if order.Filled > 0 {
+				model.State.ExecutedAmount += order.Filled
+			}
+			model.State.ExitPrice = order.Average
+			amount := model.Conditions.EntryOrder.Amount
+			if model.Conditions.MarketType == 0 {
+				amount = amount - sm.Strategy.GetModel().State.Commission
+			}
+
+			sm.calculateAndSavePNL(model, step, order.Filled)
+			sm.StateMgmt.UpdateExecutedAmount(model.ID, model.State)
+			if model.State.ExecutedAmount >= amount {
+				return true
+			}
 		case "WithoutLoss":
 			if order.Filled > 0 {
 				model.State.ExecutedAmount += order.Filled
@@ -3,43 +3,14 @@ package strategies
 import (
 	"fmt"
 	"github.com/go-redsync/redsync/v4"
-	"gitlab.com/crypto_project/core/strategy_service/src/logging"
 	"gitlab.com/crypto_project/core/strategy_service/src/service/interfaces"
+	"gitlab.com/crypto_project/core/strategy_service/src/service/journal"
 	"gitlab.com/crypto_project/core/strategy_service/src/sources/mongodb/models"
-	"gitlab.com/crypto_project/core/strategy_service/src/sources/redis"
-	statsd_client "gitlab.com/crypto_project/core/strategy_service/src/statsd"
-	"go.mongodb.org/mongo-driver/mongo"
 	"go.uber.org/zap"
+	"reflect"
 	"time"
 )
 
-// GetStrategy instantiates strategy with resources created and given.
-func GetStrategy(cur *mongo.Cursor, df interfaces.IDataFeed, tr interfaces.ITrading, sm interfaces.IStateMgmt, createOrder interfaces.ICreateRequest, sd *statsd_client.StatsdClient) (*Strategy, error) {
-	var model models.MongoStrategy
-	err := cur.Decode(&model)
-	rs := redis.GetRedsync()
-	mutexName := fmt.Sprintf("strategy:%v:%v:%v", model.Conditions.MarketType, model.Conditions.Pair,
-		model.ID.Hex())
-	mutex := rs.NewMutex(mutexName,
-		redsync.WithTries(2),
-		redsync.WithRetryDelay(1*time.Second),
-		redsync.WithExpiry(10*time.Second), // TODO(khassanov): use parameter to conform with extend call period
-	) // upsert
-	logger, _ := logging.GetZapLogger()
-	loggerName := fmt.Sprintf("sm-%v", model.ID.Hex())
-	logger = logger.With(zap.String("logger", loggerName))
-	return &Strategy{
-		Model:           &model,
-		SettlementMutex: mutex,
-		Datafeed:        df,
-		Trading:         tr,
-		StateMgmt:       sm,
-		Statsd:          sd,
-		Singleton:       createOrder,
-		Log:             logger,
-	}, err
-}
-
 // A Strategy describes user defined rules to order trades and what are interfaces to execute these rules.
 type Strategy struct {
 	Model           *models.MongoStrategy
@@ -51,6 +22,7 @@ type Strategy struct {
 	Statsd          interfaces.IStatsClient
 	Singleton       interfaces.ICreateRequest
 	Log             interfaces.ILogger
+	Journal         interfaces.IJournal
 }
 
 func (strategy *Strategy) GetModel() *models.MongoStrategy {
@@ -89,6 +61,14 @@ func (strategy *Strategy) GetLogger() interfaces.ILogger {
 	return strategy.Log
 }
 
+// GetJournal returns the strategy timeline journal, entries are dropped if it's not set.
+func (strategy *Strategy) GetJournal() interfaces.IJournal {
+	if strategy.Journal == nil {
+		return (*journal.Journal)(nil)
+	}
+	return strategy.Journal
+}
+
 // ID returns unique identifier the strategy holds.
 func (strategy *Strategy) ID() string {
 	return fmt.Sprintf("%q", strategy.Model.ID.Hex())
@@ -110,6 +90,34 @@ func (strategy *Strategy) Start() {
 			zap.Int64("type", strategy.Model.Type),
 		)
 		strategy.StrategyRuntime = RunMakerOnlyOrder(strategy, strategy.Datafeed, strategy.Trading, strategy.Model.AccountId)
+	case 3:
+		strategy.Log.Info("running pairs order",
+			zap.String("id", strategy.ID()),
+			zap.Int64("type", strategy.Model.Type),
+		)
+		strategy.StrategyRuntime = RunPairsOrder(strategy, strategy.Datafeed, strategy.Trading, strategy.Statsd, strategy.Model.AccountId)
+		strategy.Statsd.Inc("pairs_order.runtime_start")
+	case 4:
+		strategy.Log.Info("running funding order",
+			zap.String("id", strategy.ID()),
+			zap.Int64("type", strategy.Model.Type),
+		)
+		strategy.StrategyRuntime = RunFundingOrder(strategy, strategy.Datafeed, strategy.Trading, strategy.Statsd, strategy.Model.AccountId)
+		strategy.Statsd.Inc("funding_order.runtime_start")
+	case 5:
+		strategy.Log.Info("running arbitrage order",
+			zap.String("id", strategy.ID()),
+			zap.Int64("type", strategy.Model.Type),
+		)
+		strategy.StrategyRuntime = RunArbitrageOrder(strategy, strategy.Datafeed, strategy.Trading, strategy.Statsd, strategy.Model.AccountId)
+		strategy.Statsd.Inc("arbitrage_order.runtime_start")
+	case 6:
+		strategy.Log.Info("running rebalance order",
+			zap.String("id", strategy.ID()),
+			zap.Int64("type", strategy.Model.Type),
+		)
+		strategy.StrategyRuntime = RunRebalanceOrder(strategy, strategy.Datafeed, strategy.Trading, strategy.Statsd, strategy.Model.AccountId)
+		strategy.Statsd.Inc("rebalance_order.runtime_start")
 	default:
 		strategy.Log.Warn("strategy type not supported",
 			zap.String("id", strategy.ID()),
@@ -124,6 +132,9 @@ func (strategy *Strategy) HotReload(mongoStrategy models.MongoStrategy) {
 		zap.String("id", strategy.ID()),
 	)
 	strategy.Model.Enabled = mongoStrategy.Enabled
+	if mongoStrategy.Conditions != nil && !reflect.DeepEqual(strategy.Model.Conditions, mongoStrategy.Conditions) {
+		strategy.GetJournal().ConditionsEdited(mongoStrategy.Conditions)
+	}
 	strategy.Model.Conditions = mongoStrategy.Conditions
 	if mongoStrategy.Enabled == false {
 		if strategy.StrategyRuntime != nil {
@@ -5,14 +5,18 @@ import (
 	"fmt"
 	"github.com/go-redsync/redsync/v4"
 	"gitlab.com/crypto_project/core/strategy_service/src/logging"
+	"gitlab.com/crypto_project/core/strategy_service/src/service/copytrading"
 	"gitlab.com/crypto_project/core/strategy_service/src/service/interfaces"
+	"gitlab.com/crypto_project/core/strategy_service/src/service/journal"
+	"gitlab.com/crypto_project/core/strategy_service/src/service/quotas"
+	"gitlab.com/crypto_project/core/strategy_service/src/service/signals"
 	"gitlab.com/crypto_project/core/strategy_service/src/service/strategies"
 	"gitlab.com/crypto_project/core/strategy_service/src/service/strategies/makeronly_order"
 	"gitlab.com/crypto_project/core/strategy_service/src/service/strategies/smart_order"
 	"gitlab.com/crypto_project/core/strategy_service/src/sources"
 	"gitlab.com/crypto_project/core/strategy_service/src/sources/mongodb"
 	"gitlab.com/crypto_project/core/strategy_service/src/sources/mongodb/models"
-	"gitlab.com/crypto_project/core/strategy_service/src/sources/redis"
+	"gitlab.com/crypto_project/core/strategy_service/src/sources/mongodb/schema"
 	"gitlab.com/crypto_project/core/strategy_service/src/trading/orders"
 	"log"
 
@@ -40,6 +44,12 @@ type StrategyService struct {
 	dataFeed   interfaces.IDataFeed
 	dataFeedSerum   interfaces.IDataFeed
 	stateMgmt  interfaces.IStateMgmt
+	signals     *signals.Engine // set only in the instance evaluating signals
+	signalStore interfaces.ISignalStore
+	webhookStore interfaces.IWebhookStore
+	copyTrading      *copytrading.Engine // set only in the instance copying strategies
+	copyTradingStore interfaces.ICopyTradingStore
+	quotas           *quotas.Enforcer // limits strategies and orders of owners and accounts
 	statsd     statsd_client.StatsdClient
 	log        interfaces.ILogger
 	full       bool // indicates whether an instance full or can take more strategies
@@ -63,27 +73,53 @@ func GetStrategyService() *StrategyService {
 		statsd := statsd_client.StatsdClient{}
 		statsd.Init()
 		sm := mongodb.StateMgmt{Statsd: &statsd}
-		singleton = &StrategyService{
-			pairs:      map[int8]map[string]struct{}{0: map[string]struct{}{}, 1: map[string]struct{}{}},
-			strategies: map[string]*strategies.Strategy{},
-			dataFeed:   df,
-			trading:    tr,
-			stateMgmt:  &sm,
-			statsd:     statsd,
-			log:        logger,
+		var stateMgmt interfaces.IStateMgmt = &sm
+		if store := newStateStore(&statsd); store != nil {
+			stateMgmt = store
+		} else {
+			sm.UseWriteBehind(mongodb.NewWriteBehind(writeBehindPeriod(), &statsd))
 		}
+		singleton = NewStrategyService(df, tr, stateMgmt, statsd, logger)
+		// signals, webhooks and copy trading are kept in mongodb whatever the state store
+		singleton.signalStore = &sm
+		singleton.webhookStore = &sm
+		singleton.copyTradingStore = &sm
 		logger.Info("strategy service instantiated")
 		statsd.Inc("strategy_service.instantiated")
 	})
 	return singleton
 }
 
+// NewStrategyService instantiates service with the dependencies given, e.g. to run it against in-memory stores.
+// Signals, webhooks, copy trading and quotas are kept by the state management given if it supports them.
+func NewStrategyService(df interfaces.IDataFeed, tr interfaces.ITrading, stateMgmt interfaces.IStateMgmt, statsd statsd_client.StatsdClient, logger interfaces.ILogger) *StrategyService {
+	ss := &StrategyService{
+		pairs:      map[int8]map[string]struct{}{0: map[string]struct{}{}, 1: map[string]struct{}{}},
+		strategies: map[string]*strategies.Strategy{},
+		dataFeed:   df,
+		trading:    tr,
+		stateMgmt:  stateMgmt,
+		statsd:     statsd,
+		log:        logger,
+	}
+	ss.signalStore, _ = stateMgmt.(interfaces.ISignalStore)
+	ss.webhookStore, _ = stateMgmt.(interfaces.IWebhookStore)
+	ss.copyTradingStore, _ = stateMgmt.(interfaces.ICopyTradingStore)
+	quotaStore, _ := stateMgmt.(interfaces.IQuotaStore)
+	ss.quotas = quotas.NewEnforcer(quotaStore, quotaDefaults(), df, &ss.statsd)
+	return ss
+}
+
 // Init loads enabled strategies from persistent storage and instantiates subscriptions to positions, orders and strategies updates.
 func (ss *StrategyService) Init(wg *sync.WaitGroup, isLocalBuild bool) {
 	t1 := time.Now()
 	ss.log.Info("strategy service init",
 		zap.Bool("isLocalBuild", isLocalBuild),
 	)
+	if store, ok := ss.stateMgmt.(interfaces.IStateStore); ok {
+		ss.initFromStore(store, isLocalBuild)
+		return
+	}
 	ctx := context.Background()
 
 	// Select pairs to process
@@ -142,7 +178,8 @@ func (ss *StrategyService) Init(wg *sync.WaitGroup, isLocalBuild bool) {
 	var strategiesAdded int64 = 0
 	for cur.Next(ctx) {
 		// create a value into which the single document can be decoded
-		strategy, err := strategies.GetStrategy(cur, ss.dataFeed, ss.trading, ss.stateMgmt, ss, &ss.statsd)
+		var model models.MongoStrategy
+		err := schema.DecodeStrategy(cur.Current, &model)
 		if err != nil {
 			ss.log.Error("failing to process enabled strategy",
 				zap.String("err", err.Error()),
@@ -153,6 +190,7 @@ func (ss *StrategyService) Init(wg *sync.WaitGroup, isLocalBuild bool) {
 				zap.String("err", err.Error()),
 			) // TODO(khassanov): unreachable?
 		}
+		strategy := GetStrategy(&model, ss.dataFeed, ss.trading, ss.stateMgmt, &ss.statsd, ss)
 		if strategy.Model.AccountId != nil && strategy.Model.AccountId.Hex() == "5e4ce62b1318ef1b1e85b6f4" {
 			continue
 		}
@@ -167,6 +205,7 @@ func (ss *StrategyService) Init(wg *sync.WaitGroup, isLocalBuild bool) {
 			zap.String("ObjectID", strategy.Model.ID.String()),
 		)
 		GetStrategyService().strategies[strategy.Model.ID.String()] = strategy
+		ss.recordCandles(strategy.Model)
 		go strategy.Start()
 		strategiesAdded++
 	}
@@ -179,6 +218,10 @@ func (ss *StrategyService) Init(wg *sync.WaitGroup, isLocalBuild bool) {
 	go ss.WatchStrategies(isLocalBuild, accountId) // subscribe to new smart trades to add them into runtime
 	go ss.runReporting()
 	go ss.runIsFullTracking()
+	go ss.RunSignals()
+	go ss.RunCopyTrading()
+	go ss.runArchiving()
+	go ss.runSchemaMigration()
 
 	if err := cur.Err(); err != nil { // TODO(khassanov): can we retry here?
 		wg.Done()
@@ -190,49 +233,75 @@ func (ss *StrategyService) Init(wg *sync.WaitGroup, isLocalBuild bool) {
 	ss.log.Info("init complete, ready to settle strategies", zap.Duration("elapsed while init", dt))
 }
 
-// GetStrategy creates strategy instance with given arguments.
+// GetStrategy creates strategy instance with given arguments, trading of the strategy checks orders against quotas.
+// Strategies loaded on init and added by updates are all created by it.
 func GetStrategy(strategy *models.MongoStrategy, df interfaces.IDataFeed, tr interfaces.ITrading, st interfaces.IStateMgmt, statsd *statsd_client.StatsdClient, ss *StrategyService) *strategies.Strategy {
-	// TODO(khassanov): why we use this instead of the same from the `strategy` package?
-	// TODO(khassanov): remove code copy got from the same in the strategy package
 	logger, _ := logging.GetZapLogger()
 	loggerName := fmt.Sprintf("sm-%v", strategy.ID.Hex())
 	logger = logger.With(zap.String("logger", loggerName))
-	rs := redis.GetRedsync()
+	rs := ss.redsync()
 	mutexName := fmt.Sprintf("strategy:%v:%v", strategy.Conditions.Pair, strategy.ID.Hex())
 	mutex := rs.NewMutex(mutexName,
 		redsync.WithTries(2),
 		redsync.WithRetryDelay(200*time.Millisecond),
 		redsync.WithExpiry(10*time.Second), // TODO(khassanov): use parameter to conform with extend call period
 	) // upsert
+	journalStore, _ := st.(interfaces.IJournalStore)
 	return &strategies.Strategy{
 		Model:           strategy,
 		SettlementMutex: mutex,
 		Datafeed:        df,
-		Trading:         tr,
+		Trading:         ss.quotas.Trading(tr, strategy),
 		StateMgmt:       st,
 		Singleton:       ss,
 		Statsd:          statsd,
 		Log:             logger,
+		Journal:         journal.New(*strategy.ID, journalStore),
 	}
 }
 
-// AddStrategy instantiates given strategy to store in the service instance and start it.
-func (ss *StrategyService) AddStrategy(strategy *models.MongoStrategy) {
+// AddStrategy instantiates given strategy to store in the service instance and start it. Quotas are checked for
+// strategies just enabled, inserted enabled or enabled by an update, once settled so the check is done by the instance
+// running it only.
+func (ss *StrategyService) AddStrategy(strategy *models.MongoStrategy, enabled bool) {
 	if ss.strategies[strategy.ID.String()] == nil {
 		sig := GetStrategy(strategy, ss.dataFeed, ss.trading, ss.stateMgmt, &ss.statsd, ss)
 		if ok, err := sig.Settle(); !ok || err != nil {
 			return // TODO(khassanov): distinguish a state locked in dlm and network errors
 		}
+		if enabled {
+			if err := ss.quotas.CheckStrategy(strategy); err != nil {
+				ss.statsd.Inc("strategy_service.quota_rejected")
+				ss.rejectStrategy(strategy, err)
+				return
+			}
+		}
+		if err := smart_order.ValidateConditions(strategy); err != nil {
+			ss.statsd.Inc("strategy_service.conditions_rejected")
+			ss.rejectStrategy(strategy, err)
+			return
+		}
 		ss.log.Info("adding strategy",
 			zap.String("ObjectID", sig.Model.ID.Hex()),
 		)
 		ss.strategies[sig.Model.ID.String()] = sig
+		ss.recordCandles(sig.Model)
 		go sig.Start()
 		ss.statsd.Inc("strategy_service.add_strategy")
 		ss.statsd.Gauge("strategy_service.active_strategies", int64(len(ss.strategies)))
 	}
 }
 
+// recordCandles starts candles history of the strategy pair on load, so candles are there by the time the strategy
+// measures volatility or evaluates indicators.
+func (ss *StrategyService) recordCandles(strategy *models.MongoStrategy) {
+	recorder, ok := ss.dataFeed.(interfaces.ICandleRecorder)
+	if !ok || strategy.Conditions == nil {
+		return
+	}
+	recorder.RecordCandles(strategy.Conditions.Pair, strategy.Conditions.Exchange, strategy.Conditions.MarketType)
+}
+
 // CreateOrder instantiates smart trade strategy with requested parameters and adds it to the service runtime.
 func (ss *StrategyService) CreateOrder(request orders.CreateOrderRequest) orders.OrderResponse {
 	t1 := time.Now()
@@ -247,6 +316,51 @@ func (ss *StrategyService) CreateOrder(request orders.CreateOrderRequest) orders
 
 	hedgeMode := request.KeyParams.PositionSide != "BOTH"
 
+	ownerId := primitive.NilObjectID
+	if request.OwnerId != nil {
+		ownerId = *request.OwnerId
+	}
+	quotaCheck := models.MongoStrategy{
+		ID:        &id,
+		AccountId: request.KeyId,
+		OwnerId:   ownerId,
+		Conditions: &models.MongoStrategyCondition{
+			Pair:       request.KeyParams.Symbol,
+			MarketType: request.KeyParams.MarketType,
+			EntryOrder: &models.MongoEntryPoint{Amount: request.KeyParams.Amount},
+		},
+	}
+	if conditions := request.KeyParams.Params.SmartOrder; conditions != nil {
+		if err := smart_order.ValidateConditions(&models.MongoStrategy{Conditions: conditions}); err != nil {
+			ss.log.Warn("order rejected by conditions", zap.Error(err))
+			ss.statsd.Inc("strategy_service.conditions_rejected")
+			return orders.OrderResponse{
+				Status: "ERR",
+				Data: orders.OrderResponseData{
+					Msg: err.Error(),
+				},
+			}
+		}
+	}
+	// orders placed by runtimes are counted by trading of the strategy placing them and don't add strategies to quotas
+	var err error
+	if request.ParentId == nil {
+		err = ss.quotas.CheckOrder(request.OwnerId, request.KeyId)
+		if err == nil {
+			err = ss.quotas.CheckStrategy(&quotaCheck)
+		}
+	}
+	if err != nil {
+		ss.log.Warn("order rejected by quota", zap.Error(err))
+		ss.statsd.Inc("strategy_service.quota_rejected")
+		return orders.OrderResponse{
+			Status: "ERR",
+			Data: orders.OrderResponseData{
+				Msg: err.Error(),
+			},
+		}
+	}
+
 	order := models.MongoOrder{
 		ID:           id,
 		Status:       "open",
@@ -379,11 +493,11 @@ func (ss *StrategyService) CreateOrder(request orders.CreateOrderRequest) orders
 		SignalIds:       nil,
 		OrderIds:        nil,
 		WaitForOrderIds: nil,
-		OwnerId:         primitive.ObjectID{},
+		OwnerId:         ownerId,
 		Social:          models.MongoSocial{},
 		CreatedAt:       time.Time{},
 	}
-	go ss.AddStrategy(&strategy)
+	go ss.AddStrategy(&strategy, false)
 	hex := id.Hex()
 	response := orders.OrderResponse{
 		Status: "OK",
@@ -438,6 +552,17 @@ func (ss *StrategyService) CancelOrder(request orders.CancelOrderRequest) orders
 		zap.String("strategy", fmt.Sprintf("%+v", strategy)),
 	)
 
+	if !quotas.CanManage(ss.stateMgmt.GetStrategy(&id), request.OwnerId, request.KeyId) {
+		ss.statsd.Inc("strategy_service.cancel_forbidden")
+		return orders.OrderResponse{
+			Status: "ERR",
+			Data: orders.OrderResponseData{
+				OrderId: request.KeyParams.OrderId,
+				Msg:     "only the strategy owner can cancel the order",
+			},
+		}
+	}
+
 	if strategy != nil {
 		pointStrategy := *ss.strategies[id.String()]
 		pointStrategy.GetModel().LastUpdate = 10
@@ -500,7 +625,7 @@ func (ss *StrategyService) WatchStrategies(isLocalBuild bool, accountId string)
 
 	for cs.Next(ctx) {
 		var event models.MongoStrategyUpdateEvent
-		err := cs.Decode(&event)
+		err := schema.DecodeStrategyEvent(cs.Current, &event)
 
 		//	data := next.String()
 		// log.Print(data)
@@ -512,130 +637,145 @@ func (ss *StrategyService) WatchStrategies(isLocalBuild bool, accountId string)
 			continue
 		}
 
-		if event.FullDocument.ID == nil {
-			ss.log.Error("new smart order id is nil",
-				zap.String("event.FullDocument", fmt.Sprintf("%+v", event.FullDocument)),
-			)
-			continue
-		}
+		ss.processStrategyUpdate(&event.FullDocument, event.Enables(), isLocalBuild, accountId)
+	}
+	ss.log.Fatal("new strategies watch")
+	return nil
+}
 
-		// disable SM for Anton in dev
-		if event.FullDocument.AccountId != nil && event.FullDocument.AccountId.Hex() == "5e4ce62b1318ef1b1e85b6f4" {
-			continue
-		}
+// processStrategyUpdate adds a new enabled strategy to runtime or hot reloads the one running with the update given.
+// Quotas are checked for strategies the update enables, strategies taken over from another instance are added as they
+// are.
+func (ss *StrategyService) processStrategyUpdate(strategy *models.MongoStrategy, enabled bool, isLocalBuild bool, accountId string) {
+	if strategy.ID == nil {
+		ss.log.Error("new smart order id is nil",
+			zap.String("event.FullDocument", fmt.Sprintf("%+v", *strategy)),
+		)
+		return
+	}
 
-		if _, ok := ss.pairs[int8(event.FullDocument.Conditions.MarketType)][event.FullDocument.Conditions.Pair]; !ok {
-			continue // skip a foreign pair
-		}
+	// disable SM for Anton in dev
+	if strategy.AccountId != nil && strategy.AccountId.Hex() == "5e4ce62b1318ef1b1e85b6f4" {
+		return
+	}
 
-		if event.FullDocument.Type == 2 && event.FullDocument.State.ColdStart { // 2 means maker only
-			sig := GetStrategy(&event.FullDocument, ss.dataFeed, ss.trading, ss.stateMgmt, &ss.statsd, ss)
-			ss.strategies[event.FullDocument.ID.String()] = sig
-			ss.log.Info("continue in maker-only cold start")
-			continue
-		}
+	if _, ok := ss.pairs[int8(strategy.Conditions.MarketType)][strategy.Conditions.Pair]; !ok {
+		return // skip a foreign pair
+	}
+
+	if strategy.Type == 2 && strategy.State.ColdStart { // 2 means maker only
+		sig := GetStrategy(strategy, ss.dataFeed, ss.trading, ss.stateMgmt, &ss.statsd, ss)
+		ss.strategies[strategy.ID.String()] = sig
+		ss.log.Info("continue in maker-only cold start")
+		return
+	}
 
-		if isLocalBuild && (event.FullDocument.AccountId == nil || event.FullDocument.AccountId.Hex() != accountId) {
-			ss.log.Warn("continue watchStrategies in accountId incomparable",
-				zap.String("ObjectID", event.FullDocument.ID.Hex()),
-				zap.String("event AccountID", event.FullDocument.AccountId.Hex()),
-				zap.String("AccountID in .env", accountId),
+	if isLocalBuild && (strategy.AccountId == nil || strategy.AccountId.Hex() != accountId) {
+		ss.log.Warn("continue watchStrategies in accountId incomparable",
+			zap.String("ObjectID", strategy.ID.Hex()),
+			zap.String("event AccountID", strategy.AccountId.Hex()),
+			zap.String("AccountID in .env", accountId),
+		)
+		return
+	}
+
+	if ss.strategies[strategy.ID.String()] != nil {
+		running := ss.strategies[strategy.ID.String()].GetModel()
+		if !canEdit(running, strategy) {
+			ss.log.Warn("reverting conditions edited by a user other than the owner",
+				zap.String("strategy", strategy.ID.Hex()),
+				zap.String("editedBy", strategy.EditedBy.Hex()),
 			)
-			continue
+			ss.statsd.Inc("strategy_service.edit_forbidden")
+			ss.stateMgmt.UpdateConditions(strategy.ID, running.Conditions)
+			return
 		}
-
-		if ss.strategies[event.FullDocument.ID.String()] != nil {
-			ss.strategies[event.FullDocument.ID.String()].HotReload(event.FullDocument)
-			ss.EditConditions(ss.strategies[event.FullDocument.ID.String()])
-			if event.FullDocument.Enabled == false {
-				delete(ss.strategies, event.FullDocument.ID.String())
-			}
-		} else { // brand new smart trade
-			if ss.full {
-				ss.log.Debug("ignoring new strategy while the instance is full",
-					zap.Bool("full", ss.full),
-					zap.String("strategy", event.FullDocument.ID.Hex()),
-					zap.Bool("strategy enabled", event.FullDocument.Enabled),
-				)
-				continue
-			}
-			if event.FullDocument.Enabled == true {
-				ss.AddStrategy(&event.FullDocument)
-				ss.statsd.Inc("strategy_service.add_strategy_from_db")
-			}
+		ss.strategies[strategy.ID.String()].HotReload(*strategy)
+		ss.EditConditions(ss.strategies[strategy.ID.String()])
+		if strategy.Enabled == false {
+			delete(ss.strategies, strategy.ID.String())
+		}
+	} else { // brand new smart trade
+		if ss.full {
+			ss.log.Debug("ignoring new strategy while the instance is full",
+				zap.Bool("full", ss.full),
+				zap.String("strategy", strategy.ID.Hex()),
+				zap.Bool("strategy enabled", strategy.Enabled),
+			)
+			return
+		}
+		if strategy.Enabled == true {
+			ss.AddStrategy(strategy, enabled)
+			ss.statsd.Inc("strategy_service.add_strategy_from_db")
 		}
 	}
-	ss.log.Fatal("new strategies watch")
-	return nil
 }
 
 // InitPositionsWatch subscribes to smart trade updates for each position update received to disable smart trade if position closed externally.
+// The watch is resumed after interruptions.
 func (ss *StrategyService) InitPositionsWatch() {
 	ss.log.Info("watching for new positions in the storage")
 	ctx := context.Background()
-	var collPositions = mongodb.GetCollection("core_positions")
-	pipeline := mongo.Pipeline{}
-
-	cs, err := collPositions.Watch(ctx, pipeline, options.ChangeStream().SetFullDocument(options.UpdateLookup))
-	if err != nil {
-		ss.log.Info("panic error on watching positions")
-		panic(err.Error())
-	}
-	//require.NoError(cs, err)
-	defer cs.Close(ctx)
-	for cs.Next(ctx) {
-		var positionEventDecoded models.MongoPositionUpdateEvent
-		err := cs.Decode(&positionEventDecoded)
-		//	data := next.String()
-		// log.Print(data)
-		//		err := json.Unmarshal([]byte(data), &event)
-		if err != nil {
-			ss.log.Info("event decode in processing position",
-				zap.String("err", err.Error()),
-			)
-		}
-
-		go func(event models.MongoPositionUpdateEvent) {
-			var collStrategies = mongodb.GetCollection("core_strategies")
-			cur, err := collStrategies.Find(ctx, bson.D{
-				{"conditions.marketType", 1},
-				{"enabled", true},
-				{"accountId", event.FullDocument.KeyId},
-				{"conditions.pair", event.FullDocument.Symbol}},
-			)
-
+	watch := mongodb.ResumableWatch{
+		Name:       "positions",
+		Collection: mongodb.GetCollection("core_positions"),
+		Pipeline:   mongo.Pipeline{},
+		Statsd:     &ss.statsd,
+		Handle: func(cs *mongo.ChangeStream) {
+			var positionEventDecoded models.MongoPositionUpdateEvent
+			err := cs.Decode(&positionEventDecoded)
 			if err != nil {
-				ss.log.Fatal("on finding enabled strategies by position",
+				ss.log.Info("event decode in processing position",
 					zap.String("err", err.Error()),
 				)
+				return
 			}
+			go ss.processPositionUpdate(ctx, positionEventDecoded)
+		},
+	}
+	watch.Run()
+}
+
+// processPositionUpdate disables smart trades at the key and symbol of the position closed if they wait for it.
+func (ss *StrategyService) processPositionUpdate(ctx context.Context, event models.MongoPositionUpdateEvent) {
+	var collStrategies = mongodb.GetCollection("core_strategies")
+	cur, err := collStrategies.Find(ctx, bson.D{
+		{"conditions.marketType", 1},
+		{"enabled", true},
+		{"accountId", event.FullDocument.KeyId},
+		{"conditions.pair", event.FullDocument.Symbol}},
+	)
+
+	if err != nil {
+		ss.log.Error("on finding enabled strategies by position",
+			zap.String("err", err.Error()),
+		)
+		return
+	}
 
-			defer cur.Close(ctx)
+	defer cur.Close(ctx)
 
-			for cur.Next(ctx) {
-				var strategyEventDecoded models.MongoStrategy
-				err := cur.Decode(&strategyEventDecoded)
+	for cur.Next(ctx) {
+		var strategyEventDecoded models.MongoStrategy
+		err := schema.DecodeStrategy(cur.Current, &strategyEventDecoded)
 
-				if err != nil {
-					ss.log.Error("event decode on processing strategy found by position close",
-						zap.String("err", err.Error()),
-					)
-				}
+		if err != nil {
+			ss.log.Error("event decode on processing strategy found by position close",
+				zap.String("err", err.Error()),
+			)
+		}
 
-				// if SM created before last position update
-				// then we caught position event before actual update
-				if positionEventDecoded.FullDocument.PositionAmt == 0 {
-					strategy := ss.strategies[strategyEventDecoded.ID.String()]
-					if strategy != nil && strategy.GetModel().Conditions.PositionWasClosed {
-						ss.log.Info("disabled by position close")
-						strategy.GetModel().Enabled = false
-						collStrategies.FindOneAndUpdate(ctx, bson.D{{"_id", strategyEventDecoded.ID}}, bson.M{"$set": bson.M{"enabled": false}})
-					}
-				}
+		// if SM created before last position update
+		// then we caught position event before actual update
+		if event.FullDocument.PositionAmt == 0 {
+			strategy := ss.strategies[strategyEventDecoded.ID.String()]
+			if strategy != nil && strategy.GetModel().Conditions.PositionWasClosed {
+				ss.log.Info("disabled by position close")
+				strategy.GetModel().Enabled = false
+				collStrategies.FindOneAndUpdate(ctx, bson.D{{"_id", strategyEventDecoded.ID}}, bson.M{"$set": bson.M{"enabled": false}, "$inc": bson.M{"version": 1}})
 			}
-		}(positionEventDecoded)
+		}
 	}
-	ss.log.Fatal("new positions watch")
 }
 
 func (ss *StrategyService) EditConditions(strategy *strategies.Strategy) {
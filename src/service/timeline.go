@@ -0,0 +1,99 @@
+package service
+
+import (
+	"time"
+
+	"gitlab.com/crypto_project/core/strategy_service/src/service/interfaces"
+	"gitlab.com/crypto_project/core/strategy_service/src/service/journal"
+	"gitlab.com/crypto_project/core/strategy_service/src/sources/mongodb/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.uber.org/zap"
+)
+
+// A TimelineResponse lists journal entries of a strategy in order.
+type TimelineResponse struct {
+	Status   string                     `json:"status"`
+	Msg      string                     `json:"msg,omitempty"`
+	Timeline []models.MongoJournalEntry `json:"timeline"`
+}
+
+// A RebuildResponse holds the state and conditions rebuilt from a strategy journal.
+type RebuildResponse struct {
+	Status     string                         `json:"status"`
+	Msg        string                         `json:"msg,omitempty"`
+	State      *models.MongoStrategyState     `json:"state,omitempty"`
+	Conditions *models.MongoStrategyCondition `json:"conditions,omitempty"`
+	Applied    bool                           `json:"applied"`
+}
+
+// GetTimeline returns journal entries of the strategy given, e.g. to render what a smart trade did and why.
+func (ss *StrategyService) GetTimeline(strategyHex string, afterSeq int64) TimelineResponse {
+	store, strategyId, msg := ss.journalStore(strategyHex)
+	if msg != "" {
+		return TimelineResponse{Status: "ERR", Msg: msg}
+	}
+	entries := store.GetJournal(strategyId, afterSeq)
+	if entries == nil {
+		entries = []models.MongoJournalEntry{}
+	}
+	return TimelineResponse{Status: "OK", Timeline: entries}
+}
+
+// RebuildState replays the strategy journal to get its state and conditions. With apply set the rebuilt state and
+// conditions edited are saved, which is refused for strategies enabled as their runtime, in this instance or another
+// one, would overwrite them.
+func (ss *StrategyService) RebuildState(strategyHex string, apply bool) RebuildResponse {
+	t1 := time.Now()
+	store, strategyId, msg := ss.journalStore(strategyHex)
+	if msg != "" {
+		return RebuildResponse{Status: "ERR", Msg: msg}
+	}
+	entries := store.GetJournal(strategyId, 0)
+	if len(entries) == 0 {
+		return RebuildResponse{Status: "ERR", Msg: "journal is empty"}
+	}
+	state, conditions, err := journal.Rebuild(entries)
+	if err != nil {
+		return RebuildResponse{Status: "ERR", Msg: err.Error(), State: state, Conditions: conditions}
+	}
+	response := RebuildResponse{Status: "OK", State: state, Conditions: conditions}
+	if !apply {
+		return response
+	}
+	stored := ss.stateMgmt.GetStrategy(strategyId)
+	if stored == nil {
+		response.Status = "ERR"
+		response.Msg = "strategy not found"
+		return response
+	}
+	if stored.Enabled {
+		response.Status = "ERR"
+		response.Msg = "strategy is enabled, disable it first"
+		return response
+	}
+	ss.stateMgmt.UpdateStrategyState(strategyId, state)
+	if conditions != nil {
+		ss.stateMgmt.UpdateConditions(strategyId, conditions)
+	}
+	response.Applied = true
+	ss.log.Info("strategy state rebuilt from journal",
+		zap.String("strategy", strategyHex),
+		zap.Int("entries", len(entries)),
+		zap.String("state", state.State),
+	)
+	ss.statsd.TimingDuration("strategy_service.rebuild_state", time.Since(t1))
+	return response
+}
+
+// journalStore returns the journal store and the strategy id parsed, or a message why they can't be.
+func (ss *StrategyService) journalStore(strategyHex string) (interfaces.IJournalStore, *primitive.ObjectID, string) {
+	store, ok := ss.stateMgmt.(interfaces.IJournalStore)
+	if !ok {
+		return nil, nil, "journal is not kept"
+	}
+	strategyId, err := primitive.ObjectIDFromHex(strategyHex)
+	if err != nil {
+		return nil, nil, "malformed strategy id"
+	}
+	return store, &strategyId, ""
+}
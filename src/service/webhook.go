@@ -0,0 +1,183 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"gitlab.com/crypto_project/core/strategy_service/src/sources/mongodb/models"
+	"gitlab.com/crypto_project/core/strategy_service/src/trading/orders"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.uber.org/zap"
+)
+
+// WebhookMaxAge is a replay window in seconds, signals fired earlier or later are rejected.
+const WebhookMaxAge = 60
+
+// ProcessWebhook authenticates external signal by template token, spawns a strategy from the template and records the attempt to the audit trail.
+func (ss *StrategyService) ProcessWebhook(token string, body []byte, remoteAddr string) orders.OrderResponse {
+	t1 := time.Now()
+	ss.statsd.Inc("strategy_service.webhook_request")
+	event := models.MongoWebhookEvent{
+		ID:         primitive.NewObjectID(),
+		RemoteAddr: remoteAddr,
+		Payload:    string(body),
+		ReceivedAt: t1,
+	}
+	reject := func(msg string) orders.OrderResponse {
+		ss.statsd.Inc("strategy_service.webhook_rejected")
+		ss.log.Warn("webhook rejected",
+			zap.String("msg", msg),
+			zap.String("remoteAddr", remoteAddr),
+		)
+		event.Status = models.WebhookRejected
+		event.Msg = msg
+		go ss.webhookStore.SaveWebhookEvent(event)
+		return orders.OrderResponse{Status: "ERR", Data: orders.OrderResponseData{Msg: msg}}
+	}
+
+	template := ss.webhookStore.GetTemplateByToken(token)
+	if token == "" || template == nil {
+		return reject("unknown token")
+	}
+	event.TemplateStrategyId = template.ID
+
+	var payload models.WebhookPayload
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return reject(fmt.Sprintf("malformed payload: %v", err))
+	}
+	now := t1.Unix()
+	if payload.Timestamp < now-WebhookMaxAge || payload.Timestamp > now+WebhookMaxAge {
+		return reject("timestamp out of replay window")
+	}
+	nonce := payload.Id
+	if nonce == "" {
+		sum := sha256.Sum256(body)
+		nonce = hex.EncodeToString(sum[:])
+	}
+	event.Nonce = nonce
+	if !ss.webhookStore.RegisterWebhookNonce(template.ID.Hex() + ":" + nonce) {
+		return reject("replayed signal")
+	}
+
+	var lastPrice float64
+	if conditions := template.Conditions; payload.Stop > 0 && payload.Price == 0 && conditions != nil {
+		if ohlcv := ss.dataFeed.GetPriceForPairAtExchange(conditions.Pair, conditions.Exchange, conditions.MarketType); ohlcv != nil {
+			lastPrice = ohlcv.Close
+		}
+	}
+	strategy, err := NewStrategyFromTemplate(template, payload, lastPrice)
+	if err != nil {
+		return reject(err.Error())
+	}
+	ss.stateMgmt.CreateStrategy(strategy) // picked up by the strategies watch
+	event.StrategyId = strategy.ID
+	event.Status = models.WebhookAccepted
+	go ss.webhookStore.SaveWebhookEvent(event)
+	ss.log.Info("strategy created by webhook",
+		zap.String("template", template.ID.Hex()),
+		zap.String("strategy", strategy.ID.Hex()),
+	)
+	ss.statsd.TimingDuration("strategy_service.webhook", time.Since(t1))
+	return orders.OrderResponse{
+		Status: "OK",
+		Data: orders.OrderResponseData{
+			OrderId: strategy.ID.Hex(),
+			Status:  "open",
+			Amount:  strategy.Conditions.EntryOrder.Amount,
+			Price:   strategy.Conditions.EntryOrder.Price,
+		},
+	}
+}
+
+// NewStrategyFromTemplate maps payload fields onto a copy of template conditions and returns a new enabled strategy.
+// Stop of entries without price is checked against the last price given, such a stop is rejected if it's 0.
+func NewStrategyFromTemplate(template *models.MongoStrategy, payload models.WebhookPayload, lastPrice float64) (*models.MongoStrategy, error) {
+	if template.Conditions == nil || template.Conditions.EntryOrder == nil {
+		return nil, fmt.Errorf("template has no entry order")
+	}
+	conditions := *template.Conditions
+	entryOrder := *template.Conditions.EntryOrder
+	conditions.EntryOrder = &entryOrder
+	conditions.TemplateToken = ""
+	conditions.CreatedByTemplate = true
+	conditions.TemplateStrategyId = template.ID
+
+	switch payload.Side {
+	case "buy", "sell":
+		entryOrder.Side = payload.Side
+	case "":
+		if entryOrder.Side == "" {
+			return nil, fmt.Errorf("side not specified")
+		}
+	default:
+		return nil, fmt.Errorf("unknown side %v", payload.Side)
+	}
+	if payload.Amount < 0 || payload.Price < 0 || payload.Stop < 0 {
+		return nil, fmt.Errorf("negative amount or price")
+	}
+	if payload.Amount > 0 {
+		entryOrder.Amount = payload.Amount
+	}
+	if entryOrder.Amount == 0 {
+		return nil, fmt.Errorf("amount not specified")
+	}
+	if payload.Price > 0 {
+		entryOrder.Price = payload.Price
+		entryOrder.Type = 0
+		entryOrder.OrderType = "limit"
+	} else if entryOrder.ActivatePrice == 0 {
+		entryOrder.Price = 0
+		entryOrder.OrderType = "market"
+	}
+
+	if payload.Stop > 0 {
+		price := payload.Price
+		if price == 0 {
+			price = lastPrice
+		}
+		if price == 0 {
+			return nil, fmt.Errorf("stop %v can't be checked without price", payload.Stop)
+		}
+		if entryOrder.Side == "buy" && payload.Stop >= price || entryOrder.Side == "sell" && payload.Stop <= price {
+			return nil, fmt.Errorf("stop %v is on the wrong side of price %v", payload.Stop, price)
+		}
+		conditions.StopLossPrice = payload.Stop
+	}
+
+	if len(payload.Targets) > 0 {
+		orderType := "limit"
+		if len(template.Conditions.ExitLevels) > 0 && template.Conditions.ExitLevels[0].OrderType != "" {
+			orderType = template.Conditions.ExitLevels[0].OrderType
+		}
+		amount := entryOrder.Amount / float64(len(payload.Targets)) // the last target takes the rest anyway
+		conditions.ExitLevels = make([]*models.MongoEntryPoint, 0, len(payload.Targets))
+		for _, target := range payload.Targets {
+			if target <= 0 {
+				return nil, fmt.Errorf("bad target %v", target)
+			}
+			conditions.ExitLevels = append(conditions.ExitLevels, &models.MongoEntryPoint{
+				Price:     target,
+				Amount:    amount,
+				Type:      0,
+				OrderType: orderType,
+			})
+		}
+	}
+
+	id := primitive.NewObjectID()
+	return &models.MongoStrategy{
+		ID:          &id,
+		Type:        template.Type,
+		Enabled:     true,
+		AccountId:   template.AccountId,
+		Conditions:  &conditions,
+		State:       &models.MongoStrategyState{},
+		TriggerWhen: template.TriggerWhen,
+		OwnerId:     template.OwnerId,
+		Social:      template.Social,
+		CreatedAt:   time.Now(),
+	}, nil
+}
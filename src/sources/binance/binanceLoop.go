@@ -5,17 +5,25 @@ import (
 	"github.com/Cryptocurrencies-AI/go-binance"
 	"gitlab.com/crypto_project/core/strategy_service/src/logging"
 	"gitlab.com/crypto_project/core/strategy_service/src/service/interfaces"
+	"gitlab.com/crypto_project/core/strategy_service/src/sources/candles"
 	"go.uber.org/zap"
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 )
 
 type BinanceLoop struct {
-	OhlcvMap  sync.Map // <string: exchange+pair+o/h/l/c/v, OHLCV: ohlcv>
-	SpreadMap sync.Map
+	OhlcvMap   sync.Map // <string: exchange+pair+o/h/l/c/v, OHLCV: ohlcv>
+	SpreadMap  sync.Map
+	FundingMap sync.Map // <string: exchange+pair, FundingData: funding>
+	Candles    *candles.History
+	volumes    sync.Map // <string: exchange+pair+marketType, float64: rolling 24h base volume>
 }
 
+// candleHistorySize is a count of bars kept per pair and timeframe.
+const candleHistorySize = 500
+
 var binanceLoop *BinanceLoop
 var log interfaces.ILogger
 
@@ -26,7 +34,7 @@ func init() {
 
 func InitBinance() interfaces.IDataFeed {
 	if binanceLoop == nil {
-		binanceLoop = &BinanceLoop{}
+		binanceLoop = &BinanceLoop{Candles: candles.NewHistory(candleHistorySize)}
 		binanceLoop.SubscribeToPairs()
 	}
 	return binanceLoop
@@ -34,7 +42,7 @@ func InitBinance() interfaces.IDataFeed {
 
 func (rl *BinanceLoop) GetPriceForPairAtExchange(pair string, exchange string, marketType int64) *interfaces.OHLCV {
 	if binanceLoop == nil {
-		binanceLoop = &BinanceLoop{}
+		binanceLoop = &BinanceLoop{Candles: candles.NewHistory(candleHistorySize)}
 		binanceLoop.SubscribeToPairs()
 	}
 	return binanceLoop.GetPrice(pair, exchange, marketType)
@@ -42,12 +50,34 @@ func (rl *BinanceLoop) GetPriceForPairAtExchange(pair string, exchange string, m
 
 func (rl *BinanceLoop) GetSpreadForPairAtExchange(pair string, exchange string, marketType int64) *interfaces.SpreadData {
 	if binanceLoop == nil {
-		binanceLoop = &BinanceLoop{}
+		binanceLoop = &BinanceLoop{Candles: candles.NewHistory(candleHistorySize)}
 		binanceLoop.SubscribeToPairs()
 	}
 	return binanceLoop.GetSpread(pair, exchange, marketType)
 }
 
+func (rl *BinanceLoop) GetFundingForPairAtExchange(pair string, exchange string) *interfaces.FundingData {
+	if binanceLoop == nil {
+		binanceLoop = &BinanceLoop{Candles: candles.NewHistory(candleHistorySize)}
+		binanceLoop.SubscribeToPairs()
+	}
+	return binanceLoop.GetFunding(pair)
+}
+
+// GetCandles returns up to n last closed candles of the timeframe oldest first. History is recorded since the pair
+// strategy loaded or the first request of the pair and backfilled from klines, so it may have less candles than
+// requested for a while.
+func (rl *BinanceLoop) GetCandles(pair string, exchange string, marketType int64, timeframe string, n int) []interfaces.Candle {
+	rl.RecordCandles(pair, exchange, marketType)
+	key := "binance" + symbolOf(pair) + strconv.FormatInt(marketType, 10)
+	return binanceLoop.Candles.Get(key, timeframe, n)
+}
+
+// symbolOf returns exchange symbol of the pair, e.g. BTCUSDT of BTC_USDT.
+func symbolOf(pair string) string {
+	return strings.Replace(pair, "_", "", -1)
+}
+
 type MiniTicker struct {
 	// EventType string `json:"e,string"` // "24hrMiniTicker"
 	// EventTime time.Time `json:"E,number"` // 123456789
@@ -55,10 +85,10 @@ type MiniTicker struct {
 	// Close float64 `json:"c,string"` // "0.0025"
 	Symbol string `json:"s"` // "BNBBTC"
 	Close  string `json:"c"` // "0.0025"
+	Volume string `json:"v"` // "10000", rolling 24h base volume
 	// Open float64 `json:"o,string"` // "0.0010"
 	// High float64 `json:"h,string"` // "0.0025"
 	// Low float64 `json:"l,string"` // "0.0010"
-	// Volume float64 `json:"v,string"` // "10000"
 	// Quote float64 `json:"q,string"` // "18"
 }
 
@@ -70,12 +100,22 @@ type RawSpread struct {
 	Symbol       string  `json:"s"`
 }
 
+// RawMarkPrice is a futures mark price update with funding rate.
+type RawMarkPrice struct {
+	Symbol          string  `json:"s"`
+	MarkPrice       float64 `json:"p,string"`
+	IndexPrice      float64 `json:"i,string"`
+	FundingRate     float64 `json:"r,string"`
+	NextFundingTime int64   `json:"T"`
+}
+
 func (rl *BinanceLoop) SubscribeToPairs() {
 	go ListenBinancePrice(func(data *binance.RawEvent, marketType int8) error {
 		go rl.UpdateOHLCV(data.Data, marketType)
 		return nil
 	})
 	rl.SubscribeToSpread()
+	rl.SubscribeToFunding()
 }
 
 // UpdateOHLCV decodes raw OHLCV data and writes them to OHLCVMap for future use.
@@ -88,6 +128,7 @@ func (rl *BinanceLoop) UpdateOHLCV(data []byte, marketType int8) {
 		)
 		return
 	}
+	now := time.Now().Unix()
 	for _, ohlcv := range allMarketOHLCV {
 		pair := ohlcv.Symbol
 		price, err := strconv.ParseFloat(ohlcv.Close, 10)
@@ -97,15 +138,33 @@ func (rl *BinanceLoop) UpdateOHLCV(data []byte, marketType int8) {
 			)
 			continue
 		}
+		key := "binance" + pair + strconv.FormatInt(int64(marketType), 10)
+		volume := rl.tickVolume(key, ohlcv.Volume)
 		ohlcvToSave := interfaces.OHLCV{
 			Open:   price,
 			High:   price,
 			Low:    price,
 			Close:  price,
-			Volume: price,
+			Volume: volume,
 		}
-		rl.OhlcvMap.Store("binance"+pair+strconv.FormatInt(int64(marketType), 10), ohlcvToSave)
+		rl.OhlcvMap.Store(key, ohlcvToSave)
+		rl.Candles.Update(key, ohlcvToSave, now)
+	}
+}
+
+// tickVolume returns base volume traded since the previous ticker of the key by rolling 24h volume given. Volume is
+// zero for the first ticker and when trades leaving the 24h window outweigh the new ones.
+func (rl *BinanceLoop) tickVolume(key string, rollingVolume string) float64 {
+	volume, err := strconv.ParseFloat(rollingVolume, 64)
+	if err != nil {
+		return 0
 	}
+	previous, ok := rl.volumes.Load(key)
+	rl.volumes.Store(key, volume)
+	if !ok || volume < previous.(float64) {
+		return 0
+	}
+	return volume - previous.(float64)
 }
 
 func (rl *BinanceLoop) GetPrice(pair, exchange string, marketType int64) *interfaces.OHLCV {
@@ -154,3 +213,38 @@ func (rl *BinanceLoop) GetSpread(pair, exchange string, marketType int64) *inter
 	}
 	return nil
 }
+
+func (rl *BinanceLoop) SubscribeToFunding() {
+	go ListenBinanceMarkPrice(func(data *binance.RawEvent) error {
+		go rl.UpdateFunding(data.Data)
+		return nil
+	})
+}
+
+// UpdateFunding decodes all market mark prices and writes them to FundingMap for future use.
+func (rl *BinanceLoop) UpdateFunding(data []byte) {
+	var markPrices []RawMarkPrice
+	if err := json.Unmarshal(data, &markPrices); err != nil {
+		log.Debug("decode all market mark price while funding update",
+			zap.Error(err),
+		)
+		return
+	}
+	for _, markPrice := range markPrices {
+		rl.FundingMap.Store("binance"+markPrice.Symbol, interfaces.FundingData{
+			MarkPrice:       markPrice.MarkPrice,
+			IndexPrice:      markPrice.IndexPrice,
+			FundingRate:     markPrice.FundingRate,
+			NextFundingTime: markPrice.NextFundingTime,
+		})
+	}
+}
+
+func (rl *BinanceLoop) GetFunding(pair string) *interfaces.FundingData {
+	fundingRaw, ok := rl.FundingMap.Load("binance" + strings.Replace(pair, "_", "", -1))
+	if ok {
+		funding := fundingRaw.(interfaces.FundingData)
+		return &funding
+	}
+	return nil
+}
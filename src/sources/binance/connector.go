@@ -99,3 +99,30 @@ func ListenBinanceSpread(onMessage func(data *binance.SpreadAllEvent) error) err
 	log.Info("exit")
 	return nil
 }
+
+func ListenBinanceMarkPrice(onMessage func(data *binance.RawEvent) error) error {
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	binanceInstance, cancelCtx := GetBinanceClientInstance()
+	kech, done, err := binanceInstance.MarkPriceStreamAllMarketWebsocket()
+	if err != nil {
+		log.Error("listen mark price", zap.Error(err))
+		return fmt.Errorf("listen mark price: %v", err)
+	}
+
+	go func() {
+		for {
+			select {
+			case e := <-kech:
+				_ = onMessage(e)
+			case <-done:
+				break
+			}
+		}
+	}()
+
+	<-interrupt
+	cancelCtx()
+	<-done
+	return nil
+}
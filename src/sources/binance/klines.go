@@ -0,0 +1,111 @@
+package binance
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+
+	"gitlab.com/crypto_project/core/strategy_service/src/service/interfaces"
+	"gitlab.com/crypto_project/core/strategy_service/src/sources/candles"
+	"go.uber.org/zap"
+)
+
+// Klines endpoints by market type, spot and USDT-M futures.
+var klinesUrls = map[int64]string{
+	0: "https://api.binance.com/api/v3/klines",
+	1: "https://fapi.binance.com/fapi/v1/klines",
+}
+
+var klinesClient = &http.Client{Timeout: 10 * time.Second}
+
+// RecordCandles starts recording candles of the pair and backfills their history from exchange klines, so candles
+// are there by the time the strategy asks for them.
+func (rl *BinanceLoop) RecordCandles(pair string, exchange string, marketType int64) {
+	if binanceLoop == nil {
+		binanceLoop = &BinanceLoop{Candles: candles.NewHistory(candleHistorySize)}
+		binanceLoop.SubscribeToPairs()
+	}
+	symbol := symbolOf(pair)
+	key := "binance" + symbol + strconv.FormatInt(marketType, 10)
+	if !binanceLoop.Candles.Watch(key) {
+		return
+	}
+	go binanceLoop.backfillCandles(key, symbol, marketType)
+}
+
+func (rl *BinanceLoop) backfillCandles(key string, symbol string, marketType int64) {
+	for timeframe := range candles.Timeframes {
+		bars, err := FetchKlines(symbol, marketType, timeframe, candleHistorySize)
+		if err != nil {
+			log.Warn("can't backfill candles",
+				zap.String("symbol", symbol),
+				zap.Int64("marketType", marketType),
+				zap.String("timeframe", timeframe),
+				zap.Error(err),
+			)
+			continue
+		}
+		rl.Candles.Backfill(key, timeframe, bars)
+	}
+}
+
+// FetchKlines returns up to limit last closed candles of the symbol, e.g. BTCUSDT, oldest first.
+func FetchKlines(symbol string, marketType int64, timeframe string, limit int) ([]interfaces.Candle, error) {
+	url, ok := klinesUrls[marketType]
+	if !ok {
+		return nil, fmt.Errorf("no klines for market type %v", marketType)
+	}
+	// the last kline is not closed yet
+	response, err := klinesClient.Get(fmt.Sprintf("%v?symbol=%v&interval=%v&limit=%v", url, symbol, timeframe, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	data, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("klines status %v: %s", response.StatusCode, data)
+	}
+	return ParseKlines(data, time.Now())
+}
+
+// ParseKlines decodes klines response to candles closed by now, oldest first.
+func ParseKlines(data []byte, now time.Time) ([]interfaces.Candle, error) {
+	var raw [][]interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("decode klines: %v", err)
+	}
+	bars := make([]interfaces.Candle, 0, len(raw))
+	for _, kline := range raw {
+		if len(kline) < 7 {
+			return nil, fmt.Errorf("short kline: %v", kline)
+		}
+		openTime, okOpen := kline[0].(float64)
+		closeTime, okClose := kline[6].(float64)
+		if !okOpen || !okClose {
+			return nil, fmt.Errorf("wrong kline times: %v", kline)
+		}
+		if int64(closeTime) >= now.UnixNano()/int64(time.Millisecond) {
+			continue
+		}
+		bar := interfaces.Candle{Timestamp: int64(openTime) / 1000}
+		for i, field := range []*float64{&bar.Open, &bar.High, &bar.Low, &bar.Close, &bar.Volume} {
+			value, ok := kline[i+1].(string)
+			if !ok {
+				return nil, fmt.Errorf("wrong kline value: %v", kline)
+			}
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return nil, fmt.Errorf("parse kline value: %v", err)
+			}
+			*field = parsed
+		}
+		bars = append(bars, bar)
+	}
+	return bars, nil
+}
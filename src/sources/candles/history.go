@@ -0,0 +1,181 @@
+// Package candles builds OHLCV bars of several timeframes from the price ticks stream.
+package candles
+
+import (
+	"math"
+	"sync"
+
+	"gitlab.com/crypto_project/core/strategy_service/src/service/interfaces"
+)
+
+// Timeframes supported by history in seconds.
+var Timeframes = map[string]int64{
+	"1m":  60,
+	"5m":  5 * 60,
+	"15m": 15 * 60,
+	"1h":  60 * 60,
+	"4h":  4 * 60 * 60,
+	"1d":  24 * 60 * 60,
+}
+
+// A History keeps up to Size last closed bars of each timeframe for the keys watched, keys not watched are not
+// recorded to save memory.
+type History struct {
+	Size   int
+	mux    sync.RWMutex
+	series map[string]*series
+}
+
+type series struct {
+	frames map[string]*frame
+}
+
+// A frame builds bars of a single timeframe.
+type frame struct {
+	period  int64
+	current *interfaces.Candle
+	closed  *Ring
+}
+
+// NewHistory instantiates history keeping size bars per key and timeframe.
+func NewHistory(size int) *History {
+	return &History{Size: size, series: map[string]*series{}}
+}
+
+// Watch starts recording bars of the key and returns true if it was not recorded yet. History is empty until the
+// first bar of a timeframe closes unless backfilled.
+func (h *History) Watch(key string) bool {
+	h.mux.RLock()
+	_, ok := h.series[key]
+	h.mux.RUnlock()
+	if ok {
+		return false
+	}
+	h.mux.Lock()
+	defer h.mux.Unlock()
+	if _, ok := h.series[key]; ok {
+		return false
+	}
+	s := &series{frames: map[string]*frame{}}
+	for timeframe, period := range Timeframes {
+		s.frames[timeframe] = &frame{period: period, closed: NewRing(h.Size)}
+	}
+	h.series[key] = s
+	return true
+}
+
+// Backfill adds closed bars of the timeframe older than the ones recorded for the key, e.g. loaded from the exchange
+// once recording started. Bars should be oldest first, the key should be watched.
+func (h *History) Backfill(key string, timeframe string, bars []interfaces.Candle) {
+	h.mux.Lock()
+	defer h.mux.Unlock()
+	s, ok := h.series[key]
+	if !ok {
+		return
+	}
+	f, ok := s.frames[timeframe]
+	if !ok {
+		return
+	}
+	recorded := f.closed.Last(f.closed.Len())
+	oldest := int64(math.MaxInt64)
+	if len(recorded) > 0 {
+		oldest = recorded[0].Timestamp
+	} else if f.current != nil {
+		oldest = f.current.Timestamp
+	}
+	closed := NewRing(h.Size)
+	for _, bar := range bars {
+		if bar.Timestamp < oldest {
+			closed.Push(bar)
+		}
+	}
+	for _, bar := range recorded {
+		closed.Push(bar)
+	}
+	f.closed = closed
+}
+
+// Update accounts the tick at timestamp in unix seconds for the key if it is watched. Tick high and low extend bars,
+// close is the last price and volume is added to bars volume.
+func (h *History) Update(key string, tick interfaces.OHLCV, timestamp int64) {
+	if tick.Close <= 0 {
+		return
+	}
+	h.mux.Lock()
+	defer h.mux.Unlock()
+	s, ok := h.series[key]
+	if !ok {
+		return
+	}
+	for _, f := range s.frames {
+		f.update(tick, timestamp)
+	}
+}
+
+func (f *frame) update(tick interfaces.OHLCV, timestamp int64) {
+	openTime := timestamp - timestamp%f.period
+	if f.current != nil && f.current.Timestamp < openTime {
+		f.closed.Push(*f.current)
+		f.current = nil
+	}
+	if f.current == nil {
+		f.current = &interfaces.Candle{Timestamp: openTime, Open: tick.Close, High: tick.Close, Low: tick.Close}
+	}
+	if tick.High > f.current.High {
+		f.current.High = tick.High
+	}
+	if tick.Low > 0 && tick.Low < f.current.Low {
+		f.current.Low = tick.Low
+	}
+	f.current.Close = tick.Close
+	f.current.Volume += tick.Volume
+}
+
+// UpdateBar replaces the current bar of the timeframe for the key with the bar at timestamp in unix seconds, for sources
+// publishing bars of the timeframe updated in place. The current bar is closed once a bar of the next period comes.
+func (h *History) UpdateBar(key string, timeframe string, bar interfaces.OHLCV, timestamp int64) {
+	if bar.Close <= 0 {
+		return
+	}
+	h.mux.Lock()
+	defer h.mux.Unlock()
+	s, ok := h.series[key]
+	if !ok {
+		return
+	}
+	f, ok := s.frames[timeframe]
+	if !ok {
+		return
+	}
+	openTime := timestamp - timestamp%f.period
+	if f.current != nil && f.current.Timestamp > openTime {
+		return // late update of the bar closed already
+	}
+	if f.current != nil && f.current.Timestamp < openTime {
+		f.closed.Push(*f.current)
+	}
+	f.current = &interfaces.Candle{
+		Timestamp: openTime,
+		Open:      bar.Open,
+		High:      bar.High,
+		Low:       bar.Low,
+		Close:     bar.Close,
+		Volume:    bar.Volume,
+	}
+}
+
+// Get returns up to n last closed bars of the timeframe for the key, oldest first. Nil if the timeframe is unknown.
+func (h *History) Get(key string, timeframe string, n int) []interfaces.Candle {
+	h.mux.RLock()
+	defer h.mux.RUnlock()
+	s, ok := h.series[key]
+	if !ok {
+		return nil
+	}
+	f, ok := s.frames[timeframe]
+	if !ok {
+		return nil
+	}
+	return f.closed.Last(n)
+}
@@ -0,0 +1,49 @@
+package candles
+
+import "gitlab.com/crypto_project/core/strategy_service/src/service/interfaces"
+
+// A Ring is a bounded buffer of candles overwriting the oldest candle when full.
+type Ring struct {
+	bars  []interfaces.Candle
+	start int
+	size  int
+}
+
+// NewRing instantiates ring keeping up to capacity candles.
+func NewRing(capacity int) *Ring {
+	return &Ring{bars: make([]interfaces.Candle, capacity)}
+}
+
+// Push appends the candle dropping the oldest one if the ring is full.
+func (r *Ring) Push(candle interfaces.Candle) {
+	if len(r.bars) == 0 {
+		return
+	}
+	if r.size < len(r.bars) {
+		r.bars[(r.start+r.size)%len(r.bars)] = candle
+		r.size++
+		return
+	}
+	r.bars[r.start] = candle
+	r.start = (r.start + 1) % len(r.bars)
+}
+
+// Len returns count of candles kept.
+func (r *Ring) Len() int {
+	return r.size
+}
+
+// Last returns a copy of up to n last candles, oldest first.
+func (r *Ring) Last(n int) []interfaces.Candle {
+	if n > r.size {
+		n = r.size
+	}
+	if n <= 0 {
+		return nil
+	}
+	last := make([]interfaces.Candle, n)
+	for i := 0; i < n; i++ {
+		last[i] = r.bars[(r.start+r.size-n+i)%len(r.bars)]
+	}
+	return last
+}
@@ -72,3 +72,42 @@ func (df *DataFeed) GetSpreadForPairAtExchange(pair string, exchange string, mar
 		}
 	}
 }
+
+// GetFundingForPairAtExchange returns funding rate and mark price of perpetual futures, nil if the exchange has no such.
+func (df *DataFeed) GetFundingForPairAtExchange(pair string, exchange string) *interfaces.FundingData {
+	switch exchange {
+		case "binance", "": {
+			return df.binanceLoop.GetFundingForPairAtExchange(pair, exchange)
+		}
+		default: {
+			return nil
+		}
+	}
+}
+
+// GetCandles returns up to n last closed candles of the timeframe, nil if the exchange has no candles history.
+func (df *DataFeed) GetCandles(pair string, exchange string, marketType int64, timeframe string, n int) []interfaces.Candle {
+	switch exchange {
+		case "serum": {
+			return df.redisLoop.GetCandles(pair, exchange, marketType, timeframe, n)
+		}
+		case "binance", "": {
+			return df.binanceLoop.GetCandles(pair, exchange, marketType, timeframe, n)
+		}
+		default: {
+			return nil
+		}
+	}
+}
+
+// RecordCandles starts recording candles of the pair at the exchange if it has candles history.
+func (df *DataFeed) RecordCandles(pair string, exchange string, marketType int64) {
+	switch exchange {
+		case "serum": {
+			df.redisLoop.(interfaces.ICandleRecorder).RecordCandles(pair, exchange, marketType)
+		}
+		case "binance", "": {
+			df.binanceLoop.(interfaces.ICandleRecorder).RecordCandles(pair, exchange, marketType)
+		}
+	}
+}
@@ -2,30 +2,44 @@ package mysql
 
 import (
 	"database/sql"
-	"log"
 	"os"
 
 	_ "github.com/go-sql-driver/mysql"
+	"gitlab.com/crypto_project/core/strategy_service/src/logging"
+	"gitlab.com/crypto_project/core/strategy_service/src/service/interfaces"
+	"go.uber.org/zap"
 )
 
+var log interfaces.ILogger
+
+func init() {
+	logger, _ := logging.GetZapLogger()
+	log = logger.With(zap.String("logger", "srcMysql"))
+}
+
 // SQLConn - SQL connection structure
 type SQLConn struct {
 	db *sql.DB
 }
 
+// NewSQLConn returns a connection over the database given, e.g. to share a pool or to use a mocked one.
+func NewSQLConn(db *sql.DB) *SQLConn {
+	return &SQLConn{db: db}
+}
+
 // Initialize - establishes connection to MySQL server if not yet established
 func (sc *SQLConn) Initialize() {
 	if sc.db != nil {
 		return
 	}
 
-	log.Println("Connecting to MySQL: ", os.Getenv("SQL_CONN_STRING"))
+	log.Info("connecting to MySQL")
 	db, _ := sql.Open("mysql", os.Getenv("SQL_CONN_STRING"))
 
 	// Open doesn't open a connection. Validate connection:
 	err := db.Ping()
 	if err != nil {
-		log.Println("Error while connecting to MYSQL")
+		log.Error("error while connecting to MySQL", zap.Error(err))
 		panic(err.Error())
 	}
 
@@ -0,0 +1,61 @@
+package mysql
+
+import (
+	"encoding/json"
+	"time"
+
+	"gitlab.com/crypto_project/core/strategy_service/src/sources/mongodb/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.uber.org/zap"
+)
+
+// AppendJournalEntry inserts the entry, the primary key fails it on sequence number taken.
+func (sm *StateMgmt) AppendJournalEntry(entry *models.MongoJournalEntry) error {
+	t1 := time.Now()
+	document, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	_, err = sm.Conn.db.Exec("INSERT INTO strategy_journal (strategy_id, seq, type, at, document) VALUES (?, ?, ?, ?, ?)",
+		entry.StrategyId.Hex(), entry.Seq, entry.Type, entry.At, document)
+	sm.Statsd.TimingDuration("state_mgmt.append_journal_entry", time.Since(t1))
+	return err
+}
+
+// GetJournal reads strategy journal entries after the sequence number given in order.
+func (sm *StateMgmt) GetJournal(strategyId *primitive.ObjectID, afterSeq int64) []models.MongoJournalEntry {
+	t1 := time.Now()
+	rows, err := sm.Conn.db.Query("SELECT document FROM strategy_journal WHERE strategy_id = ? AND seq > ? ORDER BY seq",
+		strategyId.Hex(), afterSeq)
+	if err != nil {
+		log.Error("can't read journal", zap.Error(err))
+		return nil
+	}
+	defer rows.Close()
+	var entries []models.MongoJournalEntry
+	for rows.Next() {
+		var document []byte
+		var entry models.MongoJournalEntry
+		if err := rows.Scan(&document); err != nil {
+			log.Error("can't read journal", zap.Error(err))
+			return entries
+		}
+		if err := json.Unmarshal(document, &entry); err != nil {
+			log.Error("journal entry decode error", zap.Error(err))
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	sm.Statsd.TimingDuration("state_mgmt.get_journal", time.Since(t1))
+	return entries
+}
+
+// GetLastJournalSeq returns the last sequence number of strategy journal, 0 if empty.
+func (sm *StateMgmt) GetLastJournalSeq(strategyId *primitive.ObjectID) int64 {
+	var seq int64
+	if err := sm.Conn.db.QueryRow("SELECT COALESCE(MAX(seq), 0) FROM strategy_journal WHERE strategy_id = ?",
+		strategyId.Hex()).Scan(&seq); err != nil {
+		log.Error("can't read last journal entry", zap.Error(err))
+	}
+	return seq
+}
@@ -0,0 +1,179 @@
+package mysql
+
+import (
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// A migration changes the schema to the version given. Applied migrations are never edited, add a new one instead.
+type migration struct {
+	version    int64
+	statements []string
+}
+
+// migrations bring the schema from scratch to the latest version, in order.
+var migrations = []migration{
+	{
+		version: 1,
+		statements: []string{
+			`CREATE TABLE IF NOT EXISTS strategies (
+				id CHAR(24) NOT NULL PRIMARY KEY,
+				type INT NOT NULL,
+				enabled BOOL NOT NULL,
+				account_id CHAR(24) NULL,
+				pair VARCHAR(64) NOT NULL DEFAULT '',
+				market_type INT NOT NULL DEFAULT 0,
+				conditions JSON NULL,
+				document JSON NOT NULL,
+				created_at BIGINT NOT NULL,
+				updated_at BIGINT NOT NULL,
+				INDEX strategies_account_market (account_id, pair, market_type, enabled),
+				INDEX strategies_enabled (enabled)
+			)`,
+			`CREATE TABLE IF NOT EXISTS strategy_states (
+				strategy_id CHAR(24) NOT NULL PRIMARY KEY,
+				state VARCHAR(64) NOT NULL DEFAULT '',
+				msg TEXT NULL,
+				entry_price DOUBLE NOT NULL DEFAULT 0,
+				exit_price DOUBLE NOT NULL DEFAULT 0,
+				executed_amount DOUBLE NOT NULL DEFAULT 0,
+				position_amount DOUBLE NOT NULL DEFAULT 0,
+				received_profit_amount DOUBLE NOT NULL DEFAULT 0,
+				document JSON NOT NULL,
+				updated_at BIGINT NOT NULL,
+				CONSTRAINT strategy_states_strategy FOREIGN KEY (strategy_id) REFERENCES strategies (id) ON DELETE CASCADE
+			)`,
+			`CREATE TABLE IF NOT EXISTS strategy_state_history (
+				id BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+				strategy_id CHAR(24) NOT NULL,
+				state VARCHAR(64) NOT NULL DEFAULT '',
+				document JSON NOT NULL,
+				created_at BIGINT NOT NULL,
+				INDEX strategy_state_history_strategy (strategy_id, created_at)
+			)`,
+			`CREATE TABLE IF NOT EXISTS orders (
+				id CHAR(24) NOT NULL PRIMARY KEY,
+				order_id VARCHAR(64) NOT NULL,
+				post_only_initial_order_id VARCHAR(64) NOT NULL DEFAULT '',
+				key_id CHAR(24) NULL,
+				market_type INT NOT NULL DEFAULT 0,
+				symbol VARCHAR(64) NOT NULL DEFAULT '',
+				side VARCHAR(8) NOT NULL DEFAULT '',
+				type VARCHAR(32) NOT NULL DEFAULT '',
+				status VARCHAR(32) NOT NULL DEFAULT '',
+				position_side VARCHAR(16) NOT NULL DEFAULT '',
+				reduce_only BOOL NOT NULL DEFAULT FALSE,
+				amount DOUBLE NOT NULL DEFAULT 0,
+				filled DOUBLE NOT NULL DEFAULT 0,
+				average DOUBLE NOT NULL DEFAULT 0,
+				price DOUBLE NOT NULL DEFAULT 0,
+				stop_price DOUBLE NOT NULL DEFAULT 0,
+				updated_at BIGINT NOT NULL,
+				UNIQUE INDEX orders_order_id (order_id)
+			)`,
+			`CREATE TABLE IF NOT EXISTS positions (
+				id CHAR(24) NOT NULL PRIMARY KEY,
+				key_id CHAR(24) NOT NULL,
+				symbol VARCHAR(64) NOT NULL,
+				entry_price DOUBLE NOT NULL DEFAULT 0,
+				mark_price DOUBLE NOT NULL DEFAULT 0,
+				position_amt DOUBLE NOT NULL DEFAULT 0,
+				leverage DOUBLE NOT NULL DEFAULT 0,
+				updated_at BIGINT NOT NULL,
+				INDEX positions_key_symbol (key_id, symbol)
+			)`,
+			`CREATE TABLE IF NOT EXISTS markets (
+				name VARCHAR(64) NOT NULL,
+				market_type INT NOT NULL,
+				price_precision INT NOT NULL,
+				amount_precision INT NOT NULL,
+				PRIMARY KEY (name, market_type)
+			)`,
+			`CREATE TABLE IF NOT EXISTS key_balances (
+				key_id CHAR(24) NOT NULL,
+				asset VARCHAR(32) NOT NULL,
+				free DOUBLE NOT NULL DEFAULT 0,
+				PRIMARY KEY (key_id, asset)
+			)`,
+			`CREATE TABLE IF NOT EXISTS template_pnl (
+				template_strategy_id CHAR(24) NOT NULL PRIMARY KEY,
+				pnl DOUBLE NOT NULL DEFAULT 0
+			)`,
+			// a change log polled instead of change streams, see watch.go
+			`CREATE TABLE IF NOT EXISTS changes (
+				id BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+				entity VARCHAR(16) NOT NULL,
+				entity_id VARCHAR(64) NOT NULL,
+				inserted BOOL NOT NULL DEFAULT FALSE,
+				created_at BIGINT NOT NULL
+			)`,
+		},
+	},
+	{
+		version: 2,
+		statements: []string{
+			`CREATE TABLE IF NOT EXISTS strategy_journal (
+				strategy_id CHAR(24) NOT NULL,
+				seq BIGINT NOT NULL,
+				type VARCHAR(16) NOT NULL,
+				at BIGINT NOT NULL,
+				document JSON NOT NULL,
+				PRIMARY KEY (strategy_id, seq)
+			)`,
+		},
+	},
+	{
+		version: 3,
+		statements: []string{
+			// strategies created enabled or updated from disabled, quotas are checked for
+			`ALTER TABLE changes ADD COLUMN enabled BOOL NOT NULL DEFAULT FALSE`,
+		},
+	},
+}
+
+// Migrate applies migrations not applied yet, each one in a transaction. DDL statements commit implicitly in MySQL, so
+// statements are written to be rerun safely if a migration fails in the middle.
+func (sc *SQLConn) Migrate() error {
+	if _, err := sc.db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+		version BIGINT NOT NULL PRIMARY KEY,
+		applied_at BIGINT NOT NULL
+	)`); err != nil {
+		return fmt.Errorf("create schema_migrations: %w", err)
+	}
+	var current int64
+	if err := sc.db.QueryRow("SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&current); err != nil {
+		return fmt.Errorf("read schema version: %w", err)
+	}
+	for _, m := range migrations {
+		if m.version <= current {
+			continue
+		}
+		tx, err := sc.db.Begin()
+		if err != nil {
+			return err
+		}
+		for _, statement := range m.statements {
+			if _, err := tx.Exec(statement); err != nil {
+				tx.Rollback()
+				return fmt.Errorf("migration %v: %w", m.version, err)
+			}
+		}
+		if _, err := tx.Exec("INSERT INTO schema_migrations (version, applied_at) VALUES (?, ?)",
+			m.version, time.Now().UnixNano()/int64(time.Millisecond)); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %v: %w", m.version, err)
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+		log.Info("schema migrated", zap.Int64("version", m.version))
+	}
+	return nil
+}
+
+// SchemaVersion returns the latest schema version known.
+func SchemaVersion() int64 {
+	return migrations[len(migrations)-1].version
+}
@@ -0,0 +1,657 @@
+package mysql
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"gitlab.com/crypto_project/core/strategy_service/src/sources/mongodb/models"
+	statsd_client "gitlab.com/crypto_project/core/strategy_service/src/statsd"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.uber.org/zap"
+)
+
+// Precisions returned for markets not found, wide enough to not round amounts of any market.
+const (
+	defaultPricePrecision  = 8
+	defaultAmountPrecision = 8
+)
+
+// A StateMgmt keeps strategies, their state, orders and positions in MySQL tables. Updates of a strategy are done in a
+// transaction holding the strategy row and each one is appended to the strategy state history.
+type StateMgmt struct {
+	Conn           *SQLConn
+	Statsd         *statsd_client.StatsdClient
+	OrderCallbacks *sync.Map
+	hedgeCallbacks map[primitive.ObjectID][]func(strategy *models.MongoStrategy)
+	watchers       []func(strategy *models.MongoStrategy, enabled bool)
+	mux            sync.Mutex
+	known          models.KnownStrategies // strategies as written last, the base to merge order ids
+}
+
+// querier is either a database or a transaction.
+type querier interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// NewStateMgmt instantiates state management with the connection given, migrating the schema to the latest version.
+func NewStateMgmt(conn *SQLConn, statsd *statsd_client.StatsdClient) *StateMgmt {
+	conn.Initialize()
+	if err := conn.Migrate(); err != nil {
+		log.Panic("schema migration failure", zap.Error(err))
+	}
+	return &StateMgmt{
+		Conn:           conn,
+		Statsd:         statsd,
+		OrderCallbacks: &sync.Map{},
+		hedgeCallbacks: map[primitive.ObjectID][]func(strategy *models.MongoStrategy){},
+	}
+}
+
+func (sm *StateMgmt) CreateStrategy(strategy *models.MongoStrategy) *models.MongoStrategy {
+	t1 := time.Now()
+	if strategy.ID == nil {
+		id := primitive.NewObjectID()
+		strategy.ID = &id
+	}
+	if err := sm.inTx(func(tx *sql.Tx) error {
+		return saveStrategy(tx, strategy, true, strategy.Enabled)
+	}); err != nil {
+		log.Error("create strategy", zap.Error(err))
+	}
+	sm.Statsd.TimingDuration("state_mgmt.create_strategy", time.Since(t1))
+	return strategy
+}
+
+// SaveStrategy upserts the strategy.
+func (sm *StateMgmt) SaveStrategy(strategy *models.MongoStrategy) *models.MongoStrategy {
+	t1 := time.Now()
+	if err := sm.inTx(func(tx *sql.Tx) error {
+		stored, err := readStrategy(tx, strategy.ID, true)
+		if err != nil {
+			return err
+		}
+		return saveStrategy(tx, strategy, stored == nil, strategy.Enabled && (stored == nil || !stored.Enabled))
+	}); err != nil {
+		log.Error("save strategy", zap.Error(err))
+	}
+	sm.Statsd.TimingDuration("state_mgmt.save_strategy", time.Since(t1))
+	return strategy
+}
+
+func (sm *StateMgmt) GetStrategy(strategyId *primitive.ObjectID) *models.MongoStrategy {
+	t1 := time.Now()
+	strategy, err := readStrategy(sm.Conn.db, strategyId, false)
+	if err != nil {
+		log.Error("get strategy", zap.Error(err))
+	}
+	sm.Statsd.TimingDuration("state_mgmt.get_strategy", time.Since(t1))
+	return strategy
+}
+
+// GetEnabledStrategies reads all the enabled strategies.
+func (sm *StateMgmt) GetEnabledStrategies() []*models.MongoStrategy {
+	rows, err := sm.Conn.db.Query("SELECT id FROM strategies WHERE enabled")
+	if err != nil {
+		log.Error("can't read strategies", zap.Error(err))
+		return nil
+	}
+	var ids []primitive.ObjectID
+	for rows.Next() {
+		var hex string
+		if err := rows.Scan(&hex); err != nil {
+			log.Error("strategy id scan", zap.Error(err))
+			continue
+		}
+		if id, err := primitive.ObjectIDFromHex(hex); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	rows.Close()
+	var enabled []*models.MongoStrategy
+	for i := range ids {
+		if strategy := sm.GetStrategy(&ids[i]); strategy != nil {
+			enabled = append(enabled, strategy)
+		}
+	}
+	return enabled
+}
+
+// GetMarkets returns pairs by market type of the markets known.
+func (sm *StateMgmt) GetMarkets() map[int64][]string {
+	markets := map[int64][]string{}
+	rows, err := sm.Conn.db.Query("SELECT name, market_type FROM markets")
+	if err != nil {
+		log.Error("can't read markets", zap.Error(err))
+		return markets
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		var marketType int64
+		if err := rows.Scan(&name, &marketType); err != nil {
+			log.Error("market scan", zap.Error(err))
+			continue
+		}
+		markets[marketType] = append(markets[marketType], name)
+	}
+	return markets
+}
+
+func (sm *StateMgmt) GetMarketPrecision(pair string, marketType int64) (int64, int64) {
+	t1 := time.Now()
+	var pricePrecision, amountPrecision int64
+	err := sm.Conn.db.QueryRow("SELECT price_precision, amount_precision FROM markets WHERE name = ? AND market_type = ?",
+		pair, marketType).Scan(&pricePrecision, &amountPrecision)
+	if err != nil {
+		log.Error("read market precision",
+			zap.String("pair", pair),
+			zap.Int64("marketType", marketType),
+			zap.Error(err),
+		)
+		return defaultPricePrecision, defaultAmountPrecision
+	}
+	sm.Statsd.TimingDuration("state_mgmt.get_market_precision", time.Since(t1))
+	return pricePrecision, amountPrecision
+}
+
+func (sm *StateMgmt) GetKeyBalances(keyId *primitive.ObjectID) map[string]float64 {
+	t1 := time.Now()
+	balances := map[string]float64{}
+	rows, err := sm.Conn.db.Query("SELECT asset, free FROM key_balances WHERE key_id = ?", keyId.Hex())
+	if err != nil {
+		log.Error("can't read key balances", zap.Error(err))
+		return balances
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var asset string
+		var free float64
+		if err := rows.Scan(&asset, &free); err != nil {
+			log.Error("key balance scan", zap.Error(err))
+			continue
+		}
+		balances[asset] += free
+	}
+	sm.Statsd.TimingDuration("state_mgmt.get_key_balances", time.Since(t1))
+	return balances
+}
+
+func (sm *StateMgmt) AnyActiveStrats(strategy *models.MongoStrategy) bool {
+	t1 := time.Now()
+	var count int64
+	err := sm.Conn.db.QueryRow(`SELECT COUNT(*) FROM strategies
+		WHERE id <> ? AND enabled AND account_id = ? AND pair = ? AND market_type = ?`,
+		strategy.ID.Hex(), nullableHex(strategy.AccountId), strategy.Conditions.Pair, strategy.Conditions.MarketType,
+	).Scan(&count)
+	if err != nil {
+		log.Error("any active strategies", zap.Error(err))
+		return false
+	}
+	sm.Statsd.TimingDuration("state_mgmt.any_active_strats", time.Since(t1))
+	return count > 0
+}
+
+func (sm *StateMgmt) EnableStrategy(strategyId *primitive.ObjectID) {
+	sm.update("enable_strategy", strategyId, func(strategy *models.MongoStrategy) {
+		strategy.Enabled = true
+	})
+}
+
+func (sm *StateMgmt) DisableStrategy(strategyId *primitive.ObjectID) {
+	log.Info("disabling strategy", zap.String("id", strategyId.String()))
+	sm.update("disable_strategy", strategyId, func(strategy *models.MongoStrategy) {
+		strategy.Enabled = false
+	})
+}
+
+func (sm *StateMgmt) EnableHedgeLossStrategy(strategyId *primitive.ObjectID) {
+	sm.update("enable_hadge_loss_strategy", strategyId, func(strategy *models.MongoStrategy) {
+		if strategy.Conditions != nil {
+			strategy.Conditions.TakeProfitExternal = false
+		}
+	})
+}
+
+func (sm *StateMgmt) UpdateConditions(strategyId *primitive.ObjectID, conditions *models.MongoStrategyCondition) {
+	sm.update("update_conditions", strategyId, func(strategy *models.MongoStrategy) {
+		strategy.Conditions = conditions
+	})
+}
+
+func (sm *StateMgmt) UpdateState(strategyId *primitive.ObjectID, state *models.MongoStrategyState) {
+	sm.updateState("update_state", strategyId, func(stored *models.MongoStrategyState) {
+		stored.State = state.State
+		if len(state.Msg) > 0 {
+			stored.Msg = state.Msg
+		}
+	})
+}
+
+func (sm *StateMgmt) UpdateStrategyState(strategyId *primitive.ObjectID, state *models.MongoStrategyState) {
+	sm.updateMerged("update_strategy_state", strategyId, func(strategy *models.MongoStrategy, base *models.MongoStrategy) {
+		strategy.State = models.MergeOrderIds(state, baseState(base), strategy.State)
+	})
+}
+
+func (sm *StateMgmt) UpdateExecutedAmount(strategyId *primitive.ObjectID, state *models.MongoStrategyState) {
+	sm.updateState("update_executed_amount", strategyId, func(stored *models.MongoStrategyState) {
+		stored.ExecutedAmount = state.ExecutedAmount
+		stored.ExitPrice = state.ExitPrice
+		if state.ExecutedAmount == 0 {
+			stored.ExecutedOrders = []string{}
+			stored.EntryPrice = 0
+			stored.Amount = 0
+			stored.ReachedTargetCount = 0
+		}
+	})
+}
+
+// UpdateOrders adds order IDs stored in a state provided to the ones of the strategy, skipping known ones.
+func (sm *StateMgmt) UpdateOrders(strategyId *primitive.ObjectID, state *models.MongoStrategyState) {
+	if len(state.Orders)+len(state.ExecutedOrders) == 0 {
+		return
+	}
+	sm.updateState("update_orders", strategyId, func(stored *models.MongoStrategyState) {
+		stored.Orders = addToSet(stored.Orders, state.Orders)
+		stored.ExecutedOrders = addToSet(stored.ExecutedOrders, state.ExecutedOrders)
+	})
+}
+
+func (sm *StateMgmt) UpdateEntryPrice(strategyId *primitive.ObjectID, state *models.MongoStrategyState) {
+	sm.updateState("update_entry_price", strategyId, func(stored *models.MongoStrategyState) {
+		stored.EntryPrice = state.EntryPrice
+		stored.State = state.State
+		stored.PositionAmount = state.PositionAmount
+	})
+}
+
+func (sm *StateMgmt) UpdateHedgeExitPrice(strategyId *primitive.ObjectID, state *models.MongoStrategyState) {
+	sm.updateState("update_hedge_exit_price", strategyId, func(stored *models.MongoStrategyState) {
+		stored.HedgeExitPrice = state.HedgeExitPrice
+		stored.State = state.State
+	})
+}
+
+// UpdateStateAndConditions updates state and conditions in a single transaction.
+func (sm *StateMgmt) UpdateStateAndConditions(strategyId *primitive.ObjectID, model *models.MongoStrategy) {
+	sm.updateMerged("update_state_and_conditions", strategyId, func(strategy *models.MongoStrategy, base *models.MongoStrategy) {
+		strategy.Conditions = model.Conditions
+		strategy.State = models.MergeOrderIds(model.State, baseState(base), strategy.State)
+	})
+}
+
+func (sm *StateMgmt) SavePNL(templateStrategyId *primitive.ObjectID, profitAmount float64) {
+	t1 := time.Now()
+	_, err := sm.Conn.db.Exec(`INSERT INTO template_pnl (template_strategy_id, pnl) VALUES (?, ?)
+		ON DUPLICATE KEY UPDATE pnl = pnl + VALUES(pnl)`, templateStrategyId.Hex(), profitAmount)
+	if err != nil {
+		log.Error("save pnl", zap.Error(err))
+		return
+	}
+	sm.Statsd.TimingDuration("state_mgmt.save_pnl", time.Since(t1))
+}
+
+// SaveStrategyConditions updates dynamic state with given static (persistent) conditions.
+func (sm *StateMgmt) SaveStrategyConditions(strategy *models.MongoStrategy) {
+	strategy.State.EntryPointPrice = strategy.Conditions.EntryOrder.Price
+	strategy.State.EntryPointType = strategy.Conditions.EntryOrder.OrderType
+	strategy.State.EntryPointSide = strategy.Conditions.EntryOrder.Side
+	strategy.State.EntryPointAmount = strategy.Conditions.EntryOrder.Amount
+	strategy.State.EntryPointDeviation = strategy.Conditions.EntryOrder.EntryDeviation
+
+	strategy.State.StopLoss = strategy.Conditions.StopLoss
+	strategy.State.ForcedLoss = strategy.Conditions.ForcedLoss
+	strategy.State.TakeProfit = strategy.Conditions.ExitLevels
+	strategy.State.StopLossPrice = strategy.Conditions.StopLossPrice
+	strategy.State.ForcedLossPrice = strategy.Conditions.ForcedLossPrice
+	strategy.State.TrailingExitPrice = strategy.Conditions.TrailingExitPrice
+	strategy.State.TakeProfitPrice = strategy.Conditions.TakeProfitPrice
+	strategy.State.TakeProfitHedgePrice = strategy.Conditions.TakeProfitHedgePrice
+}
+
+// SaveOrder upserts the order, subscribers are notified by the changes watch.
+func (sm *StateMgmt) SaveOrder(order models.MongoOrder, keyId *primitive.ObjectID, marketType int64) {
+	t1 := time.Now()
+	log.Info("saving order", zap.String("order", fmt.Sprintf("%v", order)))
+	err := sm.inTx(func(tx *sql.Tx) error {
+		_, err := tx.Exec(`INSERT INTO orders (id, order_id, post_only_initial_order_id, key_id, market_type, symbol, side,
+				type, status, position_side, reduce_only, amount, filled, average, price, stop_price, updated_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+			ON DUPLICATE KEY UPDATE order_id = VALUES(order_id),
+				post_only_initial_order_id = VALUES(post_only_initial_order_id), status = VALUES(status),
+				filled = VALUES(filled), average = VALUES(average), updated_at = VALUES(updated_at)`,
+			order.ID.Hex(), order.OrderId, order.PostOnlyInitialOrderId, nullableHex(keyId), marketType, order.Symbol,
+			order.Side, order.Type, order.Status, order.PositionSide, order.ReduceOnly, order.Amount, order.Filled,
+			order.Average, order.Price, order.StopPrice, nowMillis(),
+		)
+		if err != nil {
+			return err
+		}
+		return recordChange(tx, entityOrder, order.OrderId, false, false)
+	})
+	if err != nil {
+		log.Error("save order", zap.Error(err))
+	}
+	sm.Statsd.TimingDuration("state_mgmt.save_order", time.Since(t1))
+}
+
+// SavePosition upserts the position.
+func (sm *StateMgmt) SavePosition(position models.MongoPosition) {
+	t1 := time.Now()
+	_, err := sm.Conn.db.Exec(`INSERT INTO positions (id, key_id, symbol, entry_price, mark_price, position_amt, leverage,
+			updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE entry_price = VALUES(entry_price), mark_price = VALUES(mark_price),
+			position_amt = VALUES(position_amt), leverage = VALUES(leverage), updated_at = VALUES(updated_at)`,
+		position.ID.Hex(), position.KeyId.Hex(), position.Symbol, position.EntryPrice, position.MarkPrice,
+		position.PositionAmt, position.Leverage, nowMillis(),
+	)
+	if err != nil {
+		log.Error("save position", zap.Error(err))
+	}
+	sm.Statsd.TimingDuration("state_mgmt.save_position", time.Since(t1))
+}
+
+func (sm *StateMgmt) GetPosition(strategyId *primitive.ObjectID, symbol string) {
+}
+
+func (sm *StateMgmt) GetOrder(orderId string) *models.MongoOrder {
+	t1 := time.Now()
+	order, err := readOrder(sm.Conn.db, "order_id = ?", orderId)
+	if err != nil {
+		log.Error("get order", zap.Error(err))
+	}
+	sm.Statsd.TimingDuration("state_mgmt.get_order", time.Since(t1))
+	return order
+}
+
+func (sm *StateMgmt) GetOrderById(orderId *primitive.ObjectID) *models.MongoOrder {
+	t1 := time.Now()
+	order, err := readOrder(sm.Conn.db, "id = ?", orderId.Hex())
+	if err != nil {
+		log.Error("get order by id", zap.Error(err))
+	}
+	sm.Statsd.TimingDuration("state_mgmt.get_order_by_id", time.Since(t1))
+	return order
+}
+
+func (sm *StateMgmt) SubscribeToOrder(orderId string, onOrderStatusUpdate func(order *models.MongoOrder)) error {
+	sm.OrderCallbacks.Store(orderId, onOrderStatusUpdate)
+	if executedOrder := sm.GetOrder(orderId); executedOrder != nil {
+		onOrderStatusUpdate(executedOrder)
+	}
+	return nil
+}
+
+// SubscribeToHedge invokes the callback given with the hedge strategy now and on each update of it.
+func (sm *StateMgmt) SubscribeToHedge(strategyId *primitive.ObjectID, onHedgeExitUpdate func(strategy *models.MongoStrategy)) error {
+	sm.mux.Lock()
+	sm.hedgeCallbacks[*strategyId] = append(sm.hedgeCallbacks[*strategyId], onHedgeExitUpdate)
+	sm.mux.Unlock()
+	if strategy := sm.GetStrategy(strategyId); strategy != nil {
+		onHedgeExitUpdate(strategy)
+	}
+	return nil
+}
+
+// WatchStrategies registers a callback invoked in order on every strategy created or updated, like a change stream.
+// Callbacks are invoked by InitOrdersWatch polling changes.
+func (sm *StateMgmt) WatchStrategies(onStrategyUpdate func(strategy *models.MongoStrategy, enabled bool)) {
+	sm.mux.Lock()
+	defer sm.mux.Unlock()
+	sm.watchers = append(sm.watchers, onStrategyUpdate)
+}
+
+// update applies the change given to the strategy read in a transaction holding it, incrementing its version. Unknown
+// strategies are skipped.
+func (sm *StateMgmt) update(metric string, strategyId *primitive.ObjectID, change func(strategy *models.MongoStrategy)) {
+	sm.updateMerged(metric, strategyId, func(strategy *models.MongoStrategy, _ *models.MongoStrategy) {
+		change(strategy)
+	})
+}
+
+// updateMerged applies the change given to the strategy stored given the base one, the strategy as the instance wrote
+// it last or nil if it's not known, to merge changes of other writers made since.
+func (sm *StateMgmt) updateMerged(metric string, strategyId *primitive.ObjectID, change func(strategy *models.MongoStrategy, base *models.MongoStrategy)) {
+	t1 := time.Now()
+	var saved *models.MongoStrategy
+	err := sm.inTx(func(tx *sql.Tx) error {
+		strategy, err := readStrategy(tx, strategyId, true)
+		if err != nil || strategy == nil {
+			return err
+		}
+		wasEnabled := strategy.Enabled
+		change(strategy, sm.known.Get(strategyId))
+		strategy.Version++
+		saved = strategy
+		return saveStrategy(tx, strategy, false, strategy.Enabled && !wasEnabled)
+	})
+	if err != nil {
+		log.Error("update strategy",
+			zap.String("id", strategyId.Hex()),
+			zap.String("update", metric),
+			zap.Error(err),
+		)
+		sm.known.Forget(strategyId)
+		return
+	}
+	sm.remember(saved)
+	sm.Statsd.TimingDuration("state_mgmt."+metric, time.Since(t1))
+}
+
+// remember keeps a copy of the strategy saved as known, it's forgotten if it can't be copied.
+func (sm *StateMgmt) remember(strategy *models.MongoStrategy) {
+	if strategy == nil {
+		return
+	}
+	document, conditions, state, err := marshalStrategy(strategy)
+	var known *models.MongoStrategy
+	if err == nil {
+		known, err = unmarshalStrategy(document, conditions, state)
+	}
+	if err != nil {
+		sm.known.Forget(strategy.ID)
+		return
+	}
+	sm.known.Set(known)
+}
+
+// updateState applies the change given to the state of the strategy, creating the state if not set.
+func (sm *StateMgmt) updateState(metric string, strategyId *primitive.ObjectID, change func(state *models.MongoStrategyState)) {
+	sm.update(metric, strategyId, func(strategy *models.MongoStrategy) {
+		if strategy.State == nil {
+			strategy.State = &models.MongoStrategyState{}
+		}
+		change(strategy.State)
+	})
+}
+
+// baseState returns state of the base strategy, nil if it's not known.
+func baseState(base *models.MongoStrategy) *models.MongoStrategyState {
+	if base == nil {
+		return nil
+	}
+	return base.State
+}
+
+// inTx runs the function given in a transaction committed if no error returned, rolled back otherwise.
+func (sm *StateMgmt) inTx(f func(tx *sql.Tx) error) error {
+	tx, err := sm.Conn.db.Begin()
+	if err != nil {
+		return err
+	}
+	if err := f(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// saveStrategy upserts the strategy with its state, appends the state to history and records the change, whether it
+// inserted or enabled the strategy.
+func saveStrategy(q querier, strategy *models.MongoStrategy, inserted bool, enabled bool) error {
+	document, conditions, state, err := marshalStrategy(strategy)
+	if err != nil {
+		return err
+	}
+	now := nowMillis()
+	createdAt := now
+	if !strategy.CreatedAt.IsZero() {
+		createdAt = strategy.CreatedAt.UnixNano() / int64(time.Millisecond)
+	}
+	pair, marketType := "", int64(0)
+	if strategy.Conditions != nil {
+		pair, marketType = strategy.Conditions.Pair, strategy.Conditions.MarketType
+	}
+	_, err = q.Exec(`INSERT INTO strategies (id, type, enabled, account_id, pair, market_type, conditions, document,
+			created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE type = VALUES(type), enabled = VALUES(enabled), account_id = VALUES(account_id),
+			pair = VALUES(pair), market_type = VALUES(market_type), conditions = VALUES(conditions),
+			document = VALUES(document), updated_at = VALUES(updated_at)`,
+		strategy.ID.Hex(), strategy.Type, strategy.Enabled, nullableHex(strategy.AccountId), pair, marketType,
+		conditions, document, createdAt, now,
+	)
+	if err != nil {
+		return err
+	}
+	if strategy.State != nil {
+		s := strategy.State
+		_, err = q.Exec(`INSERT INTO strategy_states (strategy_id, state, msg, entry_price, exit_price, executed_amount,
+				position_amount, received_profit_amount, document, updated_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+			ON DUPLICATE KEY UPDATE state = VALUES(state), msg = VALUES(msg), entry_price = VALUES(entry_price),
+				exit_price = VALUES(exit_price), executed_amount = VALUES(executed_amount),
+				position_amount = VALUES(position_amount), received_profit_amount = VALUES(received_profit_amount),
+				document = VALUES(document), updated_at = VALUES(updated_at)`,
+			strategy.ID.Hex(), s.State, s.Msg, s.EntryPrice, s.ExitPrice, s.ExecutedAmount, s.PositionAmount,
+			s.ReceivedProfitAmount, state, now,
+		)
+		if err != nil {
+			return err
+		}
+		_, err = q.Exec("INSERT INTO strategy_state_history (strategy_id, state, document, created_at) VALUES (?, ?, ?, ?)",
+			strategy.ID.Hex(), s.State, state, now)
+		if err != nil {
+			return err
+		}
+	}
+	return recordChange(q, entityStrategy, strategy.ID.Hex(), inserted, enabled)
+}
+
+// readStrategy reads the strategy with its state, nil if not found. The strategy row is locked if for update.
+func readStrategy(q querier, strategyId *primitive.ObjectID, forUpdate bool) (*models.MongoStrategy, error) {
+	query := `SELECT s.document, s.conditions, st.document FROM strategies s
+		LEFT JOIN strategy_states st ON st.strategy_id = s.id WHERE s.id = ?`
+	if forUpdate {
+		query += " FOR UPDATE"
+	}
+	var document, conditions, state []byte
+	err := q.QueryRow(query, strategyId.Hex()).Scan(&document, &conditions, &state)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return unmarshalStrategy(document, conditions, state)
+}
+
+// marshalStrategy returns JSON of the strategy without conditions and state, JSON of conditions and JSON of state.
+func marshalStrategy(strategy *models.MongoStrategy) ([]byte, []byte, []byte, error) {
+	rest := *strategy
+	rest.Conditions = nil
+	rest.State = nil
+	document, err := json.Marshal(rest)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	var conditions, state []byte
+	if strategy.Conditions != nil {
+		if conditions, err = json.Marshal(strategy.Conditions); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+	if strategy.State != nil {
+		if state, err = json.Marshal(strategy.State); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+	return document, conditions, state, nil
+}
+
+// unmarshalStrategy assembles the strategy from JSON documents given, conditions and state may be empty.
+func unmarshalStrategy(document []byte, conditions []byte, state []byte) (*models.MongoStrategy, error) {
+	var strategy models.MongoStrategy
+	if err := json.Unmarshal(document, &strategy); err != nil {
+		return nil, err
+	}
+	if len(conditions) > 0 {
+		strategy.Conditions = &models.MongoStrategyCondition{}
+		if err := json.Unmarshal(conditions, strategy.Conditions); err != nil {
+			return nil, err
+		}
+	}
+	if len(state) > 0 {
+		strategy.State = &models.MongoStrategyState{}
+		if err := json.Unmarshal(state, strategy.State); err != nil {
+			return nil, err
+		}
+	}
+	return &strategy, nil
+}
+
+// readOrder reads the order matching the condition given, nil if not found.
+func readOrder(q querier, where string, args ...interface{}) (*models.MongoOrder, error) {
+	var order models.MongoOrder
+	var id string
+	var updatedAt int64
+	err := q.QueryRow(`SELECT id, order_id, post_only_initial_order_id, symbol, side, type, status, position_side,
+			reduce_only, amount, filled, average, price, stop_price, updated_at
+		FROM orders WHERE `+where, args...).Scan(&id, &order.OrderId, &order.PostOnlyInitialOrderId, &order.Symbol,
+		&order.Side, &order.Type, &order.Status, &order.PositionSide, &order.ReduceOnly, &order.Amount, &order.Filled,
+		&order.Average, &order.Price, &order.StopPrice, &updatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	order.ID, _ = primitive.ObjectIDFromHex(id)
+	order.UpdatedAt = time.Unix(0, updatedAt*int64(time.Millisecond))
+	order.Timestamp = float64(updatedAt)
+	return &order, nil
+}
+
+// nullableHex returns hex of the id given, NULL if nil.
+func nullableHex(id *primitive.ObjectID) sql.NullString {
+	if id == nil {
+		return sql.NullString{}
+	}
+	return sql.NullString{String: id.Hex(), Valid: true}
+}
+
+func nowMillis() int64 {
+	return time.Now().UnixNano() / int64(time.Millisecond)
+}
+
+// addToSet appends values not in the set yet.
+func addToSet(set []string, values []string) []string {
+	for _, value := range values {
+		found := false
+		for _, item := range set {
+			if item == value {
+				found = true
+				break
+			}
+		}
+		if !found {
+			set = append(set, value)
+		}
+	}
+	return set
+}
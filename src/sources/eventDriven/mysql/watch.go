@@ -0,0 +1,152 @@
+package mysql
+
+import (
+	"time"
+
+	"gitlab.com/crypto_project/core/strategy_service/src/sources/mongodb/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.uber.org/zap"
+)
+
+// Entities recorded in the changes log.
+const (
+	entityStrategy = "strategy"
+	entityOrder    = "order"
+)
+
+const (
+	watchPeriod = time.Second
+	// Changes are re-read this far back as auto increment ids of concurrent transactions may commit out of order.
+	changesLookBack = 1000
+	// Changes older than retention and out of the look back are deleted once a prune period, the watch starts from
+	// the last change so older ones are kept only to investigate.
+	changesRetention   = time.Hour
+	changesPrunePeriod = time.Minute
+)
+
+type change struct {
+	id       int64
+	entity   string
+	entityId string
+	enabled  bool // strategy created enabled or updated from disabled
+}
+
+// recordChange appends the change to the log polled by InitOrdersWatch, in the transaction of the change.
+func recordChange(q querier, entity string, entityId string, inserted bool, enabled bool) error {
+	_, err := q.Exec("INSERT INTO changes (entity, entity_id, inserted, enabled, created_at) VALUES (?, ?, ?, ?, ?)",
+		entity, entityId, inserted, enabled, nowMillis())
+	return err
+}
+
+// InitOrdersWatch polls the changes log instead of change streams. It invokes order callbacks on `filled` and
+// `canceled` orders and strategy watchers and hedge subscribers on strategies updated. It never returns.
+func (sm *StateMgmt) InitOrdersWatch() {
+	log.Info("polling for changes in the storage")
+	var lastId int64
+	if err := sm.Conn.db.QueryRow("SELECT COALESCE(MAX(id), 0) FROM changes").Scan(&lastId); err != nil {
+		log.Fatal("can't read changes", zap.Error(err))
+	}
+	seen := map[int64]bool{}
+	var prunedAt time.Time
+	for {
+		if time.Since(prunedAt) >= changesPrunePeriod {
+			sm.pruneChanges(lastId - changesLookBack)
+			prunedAt = time.Now()
+		}
+		changes, err := sm.readChanges(lastId - changesLookBack)
+		if err != nil {
+			log.Error("can't read changes", zap.Error(err))
+			time.Sleep(watchPeriod)
+			continue
+		}
+		for _, c := range changes {
+			if seen[c.id] {
+				continue
+			}
+			seen[c.id] = true
+			if c.id > lastId {
+				lastId = c.id
+			}
+			sm.dispatch(c)
+		}
+		for id := range seen {
+			if id <= lastId-changesLookBack {
+				delete(seen, id)
+			}
+		}
+		time.Sleep(watchPeriod)
+	}
+}
+
+// pruneChanges deletes changes older than retention up to the id given.
+func (sm *StateMgmt) pruneChanges(upToId int64) {
+	t1 := time.Now()
+	createdBefore := time.Now().Add(-changesRetention).UnixNano() / int64(time.Millisecond)
+	result, err := sm.Conn.db.Exec("DELETE FROM changes WHERE id <= ? AND created_at < ?", upToId, createdBefore)
+	if err != nil {
+		log.Error("can't prune changes", zap.Error(err))
+		return
+	}
+	pruned, _ := result.RowsAffected()
+	sm.Statsd.Gauge("state_mgmt.changes_pruned", pruned)
+	sm.Statsd.TimingDuration("state_mgmt.prune_changes", time.Since(t1))
+}
+
+// readChanges reads changes after the id given in order.
+func (sm *StateMgmt) readChanges(afterId int64) ([]change, error) {
+	rows, err := sm.Conn.db.Query("SELECT id, entity, entity_id, enabled FROM changes WHERE id > ? ORDER BY id", afterId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var changes []change
+	for rows.Next() {
+		var c change
+		if err := rows.Scan(&c.id, &c.entity, &c.entityId, &c.enabled); err != nil {
+			return nil, err
+		}
+		changes = append(changes, c)
+	}
+	return changes, rows.Err()
+}
+
+// dispatch invokes callbacks subscribed to the entity changed with its current version.
+func (sm *StateMgmt) dispatch(c change) {
+	switch c.entity {
+	case entityOrder:
+		order := sm.GetOrder(c.entityId)
+		if order == nil || (order.Status != "filled" && order.Status != "canceled") {
+			return
+		}
+		orderId := order.OrderId
+		if order.PostOnlyInitialOrderId != "" {
+			orderId = order.PostOnlyInitialOrderId
+		}
+		log.Info("order",
+			zap.String("orderId", orderId),
+			zap.String("status", order.Status),
+		)
+		if callback, ok := sm.OrderCallbacks.Load(orderId); ok {
+			go callback.(func(order *models.MongoOrder))(order)
+		}
+	case entityStrategy:
+		id, err := primitive.ObjectIDFromHex(c.entityId)
+		if err != nil {
+			return
+		}
+		strategy := sm.GetStrategy(&id)
+		if strategy == nil {
+			return
+		}
+		sm.mux.Lock()
+		watchers := sm.watchers
+		hedgeCallbacks := sm.hedgeCallbacks[id]
+		sm.mux.Unlock()
+		for _, watcher := range watchers {
+			watcher(strategy, c.enabled)
+		}
+		for _, callback := range hedgeCallbacks {
+			callback(strategy)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package memory
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+
+	"gitlab.com/crypto_project/core/strategy_service/src/sources/mongodb/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// A Fixture seeds the in-memory state with markets, key balances and strategies, e.g. to run the service locally.
+type Fixture struct {
+	Markets    []FixtureMarket               `json:"markets"`
+	Balances   map[string]map[string]float64 `json:"balances"` // free balances by asset by key id
+	Strategies []*models.MongoStrategy       `json:"strategies"`
+}
+
+// A FixtureMarket is a market processed with its precisions.
+type FixtureMarket struct {
+	Pair            string `json:"pair"`
+	MarketType      int64  `json:"marketType"`
+	PricePrecision  int64  `json:"pricePrecision"`
+	AmountPrecision int64  `json:"amountPrecision"`
+}
+
+// ReadFixture reads a fixture from the JSON file given.
+func ReadFixture(path string) (*Fixture, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var fixture Fixture
+	if err := json.Unmarshal(data, &fixture); err != nil {
+		return nil, fmt.Errorf("fixture %v: %w", path, err)
+	}
+	return &fixture, nil
+}
+
+// Load adds markets, balances and strategies of the fixture to the state, strategies are created as inserted.
+func (sm *StateMgmt) Load(fixture *Fixture) error {
+	for _, m := range fixture.Markets {
+		sm.SetMarketPrecision(m.Pair, m.MarketType, m.PricePrecision, m.AmountPrecision)
+	}
+	for keyId, balances := range fixture.Balances {
+		id, err := primitive.ObjectIDFromHex(keyId)
+		if err != nil {
+			return fmt.Errorf("balances key id %v: %w", keyId, err)
+		}
+		sm.SetKeyBalances(&id, balances)
+	}
+	for _, strategy := range fixture.Strategies {
+		if strategy.Conditions == nil {
+			return fmt.Errorf("strategy %v has no conditions", strategy.ID)
+		}
+		if strategy.State == nil {
+			strategy.State = &models.MongoStrategyState{}
+		}
+		sm.CreateStrategy(strategy)
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+package memory
+
+import (
+	"fmt"
+
+	"gitlab.com/crypto_project/core/strategy_service/src/sources/mongodb/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// AppendJournalEntry appends the entry, failing on sequence number taken.
+func (sm *StateMgmt) AppendJournalEntry(entry *models.MongoJournalEntry) error {
+	sm.mux.Lock()
+	defer sm.mux.Unlock()
+	entries := sm.journal[entry.StrategyId]
+	if len(entries) > 0 && entries[len(entries)-1].Seq >= entry.Seq {
+		return fmt.Errorf("journal sequence number %v taken", entry.Seq)
+	}
+	sm.journal[entry.StrategyId] = append(entries, *entry)
+	return nil
+}
+
+// GetJournal returns strategy journal entries after the sequence number given in order.
+func (sm *StateMgmt) GetJournal(strategyId *primitive.ObjectID, afterSeq int64) []models.MongoJournalEntry {
+	sm.mux.RLock()
+	defer sm.mux.RUnlock()
+	var entries []models.MongoJournalEntry
+	for _, entry := range sm.journal[*strategyId] {
+		if entry.Seq > afterSeq {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+// GetLastJournalSeq returns the last sequence number of strategy journal, 0 if empty.
+func (sm *StateMgmt) GetLastJournalSeq(strategyId *primitive.ObjectID) int64 {
+	sm.mux.RLock()
+	defer sm.mux.RUnlock()
+	entries := sm.journal[*strategyId]
+	if len(entries) == 0 {
+		return 0
+	}
+	return entries[len(entries)-1].Seq
+}
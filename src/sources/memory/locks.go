@@ -0,0 +1,120 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/go-redsync/redsync/v4"
+	"github.com/go-redsync/redsync/v4/redis"
+)
+
+// A LockPool keeps settlement locks in memory in place of redis, so strategies of the in-memory state are settled
+// in the process without redis. Only commands redsync mutexes use are supported.
+type LockPool struct {
+	locks map[string]lock
+	mux   sync.Mutex
+}
+
+type lock struct {
+	value     string
+	expiresAt time.Time
+}
+
+// A lockConn is a connection to the lock pool, connections have no state of their own.
+type lockConn struct {
+	pool *LockPool
+}
+
+// NewLockPool instantiates an empty lock pool.
+func NewLockPool() *LockPool {
+	return &LockPool{locks: map[string]lock{}}
+}
+
+// Get returns a connection to the pool.
+func (p *LockPool) Get(ctx context.Context) (redis.Conn, error) {
+	return &lockConn{pool: p}, nil
+}
+
+// Close does nothing as there is nothing to release.
+func (c *lockConn) Close() error {
+	return nil
+}
+
+// Get returns value of the lock given, empty if it's not taken.
+func (c *lockConn) Get(name string) (string, error) {
+	c.pool.mux.Lock()
+	defer c.pool.mux.Unlock()
+	return c.pool.load(name).value, nil
+}
+
+// Set takes the lock given with no expiration.
+func (c *lockConn) Set(name string, value string) (bool, error) {
+	c.pool.mux.Lock()
+	defer c.pool.mux.Unlock()
+	c.pool.locks[name] = lock{value: value}
+	return true, nil
+}
+
+// SetNX takes the lock given for the expiry if it's not taken.
+func (c *lockConn) SetNX(name string, value string, expiry time.Duration) (bool, error) {
+	c.pool.mux.Lock()
+	defer c.pool.mux.Unlock()
+	if c.pool.load(name).value != "" {
+		return false, nil
+	}
+	c.pool.locks[name] = lock{value: value, expiresAt: time.Now().Add(expiry)}
+	return true, nil
+}
+
+// PTTL returns how long the lock given is taken for, zero if it's not taken or doesn't expire.
+func (c *lockConn) PTTL(name string) (time.Duration, error) {
+	c.pool.mux.Lock()
+	defer c.pool.mux.Unlock()
+	l := c.pool.load(name)
+	if l.expiresAt.IsZero() {
+		return 0, nil
+	}
+	return time.Until(l.expiresAt), nil
+}
+
+// Eval runs the release script of redsync given the lock and its value, and the extension script given the expiry in
+// milliseconds as well. Both change the lock only if it's taken with the value given and return 1 if so.
+func (c *lockConn) Eval(script *redis.Script, keysAndArgs ...interface{}) (interface{}, error) {
+	if script.KeyCount != 1 || len(keysAndArgs) < 2 {
+		return nil, fmt.Errorf("script not supported")
+	}
+	name, _ := keysAndArgs[0].(string)
+	value, _ := keysAndArgs[1].(string)
+	c.pool.mux.Lock()
+	defer c.pool.mux.Unlock()
+	if l := c.pool.load(name); l.value == "" || l.value != value {
+		return int64(0), nil
+	}
+	if len(keysAndArgs) == 2 {
+		delete(c.pool.locks, name)
+		return int64(1), nil
+	}
+	expiry, ok := keysAndArgs[2].(int)
+	if !ok {
+		return nil, fmt.Errorf("bad expiry %v", keysAndArgs[2])
+	}
+	c.pool.locks[name] = lock{value: value, expiresAt: time.Now().Add(time.Duration(expiry) * time.Millisecond)}
+	return int64(1), nil
+}
+
+// load returns the lock given, expired ones are removed. It must be called with the mutex locked.
+func (p *LockPool) load(name string) lock {
+	l, ok := p.locks[name]
+	if ok && !l.expiresAt.IsZero() && time.Now().After(l.expiresAt) {
+		delete(p.locks, name)
+		return lock{}
+	}
+	return l
+}
+
+// Redsync returns settlement locks kept by the in-memory state.
+func (sm *StateMgmt) Redsync() *redsync.Redsync {
+	return sm.redsync
+}
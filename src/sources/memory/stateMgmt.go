@@ -0,0 +1,497 @@
+package memory
+
+import (
+	"sync"
+	"time"
+
+	"github.com/go-redsync/redsync/v4"
+	"gitlab.com/crypto_project/core/strategy_service/src/logging"
+	"gitlab.com/crypto_project/core/strategy_service/src/service/interfaces"
+	"gitlab.com/crypto_project/core/strategy_service/src/sources/mongodb/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.uber.org/zap"
+)
+
+// Precisions returned for markets not set, wide enough to not round amounts of any market.
+const (
+	defaultPricePrecision  = 8
+	defaultAmountPrecision = 8
+)
+
+var log interfaces.ILogger
+
+func init() {
+	logger, _ := logging.GetZapLogger()
+	log = logger.With(zap.String("logger", "srcMemory"))
+}
+
+// A StateMgmt keeps strategies, orders, market precisions and balances in memory. It is safe for concurrent use and
+// lets to run the service locally, in backtests and integration tests without a persistent storage.
+type StateMgmt struct {
+	strategies     map[primitive.ObjectID]*models.MongoStrategy
+	orders         map[string]*models.MongoOrder // by exchange order id
+	orderCallbacks map[string]func(order *models.MongoOrder)
+	hedgeCallbacks map[primitive.ObjectID][]func(strategy *models.MongoStrategy)
+	watchers       []func(strategy *models.MongoStrategy, enabled bool)
+	precisions     map[market][2]int64 // price and amount precisions
+	balances       map[primitive.ObjectID]map[string]float64
+	pnl            map[primitive.ObjectID]float64 // by template strategy id
+	journal        map[primitive.ObjectID][]models.MongoJournalEntry
+	events         []strategyEvent // queued for watchers, unbounded to let watchers update strategies back
+	eventsCond     *sync.Cond
+	redsync        *redsync.Redsync // settlement locks
+	mux            sync.RWMutex
+}
+
+type market struct {
+	pair       string
+	marketType int64
+}
+
+type strategyEvent struct {
+	strategy       *models.MongoStrategy
+	enabled        bool // created enabled or updated from disabled
+	watchers       []func(strategy *models.MongoStrategy, enabled bool)
+	hedgeCallbacks []func(strategy *models.MongoStrategy)
+}
+
+// NewStateMgmt instantiates an empty in-memory state and starts delivering strategy updates to watchers.
+func NewStateMgmt() *StateMgmt {
+	sm := &StateMgmt{
+		strategies:     map[primitive.ObjectID]*models.MongoStrategy{},
+		orders:         map[string]*models.MongoOrder{},
+		orderCallbacks: map[string]func(order *models.MongoOrder){},
+		hedgeCallbacks: map[primitive.ObjectID][]func(strategy *models.MongoStrategy){},
+		precisions:     map[market][2]int64{},
+		balances:       map[primitive.ObjectID]map[string]float64{},
+		pnl:            map[primitive.ObjectID]float64{},
+		journal:        map[primitive.ObjectID][]models.MongoJournalEntry{},
+		eventsCond:     sync.NewCond(&sync.Mutex{}),
+		redsync:        redsync.New(NewLockPool()),
+	}
+	go sm.deliverStrategyEvents()
+	return sm
+}
+
+// SetMarketPrecision sets price and amount precisions of the market given.
+func (sm *StateMgmt) SetMarketPrecision(pair string, marketType int64, pricePrecision int64, amountPrecision int64) {
+	sm.mux.Lock()
+	defer sm.mux.Unlock()
+	sm.precisions[market{pair, marketType}] = [2]int64{pricePrecision, amountPrecision}
+}
+
+// GetMarkets returns pairs with precisions set by market type.
+func (sm *StateMgmt) GetMarkets() map[int64][]string {
+	sm.mux.RLock()
+	defer sm.mux.RUnlock()
+	markets := map[int64][]string{}
+	for m := range sm.precisions {
+		markets[m.marketType] = append(markets[m.marketType], m.pair)
+	}
+	return markets
+}
+
+// SetKeyBalances replaces free balances by asset of the key given.
+func (sm *StateMgmt) SetKeyBalances(keyId *primitive.ObjectID, balances map[string]float64) {
+	sm.mux.Lock()
+	defer sm.mux.Unlock()
+	copied := map[string]float64{}
+	for asset, balance := range balances {
+		copied[asset] = balance
+	}
+	sm.balances[*keyId] = copied
+}
+
+// GetPNL returns profit accumulated by strategies created from the template given.
+func (sm *StateMgmt) GetPNL(templateStrategyId *primitive.ObjectID) float64 {
+	sm.mux.RLock()
+	defer sm.mux.RUnlock()
+	return sm.pnl[*templateStrategyId]
+}
+
+// WatchStrategies registers a callback invoked in order on every strategy created or updated, like a change stream,
+// telling whether the change enabled the strategy.
+func (sm *StateMgmt) WatchStrategies(onStrategyUpdate func(strategy *models.MongoStrategy, enabled bool)) {
+	sm.mux.Lock()
+	defer sm.mux.Unlock()
+	sm.watchers = append(sm.watchers, onStrategyUpdate)
+}
+
+// GetStrategy returns a copy of the strategy stored, nil if not found.
+func (sm *StateMgmt) GetStrategy(strategyId *primitive.ObjectID) *models.MongoStrategy {
+	sm.mux.RLock()
+	defer sm.mux.RUnlock()
+	strategy, ok := sm.strategies[*strategyId]
+	if !ok {
+		return nil
+	}
+	return copyStrategy(strategy)
+}
+
+// GetEnabledStrategies returns copies of all the enabled strategies.
+func (sm *StateMgmt) GetEnabledStrategies() []*models.MongoStrategy {
+	sm.mux.RLock()
+	defer sm.mux.RUnlock()
+	var enabled []*models.MongoStrategy
+	for _, strategy := range sm.strategies {
+		if strategy.Enabled {
+			enabled = append(enabled, copyStrategy(strategy))
+		}
+	}
+	return enabled
+}
+
+// InitOrdersWatch does nothing as orders saved are dispatched to subscribers right away.
+func (sm *StateMgmt) InitOrdersWatch() {
+	log.Info("watching for orders in memory")
+}
+
+func (sm *StateMgmt) SubscribeToOrder(orderId string, onOrderStatusUpdate func(order *models.MongoOrder)) error {
+	sm.mux.Lock()
+	sm.orderCallbacks[orderId] = onOrderStatusUpdate
+	order, ok := sm.orders[orderId]
+	if ok {
+		copied := *order
+		order = &copied
+	}
+	sm.mux.Unlock()
+	if ok {
+		onOrderStatusUpdate(order)
+	}
+	return nil
+}
+
+// SubscribeToHedge invokes the callback given with the hedge strategy now and on each update of it.
+func (sm *StateMgmt) SubscribeToHedge(strategyId *primitive.ObjectID, onHedgeExitUpdate func(strategy *models.MongoStrategy)) error {
+	sm.mux.Lock()
+	sm.hedgeCallbacks[*strategyId] = append(sm.hedgeCallbacks[*strategyId], onHedgeExitUpdate)
+	strategy, ok := sm.strategies[*strategyId]
+	if ok {
+		strategy = copyStrategy(strategy)
+	}
+	sm.mux.Unlock()
+	if ok {
+		onHedgeExitUpdate(strategy)
+	}
+	return nil
+}
+
+func (sm *StateMgmt) GetOrder(orderId string) *models.MongoOrder {
+	sm.mux.RLock()
+	defer sm.mux.RUnlock()
+	order, ok := sm.orders[orderId]
+	if !ok {
+		return nil
+	}
+	copied := *order
+	return &copied
+}
+
+func (sm *StateMgmt) GetOrderById(orderId *primitive.ObjectID) *models.MongoOrder {
+	sm.mux.RLock()
+	defer sm.mux.RUnlock()
+	for _, order := range sm.orders {
+		if order.ID == *orderId {
+			copied := *order
+			return &copied
+		}
+	}
+	return nil
+}
+
+// SaveOrder upserts the order and notifies its subscriber once the order filled or canceled.
+func (sm *StateMgmt) SaveOrder(order models.MongoOrder, keyId *primitive.ObjectID, marketType int64) {
+	if order.UpdatedAt.IsZero() {
+		order.UpdatedAt = time.Now()
+	}
+	sm.mux.Lock()
+	stored := order
+	sm.orders[order.OrderId] = &stored
+	orderId := order.OrderId
+	if order.PostOnlyInitialOrderId != "" {
+		orderId = order.PostOnlyInitialOrderId
+	}
+	callback := sm.orderCallbacks[orderId]
+	sm.mux.Unlock()
+	if callback != nil && (order.Status == "filled" || order.Status == "canceled") {
+		go callback(&order)
+	}
+}
+
+func (sm *StateMgmt) GetPosition(strategyId *primitive.ObjectID, symbol string) {
+}
+
+func (sm *StateMgmt) GetMarketPrecision(pair string, marketType int64) (int64, int64) {
+	sm.mux.RLock()
+	defer sm.mux.RUnlock()
+	precision, ok := sm.precisions[market{pair, marketType}]
+	if !ok {
+		log.Warn("market precision not set",
+			zap.String("pair", pair),
+			zap.Int64("marketType", marketType),
+		)
+		return defaultPricePrecision, defaultAmountPrecision
+	}
+	return precision[0], precision[1]
+}
+
+func (sm *StateMgmt) GetKeyBalances(keyId *primitive.ObjectID) map[string]float64 {
+	sm.mux.RLock()
+	defer sm.mux.RUnlock()
+	balances := map[string]float64{}
+	for asset, balance := range sm.balances[*keyId] {
+		balances[asset] = balance
+	}
+	return balances
+}
+
+func (sm *StateMgmt) AnyActiveStrats(strategy *models.MongoStrategy) bool {
+	sm.mux.RLock()
+	defer sm.mux.RUnlock()
+	for id, found := range sm.strategies {
+		if id == *strategy.ID || !found.Enabled || found.AccountId == nil || strategy.AccountId == nil ||
+			*found.AccountId != *strategy.AccountId || found.Conditions == nil {
+			continue
+		}
+		if found.Conditions.Pair == strategy.Conditions.Pair && found.Conditions.MarketType == strategy.Conditions.MarketType {
+			return true
+		}
+	}
+	return false
+}
+
+func (sm *StateMgmt) CreateStrategy(strategy *models.MongoStrategy) *models.MongoStrategy {
+	if strategy.ID == nil {
+		id := primitive.NewObjectID()
+		strategy.ID = &id
+	}
+	sm.mux.Lock()
+	stored, found := sm.strategies[*strategy.ID]
+	sm.strategies[*strategy.ID] = copyStrategy(strategy)
+	sm.notify(*strategy.ID, strategy.Enabled && (!found || !stored.Enabled))
+	sm.mux.Unlock()
+	return strategy
+}
+
+func (sm *StateMgmt) SaveStrategy(strategy *models.MongoStrategy) *models.MongoStrategy {
+	return sm.CreateStrategy(strategy)
+}
+
+func (sm *StateMgmt) EnableStrategy(strategyId *primitive.ObjectID) {
+	sm.update(strategyId, func(strategy *models.MongoStrategy) {
+		strategy.Enabled = true
+	})
+}
+
+func (sm *StateMgmt) DisableStrategy(strategyId *primitive.ObjectID) {
+	log.Info("disabling strategy", zap.String("id", strategyId.String()))
+	sm.update(strategyId, func(strategy *models.MongoStrategy) {
+		strategy.Enabled = false
+	})
+}
+
+func (sm *StateMgmt) EnableHedgeLossStrategy(strategyId *primitive.ObjectID) {
+	sm.update(strategyId, func(strategy *models.MongoStrategy) {
+		if strategy.Conditions != nil {
+			strategy.Conditions.TakeProfitExternal = false
+		}
+	})
+}
+
+func (sm *StateMgmt) UpdateConditions(strategyId *primitive.ObjectID, conditions *models.MongoStrategyCondition) {
+	sm.update(strategyId, func(strategy *models.MongoStrategy) {
+		strategy.Conditions = copyConditions(conditions)
+	})
+}
+
+func (sm *StateMgmt) UpdateState(strategyId *primitive.ObjectID, state *models.MongoStrategyState) {
+	sm.updateState(strategyId, func(stored *models.MongoStrategyState) {
+		stored.State = state.State
+		if len(state.Msg) > 0 {
+			stored.Msg = state.Msg
+		}
+	})
+}
+
+func (sm *StateMgmt) UpdateStrategyState(strategyId *primitive.ObjectID, state *models.MongoStrategyState) {
+	// the state stored is the one written last as there are no other writers, so it's replaced as a whole
+	sm.update(strategyId, func(strategy *models.MongoStrategy) {
+		strategy.State = copyState(state)
+	})
+}
+
+func (sm *StateMgmt) UpdateExecutedAmount(strategyId *primitive.ObjectID, state *models.MongoStrategyState) {
+	sm.updateState(strategyId, func(stored *models.MongoStrategyState) {
+		stored.ExecutedAmount = state.ExecutedAmount
+		stored.ExitPrice = state.ExitPrice
+		if state.ExecutedAmount == 0 {
+			stored.ExecutedOrders = []string{}
+			stored.EntryPrice = 0
+			stored.Amount = 0
+			stored.ReachedTargetCount = 0
+		}
+	})
+}
+
+// UpdateOrders adds order IDs stored in a state provided to the ones of the strategy, skipping known ones.
+func (sm *StateMgmt) UpdateOrders(strategyId *primitive.ObjectID, state *models.MongoStrategyState) {
+	if len(state.Orders)+len(state.ExecutedOrders) == 0 {
+		return
+	}
+	sm.updateState(strategyId, func(stored *models.MongoStrategyState) {
+		stored.Orders = addToSet(stored.Orders, state.Orders)
+		stored.ExecutedOrders = addToSet(stored.ExecutedOrders, state.ExecutedOrders)
+	})
+}
+
+func (sm *StateMgmt) UpdateEntryPrice(strategyId *primitive.ObjectID, state *models.MongoStrategyState) {
+	sm.updateState(strategyId, func(stored *models.MongoStrategyState) {
+		stored.EntryPrice = state.EntryPrice
+		stored.State = state.State
+		stored.PositionAmount = state.PositionAmount
+	})
+}
+
+func (sm *StateMgmt) UpdateHedgeExitPrice(strategyId *primitive.ObjectID, state *models.MongoStrategyState) {
+	sm.updateState(strategyId, func(stored *models.MongoStrategyState) {
+		stored.HedgeExitPrice = state.HedgeExitPrice
+		stored.State = state.State
+	})
+}
+
+// UpdateStateAndConditions replaces both state and conditions of the strategy.
+func (sm *StateMgmt) UpdateStateAndConditions(strategyId *primitive.ObjectID, model *models.MongoStrategy) {
+	sm.update(strategyId, func(strategy *models.MongoStrategy) {
+		strategy.Conditions = copyConditions(model.Conditions)
+		strategy.State = copyState(model.State)
+	})
+}
+
+func (sm *StateMgmt) SavePNL(templateStrategyId *primitive.ObjectID, profitAmount float64) {
+	sm.mux.Lock()
+	defer sm.mux.Unlock()
+	sm.pnl[*templateStrategyId] += profitAmount
+}
+
+// SaveStrategyConditions updates dynamic state with given static (persistent) conditions.
+func (sm *StateMgmt) SaveStrategyConditions(strategy *models.MongoStrategy) {
+	strategy.State.EntryPointPrice = strategy.Conditions.EntryOrder.Price
+	strategy.State.EntryPointType = strategy.Conditions.EntryOrder.OrderType
+	strategy.State.EntryPointSide = strategy.Conditions.EntryOrder.Side
+	strategy.State.EntryPointAmount = strategy.Conditions.EntryOrder.Amount
+	strategy.State.EntryPointDeviation = strategy.Conditions.EntryOrder.EntryDeviation
+
+	strategy.State.StopLoss = strategy.Conditions.StopLoss
+	strategy.State.ForcedLoss = strategy.Conditions.ForcedLoss
+	strategy.State.TakeProfit = strategy.Conditions.ExitLevels
+	strategy.State.StopLossPrice = strategy.Conditions.StopLossPrice
+	strategy.State.ForcedLossPrice = strategy.Conditions.ForcedLossPrice
+	strategy.State.TrailingExitPrice = strategy.Conditions.TrailingExitPrice
+	strategy.State.TakeProfitPrice = strategy.Conditions.TakeProfitPrice
+	strategy.State.TakeProfitHedgePrice = strategy.Conditions.TakeProfitHedgePrice
+}
+
+// update applies the change given to the strategy stored and notifies watchers. Unknown strategies are skipped.
+func (sm *StateMgmt) update(strategyId *primitive.ObjectID, change func(strategy *models.MongoStrategy)) {
+	sm.mux.Lock()
+	defer sm.mux.Unlock()
+	strategy, ok := sm.strategies[*strategyId]
+	if !ok {
+		log.Warn("strategy to update not found", zap.String("id", strategyId.Hex()))
+		return
+	}
+	wasEnabled := strategy.Enabled
+	change(strategy)
+	strategy.Version++
+	sm.notify(*strategyId, strategy.Enabled && !wasEnabled)
+}
+
+// updateState applies the change given to the state of the strategy stored, creating the state if not set.
+func (sm *StateMgmt) updateState(strategyId *primitive.ObjectID, change func(state *models.MongoStrategyState)) {
+	sm.update(strategyId, func(strategy *models.MongoStrategy) {
+		if strategy.State == nil {
+			strategy.State = &models.MongoStrategyState{}
+		}
+		change(strategy.State)
+	})
+}
+
+// notify queues a copy of the strategy for watchers and hedge subscribers at the moment, should be called with the lock
+// held to keep updates ordered.
+func (sm *StateMgmt) notify(strategyId primitive.ObjectID, enabled bool) {
+	sm.eventsCond.L.Lock()
+	sm.events = append(sm.events, strategyEvent{
+		strategy:       copyStrategy(sm.strategies[strategyId]),
+		enabled:        enabled,
+		watchers:       sm.watchers,
+		hedgeCallbacks: sm.hedgeCallbacks[strategyId],
+	})
+	sm.eventsCond.L.Unlock()
+	sm.eventsCond.Signal()
+}
+
+// deliverStrategyEvents invokes strategy watchers and hedge subscribers one update after another.
+func (sm *StateMgmt) deliverStrategyEvents() {
+	for {
+		sm.eventsCond.L.Lock()
+		for len(sm.events) == 0 {
+			sm.eventsCond.Wait()
+		}
+		event := sm.events[0]
+		sm.events = sm.events[1:]
+		sm.eventsCond.L.Unlock()
+
+		for _, watcher := range event.watchers {
+			watcher(copyStrategy(event.strategy), event.enabled)
+		}
+		for _, callback := range event.hedgeCallbacks {
+			callback(copyStrategy(event.strategy))
+		}
+	}
+}
+
+// copyStrategy returns a deep copy of the strategy as it would be read back from a persistent storage.
+func copyStrategy(strategy *models.MongoStrategy) *models.MongoStrategy {
+	var copied models.MongoStrategy
+	raw, err := bson.Marshal(strategy)
+	if err == nil {
+		err = bson.Unmarshal(raw, &copied)
+	}
+	if err != nil {
+		log.Error("can't copy strategy", zap.Error(err))
+		copied = *strategy
+	}
+	return &copied
+}
+
+func copyConditions(conditions *models.MongoStrategyCondition) *models.MongoStrategyCondition {
+	if conditions == nil {
+		return nil
+	}
+	return copyStrategy(&models.MongoStrategy{Conditions: conditions}).Conditions
+}
+
+func copyState(state *models.MongoStrategyState) *models.MongoStrategyState {
+	if state == nil {
+		return nil
+	}
+	return copyStrategy(&models.MongoStrategy{State: state}).State
+}
+
+// addToSet appends values not in the set yet.
+func addToSet(set []string, values []string) []string {
+	for _, value := range values {
+		found := false
+		for _, item := range set {
+			if item == value {
+				found = true
+				break
+			}
+		}
+		if !found {
+			set = append(set, value)
+		}
+	}
+	return set
+}
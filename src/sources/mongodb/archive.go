@@ -0,0 +1,199 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"gitlab.com/crypto_project/core/strategy_service/src/sources/mongodb/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+)
+
+// Archive collections keep strategies finished long ago with their orders and journal out of the collections the
+// runtime scans. Documents are copied replacing ones copied before and deleted after, strategies last, so a move
+// interrupted is completed by the next one.
+
+// A strategyCollections names collections a strategy with its orders and journal kept in.
+type strategyCollections struct {
+	strategies string
+	orders     string
+	journal    string
+}
+
+var (
+	liveCollections    = strategyCollections{"core_strategies", "core_orders", "core_strategy_journal"}
+	archiveCollections = strategyCollections{"core_strategies_archive", "core_orders_archive", "core_strategy_journal_archive"}
+)
+
+// archivedStates are states of strategies archived, strategies don't trade in them anymore.
+var archivedStates = bson.A{"End", "Canceled", "Timeout", "Error"}
+
+// ErrNotArchived is returned restoring a strategy not found in the archive.
+var ErrNotArchived = errors.New("strategy is not archived")
+
+// ArchiveStrategies moves up to limit disabled strategies ended, canceled, timed out or errored before the time given,
+// to archive collections with their orders and journal. Strategies ended before the end time was saved are archived
+// by the time created.
+func (sm *StateMgmt) ArchiveStrategies(endedBefore time.Time, limit int64) (models.ArchiveCounts, error) {
+	var counts models.ArchiveCounts
+	ctx := context.TODO()
+	filter := bson.D{
+		{Key: "enabled", Value: false},
+		{Key: "state.state", Value: bson.D{{Key: "$in", Value: archivedStates}}},
+		{Key: "$or", Value: bson.A{
+			bson.D{{Key: "state.endedAt", Value: bson.D{{Key: "$gt", Value: 0}, {Key: "$lt", Value: endedBefore.Unix()}}}},
+			bson.D{
+				{Key: "state.endedAt", Value: bson.D{{Key: "$in", Value: bson.A{0, nil}}}},
+				{Key: "_id", Value: bson.D{{Key: "$lt", Value: primitive.NewObjectIDFromTimestamp(endedBefore)}}},
+			},
+		}},
+	}
+	opts := options.Find().SetLimit(limit).SetProjection(bson.D{{Key: "_id", Value: 1}, {Key: "state", Value: 1}})
+	cur, err := GetCollection(liveCollections.strategies).Find(ctx, filter, opts)
+	if err != nil {
+		return counts, err
+	}
+	var strategies []models.MongoStrategy
+	if err := cur.All(ctx, &strategies); err != nil {
+		return counts, err
+	}
+	for i := range strategies {
+		moved, err := moveStrategy(&strategies[i], liveCollections, archiveCollections,
+			bson.D{{Key: "_id", Value: strategies[i].ID}, {Key: "enabled", Value: false}})
+		counts.Add(moved)
+		if err != nil {
+			return counts, err
+		}
+		log.Info("strategy archived",
+			zap.String("id", strategies[i].ID.Hex()),
+			zap.Int64("orders", moved.Orders),
+			zap.Int64("journal entries", moved.JournalEntries),
+		)
+	}
+	return counts, nil
+}
+
+// isArchivedState tells whether strategies in the state given are archived once ended long enough.
+func isArchivedState(state string) bool {
+	for _, archived := range archivedStates {
+		if state == archived {
+			return true
+		}
+	}
+	return false
+}
+
+// endedAt returns the time the strategy in the state given ended at, the time stored if it ended already, zero if it
+// runs.
+func endedAt(state string, stored *models.MongoStrategyState) int64 {
+	if !isArchivedState(state) {
+		return 0
+	}
+	if stored != nil && stored.EndedAt > 0 && isArchivedState(stored.State) {
+		return stored.EndedAt
+	}
+	return time.Now().Unix()
+}
+
+// withEndedAt returns a copy of the state with the end time set for the state stored given.
+func withEndedAt(state *models.MongoStrategyState, stored *models.MongoStrategyState) *models.MongoStrategyState {
+	if state == nil {
+		return nil
+	}
+	ended := *state
+	ended.EndedAt = endedAt(state.State, stored)
+	return &ended
+}
+
+// RestoreStrategy moves the strategy with its orders and journal back from archive collections.
+func (sm *StateMgmt) RestoreStrategy(strategyId *primitive.ObjectID) (models.ArchiveCounts, error) {
+	var strategy models.MongoStrategy
+	err := GetCollection(archiveCollections.strategies).FindOne(context.TODO(),
+		bson.D{{Key: "_id", Value: strategyId}},
+		options.FindOne().SetProjection(bson.D{{Key: "_id", Value: 1}, {Key: "state", Value: 1}}),
+	).Decode(&strategy)
+	if err == mongo.ErrNoDocuments {
+		return models.ArchiveCounts{}, ErrNotArchived
+	}
+	if err != nil {
+		return models.ArchiveCounts{}, err
+	}
+	journalCollection() // the journal restored needs sequence numbers index
+	counts, err := moveStrategy(&strategy, archiveCollections, liveCollections, bson.D{{Key: "_id", Value: strategyId}})
+	if err == nil {
+		log.Info("strategy restored from archive", zap.String("id", strategyId.Hex()))
+	}
+	return counts, err
+}
+
+// moveStrategy moves orders and journal of the strategy given, then the strategy document matching the filter.
+func moveStrategy(strategy *models.MongoStrategy, from strategyCollections, to strategyCollections, filter bson.D) (models.ArchiveCounts, error) {
+	var counts models.ArchiveCounts
+	var err error
+	if orderIds := strategyOrderIds(strategy.State); len(orderIds) > 0 {
+		counts.Orders, err = moveDocuments(GetCollection(from.orders), GetCollection(to.orders), bson.D{{Key: "$or", Value: bson.A{
+			bson.D{{Key: "id", Value: bson.D{{Key: "$in", Value: orderIds}}}},
+			bson.D{{Key: "postOnlyInitialOrderId", Value: bson.D{{Key: "$in", Value: orderIds}}}},
+		}}})
+		if err != nil {
+			return counts, err
+		}
+	}
+	counts.JournalEntries, err = moveDocuments(GetCollection(from.journal), GetCollection(to.journal),
+		bson.D{{Key: "strategyId", Value: strategy.ID}})
+	if err != nil {
+		return counts, err
+	}
+	counts.Strategies, err = moveDocuments(GetCollection(from.strategies), GetCollection(to.strategies), filter)
+	return counts, err
+}
+
+// strategyOrderIds returns ids of orders the strategy placed.
+func strategyOrderIds(state *models.MongoStrategyState) []string {
+	if state == nil {
+		return nil
+	}
+	ids := models.UnionIds(state.Orders, state.WaitForEntryIds)
+	ids = models.UnionIds(ids, state.StopLossOrderIds)
+	ids = models.UnionIds(ids, state.ForcedLossOrderIds)
+	return models.UnionIds(ids, state.TakeProfitOrderIds)
+}
+
+// moveDocuments copies documents matching the filter replacing ones copied before and deletes them, returning how
+// many deleted.
+func moveDocuments(from *mongo.Collection, to *mongo.Collection, filter bson.D) (int64, error) {
+	ctx := context.TODO()
+	cur, err := from.Find(ctx, filter)
+	if err != nil {
+		return 0, err
+	}
+	var docs []bson.Raw
+	if err := cur.All(ctx, &docs); err != nil {
+		return 0, err
+	}
+	if len(docs) == 0 {
+		return 0, nil
+	}
+	ids := make(bson.A, 0, len(docs))
+	writes := make([]mongo.WriteModel, 0, len(docs))
+	for _, doc := range docs {
+		id := doc.Lookup("_id")
+		ids = append(ids, id)
+		writes = append(writes, mongo.NewReplaceOneModel().
+			SetFilter(bson.D{{Key: "_id", Value: id}}).
+			SetReplacement(doc).
+			SetUpsert(true))
+	}
+	if _, err := to.BulkWrite(ctx, writes, options.BulkWrite().SetOrdered(false)); err != nil {
+		return 0, err
+	}
+	deleted, err := from.DeleteMany(ctx, bson.D{{Key: "_id", Value: bson.D{{Key: "$in", Value: ids}}}})
+	if err != nil {
+		return 0, err
+	}
+	return deleted.DeletedCount, nil
+}
@@ -6,6 +6,7 @@ import (
 	"gitlab.com/crypto_project/core/strategy_service/src/logging"
 	"gitlab.com/crypto_project/core/strategy_service/src/service/interfaces"
 	"gitlab.com/crypto_project/core/strategy_service/src/sources/mongodb/models"
+	"gitlab.com/crypto_project/core/strategy_service/src/sources/mongodb/schema"
 	statsd_client "gitlab.com/crypto_project/core/strategy_service/src/statsd"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -53,6 +54,11 @@ func GetMongoClientInstance() *mongo.Client {
 	return mongoClient
 }
 
+// SetMongoClient makes collections to be taken from the client given, e.g. connected to a mocked deployment.
+func SetMongoClient(client *mongo.Client) {
+	mongoClient = client
+}
+
 func Connect(url string, connectTimeout time.Duration) (*mongo.Client, error) {
 	ctx, _ := context.WithTimeout(context.Background(), connectTimeout)
 	timeout := 10 * time.Second
@@ -70,64 +76,45 @@ func Connect(url string, connectTimeout time.Duration) (*mongo.Client, error) {
 type StateMgmt struct {
 	OrderCallbacks *sync.Map
 	Statsd         *statsd_client.StatsdClient
+	WriteBehind    *WriteBehind           // buffers state updates done each tick if set
+	known          models.KnownStrategies // strategies as written last, the base to merge updates
+	delivered      map[string]orderUpdate // the last order update delivered by callback order id
+	deliveredMux   sync.Mutex
 }
 
 // InitOrdersWatch subscribes to orders updates and invokes StateMgnt callback on `filled` and `canceled` orders update event received.
+// The watch is resumed after interruptions and orders subscribed are reconciled with ones stored on each resume and
+// periodically, so a fill missed doesn't leave a strategy waiting forever.
 func (sm *StateMgmt) InitOrdersWatch() {
 	log.Info("watching for new orders in the storage")
 	sm.OrderCallbacks = &sync.Map{}
-	CollName := "core_orders"
-	ctx := context.Background()
-	var coll = GetCollection(CollName)
 	pipeline := mongo.Pipeline{bson.D{
-		{"$match", bson.M{"$or": []interface{}{
+		{Key: "$match", Value: bson.M{"$or": []interface{}{
 			bson.M{"fullDocument.status": "filled"},
 			bson.M{"fullDocument.status": "canceled"},
 		}},
 		},
 	}}
-	cs, err := coll.Watch(ctx, pipeline, options.ChangeStream().SetFullDocument(options.UpdateLookup))
-	if err != nil {
-		panic(err.Error())
-	}
-	//require.NoError(cs, err)
-	defer cs.Close(ctx)
-	for cs.Next(ctx) {
-		var eventDecoded models.MongoOrderUpdateEvent
-		err := cs.Decode(&eventDecoded)
-		//	data := next.String()
-		// log.Print(data)
-		//		err := json.Unmarshal([]byte(data), &event)
-		if err != nil {
-			log.Error("event decode",
-				zap.Error(err),
-				zap.String("orderRaw", fmt.Sprintf("%+v", cs.Current)),
-			)
-		}
-		go func(event models.MongoOrderUpdateEvent) {
-			if event.FullDocument.Status == "filled" || event.FullDocument.Status == "canceled" {
-				orderId := event.FullDocument.OrderId
-				if event.FullDocument.PostOnlyInitialOrderId != "" {
-					orderId = event.FullDocument.PostOnlyInitialOrderId
-				}
-				log.Info("order",
-					zap.String("orderId", orderId),
-					zap.String("status", event.FullDocument.Status),
-					zap.Time("event.FullDocument.UpdatedAt", event.FullDocument.UpdatedAt),
+	go sm.runOrdersReconciliation()
+	watch := ResumableWatch{
+		Name:       "orders",
+		Collection: GetCollection("core_orders"),
+		Pipeline:   pipeline,
+		Statsd:     sm.Statsd,
+		OnOpen:     sm.ReconcileOrders,
+		Handle: func(cs *mongo.ChangeStream) {
+			var eventDecoded models.MongoOrderUpdateEvent
+			if err := cs.Decode(&eventDecoded); err != nil {
+				log.Error("event decode",
+					zap.Error(err),
+					zap.String("orderRaw", fmt.Sprintf("%+v", cs.Current)),
 				)
-				getCallBackRaw, ok := sm.OrderCallbacks.Load(orderId)
-				if ok {
-					log.Debug("callback found",
-						zap.String("orderId", orderId),
-						zap.String("fullDocument", fmt.Sprintf("%+v", event.FullDocument)),
-					)
-					callback := getCallBackRaw.(func(order *models.MongoOrder))
-					callback(&event.FullDocument)
-				}
+				return
 			}
-		}(eventDecoded)
+			go sm.deliverOrder(&eventDecoded.FullDocument)
+		},
 	}
-	log.Fatal("new orders watch")
+	watch.Run()
 }
 
 func (sm *StateMgmt) EnableStrategy(strategyId *primitive.ObjectID) {
@@ -147,7 +134,7 @@ func (sm *StateMgmt) EnableStrategy(strategyId *primitive.ObjectID) {
 			},
 		},
 	}
-	_, err := col.UpdateOne(context.TODO(), request, update)
+	_, err := col.UpdateOne(context.TODO(), request, withVersionInc(update))
 	if err != nil {
 		log.Error("error in arg", zap.Error(err))
 	}
@@ -174,10 +161,11 @@ func (sm *StateMgmt) DisableStrategy(strategyId *primitive.ObjectID) {
 			},
 		},
 	}
-	_, err := col.UpdateOne(context.TODO(), request, update)
+	_, err := col.UpdateOne(context.TODO(), request, withVersionInc(update))
 	if err != nil {
 		log.Error("error in arg", zap.Error(err))
 	}
+	sm.known.Forget(strategyId)
 	sm.CheckDisabledStrategy(strategyId, 2, 30)
 	sm.Statsd.TimingDuration("state_mgmt.disable_strategy", time.Since(t1))
 }
@@ -205,8 +193,14 @@ func (sm *StateMgmt) SubscribeToOrder(orderId string, onOrderStatusUpdate func(o
 	log.Info("subscribing to order",
 		zap.Bool("executedOrder is nil", executedOrder == nil),
 	)
-	if executedOrder != nil { // looks like if this is true, we store a callback above forever, no?
+	if executedOrder != nil {
+		if executedOrder.Status == "filled" || executedOrder.Status == "canceled" {
+			sm.markDelivered(orderId, executedOrder)
+		}
 		onOrderStatusUpdate(executedOrder)
+		if executedOrder.Status == "filled" {
+			sm.dropCallback(orderId)
+		}
 	}
 	return nil
 }
@@ -316,7 +310,7 @@ func (sm *StateMgmt) SubscribeToHedge(strategyId *primitive.ObjectID, onStrategy
 	defer cs.Close(ctx)
 	for cs.Next(ctx) {
 		var event models.MongoStrategyUpdateEvent
-		err := cs.Decode(&event)
+		err := schema.DecodeStrategyEvent(cs.Current, &event)
 		//	data := next.String()
 		// log.Print(data)
 		//		err := json.Unmarshal([]byte(data), &event)
@@ -420,6 +414,9 @@ func (sm *StateMgmt) CreateStrategy(strategy *models.MongoStrategy) *models.Mong
 	CollName := "core_strategies"
 	ctx := context.Background()
 	var coll = GetCollection(CollName)
+	if strategy.SchemaVersion == 0 {
+		strategy.SchemaVersion = schema.CurrentVersion()
+	}
 	_, err := coll.InsertOne(ctx, strategy)
 	if err != nil {
 		log.Error("", zap.Error(err))
@@ -439,7 +436,11 @@ func (sm *StateMgmt) GetStrategy(strategyId *primitive.ObjectID) *models.MongoSt
 	var coll = GetCollection(CollName)
 
 	var strategy *models.MongoStrategy
-	err := coll.FindOne(ctx, request).Decode(&strategy)
+	raw, err := coll.FindOne(ctx, request).DecodeBytes()
+	if err == nil {
+		strategy = &models.MongoStrategy{}
+		err = schema.DecodeStrategy(raw, strategy)
+	}
 	if err != nil {
 		log.Error("", zap.Error(err))
 	}
@@ -475,22 +476,10 @@ func (sm *StateMgmt) GetMarketPrecision(pair string, marketType int64) (int64, i
 
 func (sm *StateMgmt) UpdateConditions(strategyId *primitive.ObjectID, state *models.MongoStrategyCondition) {
 	t1 := time.Now()
-	col := GetCollection("core_strategies")
-	var request bson.D
-	request = bson.D{
-		{"_id", strategyId},
-	}
-	var update bson.D
-	update = bson.D{
-		{
-			"$set", bson.D{
-				{
-					"conditions", state,
-				},
-			},
-		},
-	}
-	_, err := col.UpdateOne(context.TODO(), request, update)
+	// conditions changed since known are set only, to not overwrite ones changed by other writers
+	_, err := sm.updateVersioned("update_conditions", strategyId, func(current *models.MongoStrategy, base *models.MongoStrategy) bson.D {
+		return mergeDocument("conditions", state, base.Conditions, current.Conditions)
+	})
 	if err != nil {
 		log.Error("error in arg", zap.Error(err))
 	}
@@ -500,26 +489,28 @@ func (sm *StateMgmt) UpdateConditions(strategyId *primitive.ObjectID, state *mod
 
 func (sm *StateMgmt) UpdateState(strategyId *primitive.ObjectID, state *models.MongoStrategyState) {
 	t1 := time.Now()
-	col := GetCollection("core_strategies")
-	var request bson.D
-	request = bson.D{
-		{"_id", strategyId},
-	}
 	var update bson.D
 	updates := bson.D{
 		{
-			"state.state", state.State,
+			Key: "state.state", Value: state.State,
+		},
+		{
+			Key: "state.endedAt", Value: endedAt(state.State, nil),
 		},
 	}
 	if len(state.Msg) > 0 {
 		updates = append(updates, bson.E{Key: "state.msg", Value: state.Msg})
 	}
+	if sm.WriteBehind != nil && !criticalStates[state.State] {
+		sm.WriteBehind.Set(strategyId, updates)
+		return
+	}
 	update = bson.D{
 		{
-			"$set", updates,
+			Key: "$set", Value: updates,
 		},
 	}
-	updated, err := col.UpdateOne(context.TODO(), request, update)
+	updated, err := sm.updateVersioned("update_state", strategyId, func(*models.MongoStrategy, *models.MongoStrategy) bson.D { return update })
 	if err != nil {
 		log.Error("error in arg", zap.Error(err))
 		return
@@ -531,30 +522,16 @@ func (sm *StateMgmt) UpdateState(strategyId *primitive.ObjectID, state *models.M
 	sm.Statsd.TimingDuration("state_mgmt.update_state", time.Since(t1))
 }
 
+// UpdateStrategyState replaces the state of the strategy keeping order ids placed concurrently.
 func (sm *StateMgmt) UpdateStrategyState(strategyId *primitive.ObjectID, state *models.MongoStrategyState) {
 	t1 := time.Now()
-	col := GetCollection("core_strategies")
-	var request bson.D
-	request = bson.D{
-		{"_id", strategyId},
-	}
-	var update bson.D
-	updates := bson.D{
-		{
-			"state", state,
-		},
-	}
-	update = bson.D{
-		{
-			"$set", updates,
-		},
-	}
-	updated, err := col.UpdateOne(context.TODO(), request, update)
+	updated, err := sm.updateVersioned("update_strategy_state", strategyId, func(current *models.MongoStrategy, base *models.MongoStrategy) bson.D {
+		return mergeDocument("state", models.MergeOrderIds(withEndedAt(state, current.State), base.State, current.State), base.State, current.State)
+	})
 	if err != nil {
 		log.Error("error in arg",
 			zap.Error(err),
-			zap.String("filter", fmt.Sprint(request)),
-			zap.String("update", fmt.Sprint(update)),
+			zap.String("id", strategyId.Hex()),
 		)
 		return
 	}
@@ -567,17 +544,12 @@ func (sm *StateMgmt) UpdateStrategyState(strategyId *primitive.ObjectID, state *
 
 func (sm *StateMgmt) UpdateExecutedAmount(strategyId *primitive.ObjectID, state *models.MongoStrategyState) {
 	t1 := time.Now()
-	col := GetCollection("core_strategies")
-	var request bson.D
-	request = bson.D{
-		{"_id", strategyId},
-	}
 	updates := bson.D{
 		{
-			"state.executedAmount", state.ExecutedAmount,
+			Key: "state.executedAmount", Value: state.ExecutedAmount,
 		},
 		{
-			"state.exitPrice", state.ExitPrice,
+			Key: "state.exitPrice", Value: state.ExitPrice,
 		},
 	}
 	if state.ExecutedAmount == 0 {
@@ -586,13 +558,19 @@ func (sm *StateMgmt) UpdateExecutedAmount(strategyId *primitive.ObjectID, state
 		updates = append(updates, bson.E{Key: "state.amount", Value: 0})
 		updates = append(updates, bson.E{Key: "state.reachedTargetCount", Value: 0})
 	}
+	if sm.WriteBehind != nil {
+		// fills are written at once together with updates buffered
+		sm.WriteBehind.Write(strategyId, updates)
+		sm.Statsd.TimingDuration("state_mgmt.update_executed_amount", time.Since(t1))
+		return
+	}
 	var update bson.D
 	update = bson.D{
 		{
-			"$set", updates,
+			Key: "$set", Value: updates,
 		},
 	}
-	updated, err := col.UpdateOne(context.TODO(), request, update)
+	updated, err := sm.updateVersioned("update_executed_amount", strategyId, func(*models.MongoStrategy, *models.MongoStrategy) bson.D { return update })
 	if err != nil {
 		log.Error("error in arg", zap.Error(err))
 		return
@@ -607,59 +585,39 @@ func (sm *StateMgmt) UpdateExecutedAmount(strategyId *primitive.ObjectID, state
 // UpdateOrders tries to save new order IDs stored in a state provided into a strategy document specified by ID.
 func (sm *StateMgmt) UpdateOrders(strategyId *primitive.ObjectID, state *models.MongoStrategyState) {
 	t1 := time.Now()
-	// log.Debug("update orders",
-	// 	zap.String("strategy", strategyId.Hex()),
-	// 	zap.String("orders", fmt.Sprintf("%v", state.Orders)),
-	// )
 	if (state.Orders == nil && state.ExecutedOrders == nil) || ((len(state.Orders) + len(state.ExecutedOrders)) == 0) {
 		return
 	}
-	col := GetCollection("core_strategies")
-	var request bson.D
-	request = bson.D{
-		{"_id", strategyId},
-	}
-	var update bson.D
-	update = bson.D{{"$addToSet", bson.D{}}}
-	if state.Orders != nil && len(state.Orders) > 0 {
-		var ordersUpdate bson.E
-		ordersUpdate = bson.E{
-			Key: "state.orders",
-			Value: bson.D{{"$each", state.Orders}},
+	if sm.WriteBehind != nil {
+		// orders placed are written at once together with updates buffered
+		if len(state.Orders) > 0 {
+			sm.WriteBehind.AddToSet(strategyId, "state.orders", state.Orders)
 		}
-		update[0].Value = append(update[0].Value.(bson.D), ordersUpdate)
-	}
-	if state.ExecutedOrders != nil && len(state.ExecutedOrders) > 0 {
-		var executedOrdersUpdate bson.E
-		executedOrdersUpdate = bson.E{
-			Key: "state.executedOrders",
-			Value: bson.D{{"$each", state.ExecutedOrders}},
+		if len(state.ExecutedOrders) > 0 {
+			sm.WriteBehind.AddToSet(strategyId, "state.executedOrders", state.ExecutedOrders)
 		}
-		update[0].Value = append(update[0].Value.(bson.D), executedOrdersUpdate)
+		sm.WriteBehind.Sync(strategyId, func() {})
+		sm.Statsd.TimingDuration("state_mgmt.update_orders", time.Since(t1))
+		return
 	}
-	// log.Debug("sending update order request",
-	// 	zap.Any("request", request),
-	// 	zap.Any("update", update),
-	// )
-	updated, err := col.UpdateOne(context.TODO(), request, update)
-	if err != nil {
-		// If state.orders or state.executedOrders is null, set it to empty list and retry.
-		log.Warn("can't update order, trying to replace null fields with empty arrays", zap.Error(err))
-		col.UpdateOne(context.TODO(),
-			// bson.M{"_id": strategyId, "state.orders": nil},
-			bson.M{"_id": strategyId},
-			bson.M{"$set": bson.M{"state.orders": bson.A{}}},
-		)
-		col.UpdateOne(context.TODO(),
-			bson.M{"_id": strategyId, "state.executedOrders": nil},
-			bson.M{"$set": bson.M{"state.executedOrders": bson.A{}}},
-		)
-		updated, err = col.UpdateOne(context.TODO(), request, update)
-		// If it does not help, report on error.
-		if err != nil {
-			log.Error("update order", zap.Error(err))
-			return
+	// order ids are merged with ones stored, null fields are replaced this way too
+	updated, err := sm.updateVersioned("update_orders", strategyId, func(current *models.MongoStrategy, _ *models.MongoStrategy) bson.D {
+		stored := current.State
+		if stored == nil {
+			stored = &models.MongoStrategyState{}
+		}
+		updates := bson.D{}
+		if len(state.Orders) > 0 {
+			updates = append(updates, bson.E{Key: "state.orders", Value: models.UnionIds(stored.Orders, state.Orders)})
+		}
+		if len(state.ExecutedOrders) > 0 {
+			updates = append(updates, bson.E{Key: "state.executedOrders", Value: models.UnionIds(stored.ExecutedOrders, state.ExecutedOrders)})
 		}
+		return bson.D{{Key: "$set", Value: updates}}
+	})
+	if err != nil {
+		log.Error("update order", zap.Error(err))
+		return
 	}
 	log.Info("updated order state",
 		zap.Int64("count", updated.ModifiedCount),
@@ -669,28 +627,30 @@ func (sm *StateMgmt) UpdateOrders(strategyId *primitive.ObjectID, state *models.
 }
 func (sm *StateMgmt) UpdateEntryPrice(strategyId *primitive.ObjectID, state *models.MongoStrategyState) {
 	t1 := time.Now()
-	col := GetCollection("core_strategies")
-	var request bson.D
-	request = bson.D{
-		{"_id", strategyId},
+	updates := bson.D{
+		{
+			Key: "state.entryPrice", Value: state.EntryPrice,
+		},
+		{
+			Key: "state.state", Value: state.State,
+		},
+		{
+			Key: "state.positionAmount", Value: state.PositionAmount,
+		},
+	}
+	if sm.WriteBehind != nil {
+		// entries are written at once together with updates buffered
+		sm.WriteBehind.Write(strategyId, updates)
+		sm.Statsd.TimingDuration("state_mgmt.update_entry_price", time.Since(t1))
+		return
 	}
 	var update bson.D
 	update = bson.D{
 		{
-			"$set", bson.D{
-				{
-					"state.entryPrice", state.EntryPrice,
-				},
-				{
-					"state.state", state.State,
-				},
-				{
-					"state.positionAmount", state.PositionAmount,
-				},
-			},
+			Key: "$set", Value: updates,
 		},
 	}
-	updated, err := col.UpdateOne(context.TODO(), request, update)
+	updated, err := sm.updateVersioned("update_entry_price", strategyId, func(*models.MongoStrategy, *models.MongoStrategy) bson.D { return update })
 	if err != nil {
 		log.Error("error in arg", zap.Error(err))
 		return
@@ -722,25 +682,20 @@ func (sm *StateMgmt) SwitchToHedgeMode(keyId *primitive.ObjectID, trading interf
 
 func (sm *StateMgmt) UpdateHedgeExitPrice(strategyId *primitive.ObjectID, state *models.MongoStrategyState) {
 	t1 := time.Now()
-	col := GetCollection("core_strategies")
-	var request bson.D
-	request = bson.D{
-		{"_id", strategyId},
-	}
 	var update bson.D
 	update = bson.D{
 		{
-			"$set", bson.D{
+			Key: "$set", Value: bson.D{
 				{
-					"state.hedgeExitPrice", state.HedgeExitPrice,
+					Key: "state.hedgeExitPrice", Value: state.HedgeExitPrice,
 				},
 				{
-					"state.state", state.State,
+					Key: "state.state", Value: state.State,
 				},
 			},
 		},
 	}
-	updated, err := col.UpdateOne(context.TODO(), request, update)
+	updated, err := sm.updateVersioned("update_hedge_exit_price", strategyId, func(*models.MongoStrategy, *models.MongoStrategy) bson.D { return update })
 	if err != nil {
 		log.Error("error in arg", zap.Error(err))
 		return
@@ -770,7 +725,7 @@ func (sm *StateMgmt) SavePNL(templateStrategyId *primitive.ObjectID, profitAmoun
 			},
 		},
 	}
-	_, err := col.UpdateOne(context.TODO(), request, update)
+	_, err := col.UpdateOne(context.TODO(), request, withVersionInc(update))
 	if err != nil {
 		log.Error("error in arg", zap.Error(err))
 		return
@@ -799,7 +754,7 @@ func (sm *StateMgmt) EnableHedgeLossStrategy(strategyId *primitive.ObjectID) {
 			},
 		},
 	}
-	_, err := col.UpdateOne(context.TODO(), request, update)
+	_, err := col.UpdateOne(context.TODO(), request, withVersionInc(update))
 	if err != nil {
 		log.Error("error in arg", zap.Error(err))
 		return
@@ -829,25 +784,12 @@ func (sm *StateMgmt) SaveStrategyConditions(strategy *models.MongoStrategy) {
 // UpdateStateAndConditions updates state and conditions in a persistent storage.
 func (sm *StateMgmt) UpdateStateAndConditions(strategyId *primitive.ObjectID, model *models.MongoStrategy) {
 	t1 := time.Now()
-	col := GetCollection("core_strategies")
-	var request bson.D
-	request = bson.D{
-		{"_id", strategyId},
-	}
-	var update bson.D
-	update = bson.D{
-		{
-			"$set", bson.D{
-				{
-					"conditions", model.Conditions,
-				},
-				{
-					"state", model.State,
-				},
-			},
-		},
-	}
-	_, err := col.UpdateOne(context.TODO(), request, update)
+	_, err := sm.updateVersioned("update_state_and_conditions", strategyId, func(current *models.MongoStrategy, base *models.MongoStrategy) bson.D {
+		return combineUpdates(
+			mergeDocument("conditions", model.Conditions, base.Conditions, current.Conditions),
+			mergeDocument("state", models.MergeOrderIds(withEndedAt(model.State, current.State), base.State, current.State), base.State, current.State),
+		)
+	})
 	if err != nil {
 		log.Error("error in arg", zap.Error(err))
 		return
@@ -0,0 +1,76 @@
+package mongodb
+
+import (
+	"context"
+	"time"
+
+	"gitlab.com/crypto_project/core/strategy_service/src/sources/mongodb/models"
+	"gitlab.com/crypto_project/core/strategy_service/src/sources/mongodb/schema"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+)
+
+// GetEnabledCopyTradings reads all the enabled copy trading configurations from persistent storage.
+func (sm *StateMgmt) GetEnabledCopyTradings() []models.MongoCopyTrading {
+	t1 := time.Now()
+	ctx := context.Background()
+	coll := GetCollection("core_copy_trading")
+	cur, err := coll.Find(ctx, bson.M{"enabled": true})
+	if err != nil {
+		log.Error("can't read copy tradings", zap.Error(err))
+		return nil
+	}
+	defer cur.Close(ctx)
+	var copyTradings []models.MongoCopyTrading
+	for cur.Next(ctx) {
+		var copyTrading models.MongoCopyTrading
+		if err := cur.Decode(&copyTrading); err != nil {
+			log.Error("copy trading decode error", zap.Error(err))
+			continue
+		}
+		copyTradings = append(copyTradings, copyTrading)
+	}
+	sm.Statsd.TimingDuration("state_mgmt.get_enabled_copy_tradings", time.Since(t1))
+	return copyTradings
+}
+
+// GetFollowerStrategies reads strategies copied from the leader strategy given.
+func (sm *StateMgmt) GetFollowerStrategies(leaderStrategyId *primitive.ObjectID) []models.MongoStrategy {
+	t1 := time.Now()
+	ctx := context.Background()
+	coll := GetCollection("core_strategies")
+	cur, err := coll.Find(ctx, bson.M{"conditions.leaderStrategyId": leaderStrategyId})
+	if err != nil {
+		log.Error("can't read follower strategies", zap.Error(err))
+		return nil
+	}
+	defer cur.Close(ctx)
+	var followers []models.MongoStrategy
+	for cur.Next(ctx) {
+		var follower models.MongoStrategy
+		if err := schema.DecodeStrategy(cur.Current, &follower); err != nil {
+			log.Error("follower strategy decode error", zap.Error(err))
+			continue
+		}
+		followers = append(followers, follower)
+	}
+	sm.Statsd.TimingDuration("state_mgmt.get_follower_strategies", time.Since(t1))
+	return followers
+}
+
+// SaveCopyDivergence upserts divergence of the follower strategy from its leader.
+func (sm *StateMgmt) SaveCopyDivergence(divergence models.MongoCopyDivergence) {
+	t1 := time.Now()
+	coll := GetCollection("core_copy_trading_divergence")
+	_, err := coll.ReplaceOne(context.TODO(),
+		bson.M{"_id": divergence.FollowerStrategyId},
+		divergence,
+		options.Replace().SetUpsert(true),
+	)
+	if err != nil {
+		log.Error("save copy divergence", zap.Error(err))
+	}
+	sm.Statsd.TimingDuration("state_mgmt.save_copy_divergence", time.Since(t1))
+}
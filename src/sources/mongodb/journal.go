@@ -0,0 +1,81 @@
+package mongodb
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"gitlab.com/crypto_project/core/strategy_service/src/sources/mongodb/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+)
+
+var journalIndexOnce sync.Once
+
+// journalCollection returns strategy journal collection making sure sequence numbers are unique per strategy.
+func journalCollection() *mongo.Collection {
+	coll := GetCollection("core_strategy_journal")
+	journalIndexOnce.Do(func() {
+		_, err := coll.Indexes().CreateOne(context.Background(), mongo.IndexModel{
+			Keys:    bson.D{{Key: "strategyId", Value: 1}, {Key: "seq", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		})
+		if err != nil {
+			log.Error("can't create journal index", zap.Error(err))
+		}
+	})
+	return coll
+}
+
+// AppendJournalEntry inserts the entry, failing on sequence number taken.
+func (sm *StateMgmt) AppendJournalEntry(entry *models.MongoJournalEntry) error {
+	t1 := time.Now()
+	_, err := journalCollection().InsertOne(context.TODO(), entry)
+	sm.Statsd.TimingDuration("state_mgmt.append_journal_entry", time.Since(t1))
+	return err
+}
+
+// GetJournal reads strategy journal entries after the sequence number given in order.
+func (sm *StateMgmt) GetJournal(strategyId *primitive.ObjectID, afterSeq int64) []models.MongoJournalEntry {
+	t1 := time.Now()
+	ctx := context.Background()
+	cur, err := journalCollection().Find(ctx,
+		bson.M{"strategyId": strategyId, "seq": bson.M{"$gt": afterSeq}},
+		options.Find().SetSort(bson.D{{Key: "seq", Value: 1}}),
+	)
+	if err != nil {
+		log.Error("can't read journal", zap.Error(err))
+		return nil
+	}
+	defer cur.Close(ctx)
+	var entries []models.MongoJournalEntry
+	for cur.Next(ctx) {
+		var entry models.MongoJournalEntry
+		if err := cur.Decode(&entry); err != nil {
+			log.Error("journal entry decode error", zap.Error(err))
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	sm.Statsd.TimingDuration("state_mgmt.get_journal", time.Since(t1))
+	return entries
+}
+
+// GetLastJournalSeq returns the last sequence number of strategy journal, 0 if empty.
+func (sm *StateMgmt) GetLastJournalSeq(strategyId *primitive.ObjectID) int64 {
+	var entry models.MongoJournalEntry
+	err := journalCollection().FindOne(context.TODO(),
+		bson.M{"strategyId": strategyId},
+		options.FindOne().SetSort(bson.D{{Key: "seq", Value: -1}}).SetProjection(bson.M{"seq": 1}),
+	).Decode(&entry)
+	if err != nil {
+		if err != mongo.ErrNoDocuments {
+			log.Error("can't read last journal entry", zap.Error(err))
+		}
+		return 0
+	}
+	return entry.Seq
+}
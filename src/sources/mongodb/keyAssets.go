@@ -0,0 +1,44 @@
+package mongodb
+
+import (
+	"context"
+	"time"
+
+	"gitlab.com/crypto_project/core/strategy_service/src/sources/mongodb/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.uber.org/zap"
+)
+
+// GetKeyBalances reads free balances of the key by asset symbol.
+func (sm *StateMgmt) GetKeyBalances(keyId *primitive.ObjectID) map[string]float64 {
+	t1 := time.Now()
+	ctx := context.Background()
+	coll := GetCollection("core_key_assets")
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"keyId": keyId}}},
+		{{Key: "$lookup", Value: bson.M{"from": "core_assets", "localField": "assetId", "foreignField": "_id", "as": "asset"}}},
+		{{Key: "$unwind", Value: "$asset"}},
+	}
+	cur, err := coll.Aggregate(ctx, pipeline)
+	if err != nil {
+		log.Error("can't read key balances", zap.Error(err))
+		return nil
+	}
+	defer cur.Close(ctx)
+	balances := map[string]float64{}
+	for cur.Next(ctx) {
+		var keyAsset struct {
+			Free  float64           `bson:"free"`
+			Asset models.MongoAsset `bson:"asset"`
+		}
+		if err := cur.Decode(&keyAsset); err != nil {
+			log.Error("key asset decode error", zap.Error(err))
+			continue
+		}
+		balances[keyAsset.Asset.Symbol] += keyAsset.Free
+	}
+	sm.Statsd.TimingDuration("state_mgmt.get_key_balances", time.Since(t1))
+	return balances
+}
@@ -0,0 +1,15 @@
+package models
+
+// ArchiveCounts are numbers of documents moved to or from archive collections.
+type ArchiveCounts struct {
+	Strategies     int64 `json:"strategies"`
+	Orders         int64 `json:"orders"`
+	JournalEntries int64 `json:"journalEntries"`
+}
+
+// Add sums counts given to these ones.
+func (c *ArchiveCounts) Add(other ArchiveCounts) {
+	c.Strategies += other.Strategies
+	c.Orders += other.Orders
+	c.JournalEntries += other.JournalEntries
+}
@@ -0,0 +1,45 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// A MongoCopyTrading mirrors smart trades created for a leader account onto follower keys.
+type MongoCopyTrading struct {
+	ID              primitive.ObjectID `json:"_id" bson:"_id"`
+	Enabled         bool               `json:"enabled,omitempty" bson:"enabled"`
+	LeaderAccountId primitive.ObjectID `json:"leaderAccountId" bson:"leaderAccountId"`
+	LeaderEquity    float64            `json:"leaderEquity,omitempty" bson:"leaderEquity"` // in quote currency, if balance unknown
+	Followers       []*MongoFollower   `json:"followers,omitempty" bson:"followers"`
+}
+
+// A MongoFollower is a key smart trades of the leader are copied to, amounts are scaled by the ratio of follower
+// equity to leader equity if ScaleByEquity set and both equities known, by the fixed multiplier otherwise. Equities are
+// free balances of the keys in the quote asset of the pair copied, the ones configured are taken if balances unknown.
+type MongoFollower struct {
+	KeyId         primitive.ObjectID `json:"keyId" bson:"keyId"`
+	OwnerId       primitive.ObjectID `json:"ownerId" bson:"ownerId"` // user the key belongs to, owns the copies
+	Enabled       bool               `json:"enabled,omitempty" bson:"enabled"`
+	Multiplier    float64            `json:"multiplier,omitempty" bson:"multiplier"` // 1 if not set
+	ScaleByEquity bool               `json:"scaleByEquity,omitempty" bson:"scaleByEquity"`
+	Equity        float64            `json:"equity,omitempty" bson:"equity"` // in quote currency, if balance unknown
+}
+
+// A MongoCopyDivergence tracks how a follower's copy of a smart trade diverges from the leader's one.
+// Percentages are scale independent, positive entry slippage means the follower entered at a worse price.
+type MongoCopyDivergence struct {
+	FollowerStrategyId *primitive.ObjectID `json:"_id" bson:"_id"`
+	LeaderStrategyId   *primitive.ObjectID `json:"leaderStrategyId" bson:"leaderStrategyId"`
+	KeyId              *primitive.ObjectID `json:"keyId" bson:"keyId"`
+	Scale              float64             `json:"scale" bson:"scale"`
+	LeaderState        string              `json:"leaderState,omitempty" bson:"leaderState"`
+	FollowerState      string              `json:"followerState,omitempty" bson:"followerState"`
+	EntrySlippage      float64             `json:"entrySlippage" bson:"entrySlippage"`       // percentage of leader entry price
+	ExitedDivergence   float64             `json:"exitedDivergence" bson:"exitedDivergence"` // exited percentage of position, follower less leader
+	LeaderProfit       float64             `json:"leaderProfit" bson:"leaderProfit"`         // received profit amount
+	FollowerProfit     float64             `json:"followerProfit" bson:"followerProfit"`     // received profit amount
+	ProfitDivergence   float64             `json:"profitDivergence" bson:"profitDivergence"` // received profit percentage, follower less leader
+	UpdatedAt          time.Time           `json:"updatedAt,omitempty" bson:"updatedAt"`
+}
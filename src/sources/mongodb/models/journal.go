@@ -0,0 +1,36 @@
+package models
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Types of strategy journal entries.
+const (
+	JournalTransition = "transition" // state machine transition with the state it led to
+	JournalOrder      = "order"      // order placed
+	JournalFill       = "fill"       // order filled or canceled
+	JournalConditions = "conditions" // conditions edited
+)
+
+// A MongoJournalEntry is an event of a strategy timeline. Entries are appended with sequence numbers growing by one
+// per strategy and never changed.
+type MongoJournalEntry struct {
+	ID          primitive.ObjectID      `json:"_id" bson:"_id"`
+	StrategyId  primitive.ObjectID      `json:"strategyId" bson:"strategyId"`
+	Seq         int64                   `json:"seq" bson:"seq"`
+	Type        string                  `json:"type" bson:"type"`
+	At          int64                   `json:"at" bson:"at"` // unix milliseconds
+	Source      string                  `json:"source,omitempty" bson:"source,omitempty"`
+	Destination string                  `json:"destination,omitempty" bson:"destination,omitempty"`
+	Trigger     string                  `json:"trigger,omitempty" bson:"trigger,omitempty"`
+	Price       float64                 `json:"price,omitempty" bson:"price,omitempty"` // market price at the event
+	OrderId     string                  `json:"orderId,omitempty" bson:"orderId,omitempty"`
+	Step        string                  `json:"step,omitempty" bson:"step,omitempty"` // what the order placed for
+	Side        string                  `json:"side,omitempty" bson:"side,omitempty"`
+	OrderType   string                  `json:"orderType,omitempty" bson:"orderType,omitempty"`
+	Status      string                  `json:"status,omitempty" bson:"status,omitempty"`
+	Amount      float64                 `json:"amount,omitempty" bson:"amount,omitempty"`
+	Average     float64                 `json:"average,omitempty" bson:"average,omitempty"`
+	State       *MongoStrategyState     `json:"state,omitempty" bson:"state,omitempty"`
+	Conditions  *MongoStrategyCondition `json:"conditions,omitempty" bson:"conditions,omitempty"`
+}
@@ -0,0 +1,35 @@
+package models
+
+import (
+	"sync"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// KnownStrategies keeps strategies as the instance read or wrote them last, the base to merge updates of strategies
+// saved as a whole with changes made by other writers since. Strategies kept must not be changed.
+type KnownStrategies struct {
+	strategies sync.Map
+}
+
+// Get returns the strategy known, nil if it's not.
+func (k *KnownStrategies) Get(strategyId *primitive.ObjectID) *MongoStrategy {
+	strategy, ok := k.strategies.Load(*strategyId)
+	if !ok {
+		return nil
+	}
+	return strategy.(*MongoStrategy)
+}
+
+// Set keeps the strategy given as known.
+func (k *KnownStrategies) Set(strategy *MongoStrategy) {
+	if strategy == nil || strategy.ID == nil {
+		return
+	}
+	k.strategies.Store(*strategy.ID, strategy)
+}
+
+// Forget drops the strategy, e.g. once it's not run by the instance anymore.
+func (k *KnownStrategies) Forget(strategyId *primitive.ObjectID) {
+	k.strategies.Delete(*strategyId)
+}
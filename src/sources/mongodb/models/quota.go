@@ -0,0 +1,19 @@
+package models
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Fields of strategies quotas are counted by, OwnerId is stored by its lowercased name as it has no tag.
+const (
+	QuotaOwner   = "ownerid"
+	QuotaAccount = "accountId"
+)
+
+// A MongoQuota limits strategies of an owner or an account (exchange key), zero limits are unlimited.
+type MongoQuota struct {
+	ID                  primitive.ObjectID `json:"_id" bson:"_id"`                                           // owner or account id
+	MaxActiveStrategies int64              `json:"maxActiveStrategies,omitempty" bson:"maxActiveStrategies"` // enabled strategies
+	MaxNotional         float64            `json:"maxNotional,omitempty" bson:"maxNotional"`                 // entry amounts of enabled strategies in quote currency
+	MaxOrdersPerMinute  int64              `json:"maxOrdersPerMinute,omitempty" bson:"maxOrdersPerMinute"`   // orders created by requests
+}
@@ -7,16 +7,26 @@ type MongoSignalEvent struct {
 	Data interface{}
 }
 
+// A MongoSignal describes a market condition watched by the signal engine to enable or create linked smart orders.
 type MongoSignal struct {
-	Id          primitive.ObjectID `json:"_id"`
+	Id          primitive.ObjectID `json:"_id" bson:"_id"`
+	Enabled     bool
 	MonType     MongoSignalType
 	Condition   MongoSignalCondition
 	TriggerWhen TriggerOptions
 	Expiration  ExpirationSchema
-	OpenEnded   bool
+	OpenEnded   bool // re-arm the signal after trigger instead of disabling it
+	LastTrigger int64
 	Events      []MongoSignalEvent
 }
 
+// Signal types supported by the signal engine.
+const (
+	SignalTypePrice         = "price"         // target price cross
+	SignalTypePercentChange = "percentChange" // percent change over a period
+	SignalTypeSpread        = "spread"        // spread threshold
+)
+
 type MongoSignalType struct {
 	SigType  string `json:"type"`
 	Required interface{}
@@ -27,20 +37,33 @@ type MongoSignalCondition struct {
 	Symbol        string
 	PortfolioId   primitive.ObjectID
 	PercentChange float64
+	Window        int64 // seconds percent change is measured over, trigger period if not set
 	Price         float64
 	Amount        float64
 	Spread        float64
 	ExchangeId    primitive.ObjectID
 	ExchangeIds   []primitive.ObjectID
 	Pair          string
+	Exchange      string
+	MarketType    int64
+	// Side and KeyId are used to create a new order on trigger, linked strategies are enabled regardless.
+	Side  string
+	KeyId *primitive.ObjectID
 }
 
+// A TriggerOptions describes how often a trigger may fire, Period is in seconds.
 type TriggerOptions struct {
 	TrigType string `json:"type"`
 	Period   int64
 }
 
+// An ExpirationSchema describes when a signal or a strategy stops being actual, timestamp is in unix seconds.
 type ExpirationSchema struct {
-	expirationTimestamp int64
-	openEnded           bool
+	ExpirationTimestamp int64 `json:"expirationTimestamp,omitempty" bson:"expirationTimestamp"`
+	OpenEnded           bool  `json:"openEnded,omitempty" bson:"openEnded"`
+}
+
+// IsExpired returns true if expiration timestamp set, not open ended and passed by the time given.
+func (es ExpirationSchema) IsExpired(now int64) bool {
+	return !es.OpenEnded && es.ExpirationTimestamp > 0 && now >= es.ExpirationTimestamp
 }
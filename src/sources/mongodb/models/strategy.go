@@ -7,7 +7,30 @@ import (
 )
 
 type MongoStrategyUpdateEvent struct {
-	FullDocument MongoStrategy `json:"fullDocument" bson:"fullDocument"`
+	OperationType     string                 `json:"operationType" bson:"operationType"`
+	FullDocument      MongoStrategy          `json:"fullDocument" bson:"fullDocument"`
+	UpdateDescription MongoUpdateDescription `json:"updateDescription" bson:"updateDescription"`
+}
+
+// A MongoUpdateDescription lists fields changed by an update event.
+type MongoUpdateDescription struct {
+	UpdatedFields map[string]interface{} `json:"updatedFields" bson:"updatedFields"`
+}
+
+// Enables returns true if the event enables the strategy: inserts it enabled or updates it to enabled. Replaced
+// documents don't tell what changed, so they don't enable.
+func (event *MongoStrategyUpdateEvent) Enables() bool {
+	if !event.FullDocument.Enabled {
+		return false
+	}
+	switch event.OperationType {
+	case "insert":
+		return true
+	case "update":
+		_, updated := event.UpdateDescription.UpdatedFields["enabled"]
+		return updated
+	}
+	return false
 }
 
 type MongoOrderUpdateEvent struct {
@@ -112,20 +135,23 @@ type MongoPosition struct {
 // A MongoStrategy is the root of a smart trade strategy description.
 type MongoStrategy struct {
 	ID              *primitive.ObjectID     `json:"_id" bson:"_id"`             // strategy unique identity
-	Type            int64                   `json:"type,omitempty" bson:"type"` // 1 - smart order, 2 - maker only
+	Type            int64                   `json:"type,omitempty" bson:"type"` // 1 - smart order, 2 - maker only, 3 - pairs, 4 - funding, 5 - arbitrage, 6 - rebalance
 	Enabled         bool                    `json:"enabled,omitempty" bson:"enabled"`
 	AccountId       *primitive.ObjectID     `json:"accountId,omitempty" bson:"accountId"`
 	Conditions      *MongoStrategyCondition `json:"conditions,omitempty" bson:"conditions"`
 	State           *MongoStrategyState     `bson:"state,omitempty"`
 	TriggerWhen     TriggerOptions          `bson:"triggerWhen,omitempty"`
-	Expiration      ExpirationSchema
+	Expiration      ExpirationSchema        `json:"expiration,omitempty" bson:"expiration"` // smart order cancels entry or exits once expired
 	LastUpdate      int64
 	SignalIds       []primitive.ObjectID
 	OrderIds        []primitive.ObjectID `bson:"orderIds,omitempty"`
 	WaitForOrderIds []primitive.ObjectID `bson:"waitForOrderIds,omitempty"`
 	OwnerId         primitive.ObjectID
-	Social          MongoSocial `bson:"social"` // {sharedWith: [RBAC]}
-	CreatedAt       time.Time   `json:"createdAt,omitempty" bson:"createdAt"`
+	Social          MongoSocial         `bson:"social"` // {sharedWith: [RBAC]}
+	CreatedAt       time.Time           `json:"createdAt,omitempty" bson:"createdAt"`
+	Version         int64               `json:"version,omitempty" bson:"version"`             // incremented by each update to detect concurrent ones
+	SchemaVersion   int64               `json:"schemaVersion,omitempty" bson:"schemaVersion"` // documents of older versions are upgraded on load
+	EditedBy        *primitive.ObjectID `json:"editedBy,omitempty" bson:"editedBy,omitempty"` // user who changed conditions last, only the owner may
 }
 
 type MongoStrategyType struct {
@@ -150,15 +176,15 @@ type MongoStrategyState struct {
 	// Orders created by strategy to entry.
 	WaitForEntryIds []string `json:"waitForEntryIds,omitempty" bson:"waitForEntryIds"`
 	StopLoss        float64  `json:"stopLoss,omitempty" bson:"stopLoss"`
-	StopLossPrice   float64  `json:"stopLossPrice, omitempty" bson:"stopLossPrice"`
+	StopLossPrice   float64  `json:"stopLossPrice,omitempty" bson:"stopLossPrice"`
 	// Orders created by strategy for regular stop-loss.
 	StopLossOrderIds []string `json:"stopLossOrderIds,omitempty" bson:"stopLossOrderIds"`
 	ForcedLoss       float64  `json:"forcedLoss,omitempty" bson:"forcedLoss"`
-	ForcedLossPrice  float64  `json:"forcedLossPrice, omitempty" bson:"forcedLossPrice"`
+	ForcedLossPrice  float64  `json:"forcedLossPrice,omitempty" bson:"forcedLossPrice"`
 	// Orders created by strategy for forced stop-loss.
 	ForcedLossOrderIds   []string           `json:"forcedLossOrderIds,omitempty" bson:"forcedLossOrderIds"`
 	TakeProfit           []*MongoEntryPoint `json:"takeProfit,omitempty" bson:"takeProfit"`
-	TakeProfitPrice      float64            `json:"takeProfitPrice, omitempty" bson:"takeProfitPrice"`
+	TakeProfitPrice      float64            `json:"takeProfitPrice,omitempty" bson:"takeProfitPrice"`
 	TakeProfitHedgePrice float64            `json:"takeProfitHedgePrice,omitempty" bson:"takeProfitHedgePrice"`
 	// Orders created by strategy for take a profit.
 	TakeProfitOrderIds []string `json:"takeProfitOrderIds,omitempty" bson:"takeProfitOrderIds"`
@@ -171,6 +197,8 @@ type MongoStrategyState struct {
 
 	TrailingExitPrice  float64   `json:"trailingExitPrice,omitempty" bson:"trailingExitPrice"`
 	TrailingExitPrices []float64 `json:"trailingExitPrices,omitempty" bson:"trailingExitPrices"`
+	// Stop prices of trailing exit levels with trailing mode, moved towards price only.
+	TrailingExitStops  []float64 `json:"trailingExitStops,omitempty" bson:"trailingExitStops"`
 	EntryPrice         float64   `json:"entryPrice,omitempty" bson:"entryPrice"`
 	SavedEntryPrice    float64   `json:"savedEntryPrice,omitempty" bson:"savedEntryPrice"`
 	ExitPrice          float64   `json:"exitPrice,omitempty" bson:"exitPrice"`
@@ -190,6 +218,101 @@ type MongoStrategyState struct {
 	PositionAmount           float64 `json:"positionAmount,omitempty" bson:"positionAmount"`
 	ReceivedProfitAmount     float64 `json:"receivedProfitAmount,omitempty" bson:"receivedProfitAmount"`
 	ReceivedProfitPercentage float64 `json:"receivedProfitPercentage,omitempty" bson:"receivedProfitPercentage"`
+
+	// Legs of a multi-leg strategy, e.g. pairs trade.
+	Legs []*MongoLeg `json:"legs,omitempty" bson:"legs"`
+	// Rolling window of price ratio samples for pairs trade.
+	RatioWindow []float64 `json:"ratioWindow,omitempty" bson:"ratioWindow"`
+	// Funding fees received by funding arbitrage, the rate expected at the next funding time in unix milliseconds.
+	FundingPNL            float64 `json:"fundingPnl,omitempty" bson:"fundingPnl"`
+	FundingRate           float64 `json:"fundingRate,omitempty" bson:"fundingRate"`
+	NextFundingTime       int64   `json:"nextFundingTime,omitempty" bson:"nextFundingTime"`
+	CollateralTransferred float64 `json:"collateralTransferred,omitempty" bson:"collateralTransferred"`
+	// Volatility measured at entry in price units, stop-loss price trailed by volatility and the candle trailed at.
+	Volatility          float64 `json:"volatility,omitempty" bson:"volatility"`
+	VolatilityStopPrice float64 `json:"volatilityStopPrice,omitempty" bson:"volatilityStopPrice"`
+	VolatilityTrailedAt int64   `json:"volatilityTrailedAt,omitempty" bson:"volatilityTrailedAt"`
+	// Stop ladder steps reached and take-profit targets filled the steps may wait for.
+	StopLadderStep    int64 `json:"stopLadderStep,omitempty" bson:"stopLadderStep"`
+	ExitTargetsFilled int64 `json:"exitTargetsFilled,omitempty" bson:"exitTargetsFilled"`
+	// Unix seconds the position was entered at, exits by time done since and the amount they closed.
+	EnteredAt        int64   `json:"enteredAt,omitempty" bson:"enteredAt"`
+	TimeExitsDone    int64   `json:"timeExitsDone,omitempty" bson:"timeExitsDone"`
+	TimeExitedAmount float64 `json:"timeExitedAmount,omitempty" bson:"timeExitedAmount"`
+	// Base asset inventory changed by arbitrage trades by exchange.
+	Inventories map[string]float64 `json:"inventories,omitempty" bson:"inventories"`
+	// Unix seconds portfolio was rebalanced at, weight drift measured last time and the next twap slice is due at.
+	RebalancedAt     int64   `json:"rebalancedAt,omitempty" bson:"rebalancedAt"`
+	RebalanceDrift   float64 `json:"rebalanceDrift,omitempty" bson:"rebalanceDrift"`
+	RebalanceSliceAt int64   `json:"rebalanceSliceAt,omitempty" bson:"rebalanceSliceAt"`
+	// Unix seconds the strategy ended, was canceled, timed out or errored at, zero while it runs.
+	EndedAt int64 `json:"endedAt,omitempty" bson:"endedAt"`
+}
+
+// MergeOrderIds returns a copy of the state with order ids the current state got since the base one added, to not lose
+// orders placed by a concurrent writer when the state is saved as a whole. Ids removed from the base state by the
+// writer stay removed. Without the base the state is returned as is, as no id is known to be added concurrently.
+// Executed orders are not merged as they are reset on exit.
+func MergeOrderIds(state *MongoStrategyState, base *MongoStrategyState, current *MongoStrategyState) *MongoStrategyState {
+	if state == nil || base == nil || current == nil {
+		return state
+	}
+	merged := *state
+	merged.Orders = UnionIds(state.Orders, addedIds(base.Orders, current.Orders))
+	merged.WaitForEntryIds = UnionIds(state.WaitForEntryIds, addedIds(base.WaitForEntryIds, current.WaitForEntryIds))
+	merged.StopLossOrderIds = UnionIds(state.StopLossOrderIds, addedIds(base.StopLossOrderIds, current.StopLossOrderIds))
+	merged.ForcedLossOrderIds = UnionIds(state.ForcedLossOrderIds, addedIds(base.ForcedLossOrderIds, current.ForcedLossOrderIds))
+	merged.TakeProfitOrderIds = UnionIds(state.TakeProfitOrderIds, addedIds(base.TakeProfitOrderIds, current.TakeProfitOrderIds))
+	return &merged
+}
+
+// addedIds returns ids of the current slice missing in the base one.
+func addedIds(base []string, current []string) []string {
+	known := make(map[string]bool, len(base))
+	for _, id := range base {
+		known[id] = true
+	}
+	var added []string
+	for _, id := range current {
+		if !known[id] {
+			added = append(added, id)
+		}
+	}
+	return added
+}
+
+// UnionIds returns ids of both slices in order, each one once.
+func UnionIds(ids []string, other []string) []string {
+	merged := make([]string, 0, len(ids)+len(other))
+	known := make(map[string]bool, len(ids)+len(other))
+	for _, list := range [][]string{ids, other} {
+		for _, id := range list {
+			if !known[id] {
+				known[id] = true
+				merged = append(merged, id)
+			}
+		}
+	}
+	return merged
+}
+
+// A MongoLeg is a single symbol position of a multi-leg strategy.
+type MongoLeg struct {
+	Pair       string              `json:"pair,omitempty" bson:"pair"`
+	Exchange   string              `json:"exchange,omitempty" bson:"exchange"`
+	KeyId      *primitive.ObjectID `json:"keyId,omitempty" bson:"keyId"` // strategy key used if empty
+	MarketType int64               `json:"marketType,omitempty" bson:"marketType"`
+	Side       string              `json:"side,omitempty" bson:"side"`
+	Amount     float64             `json:"amount,omitempty" bson:"amount"` // requested to enter
+	Filled     float64             `json:"filled,omitempty" bson:"filled"` // entered
+	Closed     float64             `json:"closed,omitempty" bson:"closed"` // exited
+	EntryPrice float64             `json:"entryPrice,omitempty" bson:"entryPrice"`
+	ExitPrice  float64             `json:"exitPrice,omitempty" bson:"exitPrice"`
+	OrderId    string              `json:"orderId,omitempty" bson:"orderId"` // order waited for
+	Orders     int64               `json:"orders,omitempty" bson:"orders"`   // orders placed, e.g. twap slices
+
+	UnwindOrderId string  `json:"unwindOrderId,omitempty" bson:"unwindOrderId"` // order unwinding excess filled
+	Unwinding     float64 `json:"unwinding,omitempty" bson:"unwinding"`         // excess the unwind order closes
 }
 
 type MongoEntryPoint struct {
@@ -203,9 +326,21 @@ type MongoEntryPoint struct {
 	HedgeActivation         float64 `json:"hedgeActivation,omitempty" bson:"hedgeActivation"`
 	HedgeOppositeActivation float64 `json:"hedgeOppositeActivation,omitempty" bson:"hedgeOppositeActivation"`
 	PlaceWithoutLoss        bool    `json:"placeWithoutLoss,omitempty" bson:"placeWithoutLoss"`
-	// Type: 0 means absolute price, 1 means price is relative to entry price
+	// Type: 0 means absolute price, 1 means price is relative to entry price, 2 means price is distance from entry
+	// price in volatility units
 	Type      int64  `json:"type,omitempty" bson:"type"`
 	OrderType string `json:"orderType,omitempty" bson:"orderType"`
+	// Distance in volatility units of type 2 level kept while the level is converted to type 1 at entry.
+	VolatilityUnits float64 `json:"volatilityUnits,omitempty" bson:"volatilityUnits"`
+	// TrailingMode of trailing exit level: empty trails by entry deviation from the edge price, "chandelier" by the
+	// highest high less multiplier ATRs, "sar" by parabolic SAR and "giveback" gives back multiplier percents of profit
+	// reached at the edge price.
+	TrailingMode       string  `json:"trailingMode,omitempty" bson:"trailingMode"`
+	TrailingMultiplier float64 `json:"trailingMultiplier,omitempty" bson:"trailingMultiplier"`
+	TrailingPeriod     int64   `json:"trailingPeriod,omitempty" bson:"trailingPeriod"`       // candles for chandelier
+	TrailingTimeframe  string  `json:"trailingTimeframe,omitempty" bson:"trailingTimeframe"` // candles for chandelier and SAR
+	TrailingStep       float64 `json:"trailingStep,omitempty" bson:"trailingStep"`           // SAR acceleration step
+	TrailingMaxStep    float64 `json:"trailingMaxStep,omitempty" bson:"trailingMaxStep"`     // SAR acceleration limit
 }
 
 // A MongoStrategyCondition is a set of static (persistent) parameters for a smart trade.
@@ -222,8 +357,8 @@ type MongoStrategyCondition struct {
 
 	TemplateToken          string              `json:"templateToken,omitempty" bson:"templateToken"`
 	MandatoryForcedLoss    bool                `json:"mandatoryForcedLoss,omitempty" bson:"mandatoryForcedLoss"`
-	PositionWasClosed      bool                `json:"positionWasClosed, omitempty" bson:"positionWasClosed"`
-	SkipInitialSetup       bool                `json:"skipInitialSetup, omitempty" bson:"skipInitialSetup"`
+	PositionWasClosed      bool                `json:"positionWasClosed,omitempty" bson:"positionWasClosed"`
+	SkipInitialSetup       bool                `json:"skipInitialSetup,omitempty" bson:"skipInitialSetup"`
 	CancelIfAnyActive      bool                `json:"cancelIfAnyActive,omitempty" bson:"cancelIfAnyActive"`
 	TrailingExitExternal   bool                `json:"trailingExitExternal,omitempty" bson:"trailingExitExternal"`
 	TrailingExitPrice      float64             `json:"trailingExitPrice,omitempty" bson:"trailingExitPrice"`
@@ -270,9 +405,146 @@ type MongoStrategyCondition struct {
 	CreatedByTemplate  bool                `json:"createdByTemplate,omitempty" bson:"createdByTemplate"`
 	TemplateStrategyId *primitive.ObjectID `json:"templateStrategyId,omitempty" bson:"templateStrategyId"`
 
+	LeaderStrategyId *primitive.ObjectID `json:"leaderStrategyId,omitempty" bson:"leaderStrategyId"` // copy trading leader smart trade
+	CopyScale        float64             `json:"copyScale,omitempty" bson:"copyScale"`               // leader amounts multiplier
+
 	Leverage                   float64            `json:"leverage,omitempty" bson:"leverage"`
 	EntryLevels                []*MongoEntryPoint `json:"entryLevels,omitempty" bson:"entryLevels"`
 	ExitLevels                 []*MongoEntryPoint `json:"exitLevels,omitempty" bson:"exitLevels"`
 	CloseStrategyAfterFirstTAP bool               `json:"closeStrategyAfterFirstTAP,omitempty" bson:"closeStrategyAfterFirstTAP"`
 	PlaceEntryAfterTAP         bool               `json:"placeEntryAfterTAP,omitempty" bson:"placeEntryAfterTAP"`
+
+	Pairs     *MongoPairsConditions     `json:"pairs,omitempty" bson:"pairs"`         // pairs trade, strategy type 3
+	Funding   *MongoFundingConditions   `json:"funding,omitempty" bson:"funding"`     // funding arbitrage, strategy type 4
+	Arbitrage *MongoArbitrageConditions `json:"arbitrage,omitempty" bson:"arbitrage"` // cross exchange arbitrage, strategy type 5
+	Rebalance *MongoRebalanceConditions `json:"rebalance,omitempty" bson:"rebalance"` // portfolio rebalancing, strategy type 6
+
+	Volatility      *MongoVolatilityConditions `json:"volatility,omitempty" bson:"volatility"`
+	StopLadder      []*MongoStopLadderStep     `json:"stopLadder,omitempty" bson:"stopLadder"`           // steps in order of profit
+	TimeExits       []*MongoTimeExit           `json:"timeExits,omitempty" bson:"timeExits"`             // exits in order of time
+	EntryIndicators []*MongoIndicatorCondition `json:"entryIndicators,omitempty" bson:"entryIndicators"` // all should be met to enter
+
+	// Expressions of conditions over price, spread, position and indicators, e.g. close > ema(50, 15m) && spread_pct < 0.1,
+	// see smart_order.ExpressionVariables for variables available.
+	EntryExpression      string `json:"entryExpression,omitempty" bson:"entryExpression"`           // should hold to enter
+	TakeProfitExpression string `json:"takeProfitExpression,omitempty" bson:"takeProfitExpression"` // closes the position once holds
+	StopLossExpression   string `json:"stopLossExpression,omitempty" bson:"stopLossExpression"`     // stops the loss once holds
+
+	Schedule *MongoScheduleConditions `json:"schedule,omitempty" bson:"schedule"`
+}
+
+// A MongoStopLadderStep moves stop-loss to lock a profit once the step is reached, e.g. {profit: 2, stop: 0} moves it
+// to break-even at 2% profit. Percentages are with leverage, as stop-loss is.
+type MongoStopLadderStep struct {
+	Profit      float64 `json:"profit,omitempty" bson:"profit"`           // profit percentage reaching the step
+	AfterTarget int64   `json:"afterTarget,omitempty" bson:"afterTarget"` // filled take-profit targets reaching the step
+	Stop        float64 `json:"stop" bson:"stop"`                         // profit percentage to lock, negative keeps a loss
+}
+
+// A MongoTimeExit closes a part of the position by time, e.g. {after: 3600, amount: 25} closes a quarter of the entry
+// amount an hour after entry. The last exit closes the rest of the position.
+type MongoTimeExit struct {
+	After        int64   `json:"after,omitempty" bson:"after"`               // seconds since entry
+	At           int64   `json:"at,omitempty" bson:"at"`                     // unix seconds deadline if after is not set
+	Amount       float64 `json:"amount,omitempty" bson:"amount"`             // percentage of entry amount, the rest if 0
+	IfProfitable bool    `json:"ifProfitable,omitempty" bson:"ifProfitable"` // waits for the position in profit once due
+}
+
+// A MongoScheduleConditions restricts a smart order by calendar time in UTC, e.g. to enter on weekdays between 08:00
+// and 16:00 only and to exit before a known event.
+type MongoScheduleConditions struct {
+	EntryWindows  []*MongoTimeWindow `json:"entryWindows,omitempty" bson:"entryWindows"`   // entry is placed within any window only
+	EntryWeekdays []int64            `json:"entryWeekdays,omitempty" bson:"entryWeekdays"` // 0 - Sunday, entry is placed on these days only
+	CancelEntryAt int64              `json:"cancelEntryAt,omitempty" bson:"cancelEntryAt"` // unix seconds to cancel the entry not done yet
+	ForceExitAt   int64              `json:"forceExitAt,omitempty" bson:"forceExitAt"`     // unix seconds to close the position at market
+}
+
+// A MongoTimeWindow is a daily time range in HH:MM format, a window ending before it starts spans midnight.
+type MongoTimeWindow struct {
+	From string `json:"from" bson:"from"` // inclusive
+	To   string `json:"to" bson:"to"`     // exclusive
+}
+
+// A MongoIndicatorCondition compares technical indicator of the strategy pair with a value,
+// e.g. {indicator: "rsi", params: [14], timeframe: "1h", operator: "<", value: 30}.
+type MongoIndicatorCondition struct {
+	Indicator string    `json:"indicator,omitempty" bson:"indicator"` // sma, ema, rsi, macd, bb, atr or vwap
+	Params    []float64 `json:"params,omitempty" bson:"params"`       // common defaults used if empty
+	Output    string    `json:"output,omitempty" bson:"output"`       // e.g. signal for macd or upper for bb, main output if empty
+	Timeframe string    `json:"timeframe,omitempty" bson:"timeframe"` // 1m, 5m, 15m, 1h, 4h or 1d
+	Operator  string    `json:"operator,omitempty" bson:"operator"`   // <, <=, > or >=
+	Value     float64   `json:"value" bson:"value"`
+}
+
+// A MongoVolatilityConditions enables stop-loss, forced loss and exit levels of type 2 given in volatility units.
+// Levels are converted to percentages relative to entry price at entry time.
+type MongoVolatilityConditions struct {
+	Mode       string  `json:"mode,omitempty" bson:"mode"`             // atr or stddev, atr by default
+	Timeframe  string  `json:"timeframe,omitempty" bson:"timeframe"`   // candles timeframe, 15m by default
+	Period     int64   `json:"period,omitempty" bson:"period"`         // candles count, 14 by default
+	Fallback   float64 `json:"fallback,omitempty" bson:"fallback"`     // volatility in percents of entry price if candles are not enough, 1 by default
+	StopLoss   float64 `json:"stopLoss,omitempty" bson:"stopLoss"`     // stop-loss distance from entry in volatility units
+	ForcedLoss float64 `json:"forcedLoss,omitempty" bson:"forcedLoss"` // forced loss distance from entry in volatility units
+	Trailing   float64 `json:"trailing,omitempty" bson:"trailing"`     // stop-loss distance trailed from each closed candle in volatility units
+}
+
+// A MongoRebalanceConditions holds target weights of spot assets on the strategy key, e.g. 50% BTC, 30% ETH and 20%
+// USDT. Assets are rebalanced against the quote asset on the period given or once any weight drifts farther than the band.
+// Pair of the strategy conditions only assigns the strategy to a service instance.
+type MongoRebalanceConditions struct {
+	Targets      []*MongoRebalanceTarget `json:"targets,omitempty" bson:"targets"`
+	QuoteAsset   string                  `json:"quoteAsset,omitempty" bson:"quoteAsset"`     // USDT by default
+	Period       int64                   `json:"period,omitempty" bson:"period"`             // seconds between rebalances, not scheduled if 0
+	Band         float64                 `json:"band,omitempty" bson:"band"`                 // weight drift in percentage points, not checked if 0
+	MinNotional  float64                 `json:"minNotional,omitempty" bson:"minNotional"`   // smallest child order in quote asset, 10 by default
+	Execution    string                  `json:"execution,omitempty" bson:"execution"`       // twap or maker-only, twap by default
+	TwapSlices   int64                   `json:"twapSlices,omitempty" bson:"twapSlices"`     // child orders per asset, 5 by default
+	TwapInterval int64                   `json:"twapInterval,omitempty" bson:"twapInterval"` // seconds between slices, 60 by default
+}
+
+// A MongoRebalanceTarget is a weight of the asset in percents of the portfolio value.
+type MongoRebalanceTarget struct {
+	Asset  string  `json:"asset" bson:"asset"`
+	Weight float64 `json:"weight" bson:"weight"`
+}
+
+// A MongoArbitrageConditions describes arbitrage of Pair of the strategy conditions between Exchange of the strategy
+// conditions traded with the strategy key and the second exchange traded with the second key.
+type MongoArbitrageConditions struct {
+	SecondExchange     string              `json:"secondExchange,omitempty" bson:"secondExchange"` // e.g. serum
+	SecondKeyId        *primitive.ObjectID `json:"secondKeyId,omitempty" bson:"secondKeyId"`
+	Amount             float64             `json:"amount,omitempty" bson:"amount"`                         // base asset amount of each trade
+	MinProfit          float64             `json:"minProfit,omitempty" bson:"minProfit"`                   // spread net of fees relative to buy price, e.g. 0.002
+	Fee                float64             `json:"fee,omitempty" bson:"fee"`                               // taker fee rate at the first exchange
+	SecondFee          float64             `json:"secondFee,omitempty" bson:"secondFee"`                   // taker fee rate at the second exchange
+	MaxInventory       float64             `json:"maxInventory,omitempty" bson:"maxInventory"`             // max absolute base asset inventory at the first exchange
+	SecondMaxInventory float64             `json:"secondMaxInventory,omitempty" bson:"secondMaxInventory"` // max absolute base asset inventory at the second exchange
+	LegTimeout         int64               `json:"legTimeout,omitempty" bson:"legTimeout"`                 // seconds to wait for legs filled
+}
+
+// A MongoFundingConditions describes a cash and carry trade bought at spot and shorted at perpetual futures of the
+// same asset while funding rate is high, the asset is Pair of the strategy conditions.
+type MongoFundingConditions struct {
+	SpotKeyId       *primitive.ObjectID `json:"spotKeyId,omitempty" bson:"spotKeyId"`       // strategy key used if empty
+	FuturesKeyId    *primitive.ObjectID `json:"futuresKeyId,omitempty" bson:"futuresKeyId"` // strategy key used if empty
+	Amount          float64             `json:"amount,omitempty" bson:"amount"`             // base asset amount of each leg
+	EntryRate       float64             `json:"entryRate,omitempty" bson:"entryRate"`       // funding rate to enter at or above, e.g. 0.0003
+	ExitRate        float64             `json:"exitRate,omitempty" bson:"exitRate"`         // funding rate to exit at or below
+	Collateral      float64             `json:"collateral,omitempty" bson:"collateral"`     // amount to transfer from spot to futures key on entry
+	CollateralAsset string              `json:"collateralAsset,omitempty" bson:"collateralAsset"`
+	LegTimeout      int64               `json:"legTimeout,omitempty" bson:"legTimeout"` // seconds to wait for legs filled
+}
+
+// A MongoPairsConditions describes a pairs trade entered long one symbol and short the other one when their price
+// ratio deviates from the rolling mean, the first leg is Pair of the strategy conditions.
+type MongoPairsConditions struct {
+	SecondPair     string  `json:"secondPair,omitempty" bson:"secondPair"`
+	Amount         float64 `json:"amount,omitempty" bson:"amount"`                 // the first leg amount
+	SecondAmount   float64 `json:"secondAmount,omitempty" bson:"secondAmount"`     // the second leg amount
+	Window         int     `json:"window,omitempty" bson:"window"`                 // ratio samples in rolling window
+	SamplePeriod   int64   `json:"samplePeriod,omitempty" bson:"samplePeriod"`     // seconds between ratio samples
+	EntryDeviation float64 `json:"entryDeviation,omitempty" bson:"entryDeviation"` // z-score to enter at
+	ExitDeviation  float64 `json:"exitDeviation,omitempty" bson:"exitDeviation"`   // z-score to exit at on mean reversion
+	StopDeviation  float64 `json:"stopDeviation,omitempty" bson:"stopDeviation"`   // z-score to stop at, 0 disables
+	LegTimeout     int64   `json:"legTimeout,omitempty" bson:"legTimeout"`         // seconds to wait for legs filled
 }
@@ -0,0 +1,37 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// A WebhookPayload is an external trading signal, e.g. a TradingView alert, to spawn a smart trade from a template.
+type WebhookPayload struct {
+	Id        string    `json:"id,omitempty"`        // unique alert id, payload hash used if empty
+	Timestamp int64     `json:"timestamp,omitempty"` // unix seconds the alert fired at
+	Side      string    `json:"side,omitempty"`      // "buy" or "sell"
+	Amount    float64   `json:"amount,omitempty"`    // template amount used if empty
+	Price     float64   `json:"price,omitempty"`     // market entry if empty
+	Stop      float64   `json:"stop,omitempty"`      // absolute stop loss price
+	Targets   []float64 `json:"targets,omitempty"`   // absolute take profit prices, amount split evenly
+}
+
+// Webhook event statuses stored in the audit trail.
+const (
+	WebhookAccepted = "accepted"
+	WebhookRejected = "rejected"
+)
+
+// A MongoWebhookEvent is an audit trail record for a received webhook signal.
+type MongoWebhookEvent struct {
+	ID                 primitive.ObjectID  `json:"_id" bson:"_id"`
+	TemplateStrategyId *primitive.ObjectID `json:"templateStrategyId,omitempty" bson:"templateStrategyId"`
+	StrategyId         *primitive.ObjectID `json:"strategyId,omitempty" bson:"strategyId"` // spawned strategy if accepted
+	Nonce              string              `json:"nonce,omitempty" bson:"nonce"`
+	RemoteAddr         string              `json:"remoteAddr,omitempty" bson:"remoteAddr"`
+	Payload            string              `json:"payload,omitempty" bson:"payload"`
+	Status             string              `json:"status,omitempty" bson:"status"`
+	Msg                string              `json:"msg,omitempty" bson:"msg"`
+	ReceivedAt         time.Time           `json:"receivedAt,omitempty" bson:"receivedAt"`
+}
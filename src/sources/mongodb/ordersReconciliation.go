@@ -0,0 +1,158 @@
+package mongodb
+
+import (
+	"context"
+	"time"
+
+	"gitlab.com/crypto_project/core/strategy_service/src/sources/mongodb/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+)
+
+const (
+	// ordersReconcilePeriod is how often orders subscribed are checked for updates missed by the watch.
+	ordersReconcilePeriod = time.Minute
+	// ordersReconcileBatch limits order ids queried at once.
+	ordersReconcileBatch = 500
+)
+
+// An orderUpdate identifies an order update delivered, maker-only orders are updated with new orders placed.
+type orderUpdate struct {
+	orderId   string
+	status    string
+	updatedAt int64
+}
+
+// deliverOrder invokes the callback subscribed to the `filled` or `canceled` order given, once per order update as
+// the watch resumed and reconciliation may deliver it again. Maker-only orders are delivered by the initial order id.
+// The callback is dropped once the order filled, maker-only orders are placed again after cancels.
+func (sm *StateMgmt) deliverOrder(order *models.MongoOrder) bool {
+	if order.Status != "filled" && order.Status != "canceled" {
+		return false
+	}
+	orderId := order.OrderId
+	if order.PostOnlyInitialOrderId != "" {
+		orderId = order.PostOnlyInitialOrderId
+	}
+	callback, ok := sm.OrderCallbacks.Load(orderId)
+	if !ok || !sm.markDelivered(orderId, order) {
+		return false
+	}
+	log.Info("order",
+		zap.String("orderId", orderId),
+		zap.String("status", order.Status),
+		zap.Time("updatedAt", order.UpdatedAt),
+	)
+	callback.(func(order *models.MongoOrder))(order)
+	if order.Status == "filled" {
+		sm.dropCallback(orderId)
+	}
+	return true
+}
+
+// dropCallback unsubscribes the callback of the order id given and forgets updates delivered to it.
+func (sm *StateMgmt) dropCallback(orderId string) {
+	sm.deliveredMux.Lock()
+	defer sm.deliveredMux.Unlock()
+	sm.OrderCallbacks.Delete(orderId)
+	delete(sm.delivered, orderId)
+}
+
+// markDelivered records the order update delivered to the callback of the order id given, false if it was already.
+func (sm *StateMgmt) markDelivered(orderId string, order *models.MongoOrder) bool {
+	update := orderUpdate{orderId: order.OrderId, status: order.Status, updatedAt: order.UpdatedAt.UnixNano()}
+	sm.deliveredMux.Lock()
+	defer sm.deliveredMux.Unlock()
+	if sm.delivered == nil {
+		sm.delivered = map[string]orderUpdate{}
+	}
+	if sm.delivered[orderId] == update {
+		return false
+	}
+	sm.delivered[orderId] = update
+	return true
+}
+
+// ReconcileOrders delivers the last updates of orders subscribed not delivered yet, e.g. fills happened while the
+// watch was interrupted. Orders delivered filled already are skipped.
+func (sm *StateMgmt) ReconcileOrders() {
+	if sm.OrderCallbacks == nil {
+		return
+	}
+	t1 := time.Now()
+	var orderIds []string
+	sm.deliveredMux.Lock()
+	sm.OrderCallbacks.Range(func(key, _ interface{}) bool {
+		orderId := key.(string)
+		if last, ok := sm.delivered[orderId]; !ok || last.status != "filled" {
+			orderIds = append(orderIds, orderId)
+		}
+		return true
+	})
+	sm.deliveredMux.Unlock()
+	missed := 0
+	for start := 0; start < len(orderIds); start += ordersReconcileBatch {
+		end := start + ordersReconcileBatch
+		if end > len(orderIds) {
+			end = len(orderIds)
+		}
+		for _, order := range sm.lastOrderUpdates(orderIds[start:end]) {
+			if sm.deliverOrder(order) {
+				missed++
+			}
+		}
+	}
+	if missed > 0 {
+		log.Warn("order updates missed by the watch delivered", zap.Int("count", missed))
+		sm.Statsd.Gauge("state_mgmt.order_updates_reconciled", int64(missed))
+	}
+	sm.Statsd.TimingDuration("state_mgmt.reconcile_orders", time.Since(t1))
+}
+
+// lastOrderUpdates reads the last `filled` or `canceled` orders by order ids given, initial ones for maker-only orders.
+func (sm *StateMgmt) lastOrderUpdates(orderIds []string) []*models.MongoOrder {
+	ctx := context.Background()
+	cur, err := GetCollection("core_orders").Find(ctx, bson.D{
+		{Key: "status", Value: bson.D{{Key: "$in", Value: bson.A{"filled", "canceled"}}}},
+		{Key: "$or", Value: bson.A{
+			bson.D{{Key: "id", Value: bson.D{{Key: "$in", Value: orderIds}}}},
+			bson.D{{Key: "postOnlyInitialOrderId", Value: bson.D{{Key: "$in", Value: orderIds}}}},
+		}},
+	}, options.Find().SetSort(bson.D{{Key: "updatedAt", Value: 1}}))
+	if err != nil {
+		log.Error("can't read orders to reconcile", zap.Error(err))
+		return nil
+	}
+	defer cur.Close(ctx)
+	last := map[string]*models.MongoOrder{}
+	var ordered []string
+	for cur.Next(ctx) {
+		var order models.MongoOrder
+		if err := cur.Decode(&order); err != nil {
+			log.Error("order decode", zap.Error(err))
+			continue
+		}
+		orderId := order.OrderId
+		if order.PostOnlyInitialOrderId != "" {
+			orderId = order.PostOnlyInitialOrderId
+		}
+		if _, ok := last[orderId]; !ok {
+			ordered = append(ordered, orderId)
+		}
+		last[orderId] = &order
+	}
+	orders := make([]*models.MongoOrder, 0, len(ordered))
+	for _, orderId := range ordered {
+		orders = append(orders, last[orderId])
+	}
+	return orders
+}
+
+func (sm *StateMgmt) runOrdersReconciliation() {
+	ticker := time.NewTicker(ordersReconcilePeriod)
+	defer ticker.Stop()
+	for range ticker.C {
+		sm.ReconcileOrders()
+	}
+}
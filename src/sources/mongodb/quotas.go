@@ -0,0 +1,50 @@
+package mongodb
+
+import (
+	"context"
+	"time"
+
+	"gitlab.com/crypto_project/core/strategy_service/src/sources/mongodb/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+)
+
+// GetQuota returns quota of the owner or account from core_quotas, nil if not set.
+func (sm *StateMgmt) GetQuota(subjectId *primitive.ObjectID) *models.MongoQuota {
+	var quota models.MongoQuota
+	err := GetCollection("core_quotas").FindOne(context.TODO(), bson.D{{Key: "_id", Value: subjectId}}).Decode(&quota)
+	if err != nil {
+		if err != mongo.ErrNoDocuments {
+			log.Error("get quota", zap.String("id", subjectId.Hex()), zap.Error(err))
+		}
+		return nil
+	}
+	return &quota
+}
+
+// GetActiveStrategies returns enabled strategies of the owner or account with conditions and state needed to count them.
+func (sm *StateMgmt) GetActiveStrategies(field string, subjectId *primitive.ObjectID) []*models.MongoStrategy {
+	t1 := time.Now()
+	ctx := context.TODO()
+	opts := options.Find().SetProjection(bson.D{
+		{Key: "conditions.pair", Value: 1},
+		{Key: "conditions.exchange", Value: 1},
+		{Key: "conditions.marketType", Value: 1},
+		{Key: "conditions.entryOrder", Value: 1},
+		{Key: "state.entryPrice", Value: 1},
+	})
+	cur, err := GetCollection("core_strategies").Find(ctx, bson.D{{Key: field, Value: subjectId}, {Key: "enabled", Value: true}}, opts)
+	if err != nil {
+		log.Error("get active strategies", zap.String(field, subjectId.Hex()), zap.Error(err))
+		return nil
+	}
+	var strategies []*models.MongoStrategy
+	if err := cur.All(ctx, &strategies); err != nil {
+		log.Error("decode active strategies", zap.String(field, subjectId.Hex()), zap.Error(err))
+	}
+	sm.Statsd.TimingDuration("state_mgmt.get_active_strategies", time.Since(t1))
+	return strategies
+}
@@ -0,0 +1,163 @@
+// Package schema versions strategy documents and upgrades them with migrations, on load in memory or in batch.
+package schema
+
+import (
+	"fmt"
+	"reflect"
+
+	"gitlab.com/crypto_project/core/strategy_service/src/sources/mongodb/models"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// A Migration upgrades a strategy document from the previous schema version to its version. Migrations released are
+// never edited, add a new one instead. Documents upgraded on load are saved by partial updates keeping the old version,
+// so a migration should leave a document upgraded already as it is.
+type Migration struct {
+	Version     int64
+	Description string
+	Up          func(doc bson.M) error
+}
+
+// migrations bring a strategy document written before versioning, version 0, to the current version, in order.
+var migrations = []Migration{
+	{
+		Version: 1,
+		// Runtimes set leverage not set to 1 on start and divide by 1 at least. For conditions reloaded while running
+		// with leverage not set, calculations multiplying by leverage, e.g. of profit and fees, use 1 instead of 0 after.
+		Description: "default leverage not set to 1",
+		Up: func(doc bson.M) error {
+			conditions := Subdocument(doc, "conditions")
+			if conditions == nil {
+				return nil
+			}
+			if number(conditions["leverage"]) == 0 {
+				conditions["leverage"] = 1.0
+			}
+			return nil
+		},
+	},
+}
+
+// Migrations returns migrations in order, e.g. to test them against fixture documents.
+func Migrations() []Migration {
+	return append([]Migration{}, migrations...)
+}
+
+// CurrentVersion returns schema version of strategy documents the service writes.
+func CurrentVersion() int64 {
+	return migrations[len(migrations)-1].Version
+}
+
+// Version returns schema version of the strategy document given, 0 if not set.
+func Version(raw bson.Raw) int64 {
+	version, _ := raw.Lookup("schemaVersion").AsInt64OK()
+	return version
+}
+
+// number returns numeric value of a document field, 0 if it's not a number.
+func number(value interface{}) float64 {
+	switch n := value.(type) {
+	case float64:
+		return n
+	case int32:
+		return float64(n)
+	case int64:
+		return float64(n)
+	}
+	return 0
+}
+
+// Upgrade applies migrations newer than the document version in order and sets the version. It returns whether the
+// document upgraded, it's left at the last version reached on error.
+func Upgrade(doc bson.M) (bool, error) {
+	version := int64(number(doc["schemaVersion"]))
+	upgraded := false
+	for _, migration := range migrations {
+		if migration.Version <= version {
+			continue
+		}
+		if err := migration.Up(doc); err != nil {
+			return upgraded, fmt.Errorf("migration %v: %w", migration.Version, err)
+		}
+		doc["schemaVersion"] = migration.Version
+		upgraded = true
+	}
+	return upgraded, nil
+}
+
+// Changes returns a partial update setting fields of the document upgraded that differ from the document before the
+// upgrade and unsetting fields removed, by paths into subdocuments, so fields not migrated are left as stored.
+func Changes(before bson.M, after bson.M) bson.D {
+	set, unset := bson.M{}, bson.M{}
+	diff(before, after, "", set, unset)
+	update := bson.D{}
+	if len(set) > 0 {
+		update = append(update, bson.E{Key: "$set", Value: set})
+	}
+	if len(unset) > 0 {
+		update = append(update, bson.E{Key: "$unset", Value: unset})
+	}
+	return update
+}
+
+// diff collects paths of fields set and unset turning the document before into the one after.
+func diff(before bson.M, after bson.M, prefix string, set bson.M, unset bson.M) {
+	for key, value := range after {
+		embeddedBefore, embeddedAfter := Subdocument(before, key), Subdocument(after, key)
+		if embeddedBefore != nil && embeddedAfter != nil {
+			diff(embeddedBefore, embeddedAfter, prefix+key+".", set, unset)
+		} else if previous, ok := before[key]; !ok || !reflect.DeepEqual(previous, value) {
+			set[prefix+key] = value
+		}
+	}
+	for key := range before {
+		if _, ok := after[key]; !ok {
+			unset[prefix+key] = ""
+		}
+	}
+}
+
+// DecodeStrategy decodes the strategy document given upgrading it in memory first if it's of an older version.
+func DecodeStrategy(raw bson.Raw, strategy *models.MongoStrategy) error {
+	if Version(raw) >= CurrentVersion() {
+		return bson.Unmarshal(raw, strategy)
+	}
+	var doc bson.M
+	if err := bson.Unmarshal(raw, &doc); err != nil {
+		return err
+	}
+	if _, err := Upgrade(doc); err != nil {
+		return err
+	}
+	upgraded, err := bson.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	return bson.Unmarshal(upgraded, strategy)
+}
+
+// DecodeStrategyEvent decodes a change stream event of strategies upgrading the document if it's of an older version.
+func DecodeStrategyEvent(raw bson.Raw, event *models.MongoStrategyUpdateEvent) error {
+	fullDocument, ok := raw.Lookup("fullDocument").DocumentOK()
+	if !ok {
+		return bson.Unmarshal(raw, event)
+	}
+	event.OperationType, _ = raw.Lookup("operationType").StringValueOK()
+	if description, ok := raw.Lookup("updateDescription").DocumentOK(); ok {
+		if err := bson.Unmarshal(description, &event.UpdateDescription); err != nil {
+			return err
+		}
+	}
+	return DecodeStrategy(fullDocument, &event.FullDocument)
+}
+
+// Subdocument returns the document embedded under the key, nil if there is no such one.
+func Subdocument(doc bson.M, key string) bson.M {
+	switch embedded := doc[key].(type) {
+	case bson.M:
+		return embedded
+	case map[string]interface{}:
+		return embedded
+	}
+	return nil
+}
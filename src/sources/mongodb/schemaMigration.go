@@ -0,0 +1,55 @@
+package mongodb
+
+import (
+	"context"
+
+	"gitlab.com/crypto_project/core/strategy_service/src/sources/mongodb/schema"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+)
+
+// MigrateStrategies upgrades up to limit strategy documents of older schema versions and saves the fields changed,
+// returning how many found and how many saved. A document updated concurrently is skipped to be upgraded on load and
+// the next run.
+func (sm *StateMgmt) MigrateStrategies(limit int64) (found int64, migrated int64, err error) {
+	ctx := context.TODO()
+	col := GetCollection("core_strategies")
+	filter := bson.D{{Key: "$or", Value: bson.A{
+		bson.D{{Key: "schemaVersion", Value: bson.D{{Key: "$lt", Value: schema.CurrentVersion()}}}},
+		bson.D{{Key: "schemaVersion", Value: bson.D{{Key: "$exists", Value: false}}}},
+	}}}
+	cur, err := col.Find(ctx, filter, options.Find().SetLimit(limit))
+	if err != nil {
+		return 0, 0, err
+	}
+	defer cur.Close(ctx)
+	for cur.Next(ctx) {
+		found++
+		var before, doc bson.M
+		if err := bson.Unmarshal(cur.Current, &before); err != nil {
+			return found, migrated, err
+		}
+		if err := bson.Unmarshal(cur.Current, &doc); err != nil {
+			return found, migrated, err
+		}
+		strategyId, _ := cur.Current.Lookup("_id").ObjectIDOK()
+		version, _ := cur.Current.Lookup("version").AsInt64OK()
+		if _, err := schema.Upgrade(doc); err != nil {
+			log.Error("can't upgrade strategy", zap.String("id", strategyId.Hex()), zap.Error(err))
+			sm.Statsd.Inc("state_mgmt.schema_migration.error")
+			continue
+		}
+		doc["version"] = version + 1
+		updated, err := col.UpdateOne(ctx, versionFilter(&strategyId, version), schema.Changes(before, doc))
+		if err != nil {
+			return found, migrated, err
+		}
+		if updated.MatchedCount == 0 {
+			sm.Statsd.Inc("state_mgmt.schema_migration.version_conflict")
+			continue
+		}
+		migrated++
+	}
+	return found, migrated, cur.Err()
+}
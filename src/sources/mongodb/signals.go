@@ -0,0 +1,75 @@
+package mongodb
+
+import (
+	"context"
+	"time"
+
+	"gitlab.com/crypto_project/core/strategy_service/src/sources/mongodb/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.uber.org/zap"
+)
+
+// GetEnabledSignals reads all the enabled signals from persistent storage.
+func (sm *StateMgmt) GetEnabledSignals() []models.MongoSignal {
+	t1 := time.Now()
+	ctx := context.Background()
+	coll := GetCollection("core_signals")
+	cur, err := coll.Find(ctx, bson.M{"enabled": true})
+	if err != nil {
+		log.Error("can't read signals", zap.Error(err))
+		return nil
+	}
+	defer cur.Close(ctx)
+	var signals []models.MongoSignal
+	for cur.Next(ctx) {
+		var signal models.MongoSignal
+		if err := cur.Decode(&signal); err != nil {
+			log.Error("signal decode error", zap.Error(err))
+			continue
+		}
+		signals = append(signals, signal)
+	}
+	sm.Statsd.TimingDuration("state_mgmt.get_enabled_signals", time.Since(t1))
+	return signals
+}
+
+// SaveSignalTrigger appends trigger event to signal events and updates signal enabled flag.
+func (sm *StateMgmt) SaveSignalTrigger(signal *models.MongoSignal, event models.MongoSignalEvent) {
+	t1 := time.Now()
+	coll := GetCollection("core_signals")
+	update := bson.M{
+		"$set":  bson.M{"enabled": signal.Enabled, "lasttrigger": signal.LastTrigger},
+		"$push": bson.M{"events": event},
+	}
+	_, err := coll.UpdateOne(context.TODO(), bson.M{"_id": signal.Id}, update)
+	if err != nil {
+		log.Error("save signal trigger", zap.Error(err))
+	}
+	sm.Statsd.TimingDuration("state_mgmt.save_signal_trigger", time.Since(t1))
+}
+
+// DisableSignal sets signal enabled flag to false, e.g. when the signal expired.
+func (sm *StateMgmt) DisableSignal(signalId primitive.ObjectID) {
+	coll := GetCollection("core_signals")
+	_, err := coll.UpdateOne(context.TODO(), bson.M{"_id": signalId}, bson.M{"$set": bson.M{"enabled": false}})
+	if err != nil {
+		log.Error("disable signal", zap.Error(err))
+	}
+}
+
+// EnableStrategiesBySignal enables disabled strategies linked to the signal and returns how much were enabled.
+func (sm *StateMgmt) EnableStrategiesBySignal(signalId primitive.ObjectID) int64 {
+	t1 := time.Now()
+	coll := GetCollection("core_strategies")
+	res, err := coll.UpdateMany(context.TODO(),
+		bson.M{"signalids": signalId, "enabled": false},
+		bson.M{"$set": bson.M{"enabled": true}},
+	)
+	if err != nil {
+		log.Error("enable strategies by signal", zap.Error(err))
+		return 0
+	}
+	sm.Statsd.TimingDuration("state_mgmt.enable_strategies_by_signal", time.Since(t1))
+	return res.ModifiedCount
+}
@@ -0,0 +1,313 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"gitlab.com/crypto_project/core/strategy_service/src/sources/mongodb/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+)
+
+// Strategy documents carry a version incremented by each update. Updates made from goroutines of a runtime, conditions
+// editing and other services are conditional on the version known, a conflicting update is merged into the document
+// re-read and retried. Writers outside the service should increment the version too to be noticed.
+
+// maxVersionConflicts is how many times an update is retried on conflict before it's done unconditionally.
+const maxVersionConflicts = 3
+
+// versionFilter matches the strategy at the version given, documents saved before versioning match version 0.
+func versionFilter(strategyId *primitive.ObjectID, version int64) bson.D {
+	if version == 0 {
+		return bson.D{
+			{Key: "_id", Value: strategyId},
+			{Key: "version", Value: bson.D{{Key: "$in", Value: bson.A{0, nil}}}},
+		}
+	}
+	return bson.D{{Key: "_id", Value: strategyId}, {Key: "version", Value: version}}
+}
+
+// withVersionInc returns the update incrementing the strategy version as well.
+func withVersionInc(update bson.D) bson.D {
+	versioned := make(bson.D, 0, len(update)+1)
+	incremented := false
+	for _, operator := range update {
+		if operator.Key == "$inc" {
+			if fields, ok := operator.Value.(bson.D); ok {
+				operator.Value = append(append(bson.D{}, fields...), bson.E{Key: "version", Value: 1})
+				incremented = true
+			}
+		}
+		versioned = append(versioned, operator)
+	}
+	if !incremented {
+		versioned = append(versioned, bson.E{Key: "$inc", Value: bson.D{{Key: "version", Value: 1}}})
+	}
+	return versioned
+}
+
+// updateVersioned updates the strategy with the update merge returns for the strategy stored and the base one, the
+// strategy as the instance knew it before. The update is conditional on the version known, so the strategy is read
+// only if it's not known or on conflict, the update is merged again then. Once retries exhausted it's done
+// unconditionally, so the last writer wins as before. Conflicts are counted per update given by metric. Fields
+// buffered for the strategy are written before.
+func (sm *StateMgmt) updateVersioned(metric string, strategyId *primitive.ObjectID, merge func(current *models.MongoStrategy, base *models.MongoStrategy) bson.D) (updated *mongo.UpdateResult, err error) {
+	if sm.WriteBehind == nil {
+		return sm.tryUpdateVersioned(metric, strategyId, merge)
+	}
+	sm.WriteBehind.Sync(strategyId, func() {
+		updated, err = sm.tryUpdateVersioned(metric, strategyId, merge)
+	})
+	return updated, err
+}
+
+func (sm *StateMgmt) tryUpdateVersioned(metric string, strategyId *primitive.ObjectID, merge func(current *models.MongoStrategy, base *models.MongoStrategy) bson.D) (*mongo.UpdateResult, error) {
+	col := GetCollection("core_strategies")
+	projection := options.FindOne().SetProjection(bson.D{
+		{Key: "version", Value: 1},
+		{Key: "state", Value: 1},
+		{Key: "conditions", Value: 1},
+	})
+	base := sm.known.Get(strategyId)
+	current := base
+	for attempt := 0; ; attempt++ {
+		if current == nil {
+			current = &models.MongoStrategy{}
+			err := col.FindOne(context.TODO(), bson.D{{Key: "_id", Value: strategyId}}, projection).Decode(current)
+			if err != nil {
+				return nil, err
+			}
+			if base == nil {
+				base = current
+			}
+		}
+		update := withVersionInc(merge(current, base))
+		if attempt == maxVersionConflicts {
+			sm.Statsd.Inc("state_mgmt.version_conflict_unresolved")
+			log.Warn("version conflicts unresolved, updating unconditionally",
+				zap.String("id", strategyId.Hex()),
+				zap.String("update", metric),
+			)
+			sm.known.Forget(strategyId)
+			return col.UpdateOne(context.TODO(), bson.D{{Key: "_id", Value: strategyId}}, update)
+		}
+		updated, err := col.UpdateOne(context.TODO(), versionFilter(strategyId, current.Version), update)
+		if err != nil {
+			return updated, err
+		}
+		if updated.MatchedCount > 0 {
+			sm.remember(current, update)
+			return updated, nil
+		}
+		sm.Statsd.Inc("state_mgmt.version_conflict")
+		sm.Statsd.Inc("state_mgmt." + metric + ".version_conflict")
+		log.Info("strategy version conflict",
+			zap.String("id", strategyId.Hex()),
+			zap.String("update", metric),
+			zap.Int64("version", current.Version),
+		)
+		current = nil
+		time.Sleep(time.Duration(attempt+1) * 10 * time.Millisecond)
+	}
+}
+
+// remember keeps the strategy with the update applied and its version incremented as known, the strategy is forgotten
+// if the update can't be applied.
+func (sm *StateMgmt) remember(strategy *models.MongoStrategy, update bson.D) {
+	updated, err := applyUpdate(strategy, update)
+	if err != nil {
+		log.Warn("can't apply update to strategy known", zap.String("id", strategy.ID.Hex()), zap.Error(err))
+		sm.known.Forget(strategy.ID)
+		return
+	}
+	updated.Version = strategy.Version + 1
+	sm.known.Set(updated)
+}
+
+// rememberFlushed applies the update written by the write-behind to the strategy known, if any.
+func (sm *StateMgmt) rememberFlushed(strategyId primitive.ObjectID, update bson.D) {
+	if strategy := sm.known.Get(&strategyId); strategy != nil {
+		sm.remember(strategy, update)
+	}
+}
+
+// mergeDocument returns the update setting fields of the document under the path given changed since the base one,
+// fields changed by other writers are kept this way. The document is set as a whole if there is no base or current
+// one to set fields of.
+func mergeDocument(path string, document interface{}, base interface{}, current interface{}) bson.D {
+	doc, baseDoc, currentDoc := toDocument(document), toDocument(base), toDocument(current)
+	if doc == nil || baseDoc == nil || currentDoc == nil {
+		return bson.D{{Key: "$set", Value: bson.D{{Key: path, Value: document}}}}
+	}
+	keys := make([]string, 0, len(doc)+len(baseDoc))
+	for key := range doc {
+		keys = append(keys, key)
+	}
+	for key := range baseDoc {
+		if _, ok := doc[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	set, unset := bson.D{}, bson.D{}
+	for _, key := range keys {
+		value, ok := doc[key]
+		baseValue, known := baseDoc[key]
+		switch {
+		case !ok:
+			unset = append(unset, bson.E{Key: path + "." + key, Value: ""})
+		case !known || !reflect.DeepEqual(value, baseValue):
+			set = append(set, bson.E{Key: path + "." + key, Value: value})
+		}
+	}
+	update := bson.D{}
+	if len(set) > 0 {
+		update = append(update, bson.E{Key: "$set", Value: set})
+	}
+	if len(unset) > 0 {
+		update = append(update, bson.E{Key: "$unset", Value: unset})
+	}
+	return update
+}
+
+// combineUpdates returns fields of operators of the updates given combined, e.g. to set fields of two documents.
+func combineUpdates(updates ...bson.D) bson.D {
+	combined := bson.D{}
+	for _, update := range updates {
+		for _, operator := range update {
+			fields, _ := operator.Value.(bson.D)
+			merged := false
+			for i := range combined {
+				if combined[i].Key == operator.Key {
+					combined[i].Value = append(combined[i].Value.(bson.D), fields...)
+					merged = true
+				}
+			}
+			if !merged {
+				combined = append(combined, bson.E{Key: operator.Key, Value: append(bson.D{}, fields...)})
+			}
+		}
+	}
+	return combined
+}
+
+// toDocument returns the value given as a document, nil if it's nil or not a document.
+func toDocument(value interface{}) bson.M {
+	if value == nil || (reflect.ValueOf(value).Kind() == reflect.Ptr && reflect.ValueOf(value).IsNil()) {
+		return nil
+	}
+	raw, err := bson.Marshal(value)
+	if err != nil {
+		return nil
+	}
+	var doc bson.M
+	if err := bson.Unmarshal(raw, &doc); err != nil {
+		return nil
+	}
+	return doc
+}
+
+// applyUpdate returns a copy of the strategy with fields of $set, $unset and $addToSet operators of the update given
+// applied.
+func applyUpdate(strategy *models.MongoStrategy, update bson.D) (*models.MongoStrategy, error) {
+	doc := toDocument(strategy)
+	if doc == nil {
+		return nil, fmt.Errorf("strategy is not a document")
+	}
+	for _, operator := range update {
+		if operator.Key != "$set" && operator.Key != "$unset" && operator.Key != "$addToSet" {
+			continue
+		}
+		fields, ok := operator.Value.(bson.D)
+		if !ok {
+			return nil, fmt.Errorf("%v fields are not a document", operator.Key)
+		}
+		for _, field := range fields {
+			value := field.Value
+			if operator.Key == "$addToSet" {
+				if value, ok = addedToSet(doc, field); !ok {
+					return nil, fmt.Errorf("can't add to set %v", field.Key)
+				}
+			}
+			if err := setPath(doc, strings.Split(field.Key, "."), value, operator.Key == "$unset"); err != nil {
+				return nil, err
+			}
+		}
+	}
+	raw, err := bson.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+	var updated models.MongoStrategy
+	if err := bson.Unmarshal(raw, &updated); err != nil {
+		return nil, err
+	}
+	return &updated, nil
+}
+
+// addedToSet returns ids of the array field of the document with ids of the $each operator given added.
+func addedToSet(doc bson.M, field bson.E) ([]string, bool) {
+	each, ok := field.Value.(bson.D)
+	if !ok || len(each) != 1 || each[0].Key != "$each" {
+		return nil, false
+	}
+	ids, ok := each[0].Value.([]string)
+	if !ok {
+		return nil, false
+	}
+	var current []string
+	var value interface{} = doc
+	for _, key := range strings.Split(field.Key, ".") {
+		switch nested := value.(type) {
+		case bson.M:
+			value = nested[key]
+		case bson.D:
+			value = nested.Map()[key]
+		default:
+			value = nil
+		}
+	}
+	if values, ok := value.(bson.A); ok {
+		for _, id := range values {
+			if id, ok := id.(string); ok {
+				current = append(current, id)
+			}
+		}
+	}
+	return models.UnionIds(current, ids), true
+}
+
+// setPath sets or removes the value of the document by the path of field names, creating documents on the path.
+func setPath(doc bson.M, path []string, value interface{}, unset bool) error {
+	if len(path) == 1 {
+		if unset {
+			delete(doc, path[0])
+		} else {
+			doc[path[0]] = value
+		}
+		return nil
+	}
+	var nested bson.M
+	switch child := doc[path[0]].(type) {
+	case bson.M:
+		nested = child
+	case bson.D:
+		nested = child.Map()
+	case nil:
+		if unset {
+			return nil
+		}
+		nested = bson.M{}
+	default:
+		return fmt.Errorf("field %v is not a document", path[0])
+	}
+	doc[path[0]] = nested
+	return setPath(nested, path[1:], value, unset)
+}
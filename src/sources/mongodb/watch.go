@@ -0,0 +1,151 @@
+package mongodb
+
+import (
+	"context"
+	"os"
+	"time"
+
+	statsd_client "gitlab.com/crypto_project/core/strategy_service/src/statsd"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+)
+
+const (
+	// resumeTokenSavePeriod throttles resume tokens saving, events after the token saved are handled again on resume.
+	resumeTokenSavePeriod = time.Second
+	watchRetryMin         = time.Second
+	watchRetryMax         = 30 * time.Second
+)
+
+// A ResumableWatch is a change stream reopened after interruptions. Resume tokens are saved by name and instance in
+// core_resume_tokens, so a watch reopened or the instance restarted continues after the last event it saved. Tokens
+// of shared watches are saved by name only, for watches handed over between instances, e.g. by a lock holder.
+// Handlers should be idempotent as events may be handled twice.
+type ResumableWatch struct {
+	Name       string
+	Shared     bool // resume after events handled by any instance rather than this one
+	Collection *mongo.Collection
+	Pipeline   mongo.Pipeline
+	Statsd     *statsd_client.StatsdClient
+	OnOpen     func() // invoked each time the stream opened, e.g. to reconcile what could be missed, may be nil
+	Handle     func(cs *mongo.ChangeStream)
+}
+
+// InstanceId identifies the instance across restarts, INSTANCE_ID or the host name if not set.
+func InstanceId() string {
+	if id := os.Getenv("INSTANCE_ID"); id != "" {
+		return id
+	}
+	host, err := os.Hostname()
+	if err != nil {
+		log.Warn("can't get host name to identify the instance", zap.Error(err))
+	}
+	return host
+}
+
+// tokenId returns the id of the resume token saved for the watch.
+func (w *ResumableWatch) tokenId() string {
+	if w.Shared {
+		return w.Name
+	}
+	return w.Name + "/" + InstanceId()
+}
+
+// Run watches the collection invoking the handler with each event, it never returns.
+func (w *ResumableWatch) Run() {
+	w.RunUntil(context.Background())
+}
+
+// RunUntil watches the collection invoking the handler with each event until the context given is done.
+func (w *ResumableWatch) RunUntil(ctx context.Context) {
+	retry := watchRetryMin
+	for ctx.Err() == nil {
+		cs, err := w.open(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			log.Error("can't watch",
+				zap.String("watch", w.Name),
+				zap.Duration("retry", retry),
+				zap.Error(err),
+			)
+			w.Statsd.Inc("watch." + w.Name + ".open_error")
+			time.Sleep(retry)
+			if retry *= 2; retry > watchRetryMax {
+				retry = watchRetryMax
+			}
+			continue
+		}
+		retry = watchRetryMin
+		if w.OnOpen != nil {
+			go w.OnOpen()
+		}
+		savedAt := time.Now()
+		for cs.Next(ctx) {
+			w.Handle(cs)
+			if time.Since(savedAt) >= resumeTokenSavePeriod {
+				w.saveResumeToken(cs.ResumeToken())
+				savedAt = time.Now()
+			}
+		}
+		w.saveResumeToken(cs.ResumeToken())
+		if ctx.Err() != nil {
+			log.Info("watch stopped", zap.String("watch", w.Name))
+			cs.Close(context.Background())
+			return
+		}
+		log.Warn("watch interrupted, reopening", zap.String("watch", w.Name), zap.Error(cs.Err()))
+		w.Statsd.Inc("watch." + w.Name + ".interrupted")
+		cs.Close(ctx)
+		time.Sleep(watchRetryMin)
+	}
+}
+
+// open opens the change stream after the resume token saved if any. The stream is opened from now if the token can't
+// be resumed after, e.g. it's out of the oplog already.
+func (w *ResumableWatch) open(ctx context.Context) (*mongo.ChangeStream, error) {
+	opts := options.ChangeStream().SetFullDocument(options.UpdateLookup)
+	token := w.loadResumeToken()
+	if token == nil {
+		return w.Collection.Watch(ctx, w.Pipeline, opts)
+	}
+	cs, err := w.Collection.Watch(ctx, w.Pipeline, opts.SetResumeAfter(token))
+	if err == nil {
+		log.Info("watch resumed", zap.String("watch", w.Name))
+		return cs, nil
+	}
+	log.Warn("can't resume watch, watching from now", zap.String("watch", w.Name), zap.Error(err))
+	w.Statsd.Inc("watch." + w.Name + ".resume_failed")
+	return w.Collection.Watch(ctx, w.Pipeline, options.ChangeStream().SetFullDocument(options.UpdateLookup))
+}
+
+func (w *ResumableWatch) loadResumeToken() bson.Raw {
+	var saved struct {
+		Token bson.Raw `bson:"token"`
+	}
+	err := GetCollection("core_resume_tokens").FindOne(context.TODO(), bson.D{{Key: "_id", Value: w.tokenId()}}).Decode(&saved)
+	if err != nil {
+		if err != mongo.ErrNoDocuments {
+			log.Error("can't read resume token", zap.String("watch", w.Name), zap.Error(err))
+		}
+		return nil
+	}
+	return saved.Token
+}
+
+func (w *ResumableWatch) saveResumeToken(token bson.Raw) {
+	if token == nil {
+		return
+	}
+	_, err := GetCollection("core_resume_tokens").UpdateOne(context.TODO(),
+		bson.D{{Key: "_id", Value: w.tokenId()}},
+		bson.D{{Key: "$set", Value: bson.D{{Key: "token", Value: token}, {Key: "savedAt", Value: time.Now()}}}},
+		options.Update().SetUpsert(true),
+	)
+	if err != nil {
+		log.Error("can't save resume token", zap.String("watch", w.Name), zap.Error(err))
+	}
+}
@@ -0,0 +1,79 @@
+package mongodb
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"gitlab.com/crypto_project/core/strategy_service/src/sources/mongodb/models"
+	"gitlab.com/crypto_project/core/strategy_service/src/sources/mongodb/schema"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+)
+
+// GetTemplateByToken returns enabled template strategy with the token given or nil if not found.
+func (sm *StateMgmt) GetTemplateByToken(token string) *models.MongoStrategy {
+	t1 := time.Now()
+	coll := GetCollection("core_strategies")
+	var template models.MongoStrategy
+	raw, err := coll.FindOne(context.TODO(), bson.M{"conditions.templateToken": token, "enabled": true}).DecodeBytes()
+	if err == nil {
+		err = schema.DecodeStrategy(raw, &template)
+	}
+	if err != nil {
+		if err != mongo.ErrNoDocuments {
+			log.Error("get template by token", zap.Error(err))
+		}
+		return nil
+	}
+	sm.Statsd.TimingDuration("state_mgmt.get_template_by_token", time.Since(t1))
+	return &template
+}
+
+// webhookNonceTTL is how long nonces are kept in seconds, well beyond the replay window of signals.
+const webhookNonceTTL = 10 * 60
+
+var webhookNonceIndexOnce sync.Once
+
+// webhookNonceCollection returns webhook nonces collection making sure nonces expire by TTL index on createdAt.
+func webhookNonceCollection() *mongo.Collection {
+	coll := GetCollection("core_webhook_nonces")
+	webhookNonceIndexOnce.Do(func() {
+		_, err := coll.Indexes().CreateOne(context.Background(), mongo.IndexModel{
+			Keys:    bson.D{{Key: "createdAt", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(webhookNonceTTL),
+		})
+		if err != nil {
+			log.Error("can't create webhook nonces index", zap.Error(err))
+		}
+	})
+	return coll
+}
+
+// RegisterWebhookNonce stores the nonce and returns false if it was already stored, i.e. the signal is a replay.
+// Nonces older than the replay window are forgotten by TTL index.
+func (sm *StateMgmt) RegisterWebhookNonce(nonce string) bool {
+	coll := webhookNonceCollection()
+	_, err := coll.InsertOne(context.TODO(), bson.M{"_id": nonce, "createdAt": time.Now()})
+	if mongo.IsDuplicateKeyError(err) {
+		return false
+	}
+	if err != nil {
+		log.Error("register webhook nonce", zap.Error(err))
+		return false // reject rather than risk a duplicate trade
+	}
+	return true
+}
+
+// SaveWebhookEvent appends a received webhook signal to the audit trail.
+func (sm *StateMgmt) SaveWebhookEvent(event models.MongoWebhookEvent) {
+	t1 := time.Now()
+	coll := GetCollection("core_webhook_events")
+	_, err := coll.InsertOne(context.TODO(), event)
+	if err != nil {
+		log.Error("save webhook event", zap.Error(err))
+	}
+	sm.Statsd.TimingDuration("state_mgmt.save_webhook_event", time.Since(t1))
+}
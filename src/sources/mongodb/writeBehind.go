@@ -0,0 +1,286 @@
+package mongodb
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"gitlab.com/crypto_project/core/strategy_service/src/sources/mongodb/models"
+	statsd_client "gitlab.com/crypto_project/core/strategy_service/src/statsd"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+)
+
+// criticalStates are states of smart orders written at once, strategies stop or wait for a user in them.
+var criticalStates = map[string]bool{"End": true, "Error": true, "Canceled": true}
+
+// UseWriteBehind makes state updates to be buffered by the write-behind given, nil to write them at once. Strategies
+// known to the instance are kept up to date with updates it writes.
+func (sm *StateMgmt) UseWriteBehind(wb *WriteBehind) {
+	if wb != nil {
+		wb.OnFlushed(sm.rememberFlushed)
+	}
+	sm.WriteBehind = wb
+}
+
+// Flush writes state updates buffered, e.g. before the instance exits.
+func (sm *StateMgmt) Flush() {
+	if sm.WriteBehind != nil {
+		sm.WriteBehind.Flush()
+	}
+}
+
+// A WriteBehind buffers fields set to strategies and order ids added to them to write them in bulk periodically, a
+// field set again before the flush replaces the value buffered. Writes needed at once, e.g. orders placed, are done
+// by Sync after updates buffered for the strategy are flushed, so they are never overwritten by older values. Writes
+// of a strategy are serialized, writes of different strategies are not.
+type WriteBehind struct {
+	period  time.Duration
+	statsd  *statsd_client.StatsdClient
+	write   func(updates map[primitive.ObjectID]bson.D) error
+	flushed func(strategyId primitive.ObjectID, update bson.D) // called for each strategy written if set
+	pending map[primitive.ObjectID]*pendingUpdate
+	busy    map[primitive.ObjectID]chan struct{} // strategies being written, closed once written
+	mux     sync.Mutex
+}
+
+// A pendingUpdate is an update of a strategy buffered.
+type pendingUpdate struct {
+	set bson.D              // fields to set, in order first set
+	add map[string][]string // ids to add to arrays by field
+}
+
+// NewWriteBehind instantiates a buffer flushed to the storage each period given and starts flushing. Nil is returned
+// for non-positive period, updates are written at once then.
+func NewWriteBehind(period time.Duration, statsd *statsd_client.StatsdClient) *WriteBehind {
+	if period <= 0 {
+		return nil
+	}
+	wb := NewWriteBehindTo(period, statsd, bulkUpdateStrategies)
+	go wb.run()
+	return wb
+}
+
+// NewWriteBehindTo instantiates a buffer writing updates with the function given, it's not flushed until Flush called.
+func NewWriteBehindTo(period time.Duration, statsd *statsd_client.StatsdClient, write func(updates map[primitive.ObjectID]bson.D) error) *WriteBehind {
+	return &WriteBehind{
+		period:  period,
+		statsd:  statsd,
+		write:   write,
+		pending: map[primitive.ObjectID]*pendingUpdate{},
+		busy:    map[primitive.ObjectID]chan struct{}{},
+	}
+}
+
+// OnFlushed sets the function called with the update of each strategy written.
+func (wb *WriteBehind) OnFlushed(flushed func(strategyId primitive.ObjectID, update bson.D)) {
+	wb.flushed = flushed
+}
+
+// Set buffers fields to set to the strategy.
+func (wb *WriteBehind) Set(strategyId *primitive.ObjectID, fields bson.D) {
+	wb.buffer(strategyId, &pendingUpdate{set: fields})
+}
+
+// AddToSet buffers ids to add to the array field of the strategy unless added already.
+func (wb *WriteBehind) AddToSet(strategyId *primitive.ObjectID, field string, ids []string) {
+	wb.buffer(strategyId, &pendingUpdate{add: map[string][]string{field: ids}})
+}
+
+// Write buffers fields to set to the strategy and writes updates buffered for it at once. Updates buffered by writes
+// done meanwhile are written together.
+func (wb *WriteBehind) Write(strategyId *primitive.ObjectID, fields bson.D) {
+	wb.Set(strategyId, fields)
+	wb.Sync(strategyId, func() {})
+}
+
+// Sync flushes updates buffered for the strategy and runs the write given before any other write of the strategy.
+func (wb *WriteBehind) Sync(strategyId *primitive.ObjectID, write func()) {
+	update := wb.lock(*strategyId)
+	defer wb.unlock([]primitive.ObjectID{*strategyId})
+	if update != nil {
+		wb.flush(map[primitive.ObjectID]*pendingUpdate{*strategyId: update})
+	}
+	write()
+}
+
+// Flush writes all the updates buffered, updates of strategies being synced are left for the next flush.
+func (wb *WriteBehind) Flush() {
+	wb.mux.Lock()
+	updates := map[primitive.ObjectID]*pendingUpdate{}
+	strategyIds := make([]primitive.ObjectID, 0, len(wb.pending))
+	for strategyId, update := range wb.pending {
+		if _, ok := wb.busy[strategyId]; ok {
+			continue
+		}
+		updates[strategyId] = update
+		strategyIds = append(strategyIds, strategyId)
+		delete(wb.pending, strategyId)
+		wb.busy[strategyId] = make(chan struct{})
+	}
+	left := len(wb.pending)
+	wb.mux.Unlock()
+	wb.statsd.Gauge("state_mgmt.write_behind.queue_depth", int64(len(updates)+left))
+	if len(updates) > 0 {
+		wb.flush(updates)
+	}
+	wb.unlock(strategyIds)
+}
+
+// buffer merges the update into the one buffered for the strategy.
+func (wb *WriteBehind) buffer(strategyId *primitive.ObjectID, update *pendingUpdate) {
+	wb.mux.Lock()
+	defer wb.mux.Unlock()
+	buffered, ok := wb.pending[*strategyId]
+	if !ok {
+		wb.pending[*strategyId] = update.merge(nil)
+		return
+	}
+	wb.statsd.Inc("state_mgmt.write_behind.coalesced")
+	wb.pending[*strategyId] = buffered.merge(update)
+}
+
+// lock waits for writes of the strategy done and marks it as being written, returning the update buffered for it.
+func (wb *WriteBehind) lock(strategyId primitive.ObjectID) *pendingUpdate {
+	for {
+		wb.mux.Lock()
+		written, ok := wb.busy[strategyId]
+		if !ok {
+			wb.busy[strategyId] = make(chan struct{})
+			update := wb.pending[strategyId]
+			delete(wb.pending, strategyId)
+			wb.mux.Unlock()
+			return update
+		}
+		wb.mux.Unlock()
+		<-written
+	}
+}
+
+// unlock marks the strategies as written.
+func (wb *WriteBehind) unlock(strategyIds []primitive.ObjectID) {
+	wb.mux.Lock()
+	defer wb.mux.Unlock()
+	for _, strategyId := range strategyIds {
+		close(wb.busy[strategyId])
+		delete(wb.busy, strategyId)
+	}
+}
+
+// flush writes the updates given, returning them to the buffer on failure unless newer values are buffered.
+func (wb *WriteBehind) flush(updates map[primitive.ObjectID]*pendingUpdate) {
+	t1 := time.Now()
+	rendered := make(map[primitive.ObjectID]bson.D, len(updates))
+	for strategyId, update := range updates {
+		rendered[strategyId] = update.render()
+	}
+	if err := wb.write(rendered); err != nil {
+		log.Error("write behind flush", zap.Int("strategies", len(updates)), zap.Error(err))
+		wb.statsd.Inc("state_mgmt.write_behind.flush_error")
+		wb.mux.Lock()
+		for strategyId, update := range updates {
+			wb.pending[strategyId] = update.merge(wb.pending[strategyId])
+		}
+		wb.mux.Unlock()
+		return
+	}
+	if wb.flushed != nil {
+		for strategyId, update := range rendered {
+			wb.flushed(strategyId, update)
+		}
+	}
+	wb.statsd.TimingDuration("state_mgmt.write_behind.flush", time.Since(t1))
+}
+
+func (wb *WriteBehind) run() {
+	ticker := time.NewTicker(wb.period)
+	defer ticker.Stop()
+	for range ticker.C {
+		wb.Flush()
+	}
+}
+
+// merge returns the update with the newer one given merged, newer values of fields win. Ids added to a field set are
+// added to the value set.
+func (p *pendingUpdate) merge(newer *pendingUpdate) *pendingUpdate {
+	merged := &pendingUpdate{set: append(bson.D{}, p.set...), add: map[string][]string{}}
+	for field, ids := range p.add {
+		merged.add[field] = ids
+	}
+	if newer == nil {
+		return merged
+	}
+	merged.set = mergeFields(merged.set, newer.set)
+	for _, field := range newer.set {
+		delete(merged.add, field.Key)
+	}
+	for field, ids := range newer.add {
+		added := false
+		for i := range merged.set {
+			if set, ok := merged.set[i].Value.([]string); ok && merged.set[i].Key == field {
+				merged.set[i].Value = models.UnionIds(set, ids)
+				added = true
+			}
+		}
+		if !added {
+			merged.add[field] = models.UnionIds(merged.add[field], ids)
+		}
+	}
+	return merged
+}
+
+// render returns the update as $set and $addToSet operators.
+func (p *pendingUpdate) render() bson.D {
+	update := bson.D{}
+	if len(p.set) > 0 {
+		update = append(update, bson.E{Key: "$set", Value: p.set})
+	}
+	if len(p.add) > 0 {
+		fields := make([]string, 0, len(p.add))
+		for field := range p.add {
+			fields = append(fields, field)
+		}
+		sort.Strings(fields)
+		add := bson.D{}
+		for _, field := range fields {
+			add = append(add, bson.E{Key: field, Value: bson.D{{Key: "$each", Value: p.add[field]}}})
+		}
+		update = append(update, bson.E{Key: "$addToSet", Value: add})
+	}
+	return update
+}
+
+// mergeFields returns fields set with the newer ones given, replacing values of the same fields in place.
+func mergeFields(fields bson.D, newer bson.D) bson.D {
+	merged := append(bson.D{}, fields...)
+	for _, field := range newer {
+		replaced := false
+		for i := range merged {
+			if merged[i].Key == field.Key {
+				merged[i].Value = field.Value
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			merged = append(merged, field)
+		}
+	}
+	return merged
+}
+
+// bulkUpdateStrategies updates strategies in a single unordered bulk write incrementing their versions.
+func bulkUpdateStrategies(updates map[primitive.ObjectID]bson.D) error {
+	writes := make([]mongo.WriteModel, 0, len(updates))
+	for strategyId, update := range updates {
+		writes = append(writes, mongo.NewUpdateOneModel().
+			SetFilter(bson.D{{Key: "_id", Value: strategyId}}).
+			SetUpdate(withVersionInc(update)))
+	}
+	_, err := GetCollection("core_strategies").BulkWrite(context.TODO(), writes, options.BulkWrite().SetOrdered(false))
+	return err
+}
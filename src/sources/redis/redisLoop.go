@@ -5,22 +5,28 @@ import (
 	"encoding/json"
 	"fmt"
 	"gitlab.com/crypto_project/core/strategy_service/src/service/interfaces"
+	"gitlab.com/crypto_project/core/strategy_service/src/sources/candles"
 	"go.uber.org/zap"
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 )
 
 type RedisLoop struct {
 	OhlcvMap  sync.Map // <string: exchange+pair+o/h/l/c/v, OHLCV: ohlcv>
 	SpreadMap sync.Map
+	Candles   *candles.History
 }
 
+// candleHistorySize is a count of bars kept per pair and timeframe.
+const candleHistorySize = 500
+
 var redisLoop *RedisLoop
 
 func InitRedis() interfaces.IDataFeed {
 	if redisLoop == nil {
-		redisLoop = &RedisLoop{}
+		redisLoop = &RedisLoop{Candles: candles.NewHistory(candleHistorySize)}
 		redisLoop.SubscribeToPairs()
 	}
 
@@ -29,7 +35,7 @@ func InitRedis() interfaces.IDataFeed {
 
 func (rl *RedisLoop) GetPriceForPairAtExchange(pair string, exchange string, marketType int64) *interfaces.OHLCV {
 	if redisLoop == nil {
-		redisLoop = &RedisLoop{}
+		redisLoop = &RedisLoop{Candles: candles.NewHistory(candleHistorySize)}
 		redisLoop.SubscribeToPairs()
 	}
 	return redisLoop.GetPrice(pair, exchange, marketType)
@@ -37,12 +43,33 @@ func (rl *RedisLoop) GetPriceForPairAtExchange(pair string, exchange string, mar
 
 func (rl *RedisLoop) GetSpreadForPairAtExchange(pair string, exchange string, marketType int64) *interfaces.SpreadData {
 	if redisLoop == nil {
-		redisLoop = &RedisLoop{}
+		redisLoop = &RedisLoop{Candles: candles.NewHistory(candleHistorySize)}
 		redisLoop.SubscribeToPairs()
 	}
 	return redisLoop.GetSpread(pair, exchange, marketType)
 }
 
+// GetFundingForPairAtExchange returns nil, no perpetual futures are traded at the exchanges the loop serves.
+func (rl *RedisLoop) GetFundingForPairAtExchange(pair string, exchange string) *interfaces.FundingData {
+	return nil
+}
+
+// GetCandles returns up to n last closed candles of the timeframe oldest first. History is recorded since the pair
+// strategy loaded or the first request of the pair, so it may have less candles than requested.
+func (rl *RedisLoop) GetCandles(pair string, exchange string, marketType int64, timeframe string, n int) []interfaces.Candle {
+	rl.RecordCandles(pair, exchange, marketType)
+	return redisLoop.Candles.Get(exchange+pair+strconv.FormatInt(marketType, 10), timeframe, n)
+}
+
+// RecordCandles starts recording candles of the pair, there is no history to backfill from.
+func (rl *RedisLoop) RecordCandles(pair string, exchange string, marketType int64) {
+	if redisLoop == nil {
+		redisLoop = &RedisLoop{Candles: candles.NewHistory(candleHistorySize)}
+		redisLoop.SubscribeToPairs()
+	}
+	redisLoop.Candles.Watch(exchange + pair + strconv.FormatInt(marketType, 10))
+}
+
 type OrderbookOHLCV struct {
 	Open       float64 `json:"open_price,float"`
 	High       float64 `json:"high_price,float"`
@@ -64,7 +91,13 @@ type Spread struct {
 	MarketType   int64   `json:"marketType"`
 }
 
+// SubscribeToPairs subscribes to serum bars of each timeframe candles are kept for, bars are published per timeframe
+// as pair:marketType:exchange:seconds, e.g. SRM_USDC:0:serum:300.
 func (rl *RedisLoop) SubscribeToPairs() {
+	channels := make([]string, 0, len(candles.Timeframes))
+	for _, period := range candles.Timeframes {
+		channels = append(channels, "*:0:serum:"+strconv.FormatInt(period, 10))
+	}
 	go ListenPubSubChannels(context.TODO(), func() error {
 		return nil
 	}, func(channel string, data []byte) error {
@@ -74,10 +107,25 @@ func (rl *RedisLoop) SubscribeToPairs() {
 		}
 		go rl.UpdateOHLCV(channel, data)
 		return nil
-	}, "*:0:serum:60")
+	}, channels...)
 	rl.SubscribeToSpread()
 }
 
+// timeframeOf returns candles timeframe of the bars channel, empty if the channel has no timeframe supported.
+func timeframeOf(channel string) string {
+	parts := strings.Split(channel, ":")
+	period, err := strconv.ParseInt(parts[len(parts)-1], 10, 64)
+	if err != nil {
+		return ""
+	}
+	for timeframe, seconds := range candles.Timeframes {
+		if seconds == period {
+			return timeframe
+		}
+	}
+	return ""
+}
+
 func (rl *RedisLoop) UpdateOHLCV(channel string, data []byte) {
 	var ohlcvOB OrderbookOHLCV
 	_ = json.Unmarshal(data, &ohlcvOB)
@@ -90,8 +138,13 @@ func (rl *RedisLoop) UpdateOHLCV(channel string, data []byte) {
 		Close:  ohlcvOB.Close,
 		Volume: ohlcvOB.Volume,
 	}
-	rl.OhlcvMap.Store(exchange+pair+strconv.FormatInt(ohlcvOB.MarketType, 10), ohlcv)
-
+	key := exchange + pair + strconv.FormatInt(ohlcvOB.MarketType, 10)
+	timeframe := timeframeOf(channel)
+	if timeframe == "1m" {
+		rl.OhlcvMap.Store(key, ohlcv)
+	}
+	// the message is a bar of the channel timeframe updated in place
+	rl.Candles.UpdateBar(key, timeframe, ohlcv, time.Now().Unix())
 }
 func (rl *RedisLoop) FillPair(pair, exchange string) *interfaces.OHLCV {
 	redisClient := GetRedisClientInstance(false, true, false)
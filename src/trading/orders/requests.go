@@ -6,6 +6,9 @@ import (
 
 type CreateOrderRequest struct {
 	KeyId     *primitive.ObjectID `json:"keyId"`
+	OwnerId   *primitive.ObjectID `json:"ownerId,omitempty"` // user the strategy created for, quotas of the owner apply
+	ParentId  *primitive.ObjectID `json:"-"`                 // strategy placing the order, set by runtimes only
+	Exit      bool                `json:"-"`                 // order closing or protecting a position, set by runtimes only
 	KeyParams Order               `json:"keyParams"`
 }
 
@@ -17,6 +20,7 @@ type CancelOrderRequestParams struct {
 
 type CancelOrderRequest struct {
 	KeyId     *primitive.ObjectID      `json:"keyId"`
+	OwnerId   *primitive.ObjectID      `json:"ownerId,omitempty"` // user requesting, only the strategy owner may cancel
 	KeyParams CancelOrderRequestParams `json:"keyParams"`
 }
 
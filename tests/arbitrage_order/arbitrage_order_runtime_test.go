@@ -0,0 +1,125 @@
+package arbitrage_order
+
+import (
+	"testing"
+	"time"
+
+	"github.com/go-redsync/redsync/v4"
+	"gitlab.com/crypto_project/core/strategy_service/src/service/strategies"
+	"gitlab.com/crypto_project/core/strategy_service/src/service/strategies/arbitrage_order"
+	"gitlab.com/crypto_project/core/strategy_service/src/sources/memory"
+	"gitlab.com/crypto_project/core/strategy_service/src/sources/mongodb/models"
+	"gitlab.com/crypto_project/core/strategy_service/tests"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// newArbitrageOrder returns arbitrage order of 1 BTC between binance and serum trading with the mock.
+func newArbitrageOrder() (*arbitrage_order.ArbitrageOrder, *tests.MockLegsTrading) {
+	id := primitive.NewObjectID()
+	model := &models.MongoStrategy{
+		ID:      &id,
+		Enabled: true,
+		Conditions: &models.MongoStrategyCondition{
+			Pair:            "BTC_USDT",
+			Exchange:        "binance",
+			ContinueIfEnded: true,
+			Arbitrage: &models.MongoArbitrageConditions{
+				SecondExchange:     "serum",
+				Amount:             1,
+				MinProfit:          0.002,
+				MaxInventory:       5,
+				SecondMaxInventory: 5,
+				LegTimeout:         1,
+			},
+		},
+		State: &models.MongoStrategyState{},
+	}
+	sm := memory.NewStateMgmt()
+	sm.SetMarketPrecision("BTC_USDT", 0, 2, 3)
+	sm.CreateStrategy(model)
+	trading := tests.NewMockedLegsTrading(sm)
+	keyId := primitive.NewObjectID()
+	logger, stats := tests.GetLoggerStatsd()
+	strategy := strategies.Strategy{
+		Model:           model,
+		StateMgmt:       sm,
+		Log:             logger,
+		Statsd:          stats,
+		SettlementMutex: &redsync.Mutex{},
+	}
+	return arbitrage_order.New(&strategy, tests.NewMockedDataFeed(nil), trading, stats, &keyId, sm), trading
+}
+
+var opportunity = arbitrage_order.Opportunity{
+	BuyExchange:  "serum",
+	SellExchange: "binance",
+	BuyPrice:     30000,
+	SellPrice:    30150,
+	Profit:       0.005,
+}
+
+func spread(ao *arbitrage_order.ArbitrageOrder, opportunity arbitrage_order.Opportunity) {
+	ao.Lock()
+	defer ao.Unlock()
+	_ = ao.State.Fire(arbitrage_order.TriggerSpread, opportunity)
+}
+
+func currentState(ao *arbitrage_order.ArbitrageOrder) string {
+	ao.Lock()
+	defer ao.Unlock()
+	return ao.CurrentState()
+}
+
+// arbitrage order should buy at the cheap exchange, sell at the expensive one and account inventories
+func TestArbitrageOrderRound(t *testing.T) {
+	ao, trading := newArbitrageOrder()
+	spread(ao, arbitrage_order.Opportunity{BuyExchange: "serum", SellExchange: "binance", Profit: 0.001})
+	if currentState(ao) != arbitrage_order.WaitForSpread {
+		t.Fatal("arbitrage order shouldn't trade below min profit")
+	}
+
+	spread(ao, opportunity)
+	placed := trading.Orders()
+	if currentState(ao) != arbitrage_order.WaitLegs || len(placed) != 2 {
+		t.Fatal("arbitrage order should place both legs", currentState(ao), len(placed))
+	}
+	if placed[0].KeyParams.Side != "buy" || placed[1].KeyParams.Side != "sell" {
+		t.Error("cheap exchange should be bought and expensive one sold", placed)
+	}
+	trading.Fill(trading.OrderId(1), 1, 30000)
+	trading.Fill(trading.OrderId(2), 1, 30150)
+	if !tests.WaitFor(3*time.Second, func() bool {
+		ao.Lock()
+		defer ao.Unlock()
+		return ao.Strategy.GetModel().State.Iteration == 1
+	}) {
+		t.Fatal("arbitrage round should be done")
+	}
+
+	ao.Lock()
+	defer ao.Unlock()
+	state := ao.Strategy.GetModel().State
+	if ao.CurrentState() != arbitrage_order.WaitForSpread || state.ReceivedProfitAmount != 150 {
+		t.Error("arbitrage order should account profit and wait for spread again", ao.CurrentState(), state.ReceivedProfitAmount)
+	}
+	if state.Inventories["serum"] != 1 || state.Inventories["binance"] != -1 {
+		t.Error("inventories should be moved by the amount traded", state.Inventories)
+	}
+}
+
+// arbitrage order should cancel the leg not filled in time and unwind the other one without reduce-only
+func TestArbitrageOrderLegTimeout(t *testing.T) {
+	ao, trading := newArbitrageOrder()
+	spread(ao, opportunity)
+	trading.Fill(trading.OrderId(2), 1, 30150)
+	if !tests.WaitFor(3*time.Second, func() bool { return len(trading.Orders()) == 3 }) {
+		t.Fatal("sold leg should be unwound after the timeout", trading.Canceled)
+	}
+	unwind := trading.Orders()[2].KeyParams
+	if unwind.Side != "buy" || unwind.Amount != 1 || *unwind.ReduceOnly {
+		t.Error("sold leg should be bought back at spot", unwind)
+	}
+	if currentState(ao) != arbitrage_order.WaitForSpread {
+		t.Error("arbitrage order should wait for spread again", currentState(ao))
+	}
+}
@@ -0,0 +1,38 @@
+package arbitrage_order
+
+import (
+	"math"
+	"testing"
+
+	"gitlab.com/crypto_project/core/strategy_service/src/service/interfaces"
+	"gitlab.com/crypto_project/core/strategy_service/src/service/strategies/arbitrage_order"
+)
+
+func TestArbitrageFindOpportunity(t *testing.T) {
+	binance := &interfaces.SpreadData{BestBid: 99.9, BestAsk: 100}
+	serum := &interfaces.SpreadData{BestBid: 101, BestAsk: 101.2}
+	opportunity := arbitrage_order.FindOpportunity("binance", binance, 0.001, "serum", serum, 0.002)
+	if opportunity == nil || opportunity.BuyExchange != "binance" || opportunity.SellExchange != "serum" {
+		t.Fatalf("should buy at binance and sell at serum %+v", opportunity)
+	}
+	expected := (101*0.998 - 100*1.001) / (100 * 1.001)
+	if math.Abs(opportunity.Profit-expected) > 1e-12 {
+		t.Error("wrong profit net of fees", opportunity.Profit, expected)
+	}
+
+	if arbitrage_order.FindOpportunity("binance", binance, 0, "serum", &interfaces.SpreadData{}, 0) != nil {
+		t.Error("empty orderbook shouldn't give an opportunity")
+	}
+}
+
+func TestArbitrageInventoryLimits(t *testing.T) {
+	if !arbitrage_order.WithinInventory(0.5, 0.5, 1) || arbitrage_order.WithinInventory(0.8, 0.5, 1) {
+		t.Error("inventory limit not applied")
+	}
+	if !arbitrage_order.WithinInventory(1.5, -0.2, 1) {
+		t.Error("reducing inventory over limit should be allowed")
+	}
+	if !arbitrage_order.WithinInventory(100, 1, 0) {
+		t.Error("zero limit means no limit")
+	}
+}
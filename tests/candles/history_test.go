@@ -0,0 +1,166 @@
+package candles
+
+import (
+	"testing"
+	"time"
+
+	"gitlab.com/crypto_project/core/strategy_service/src/service/interfaces"
+	"gitlab.com/crypto_project/core/strategy_service/src/sources/binance"
+	"gitlab.com/crypto_project/core/strategy_service/src/sources/candles"
+	"gitlab.com/crypto_project/core/strategy_service/src/sources/redis"
+)
+
+func tick(price float64) interfaces.OHLCV {
+	return interfaces.OHLCV{High: price, Low: price, Close: price, Volume: 1}
+}
+
+func TestHistoryRecordsWatchedKeys(t *testing.T) {
+	history := candles.NewHistory(1)
+	history.Update("BTCUSDT", tick(100), 0)
+	history.Watch("ETHUSDT")
+	for i, price := range []float64{10, 12, 9, 11, 20, 21} {
+		history.Update("ETHUSDT", tick(price), int64(i*30))
+	}
+	if bars := history.Get("BTCUSDT", "1m", 10); len(bars) != 0 {
+		t.Error("not watched key shouldn't be recorded", bars)
+	}
+	bars := history.Get("ETHUSDT", "1m", 10)
+	if len(bars) != 1 {
+		t.Fatal("only closed bars within size expected", bars)
+	}
+	if bars[0].Timestamp != 60 || bars[0].Open != 9 || bars[0].High != 11 || bars[0].Close != 11 || bars[0].Volume != 2 {
+		t.Errorf("wrong bar %+v", bars[0])
+	}
+	if history.Get("ETHUSDT", "2m", 10) != nil {
+		t.Error("unknown timeframe should give nil")
+	}
+}
+
+func TestHistoryBackfill(t *testing.T) {
+	history := candles.NewHistory(10)
+	if !history.Watch("ETHUSDT") || history.Watch("ETHUSDT") {
+		t.Error("watch should tell if recording started")
+	}
+	history.Update("ETHUSDT", tick(12), 120)
+	history.Update("ETHUSDT", tick(13), 180)
+	history.Backfill("ETHUSDT", "1m", []interfaces.Candle{
+		{Timestamp: 0, Close: 10},
+		{Timestamp: 60, Close: 11},
+		{Timestamp: 120, Close: 100}, // recorded already
+	})
+	bars := history.Get("ETHUSDT", "1m", 10)
+	if len(bars) != 3 || bars[0].Timestamp != 0 || bars[1].Timestamp != 60 || bars[2].Timestamp != 120 || bars[2].Close != 12 {
+		t.Fatalf("backfilled bars should precede recorded ones %+v", bars)
+	}
+	history.Backfill("BTCUSDT", "1m", []interfaces.Candle{{Timestamp: 0}})
+	if bars := history.Get("BTCUSDT", "1m", 10); len(bars) != 0 {
+		t.Error("not watched key shouldn't be backfilled", bars)
+	}
+}
+
+func TestHistoryUpdateBar(t *testing.T) {
+	history := candles.NewHistory(10)
+	history.Watch("SRMUSDC")
+	history.UpdateBar("SRMUSDC", "5m", interfaces.OHLCV{Open: 1, High: 2, Low: 1, Close: 1.5, Volume: 10}, 300)
+	history.UpdateBar("SRMUSDC", "5m", interfaces.OHLCV{Open: 1, High: 3, Low: 1, Close: 2, Volume: 40}, 420)
+	history.UpdateBar("SRMUSDC", "5m", interfaces.OHLCV{Open: 2, High: 2, Low: 2, Close: 2, Volume: 1}, 600)
+	history.UpdateBar("SRMUSDC", "5m", interfaces.OHLCV{Open: 1, High: 9, Low: 1, Close: 9, Volume: 90}, 599)
+	bars := history.Get("SRMUSDC", "5m", 10)
+	if len(bars) != 1 {
+		t.Fatal("the bar should be closed by the next period bar", bars)
+	}
+	if bar := bars[0]; bar.Timestamp != 300 || bar.High != 3 || bar.Close != 2 || bar.Volume != 40 {
+		t.Errorf("the bar should be the last one of its period %+v", bar)
+	}
+	if bars := history.Get("SRMUSDC", "1m", 10); len(bars) != 0 {
+		t.Error("bars shouldn't be aggregated to other timeframes", bars)
+	}
+}
+
+func TestBinanceTickVolume(t *testing.T) {
+	loop := binance.BinanceLoop{Candles: candles.NewHistory(10)}
+	volume := func() float64 {
+		return loop.GetPrice("BTC_USDT", "binance", 0).Volume
+	}
+	loop.UpdateOHLCV([]byte(`[{"s":"BTCUSDT","c":"30000","v":"1000"}]`), 0)
+	if volume() != 0 {
+		t.Error("the first ticker has no volume to compare with", volume())
+	}
+	loop.UpdateOHLCV([]byte(`[{"s":"BTCUSDT","c":"30010","v":"1002.5"}]`), 0)
+	if volume() != 2.5 {
+		t.Error("tick volume should be 24h volume change", volume())
+	}
+	loop.UpdateOHLCV([]byte(`[{"s":"BTCUSDT","c":"30020","v":"990"}]`), 0)
+	if volume() != 0 {
+		t.Error("volume leaving 24h window shouldn't make tick volume negative", volume())
+	}
+}
+
+func TestRedisBarsByChannel(t *testing.T) {
+	loop := redis.RedisLoop{Candles: candles.NewHistory(10)}
+	bar := []byte(`{"open_price":1,"high_price":2,"low_price":1,"close_price":1.5,"volume":10,"market_type":0,"fsym":"SRM","tsym":"USDC"}`)
+	loop.UpdateOHLCV("SRM_USDC:0:serum:300", bar)
+	if loop.GetPrice("SRM_USDC", "serum", 0) != nil {
+		t.Error("price should be taken from minute bars only")
+	}
+	loop.UpdateOHLCV("SRM_USDC:0:serum:60", bar)
+	if price := loop.GetPrice("SRM_USDC", "serum", 0); price == nil || price.Close != 1.5 || price.Volume != 10 {
+		t.Error("minute bar should give price", price)
+	}
+}
+
+func TestParseKlines(t *testing.T) {
+	data := []byte(`[
+		[60000, "10.5", "12", "10", "11", "3.5", 119999, "38", 10, "1", "11", "0"],
+		[120000, "11", "13", "11", "12", "1", 179999, "12", 2, "0", "0", "0"]
+	]`)
+	bars, err := binance.ParseKlines(data, time.Unix(150, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bars) != 1 {
+		t.Fatal("kline not closed yet should be skipped", bars)
+	}
+	if bar := bars[0]; bar.Timestamp != 60 || bar.Open != 10.5 || bar.High != 12 || bar.Low != 10 || bar.Close != 11 || bar.Volume != 3.5 {
+		t.Errorf("wrong bar %+v", bar)
+	}
+	if _, err := binance.ParseKlines([]byte(`[[60000, 10.5]]`), time.Unix(150, 0)); err == nil {
+		t.Error("malformed kline should be rejected")
+	}
+}
+
+func TestHistoryTimeframes(t *testing.T) {
+	history := candles.NewHistory(100)
+	history.Watch("ETHUSDT")
+	for minute := int64(0); minute <= 11; minute++ {
+		history.Update("ETHUSDT", tick(float64(100+minute)), minute*60)
+	}
+	if bars := history.Get("ETHUSDT", "1m", 100); len(bars) != 11 {
+		t.Error("wrong count of minute bars", len(bars))
+	}
+	// the third 5m bar is not closed yet
+	bars := history.Get("ETHUSDT", "5m", 10)
+	if len(bars) != 2 {
+		t.Fatal("only closed 5m bars expected", bars)
+	}
+	if bars[1].Timestamp != 300 || bars[1].Open != 105 || bars[1].High != 109 || bars[1].Low != 105 || bars[1].Close != 109 {
+		t.Errorf("wrong 5m bar %+v", bars[1])
+	}
+	if bars := history.Get("ETHUSDT", "1h", 10); len(bars) != 0 {
+		t.Error("hour bar is not closed yet", bars)
+	}
+}
+
+func TestRing(t *testing.T) {
+	ring := candles.NewRing(3)
+	for i := int64(1); i <= 5; i++ {
+		ring.Push(interfaces.Candle{Timestamp: i})
+	}
+	last := ring.Last(10)
+	if ring.Len() != 3 || len(last) != 3 || last[0].Timestamp != 3 || last[2].Timestamp != 5 {
+		t.Errorf("ring should keep the last candles oldest first %+v", last)
+	}
+	if last := ring.Last(2); last[0].Timestamp != 4 {
+		t.Errorf("wrong last candles %+v", last)
+	}
+}
@@ -0,0 +1,269 @@
+package copytrading
+
+import (
+	"math"
+	"testing"
+
+	"gitlab.com/crypto_project/core/strategy_service/src/service/copytrading"
+	"gitlab.com/crypto_project/core/strategy_service/src/sources/mongodb/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// mockStore keeps strategies and balances in memory and records divergences saved.
+type mockStore struct {
+	strategies  map[primitive.ObjectID]*models.MongoStrategy
+	divergences map[primitive.ObjectID]models.MongoCopyDivergence
+	balances    map[primitive.ObjectID]map[string]float64
+}
+
+func newMockStore() *mockStore {
+	return &mockStore{
+		strategies:  map[primitive.ObjectID]*models.MongoStrategy{},
+		divergences: map[primitive.ObjectID]models.MongoCopyDivergence{},
+		balances:    map[primitive.ObjectID]map[string]float64{},
+	}
+}
+
+func (s *mockStore) GetEnabledCopyTradings() []models.MongoCopyTrading { return nil }
+
+func (s *mockStore) GetFollowerStrategies(leaderStrategyId *primitive.ObjectID) []models.MongoStrategy {
+	var followers []models.MongoStrategy
+	for _, strategy := range s.strategies {
+		if strategy.Conditions.LeaderStrategyId != nil && *strategy.Conditions.LeaderStrategyId == *leaderStrategyId {
+			followers = append(followers, *strategy)
+		}
+	}
+	return followers
+}
+
+func (s *mockStore) GetStrategy(strategyId *primitive.ObjectID) *models.MongoStrategy {
+	return s.strategies[*strategyId]
+}
+
+func (s *mockStore) CreateStrategy(strategy *models.MongoStrategy) *models.MongoStrategy {
+	s.strategies[*strategy.ID] = strategy
+	return strategy
+}
+
+func (s *mockStore) UpdateConditions(strategyId *primitive.ObjectID, conditions *models.MongoStrategyCondition) {
+	s.strategies[*strategyId].Conditions = conditions
+}
+
+func (s *mockStore) UpdateState(strategyId *primitive.ObjectID, state *models.MongoStrategyState) {
+	s.strategies[*strategyId].State.State = state.State
+}
+
+func (s *mockStore) EnableStrategy(strategyId *primitive.ObjectID) {
+	s.strategies[*strategyId].Enabled = true
+}
+
+func (s *mockStore) DisableStrategy(strategyId *primitive.ObjectID) {
+	s.strategies[*strategyId].Enabled = false
+}
+
+func (s *mockStore) SaveCopyDivergence(divergence models.MongoCopyDivergence) {
+	s.divergences[*divergence.FollowerStrategyId] = divergence
+}
+
+func (s *mockStore) GetKeyBalances(keyId *primitive.ObjectID) map[string]float64 {
+	return s.balances[*keyId]
+}
+
+func getLeaderStrategy(accountId primitive.ObjectID) *models.MongoStrategy {
+	id := primitive.NewObjectID()
+	hedgeKeyId := primitive.NewObjectID()
+	return &models.MongoStrategy{
+		ID:        &id,
+		Type:      1,
+		Enabled:   true,
+		AccountId: &accountId,
+		Conditions: &models.MongoStrategyCondition{
+			AccountId:  &accountId,
+			Pair:       "BTC_USDT",
+			MarketType: 1,
+			Leverage:   20,
+			Hedging:    true,
+			HedgeKeyId: &hedgeKeyId,
+			EntryOrder: &models.MongoEntryPoint{Side: "buy", Amount: 0.1, OrderType: "market"},
+			EntryLevels: []*models.MongoEntryPoint{
+				{Type: 0, Price: 6900, Amount: 0.05},
+				{Type: 1, Price: 2, Amount: 50},
+			},
+			ExitLevels: []*models.MongoEntryPoint{{Type: 1, Price: 5, Amount: 100, OrderType: "limit"}},
+		},
+		State: &models.MongoStrategyState{},
+	}
+}
+
+func TestCopyTradingScale(t *testing.T) {
+	if scale := copytrading.Scale(&models.MongoFollower{ScaleByEquity: true, Multiplier: 3}, 10000, 2500); scale != 0.25 {
+		t.Error("follower should be scaled by equity ratio", scale)
+	}
+	if scale := copytrading.Scale(&models.MongoFollower{ScaleByEquity: true, Multiplier: 3}, 10000, 0); scale != 3 {
+		t.Error("follower with equity unknown should be scaled by multiplier", scale)
+	}
+	if scale := copytrading.Scale(&models.MongoFollower{}, 10000, 2500); scale != 1 {
+		t.Error("follower should copy as is by default", scale)
+	}
+}
+
+func TestCopyTradingClone(t *testing.T) {
+	leader := getLeaderStrategy(primitive.NewObjectID())
+	leader.OwnerId = primitive.NewObjectID()
+	keyId, ownerId := primitive.NewObjectID(), primitive.NewObjectID()
+	follower, err := copytrading.Clone(leader, &models.MongoFollower{KeyId: keyId, OwnerId: ownerId}, 0.5)
+	if err != nil {
+		t.Fatal("clone failed", err)
+	}
+	conditions := follower.Conditions
+	if *follower.AccountId != keyId || *conditions.AccountId != keyId || conditions.LeaderStrategyId != leader.ID {
+		t.Error("copy should belong to the follower and link to the leader")
+	}
+	if follower.OwnerId != ownerId {
+		t.Error("copy should be owned by the follower owner", follower.OwnerId.Hex())
+	}
+	if math.Abs(conditions.EntryOrder.Amount-0.05) > 1e-9 || math.Abs(conditions.EntryLevels[0].Amount-0.025) > 1e-9 {
+		t.Error("absolute amounts should be scaled", conditions.EntryOrder.Amount, conditions.EntryLevels[0].Amount)
+	}
+	if conditions.EntryLevels[1].Amount != 50 || conditions.ExitLevels[0].Amount != 100 {
+		t.Error("amounts in percents shouldn't be scaled")
+	}
+	if conditions.Hedging || conditions.HedgeKeyId != nil {
+		t.Error("leader hedging shouldn't be copied")
+	}
+	if leader.Conditions.EntryOrder.Amount != 0.1 || leader.Conditions.EntryLevels[0].Amount != 0.05 || !leader.Conditions.Hedging {
+		t.Error("leader conditions changed")
+	}
+}
+
+// engine should copy a new leader strategy to enabled followers only and propagate edits, pauses and cancels
+func TestCopyTradingPropagation(t *testing.T) {
+	leaderAccountId := primitive.NewObjectID()
+	followerKeyId, followerOwnerId := primitive.NewObjectID(), primitive.NewObjectID()
+	store := newMockStore()
+	engine := copytrading.NewEngine(store)
+	engine.SetCopyTradings([]models.MongoCopyTrading{{
+		Enabled:         true,
+		LeaderAccountId: leaderAccountId,
+		Followers: []*models.MongoFollower{
+			{KeyId: followerKeyId, OwnerId: followerOwnerId, Enabled: true, Multiplier: 2},
+			{KeyId: primitive.NewObjectID()},
+		},
+	}})
+	leader := getLeaderStrategy(leaderAccountId)
+	store.CreateStrategy(leader)
+	engine.OnStrategyUpdate(leader, true)
+	engine.OnStrategyUpdate(leader, true) // duplicate event shouldn't copy twice
+
+	followers := store.GetFollowerStrategies(leader.ID)
+	if len(followers) != 1 || *followers[0].AccountId != followerKeyId {
+		t.Fatal("leader strategy should be copied to enabled follower once, copies", len(followers))
+	}
+	follower := store.GetStrategy(followers[0].ID)
+	if follower.Conditions.EntryOrder.Amount != 0.2 {
+		t.Error("copy should be scaled by multiplier", follower.Conditions.EntryOrder.Amount)
+	}
+	if follower.OwnerId != followerOwnerId {
+		t.Error("copy should be owned by the follower owner", follower.OwnerId.Hex())
+	}
+
+	edited := *leader
+	conditions := *leader.Conditions
+	conditions.StopLoss = 3
+	edited.Conditions = &conditions
+	edited.Enabled = false
+	engine.OnStrategyUpdate(&edited, false)
+	if follower.Conditions.StopLoss != 3 || follower.Conditions.EntryOrder.Amount != 0.2 {
+		t.Error("leader edit should be propagated with amounts scaled", follower.Conditions.StopLoss, follower.Conditions.EntryOrder.Amount)
+	}
+	if follower.Enabled {
+		t.Error("leader pause should be propagated")
+	}
+
+	edited.Enabled = true
+	engine.OnStrategyUpdate(&edited, false)
+	if !follower.Enabled {
+		t.Error("leader resume should be propagated")
+	}
+
+	follower.State.EntryPrice = 7010
+	edited.Enabled = false
+	edited.State = &models.MongoStrategyState{State: "Canceled"}
+	engine.OnStrategyUpdate(&edited, false)
+	if follower.Enabled || follower.State.State != "Canceled" {
+		t.Error("leader cancel should be propagated", follower.State.State)
+	}
+	if follower.State.EntryPrice != 7010 {
+		t.Error("copy state other than the state itself shouldn't be changed", follower.State.EntryPrice)
+	}
+}
+
+// followers scaled by equity should be scaled by free balances in the quote asset, by equities configured if unknown
+func TestCopyTradingScaleByBalances(t *testing.T) {
+	leaderAccountId := primitive.NewObjectID()
+	followerKeyId := primitive.NewObjectID()
+	configuredKeyId := primitive.NewObjectID()
+	store := newMockStore()
+	store.balances[leaderAccountId] = map[string]float64{"USDT": 8000, "BTC": 1}
+	store.balances[followerKeyId] = map[string]float64{"USDT": 2000}
+	engine := copytrading.NewEngine(store)
+	engine.SetCopyTradings([]models.MongoCopyTrading{{
+		Enabled:         true,
+		LeaderAccountId: leaderAccountId,
+		LeaderEquity:    4000,
+		Followers: []*models.MongoFollower{
+			{KeyId: followerKeyId, Enabled: true, ScaleByEquity: true, Equity: 8000},
+			{KeyId: configuredKeyId, Enabled: true, ScaleByEquity: true, Equity: 4000},
+		},
+	}})
+	leader := getLeaderStrategy(leaderAccountId)
+	store.CreateStrategy(leader)
+	engine.OnStrategyUpdate(leader, true)
+
+	for _, follower := range store.GetFollowerStrategies(leader.ID) {
+		switch *follower.AccountId {
+		case followerKeyId:
+			if follower.Conditions.CopyScale != 0.25 {
+				t.Error("copy should be scaled by balances", follower.Conditions.CopyScale)
+			}
+		case configuredKeyId:
+			if follower.Conditions.CopyScale != 0.5 {
+				t.Error("copy should be scaled by equity configured if balance unknown", follower.Conditions.CopyScale)
+			}
+		}
+	}
+}
+
+// divergence should compare fills and profit of the copy with the leader regardless of scale
+func TestCopyTradingDivergence(t *testing.T) {
+	leader := getLeaderStrategy(primitive.NewObjectID())
+	leader.Conditions.EntryOrder.Side = "sell"
+	leader.State = &models.MongoStrategyState{
+		State:                    "End",
+		EntryPrice:               7000,
+		ExecutedAmount:           0.1,
+		ReceivedProfitAmount:     10,
+		ReceivedProfitPercentage: 28,
+	}
+	follower, _ := copytrading.Clone(leader, &models.MongoFollower{KeyId: primitive.NewObjectID()}, 2)
+	follower.State = &models.MongoStrategyState{
+		State:                    "TakeProfit",
+		EntryPrice:               6993,
+		ExecutedAmount:           0.1,
+		ReceivedProfitAmount:     9,
+		ReceivedProfitPercentage: 13,
+	}
+	divergence := copytrading.Divergence(leader, follower)
+	if math.Abs(divergence.EntrySlippage-0.1) > 1e-9 {
+		t.Error("lower short entry should be a positive slippage", divergence.EntrySlippage)
+	}
+	if math.Abs(divergence.ExitedDivergence+50) > 1e-9 {
+		t.Error("copy exited half of position less", divergence.ExitedDivergence)
+	}
+	if divergence.ProfitDivergence != -15 || divergence.LeaderProfit != 10 || divergence.FollowerProfit != 9 {
+		t.Errorf("wrong profit divergence %+v", divergence)
+	}
+	if divergence.Scale != 2 || divergence.LeaderState != "End" || divergence.FollowerState != "TakeProfit" {
+		t.Errorf("wrong divergence %+v", divergence)
+	}
+}
@@ -0,0 +1,97 @@
+package expressions
+
+import (
+	"errors"
+	"testing"
+
+	"gitlab.com/crypto_project/core/strategy_service/src/service/expressions"
+)
+
+type env struct {
+	variables map[string]float64
+	ready     bool
+	calls     []expressions.Call
+}
+
+func (e *env) Variable(name string) (float64, error) {
+	return e.variables[name], nil
+}
+
+func (e *env) Indicator(call expressions.Call) (float64, bool, error) {
+	e.calls = append(e.calls, call)
+	return 100, e.ready, nil
+}
+
+var variables = []string{"close", "spread_pct"}
+
+func evaluate(t *testing.T, source string, e *env) (bool, error) {
+	expression, err := expressions.Compile(source, variables)
+	if err != nil {
+		t.Fatal(source, err)
+	}
+	return expression.Evaluate(e)
+}
+
+func TestEvaluate(t *testing.T) {
+	e := &env{variables: map[string]float64{"close": 101, "spread_pct": 0.05}, ready: true}
+	for source, expected := range map[string]bool{
+		"close > ema(50, 15m) && spread_pct < 0.1": true,
+		"close > ema(50,15m) && spread_pct >= 0.1": false,
+		"!(close <= 100) || false":                 true,
+		"close - 2 * 0.5 == 100":                   true,
+		"abs(-close) / max(1, 2, 0.5) > 50.4":      true,
+		"bb(20, 2, 1h).upper < close":              true,
+		"-close + min(close, 1) != -100":           false,
+	} {
+		held, err := evaluate(t, source, e)
+		if err != nil || held != expected {
+			t.Error(source, held, err)
+		}
+	}
+	// cases above are run in random order
+	single := &env{variables: e.variables, ready: true}
+	if held, err := evaluate(t, "ema(50, 15m) < close", single); err != nil || !held {
+		t.Fatal(held, err)
+	}
+	if call := single.calls[0]; call.Name != "ema" || len(call.Params) != 1 || call.Params[0] != 50 || call.Timeframe != "15m" {
+		t.Error("wrong indicator call", call)
+	}
+}
+
+func TestEvaluateNotReady(t *testing.T) {
+	e := &env{variables: map[string]float64{"close": 101}}
+	if _, err := evaluate(t, "close > sma(20)", e); err != expressions.ErrNotReady {
+		t.Error("not ready indicator should fail evaluation", err)
+	}
+	e.calls = nil
+	if held, err := evaluate(t, "close < 100 && close > sma(20)", e); held || err != nil || len(e.calls) > 0 {
+		t.Error("logical operators should be short-circuit", held, err)
+	}
+	if _, err := evaluate(t, "close / spread_pct > 1", e); err == nil || errors.Is(err, expressions.ErrNotReady) {
+		t.Error("division by zero should fail evaluation", err)
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	for _, source := range []string{
+		"",
+		"close",
+		"close > ",
+		"close > 1 1",
+		"price > 1",
+		"close > 1 && 2",
+		"(close > 1) > 0",
+		"close > kdj(9)",
+		"close > ema(15m, 50)",
+		"close > ema(50, 2w)",
+		"close > macd().upper",
+		"close > ema(close)",
+		"abs(1, 2) > 0",
+		"close > 1 $ 2",
+		"close > 1.2.3",
+	} {
+		if _, err := expressions.Compile(source, variables); err == nil {
+			t.Error("expression should be rejected", source)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package funding_order
+
+import (
+	"testing"
+	"time"
+
+	"github.com/go-redsync/redsync/v4"
+	"gitlab.com/crypto_project/core/strategy_service/src/service/interfaces"
+	"gitlab.com/crypto_project/core/strategy_service/src/service/strategies"
+	"gitlab.com/crypto_project/core/strategy_service/src/service/strategies/funding_order"
+	"gitlab.com/crypto_project/core/strategy_service/src/sources/memory"
+	"gitlab.com/crypto_project/core/strategy_service/src/sources/mongodb/models"
+	"gitlab.com/crypto_project/core/strategy_service/tests"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// newFundingOrder returns funding order of 2 BTC with 1000 USDT collateral trading with the mock.
+func newFundingOrder() (*funding_order.FundingOrder, *tests.MockLegsTrading) {
+	id := primitive.NewObjectID()
+	model := &models.MongoStrategy{
+		ID:      &id,
+		Enabled: true,
+		Conditions: &models.MongoStrategyCondition{
+			Pair:     "BTC_USDT",
+			Exchange: "binance",
+			Funding: &models.MongoFundingConditions{
+				Amount:     2,
+				EntryRate:  0.001,
+				ExitRate:   0.0001,
+				Collateral: 1000,
+				LegTimeout: 1,
+			},
+		},
+		State: &models.MongoStrategyState{},
+	}
+	sm := memory.NewStateMgmt()
+	sm.SetMarketPrecision("BTC_USDT", 0, 2, 3)
+	sm.SetMarketPrecision("BTC_USDT", 1, 2, 3)
+	sm.CreateStrategy(model)
+	trading := tests.NewMockedLegsTrading(sm)
+	keyId := primitive.NewObjectID()
+	logger, stats := tests.GetLoggerStatsd()
+	strategy := strategies.Strategy{
+		Model:           model,
+		StateMgmt:       sm,
+		Log:             logger,
+		Statsd:          stats,
+		SettlementMutex: &redsync.Mutex{},
+	}
+	return funding_order.New(&strategy, tests.NewMockedDataFeed(nil), trading, stats, &keyId, sm), trading
+}
+
+func fund(fo *funding_order.FundingOrder, rate float64) {
+	fo.Lock()
+	defer fo.Unlock()
+	_ = fo.State.Fire(funding_order.TriggerFunding, interfaces.FundingData{FundingRate: rate, MarkPrice: 30000})
+}
+
+func currentState(fo *funding_order.FundingOrder) string {
+	fo.Lock()
+	defer fo.Unlock()
+	return fo.CurrentState()
+}
+
+func waitForState(t *testing.T, fo *funding_order.FundingOrder, state string) {
+	t.Helper()
+	if !tests.WaitFor(3*time.Second, func() bool { return currentState(fo) == state }) {
+		t.Fatal("funding order should reach state", state, "but it's", currentState(fo))
+	}
+}
+
+// funding order should transfer collateral, enter both legs on high rate and close them with collateral back once it falls
+func TestFundingOrderEntryAndExit(t *testing.T) {
+	fo, trading := newFundingOrder()
+	fund(fo, 0.002)
+	placed := trading.Orders()
+	if currentState(fo) != funding_order.WaitEntryLegs || len(placed) != 2 || len(trading.Transfers) != 1 {
+		t.Fatal("funding order should transfer collateral and place both legs", currentState(fo), len(placed), len(trading.Transfers))
+	}
+	if placed[0].KeyParams.MarketType != 0 || placed[0].KeyParams.Side != "buy" ||
+		placed[1].KeyParams.MarketType != 1 || placed[1].KeyParams.Side != "sell" {
+		t.Error("spot should be bought and futures shorted", placed)
+	}
+	trading.Fill(trading.OrderId(1), 2, 30000)
+	trading.Fill(trading.OrderId(2), 2, 30050)
+	waitForState(t, fo, funding_order.InEntry)
+
+	fund(fo, 0.00005)
+	if currentState(fo) != funding_order.WaitExitLegs || len(trading.Orders()) != 4 {
+		t.Fatal("funding order should close legs once the rate fell", currentState(fo), len(trading.Orders()))
+	}
+	trading.Fill(trading.OrderId(3), 2, 31000)
+	trading.Fill(trading.OrderId(4), 2, 31000)
+	waitForState(t, fo, funding_order.End)
+
+	if len(trading.Transfers) != 2 || trading.Transfers[1].MarketType != 0 || trading.Transfers[1].Amount != 1000 {
+		t.Error("collateral should be transferred back to spot", trading.Transfers)
+	}
+	fo.Lock()
+	defer fo.Unlock()
+	if profit := fo.Strategy.GetModel().State.ReceivedProfitAmount; profit != 100 {
+		t.Error("basis converged should be received as legs profit", profit)
+	}
+}
+
+// funding order should cancel the futures leg not filled in time and unwind spot bought
+func TestFundingOrderLegTimeout(t *testing.T) {
+	fo, trading := newFundingOrder()
+	fund(fo, 0.002)
+	trading.Fill(trading.OrderId(1), 2, 30000)
+	waitForState(t, fo, funding_order.WaitForEntry)
+
+	placed := trading.Orders()
+	if len(trading.Canceled) != 1 || len(placed) != 3 || placed[2].KeyParams.MarketType != 0 || placed[2].KeyParams.Side != "sell" {
+		t.Error("futures leg should be canceled and spot sold back", trading.Canceled, placed)
+	}
+}
@@ -0,0 +1,40 @@
+package funding_order
+
+import (
+	"math"
+	"testing"
+
+	"gitlab.com/crypto_project/core/strategy_service/src/service/interfaces"
+	"gitlab.com/crypto_project/core/strategy_service/src/service/strategies/funding_order"
+	"gitlab.com/crypto_project/core/strategy_service/src/sources/mongodb/models"
+)
+
+func TestFundingAccrual(t *testing.T) {
+	state := &models.MongoStrategyState{}
+	funding := &interfaces.FundingData{MarkPrice: 10000, FundingRate: 0.001, NextFundingTime: 1000}
+	if payment := funding_order.AccrueFunding(state, funding, 2); payment != 0 {
+		t.Error("first update shouldn't accrue funding", payment)
+	}
+
+	funding.FundingRate = 0.0005
+	if payment := funding_order.AccrueFunding(state, funding, 2); payment != 0 {
+		t.Error("funding time not passed shouldn't accrue funding", payment)
+	}
+	if state.FundingRate != 0.0005 {
+		t.Error("rate expected at the next funding not updated", state.FundingRate)
+	}
+
+	funding.NextFundingTime = 2000
+	funding.MarkPrice = 12000
+	funding.FundingRate = -0.0002
+	payment := funding_order.AccrueFunding(state, funding, 2)
+	if math.Abs(payment-12) > 1e-9 || math.Abs(state.FundingPNL-12) > 1e-9 {
+		t.Error("wrong funding accrued", payment, state.FundingPNL)
+	}
+
+	funding.NextFundingTime = 3000
+	funding_order.AccrueFunding(state, funding, 2)
+	if math.Abs(state.FundingPNL-(12-4.8)) > 1e-9 {
+		t.Error("negative funding should be paid by short", state.FundingPNL)
+	}
+}
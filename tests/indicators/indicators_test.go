@@ -0,0 +1,127 @@
+package indicators
+
+import (
+	"math"
+	"testing"
+
+	"gitlab.com/crypto_project/core/strategy_service/src/service/indicators"
+	"gitlab.com/crypto_project/core/strategy_service/src/service/interfaces"
+	"gitlab.com/crypto_project/core/strategy_service/tests"
+)
+
+func closes(values ...float64) []interfaces.Candle {
+	candles := make([]interfaces.Candle, len(values))
+	for i, value := range values {
+		candles[i] = interfaces.Candle{Timestamp: int64(i+1) * 60, Open: value, High: value + 1, Low: value - 1, Close: value, Volume: 1}
+	}
+	return candles
+}
+
+func feed(t *testing.T, name string, params []float64, candles []interfaces.Candle) indicators.Indicator {
+	indicator, err := indicators.New(name, params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, candle := range candles {
+		indicator.Update(candle)
+	}
+	return indicator
+}
+
+func value(t *testing.T, indicator indicators.Indicator, output string) float64 {
+	value, ok := indicator.Value(output)
+	if !ok {
+		t.Fatal("unknown output", output)
+	}
+	return value
+}
+
+func TestMovingAverages(t *testing.T) {
+	sma := feed(t, "sma", []float64{3}, closes(1, 2, 3, 4, 5))
+	if !sma.Ready() || value(t, sma, "") != 4 {
+		t.Error("wrong sma", value(t, sma, ""))
+	}
+	ema := feed(t, "ema", []float64{3}, closes(1, 2, 3, 4))
+	// seeded by sma 2, then 4*0.5 + 2*0.5
+	if !ema.Ready() || value(t, ema, "") != 3 {
+		t.Error("wrong ema", value(t, ema, ""))
+	}
+	if feed(t, "ema", []float64{3}, closes(1, 2)).Ready() {
+		t.Error("ema shouldn't be ready before period")
+	}
+}
+
+func TestRSI(t *testing.T) {
+	rsi := feed(t, "rsi", []float64{2}, closes(10, 12, 11))
+	// average gain 1, average loss 0.5
+	if !rsi.Ready() || math.Abs(value(t, rsi, "")-100*2/3.0) > 1e-9 {
+		t.Error("wrong rsi", value(t, rsi, ""))
+	}
+	if up := feed(t, "rsi", []float64{2}, closes(1, 2, 3)); value(t, up, "") != 100 {
+		t.Error("rsi without losses should be 100", value(t, up, ""))
+	}
+}
+
+func TestMACD(t *testing.T) {
+	macd := feed(t, "macd", []float64{2, 3, 2}, closes(1, 2, 3, 4, 5, 6))
+	if !macd.Ready() {
+		t.Fatal("macd should be ready")
+	}
+	line, signal, histogram := value(t, macd, "macd"), value(t, macd, "signal"), value(t, macd, "histogram")
+	if line <= 0 || math.Abs(histogram-(line-signal)) > 1e-9 {
+		t.Error("wrong macd outputs", line, signal, histogram)
+	}
+	if _, ok := macd.Value("upper"); ok {
+		t.Error("unknown output should be rejected")
+	}
+}
+
+func TestBollingerAndVWAP(t *testing.T) {
+	bb := feed(t, "bb", []float64{2, 2}, closes(5, 1, 3))
+	if value(t, bb, "") != 2 || value(t, bb, "upper") != 4 || value(t, bb, "lower") != 0 {
+		t.Error("wrong bands", value(t, bb, ""), value(t, bb, "upper"), value(t, bb, "lower"))
+	}
+	candles := closes(10, 20)
+	candles[1].Volume = 3
+	if vwap := feed(t, "vwap", []float64{2}, candles); !vwap.Ready() || value(t, vwap, "") != 17.5 {
+		t.Error("wrong vwap", value(t, vwap, ""))
+	}
+	for i := range candles {
+		candles[i].Volume = 0
+	}
+	if vwap := feed(t, "vwap", []float64{2}, candles); vwap.Ready() {
+		t.Error("vwap without volume shouldn't be ready", value(t, vwap, ""))
+	}
+}
+
+func TestIncrementalATRMatchesBatch(t *testing.T) {
+	candles := closes(10, 12, 9, 14, 13, 15, 11)
+	atr := feed(t, "atr", []float64{3}, candles)
+	if math.Abs(value(t, atr, "")-indicators.ATR(candles, 3)) > 1e-9 {
+		t.Error("incremental atr differs", value(t, atr, ""), indicators.ATR(candles, 3))
+	}
+}
+
+func TestEngineUpdatesCachedIndicator(t *testing.T) {
+	dataFeed := tests.NewMockedDataFeed(nil)
+	dataFeed.Candles = closes(1, 2, 3)
+	engine := indicators.GetEngine(dataFeed)
+	if indicators.GetEngine(dataFeed) != engine {
+		t.Error("engine should be shared by data feed")
+	}
+	spec := indicators.Spec{Name: "sma", Params: []float64{3}, Pair: "BTC_USDT", Timeframe: "1h"}
+	value, ready, err := engine.Value(spec, "")
+	if err != nil || !ready || value != 2 {
+		t.Error("wrong warmed up value", value, ready, err)
+	}
+	dataFeed.Candles = append(dataFeed.Candles, closes(1, 2, 3, 10)[3])
+	if value, _, _ := engine.Value(spec, ""); value != 5 {
+		t.Error("new bar not accounted", value)
+	}
+	if value, _, _ := engine.Value(spec, ""); value != 5 {
+		t.Error("the same bar accounted twice", value)
+	}
+	if _, _, err := engine.Value(indicators.Spec{Name: "kdj"}, ""); err == nil {
+		t.Error("unknown indicator should be rejected")
+	}
+}
@@ -0,0 +1,42 @@
+package indicators
+
+import (
+	"math"
+	"testing"
+
+	"gitlab.com/crypto_project/core/strategy_service/src/service/indicators"
+	"gitlab.com/crypto_project/core/strategy_service/src/service/interfaces"
+)
+
+func TestChandelierExit(t *testing.T) {
+	candles := []interfaces.Candle{
+		{High: 11, Low: 9, Close: 10},
+		{High: 12, Low: 10, Close: 11},
+		{High: 11, Low: 8, Close: 9},
+		{High: 13, Low: 9, Close: 12},
+		{High: 12, Low: 6, Close: 7},
+	} // ATR 4 over 3 candles
+	if stop := indicators.ChandelierExit(candles, 3, 2, true); math.Abs(stop-5) > 1e-9 {
+		t.Error("long stop should be highest high less ATRs", stop)
+	}
+	if stop := indicators.ChandelierExit(candles, 3, 2, false); math.Abs(stop-14) > 1e-9 {
+		t.Error("short stop should be lowest low plus ATRs", stop)
+	}
+	if stop := indicators.ChandelierExit(candles[:3], 3, 2, true); stop != 0 {
+		t.Error("not enough candles should give 0", stop)
+	}
+}
+
+func TestParabolicSAR(t *testing.T) {
+	rising := []interfaces.Candle{{High: 10, Low: 8}, {High: 11, Low: 9}, {High: 12, Low: 10}}
+	if sar := indicators.ParabolicSAR(rising, 0.02, 0.2, true); math.Abs(sar-8.24) > 1e-9 {
+		t.Error("SAR should accelerate to new highs", sar)
+	}
+	reversed := []interfaces.Candle{{High: 10, Low: 8}, {High: 9, Low: 5}}
+	if sar := indicators.ParabolicSAR(reversed, 0.02, 0.2, true); math.Abs(sar-9.9) > 1e-9 {
+		t.Error("SAR should reverse above price", sar)
+	}
+	if sar := indicators.ParabolicSAR(rising[:1], 0.02, 0.2, true); sar != 0 {
+		t.Error("not enough candles should give 0", sar)
+	}
+}
@@ -0,0 +1,36 @@
+package indicators
+
+import (
+	"math"
+	"testing"
+
+	"gitlab.com/crypto_project/core/strategy_service/src/service/indicators"
+	"gitlab.com/crypto_project/core/strategy_service/src/service/interfaces"
+)
+
+func TestATR(t *testing.T) {
+	candles := []interfaces.Candle{
+		{High: 11, Low: 9, Close: 10},
+		{High: 12, Low: 10, Close: 11}, // TR 2
+		{High: 11, Low: 8, Close: 9},   // TR 3
+		{High: 13, Low: 9, Close: 12},  // TR 4, gap from close 9 up to 13
+		{High: 12, Low: 6, Close: 7},   // TR 6
+	}
+	if atr := indicators.ATR(candles[:3], 3); atr != 0 {
+		t.Error("not enough candles should give 0", atr)
+	}
+	if atr := indicators.ATR(candles[:4], 3); math.Abs(atr-3) > 1e-9 {
+		t.Error("first ATR should be mean true range", atr)
+	}
+	if atr := indicators.ATR(candles, 3); math.Abs(atr-(3*2+6)/3.0) > 1e-9 {
+		t.Error("ATR should be smoothed by Wilder", atr)
+	}
+}
+
+func TestRealizedVolatility(t *testing.T) {
+	candles := []interfaces.Candle{{Close: 100}, {Close: 110}, {Close: 99}}
+	// returns 0.1 and -0.1, sample deviation sqrt(0.02)
+	if vol := indicators.RealizedVolatility(candles, 2); math.Abs(vol-math.Sqrt(0.02)*99) > 1e-9 {
+		t.Error("wrong realized volatility", vol)
+	}
+}
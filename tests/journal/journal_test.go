@@ -0,0 +1,94 @@
+package journal
+
+import (
+	"testing"
+
+	"gitlab.com/crypto_project/core/strategy_service/src/service/interfaces"
+	"gitlab.com/crypto_project/core/strategy_service/src/service/journal"
+	"gitlab.com/crypto_project/core/strategy_service/src/sources/memory"
+	"gitlab.com/crypto_project/core/strategy_service/src/sources/mongodb/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var _ interfaces.IJournalStore = &memory.StateMgmt{}
+var _ interfaces.IJournal = &journal.Journal{}
+
+func TestJournalSequence(t *testing.T) {
+	sm := memory.NewStateMgmt()
+	strategyId := primitive.NewObjectID()
+	j := journal.New(strategyId, sm)
+	state := &models.MongoStrategyState{State: "InEntry", EntryPrice: 7000}
+	j.Transition("WaitForEntry", "InEntry", "TriggerTrade", 7000, state)
+	state.EntryPrice = 0 // the entry keeps a snapshot
+	j.OrderPlaced("1", "TakeProfit", "sell", "limit", 0.1, 7100)
+	j.OrderUpdated(&models.MongoOrder{OrderId: "1", Status: "filled", Filled: 0.1, Average: 7100})
+	j.Flush()
+
+	entries := sm.GetJournal(&strategyId, 0)
+	if len(entries) != 3 {
+		t.Fatal("all the events should be journaled, got", len(entries))
+	}
+	for i, entry := range entries {
+		if entry.Seq != int64(i+1) || entry.StrategyId != strategyId {
+			t.Errorf("wrong entry %v numbering %+v", i, entry)
+		}
+	}
+	if entries[0].State.EntryPrice != 7000 {
+		t.Error("state snapshot shouldn't change with the state", entries[0].State.EntryPrice)
+	}
+	if after := sm.GetJournal(&strategyId, 2); len(after) != 1 || after[0].Type != models.JournalFill {
+		t.Error("entries after the sequence number should be returned", after)
+	}
+
+	// another journal of the strategy, e.g. in the instance the strategy moved to, goes on with the numbering
+	other := journal.New(strategyId, sm)
+	other.ConditionsEdited(&models.MongoStrategyCondition{Pair: "BTC_USDT"})
+	other.Flush()
+	j.Transition("InEntry", "End", "CheckExistingOrders", 7100, &models.MongoStrategyState{State: "End"})
+	j.Flush()
+	if last := sm.GetLastJournalSeq(&strategyId); last != 5 {
+		t.Error("journal should retry the sequence number taken, last", last)
+	}
+}
+
+func TestJournalWithoutStore(t *testing.T) {
+	var j *journal.Journal
+	j.OrderPlaced("1", "WaitForEntry", "buy", "market", 0.1, 7000)
+	journal.New(primitive.NewObjectID(), nil).Transition("WaitForEntry", "InEntry", "TriggerTrade", 7000, nil)
+}
+
+func TestRebuild(t *testing.T) {
+	entries := []models.MongoJournalEntry{
+		{Seq: 3, Type: models.JournalOrder, OrderId: "2", Step: "Stoploss"},
+		{Seq: 1, Type: models.JournalConditions, Conditions: &models.MongoStrategyCondition{Pair: "BTC_USDT"}},
+		{Seq: 2, Type: models.JournalTransition, Destination: "InEntry",
+			State: &models.MongoStrategyState{EntryPrice: 7000, Orders: []string{"1"}, WaitForEntryIds: []string{"1"}}},
+		{Seq: 4, Type: models.JournalOrder, OrderId: "3", Step: "TakeProfit"},
+		{Seq: 5, Type: models.JournalFill, OrderId: "3", Status: "filled"},
+	}
+	state, conditions, err := journal.Rebuild(entries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state.State != "InEntry" || state.EntryPrice != 7000 {
+		t.Errorf("state should be taken from the last transition %+v", state)
+	}
+	if len(state.Orders) != 3 || len(state.StopLossOrderIds) != 1 || len(state.TakeProfitOrderIds) != 1 {
+		t.Error("orders placed after the transition should be added", state.Orders)
+	}
+	if conditions == nil || conditions.Pair != "BTC_USDT" {
+		t.Error("conditions edited should be rebuilt")
+	}
+	if entries[2].State.Orders[0] != "1" || len(entries[2].State.Orders) != 1 {
+		t.Error("entries shouldn't change on rebuild")
+	}
+
+	entries = append(entries, models.MongoJournalEntry{Seq: 7, Type: models.JournalTransition, Destination: "End"})
+	state, _, err = journal.Rebuild(entries)
+	if err == nil {
+		t.Error("sequence gap should fail rebuild")
+	}
+	if state.State != "InEntry" {
+		t.Error("state up to the gap should be returned", state.State)
+	}
+}
@@ -0,0 +1,270 @@
+package memory
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-redsync/redsync/v4"
+	"gitlab.com/crypto_project/core/strategy_service/src/service/interfaces"
+	"gitlab.com/crypto_project/core/strategy_service/src/sources/memory"
+	"gitlab.com/crypto_project/core/strategy_service/src/sources/mongodb/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var _ interfaces.IStateStore = &memory.StateMgmt{}
+
+func getStrategy() *models.MongoStrategy {
+	keyId := primitive.NewObjectID()
+	return &models.MongoStrategy{
+		Type:      1,
+		Enabled:   true,
+		AccountId: &keyId,
+		Conditions: &models.MongoStrategyCondition{
+			Pair:       "BTC_USDT",
+			MarketType: 1,
+			EntryOrder: &models.MongoEntryPoint{Side: "buy", Amount: 0.1, OrderType: "market"},
+		},
+		State: &models.MongoStrategyState{State: "WaitForEntry"},
+	}
+}
+
+func TestMemoryStrategies(t *testing.T) {
+	sm := memory.NewStateMgmt()
+	strategy := sm.CreateStrategy(getStrategy())
+	if strategy.ID == nil {
+		t.Fatal("strategy created should get id")
+	}
+	strategy.Conditions.EntryOrder.Amount = 1
+	if stored := sm.GetStrategy(strategy.ID); stored.Conditions.EntryOrder.Amount != 0.1 {
+		t.Error("stored strategy shouldn't change with the one created", stored.Conditions.EntryOrder.Amount)
+	}
+
+	sm.UpdateState(strategy.ID, &models.MongoStrategyState{State: "InEntry"})
+	sm.UpdateEntryPrice(strategy.ID, &models.MongoStrategyState{State: "InEntry", EntryPrice: 7000, PositionAmount: 0.1})
+	sm.UpdateOrders(strategy.ID, &models.MongoStrategyState{Orders: []string{"1", "2"}})
+	sm.UpdateOrders(strategy.ID, &models.MongoStrategyState{Orders: []string{"2", "3"}, ExecutedOrders: []string{"1"}})
+	stored := sm.GetStrategy(strategy.ID)
+	if stored.State.State != "InEntry" || stored.State.EntryPrice != 7000 || stored.State.PositionAmount != 0.1 {
+		t.Errorf("wrong state %+v", stored.State)
+	}
+	if len(stored.State.Orders) != 3 || len(stored.State.ExecutedOrders) != 1 {
+		t.Error("orders should be added once", stored.State.Orders, stored.State.ExecutedOrders)
+	}
+
+	sm.UpdateExecutedAmount(strategy.ID, &models.MongoStrategyState{ExecutedAmount: 0})
+	if stored := sm.GetStrategy(strategy.ID); stored.State.EntryPrice != 0 || len(stored.State.ExecutedOrders) != 0 {
+		t.Error("zero executed amount should reset entry")
+	}
+
+	other := getStrategy()
+	other.AccountId = strategy.AccountId
+	sm.CreateStrategy(other)
+	if !sm.AnyActiveStrats(strategy) {
+		t.Error("other strategy at the same key and market should be found")
+	}
+	sm.DisableStrategy(other.ID)
+	if sm.AnyActiveStrats(strategy) {
+		t.Error("disabled strategy shouldn't be found")
+	}
+	if enabled := sm.GetEnabledStrategies(); len(enabled) != 1 || *enabled[0].ID != *strategy.ID {
+		t.Error("only enabled strategy should be returned", len(enabled))
+	}
+}
+
+func TestMemoryWatchStrategies(t *testing.T) {
+	sm := memory.NewStateMgmt()
+	var events []bool
+	var enabled []bool
+	done := make(chan struct{})
+	sm.WatchStrategies(func(strategy *models.MongoStrategy, enabling bool) {
+		events = append(events, enabling)
+		enabled = append(enabled, strategy.Enabled)
+		if len(events) == 3 {
+			close(done)
+		}
+	})
+	strategy := sm.CreateStrategy(getStrategy())
+	sm.DisableStrategy(strategy.ID)
+	sm.EnableStrategy(strategy.ID)
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("watcher should get all the updates, got", len(events))
+	}
+	if !events[0] || events[1] || !events[2] {
+		t.Error("insert enabled and enabling update should enable the strategy", events)
+	}
+	if !enabled[0] || enabled[1] || !enabled[2] {
+		t.Error("updates should be delivered in order", enabled)
+	}
+}
+
+func TestMemoryOrders(t *testing.T) {
+	sm := memory.NewStateMgmt()
+	filled := make(chan *models.MongoOrder, 1)
+	_ = sm.SubscribeToOrder("42", func(order *models.MongoOrder) {
+		filled <- order
+	})
+	sm.SaveOrder(models.MongoOrder{ID: primitive.NewObjectID(), OrderId: "42", Status: "open"}, nil, 1)
+	sm.SaveOrder(models.MongoOrder{ID: primitive.NewObjectID(), OrderId: "42", Status: "filled", Average: 7000}, nil, 1)
+	select {
+	case order := <-filled:
+		if order.Status != "filled" || order.Average != 7000 {
+			t.Errorf("wrong order %+v", order)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("subscriber should be notified on order filled")
+	}
+	if order := sm.GetOrder("42"); order == nil || order.Status != "filled" {
+		t.Error("order saved should be found")
+	}
+
+	// subscription to an order already saved gets it at once
+	var got *models.MongoOrder
+	_ = sm.SubscribeToOrder("42", func(order *models.MongoOrder) { got = order })
+	if got == nil || got.Average != 7000 {
+		t.Error("subscriber should get order saved before")
+	}
+}
+
+func TestMemoryHedge(t *testing.T) {
+	sm := memory.NewStateMgmt()
+	hedge := sm.CreateStrategy(getStrategy())
+	updates := make(chan float64, 2)
+	_ = sm.SubscribeToHedge(hedge.ID, func(strategy *models.MongoStrategy) {
+		updates <- strategy.State.HedgeExitPrice
+	})
+	sm.UpdateHedgeExitPrice(hedge.ID, &models.MongoStrategyState{State: "End", HedgeExitPrice: 6900})
+	if price := <-updates; price != 0 {
+		t.Error("subscriber should get the hedge at once", price)
+	}
+	select {
+	case price := <-updates:
+		if price != 6900 {
+			t.Error("wrong hedge exit price", price)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("subscriber should be notified on hedge update")
+	}
+}
+
+func TestMemoryMarketsBalancesPNL(t *testing.T) {
+	sm := memory.NewStateMgmt()
+	sm.SetMarketPrecision("BTC_USDT", 1, 2, 3)
+	if price, amount := sm.GetMarketPrecision("BTC_USDT", 1); price != 2 || amount != 3 {
+		t.Error("wrong precision", price, amount)
+	}
+	if _, amount := sm.GetMarketPrecision("BTC_USDT", 0); amount != 8 {
+		t.Error("unknown market should get default precision", amount)
+	}
+	if markets := sm.GetMarkets(); len(markets[1]) != 1 || len(markets[0]) != 0 {
+		t.Error("wrong markets", markets)
+	}
+
+	keyId := primitive.NewObjectID()
+	sm.SetKeyBalances(&keyId, map[string]float64{"BTC": 1})
+	balances := sm.GetKeyBalances(&keyId)
+	balances["BTC"] = 2
+	if sm.GetKeyBalances(&keyId)["BTC"] != 1 {
+		t.Error("balances returned shouldn't change the stored ones")
+	}
+
+	templateId := primitive.NewObjectID()
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sm.SavePNL(&templateId, 0.5)
+		}()
+	}
+	wg.Wait()
+	if pnl := sm.GetPNL(&templateId); pnl != 50 {
+		t.Error("concurrent pnl updates should be summed up", pnl)
+	}
+}
+
+func TestMemoryVersioning(t *testing.T) {
+	sm := memory.NewStateMgmt()
+	strategy := sm.CreateStrategy(getStrategy())
+	stale := sm.GetStrategy(strategy.ID)
+
+	// order placed and then dropped by the state saved as a whole, e.g. on a new iteration
+	sm.UpdateOrders(strategy.ID, &models.MongoStrategyState{Orders: []string{"1"}})
+	sm.UpdateStrategyState(strategy.ID, &models.MongoStrategyState{Orders: []string{"2"}, TakeProfitOrderIds: []string{"2"}})
+	if stored := sm.GetStrategy(strategy.ID); len(stored.State.Orders) != 1 || stored.State.Orders[0] != "2" {
+		t.Error("order ids removed by the writer shouldn't be brought back", stored.State.Orders)
+	}
+	stale.State.State = "InEntry"
+	stale.State.StopLossOrderIds = []string{"3"}
+	sm.UpdateStateAndConditions(strategy.ID, stale)
+
+	stored := sm.GetStrategy(strategy.ID)
+	if stored.Version != stale.Version+3 {
+		t.Error("each update should increment version", stored.Version)
+	}
+	if stored.State.State != "InEntry" || len(stored.State.StopLossOrderIds) != 1 {
+		t.Errorf("state should be updated %+v", stored.State)
+	}
+}
+
+// settlement locks kept in memory should be exclusive until released or expired and extended by the holder only
+func TestMemoryLocks(t *testing.T) {
+	rs := memory.NewStateMgmt().Redsync()
+	mutex := rs.NewMutex("strategy:BTC_USDT:1", redsync.WithTries(1), redsync.WithExpiry(200*time.Millisecond))
+	other := rs.NewMutex("strategy:BTC_USDT:1", redsync.WithTries(1), redsync.WithExpiry(200*time.Millisecond))
+	if err := mutex.Lock(); err != nil {
+		t.Fatal("free lock should be taken", err)
+	}
+	if err := other.Lock(); err != redsync.ErrFailed {
+		t.Error("taken lock shouldn't be taken again", err)
+	}
+	if ok, _ := other.Extend(); ok {
+		t.Error("lock shouldn't be extended by others")
+	}
+	time.Sleep(150 * time.Millisecond)
+	if ok, err := mutex.Extend(); !ok || err != nil {
+		t.Error("lock should be extended by the holder", err)
+	}
+	time.Sleep(150 * time.Millisecond)
+	if err := other.Lock(); err != redsync.ErrFailed {
+		t.Error("extended lock shouldn't expire", err)
+	}
+	if ok, _ := mutex.Unlock(); !ok {
+		t.Error("lock should be released by the holder")
+	}
+	if err := other.Lock(); err != nil {
+		t.Error("released lock should be taken", err)
+	}
+	time.Sleep(250 * time.Millisecond)
+	if err := mutex.Lock(); err != nil {
+		t.Error("expired lock should be taken", err)
+	}
+}
+
+// fixture should seed markets, balances and strategies
+func TestMemoryFixture(t *testing.T) {
+	sm := memory.NewStateMgmt()
+	keyId := primitive.NewObjectID()
+	err := sm.Load(&memory.Fixture{
+		Markets:    []memory.FixtureMarket{{Pair: "BTC_USDT", MarketType: 1, PricePrecision: 2, AmountPrecision: 3}},
+		Balances:   map[string]map[string]float64{keyId.Hex(): {"USDT": 100}},
+		Strategies: []*models.MongoStrategy{getStrategy()},
+	})
+	if err != nil {
+		t.Fatal("fixture load failed", err)
+	}
+	if _, amount := sm.GetMarketPrecision("BTC_USDT", 1); amount != 3 {
+		t.Error("market should be seeded", amount)
+	}
+	if sm.GetKeyBalances(&keyId)["USDT"] != 100 {
+		t.Error("balances should be seeded")
+	}
+	if len(sm.GetEnabledStrategies()) != 1 {
+		t.Error("strategies should be seeded")
+	}
+	if err := sm.Load(&memory.Fixture{Balances: map[string]map[string]float64{"key": {}}}); err == nil {
+		t.Error("bad key id should be rejected")
+	}
+}
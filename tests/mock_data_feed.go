@@ -17,6 +17,8 @@ type MockDataFeed struct {
 	WaitForOrderInitialization int
 	WaitBetweenTicks           int
 	CycleLastNEntries          int
+	FundingData                *interfaces.FundingData
+	Candles                    []interfaces.Candle
 }
 
 func NewMockedDataFeed(mockedStream []interfaces.OHLCV) *MockDataFeed {
@@ -114,6 +116,17 @@ func (df *MockDataFeed) GetSpreadForPairAtExchange(pair string, exchange string,
 	return &df.spreadData[df.currentSpreadTick]
 }
 
+func (df *MockDataFeed) GetFundingForPairAtExchange(pair string, exchange string) *interfaces.FundingData {
+	return df.FundingData
+}
+
+func (df *MockDataFeed) GetCandles(pair string, exchange string, marketType int64, timeframe string, n int) []interfaces.Candle {
+	if len(df.Candles) > n {
+		return df.Candles[len(df.Candles)-n:]
+	}
+	return df.Candles
+}
+
 func (df *MockDataFeed) SubscribeToPairUpdate() {
 
 }
@@ -0,0 +1,98 @@
+package tests
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"gitlab.com/crypto_project/core/strategy_service/src/sources/memory"
+	"gitlab.com/crypto_project/core/strategy_service/src/sources/mongodb/models"
+	"gitlab.com/crypto_project/core/strategy_service/src/trading/orders"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// A MockLegsTrading records orders placed by legs runtimes and reports canceled ones to the store, so tests fill
+// orders through the store and drive the runtime state machines.
+type MockLegsTrading struct {
+	Store     *memory.StateMgmt
+	Fail      bool // rejects orders, e.g. for insufficient balance
+	Created   []orders.CreateOrderRequest
+	Canceled  []string
+	Transfers []orders.TransferRequest
+	mux       sync.Mutex
+}
+
+func NewMockedLegsTrading(store *memory.StateMgmt) *MockLegsTrading {
+	return &MockLegsTrading{Store: store}
+}
+
+func (mt *MockLegsTrading) CreateOrder(req orders.CreateOrderRequest) orders.OrderResponse {
+	mt.mux.Lock()
+	defer mt.mux.Unlock()
+	if mt.Fail {
+		return orders.OrderResponse{Status: "ERR", Data: orders.OrderResponseData{Msg: "insufficient balance"}}
+	}
+	mt.Created = append(mt.Created, req)
+	orderId := req.KeyParams.Symbol + strconv.Itoa(len(mt.Created))
+	return orders.OrderResponse{Status: "OK", Data: orders.OrderResponseData{OrderId: orderId, Status: "open"}}
+}
+
+func (mt *MockLegsTrading) CancelOrder(req orders.CancelOrderRequest) orders.OrderResponse {
+	mt.mux.Lock()
+	mt.Canceled = append(mt.Canceled, req.KeyParams.OrderId)
+	mt.mux.Unlock()
+	if order := mt.Store.GetOrder(req.KeyParams.OrderId); order == nil || order.Status == "open" {
+		mt.Store.SaveOrder(models.MongoOrder{OrderId: req.KeyParams.OrderId, Status: "canceled"}, req.KeyId, req.KeyParams.MarketType)
+	}
+	return orders.OrderResponse{Status: "OK"}
+}
+
+func (mt *MockLegsTrading) PlaceHedge(parentSmarOrder *models.MongoStrategy) orders.OrderResponse {
+	return orders.OrderResponse{Status: "OK"}
+}
+
+func (mt *MockLegsTrading) UpdateLeverage(keyId *primitive.ObjectID, leverage float64, symbol string) orders.UpdateLeverageResponse {
+	return orders.UpdateLeverageResponse{Status: "OK"}
+}
+
+func (mt *MockLegsTrading) Transfer(request orders.TransferRequest) orders.OrderResponse {
+	mt.mux.Lock()
+	defer mt.mux.Unlock()
+	mt.Transfers = append(mt.Transfers, request)
+	return orders.OrderResponse{Status: "OK"}
+}
+
+func (mt *MockLegsTrading) SetHedgeMode(keyId *primitive.ObjectID, hedgeMode bool) orders.OrderResponse {
+	return orders.OrderResponse{Status: "OK"}
+}
+
+// Orders returns orders placed so far.
+func (mt *MockLegsTrading) Orders() []orders.CreateOrderRequest {
+	mt.mux.Lock()
+	defer mt.mux.Unlock()
+	return append([]orders.CreateOrderRequest{}, mt.Created...)
+}
+
+// OrderId returns id of the order placed n-th, starting from 1.
+func (mt *MockLegsTrading) OrderId(n int) string {
+	mt.mux.Lock()
+	defer mt.mux.Unlock()
+	return mt.Created[n-1].KeyParams.Symbol + strconv.Itoa(n)
+}
+
+// Fill reports the order filled at the price given to the store.
+func (mt *MockLegsTrading) Fill(orderId string, filled float64, average float64) {
+	mt.Store.SaveOrder(models.MongoOrder{OrderId: orderId, Status: "filled", Filled: filled, Average: average}, nil, 0)
+}
+
+// WaitFor polls the condition until it holds or the timeout passes and returns the last result.
+func WaitFor(timeout time.Duration, condition func() bool) bool {
+	deadline := time.Now().Add(timeout)
+	for !condition() {
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return true
+}
@@ -17,6 +17,7 @@ type MockStateMgmt struct {
 	pair          string
 	exchange      string
 	marketType    int64
+	Balances      map[string]float64 // free balances by asset
 
 }
 
@@ -76,10 +77,18 @@ func (sm *MockStateMgmt) GetOrder(orderId string) *models.MongoOrder {
 	return &models.MongoOrder{}
 }
 
+func (sm *MockStateMgmt) GetStrategy(strategyId *primitive.ObjectID) *models.MongoStrategy {
+	return nil
+}
+
 func (sm *MockStateMgmt) GetMarketPrecision(pair string, marketType int64) (int64, int64) {
 	return 2, 3
 }
 
+func (sm *MockStateMgmt) GetKeyBalances(keyId *primitive.ObjectID) map[string]float64 {
+	return sm.Balances
+}
+
 func (sm *MockStateMgmt) SubscribeToOrder(orderId string, onOrderStatusUpdate func(order *models.MongoOrder)) error {
 	return sm.SubscribeToOrderOpts(orderId, sm.pair, sm.exchange, sm.marketType, onOrderStatusUpdate)
 }
@@ -89,7 +89,7 @@ func (mt MockTrading) CreateOrder(req orders.CreateOrderRequest) orders.OrderRes
 		Side:       req.KeyParams.Side,
 		Symbol:     req.KeyParams.Symbol,
 		StopPrice:  req.KeyParams.StopPrice,
-		ReduceOnly: *req.KeyParams.ReduceOnly,
+		ReduceOnly: req.KeyParams.ReduceOnly != nil && *req.KeyParams.ReduceOnly, // not set in hedge mode
 	}
 	if order.Average == 0 && mt.Feed != nil {
 		lent := len(mt.Feed.tickerData)
@@ -0,0 +1,165 @@
+package mongodb
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"gitlab.com/crypto_project/core/strategy_service/src/service/interfaces"
+	"gitlab.com/crypto_project/core/strategy_service/src/sources/mongodb"
+	"gitlab.com/crypto_project/core/strategy_service/src/sources/mongodb/models"
+	statsd_client "gitlab.com/crypto_project/core/strategy_service/src/statsd"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+var _ interfaces.IArchiveStore = &mongodb.StateMgmt{}
+
+func TestArchiveCountsAdd(t *testing.T) {
+	counts := models.ArchiveCounts{Strategies: 1, Orders: 3}
+	counts.Add(models.ArchiveCounts{Strategies: 2, Orders: 1, JournalEntries: 5})
+	if counts != (models.ArchiveCounts{Strategies: 3, Orders: 4, JournalEntries: 5}) {
+		t.Error("counts of batches should be summed", counts)
+	}
+}
+
+// deleted is a reply to documents deleted.
+func deleted(n int32) bson.D {
+	return bson.D{{Key: "ok", Value: 1}, {Key: "n", Value: n}}
+}
+
+// documents is a reply to documents of the collection given read.
+func documents(collection string, docs ...bson.D) bson.D {
+	return mtest.CreateCursorResponse(0, "strategy_service."+collection, mtest.FirstBatch, docs...)
+}
+
+// writesSent returns commands sent with collections they were sent to, e.g. "delete core_orders".
+func writesSent(mt *mtest.T) []string {
+	var sent []string
+	for _, event := range mt.GetAllStartedEvents() {
+		sent = append(sent, event.CommandName+" "+event.Command.Lookup(event.CommandName).StringValue())
+	}
+	return sent
+}
+
+// strategies ended long enough should be moved with their orders and journal, strategies last, and moved back on
+// restore
+func TestArchive(t *testing.T) {
+	os.Setenv("MONGODBNAME", "strategy_service")
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+	strategyId := primitive.NewObjectID()
+	strategy := bson.D{
+		{Key: "_id", Value: strategyId},
+		{Key: "enabled", Value: false},
+		{Key: "state", Value: bson.D{{Key: "state", Value: "Timeout"}, {Key: "orders", Value: bson.A{"1"}}, {Key: "endedAt", Value: 1}}},
+	}
+	order := bson.D{{Key: "_id", Value: primitive.NewObjectID()}, {Key: "id", Value: "1"}, {Key: "status", Value: "filled"}}
+	entry := bson.D{{Key: "_id", Value: primitive.NewObjectID()}, {Key: "strategyId", Value: strategyId}, {Key: "seq", Value: 1}}
+
+	mt.Run("move", func(mt *mtest.T) {
+		mongodb.SetMongoClient(mt.Client)
+		sm := &mongodb.StateMgmt{Statsd: &statsd_client.StatsdClient{}}
+		mt.AddMockResponses(
+			documents("core_strategies", strategy),
+			documents("core_orders", order), updated(1), deleted(1),
+			documents("core_strategy_journal", entry), updated(1), deleted(1),
+			documents("core_strategies", strategy), updated(1), deleted(1),
+		)
+		endedBefore := time.Now().Add(-24 * time.Hour)
+		counts, err := sm.ArchiveStrategies(endedBefore, 10)
+
+		if err != nil || counts != (models.ArchiveCounts{Strategies: 1, Orders: 1, JournalEntries: 1}) {
+			mt.Fatal("strategy should be archived with its orders and journal", counts, err)
+		}
+		finds := sentCommands(mt, "find")
+		filter := finds[0].Lookup("filter")
+		if ended := filter.Document().Lookup("$or").Array().Index(0).Value().Document().Lookup("state.endedAt", "$lt").Int64(); ended != endedBefore.Unix() {
+			mt.Error("strategies should be archived by the end time", filter)
+		}
+		states, _ := filter.Document().Lookup("state.state", "$in").Array().Values()
+		timeout := false
+		for _, state := range states {
+			timeout = timeout || state.StringValue() == "Timeout"
+		}
+		if !timeout {
+			mt.Error("strategies timed out should be archived", states)
+		}
+		expected := []string{
+			"find core_strategies",
+			"find core_orders", "update core_orders_archive", "delete core_orders",
+			"find core_strategy_journal", "update core_strategy_journal_archive", "delete core_strategy_journal",
+			"find core_strategies", "update core_strategies_archive", "delete core_strategies",
+		}
+		if sent := writesSent(mt); strings.Join(sent, ", ") != strings.Join(expected, ", ") {
+			mt.Error("documents should be copied before deleted, strategies last", sent)
+		}
+		if filter := finds[3].Lookup("filter"); filter.Document().Lookup("enabled").Boolean() {
+			mt.Error("strategy enabled meanwhile shouldn't be moved", filter)
+		}
+	})
+
+	mt.Run("ended at", func(mt *mtest.T) {
+		mongodb.SetMongoClient(mt.Client)
+		sm := &mongodb.StateMgmt{Statsd: &statsd_client.StatsdClient{}}
+		endedId := primitive.NewObjectID()
+		mt.AddMockResponses(found(strategyDoc(endedId, 1, bson.A{}, bson.D{})), updated(1), updated(1), updated(1))
+		sm.UpdateStrategyState(&endedId, &models.MongoStrategyState{State: "End"})
+		sm.UpdateStrategyState(&endedId, &models.MongoStrategyState{State: "End", Msg: "closed"})
+		sm.UpdateStrategyState(&endedId, &models.MongoStrategyState{State: "WaitForEntry"})
+
+		updates := sentUpdates(mt)
+		if len(updates) != 3 {
+			mt.Fatal("states should be written, updates", len(updates))
+		}
+		if ended := updates[0].Lookup("u", "$set", "state.endedAt").Int64(); ended < time.Now().Unix()-1 {
+			mt.Error("end time should be set once ended", ended)
+		}
+		if _, err := updates[1].LookupErr("u", "$set", "state.endedAt"); err == nil {
+			mt.Error("end time shouldn't change while ended")
+		}
+		if ended := updates[2].Lookup("u", "$set", "state.endedAt").Int64(); ended != 0 {
+			mt.Error("end time should be reset once started again", ended)
+		}
+	})
+
+	// the journal index is created once before the first journal collection use, restoring creates it if not yet
+	mt.Run("journal index", func(mt *mtest.T) {
+		mongodb.SetMongoClient(mt.Client)
+		sm := &mongodb.StateMgmt{Statsd: &statsd_client.StatsdClient{}}
+		mt.AddMockResponses(bson.D{{Key: "ok", Value: 1}}, bson.D{{Key: "ok", Value: 1}, {Key: "n", Value: 1}})
+		_ = sm.AppendJournalEntry(&models.MongoJournalEntry{ID: primitive.NewObjectID()})
+	})
+
+	mt.Run("restore", func(mt *mtest.T) {
+		mongodb.SetMongoClient(mt.Client)
+		sm := &mongodb.StateMgmt{Statsd: &statsd_client.StatsdClient{}}
+		mt.AddMockResponses(
+			documents("core_strategies_archive", strategy),
+			documents("core_orders_archive", order), updated(1), deleted(1),
+			documents("core_strategy_journal_archive", entry), updated(1), deleted(1),
+			documents("core_strategies_archive", strategy), updated(1), deleted(1),
+		)
+		counts, err := sm.RestoreStrategy(&strategyId)
+
+		if err != nil || counts != (models.ArchiveCounts{Strategies: 1, Orders: 1, JournalEntries: 1}) {
+			mt.Fatal("strategy should be restored with its orders and journal", counts, err)
+		}
+		expected := []string{
+			"find core_strategies_archive",
+			"find core_orders_archive", "update core_orders", "delete core_orders_archive",
+			"find core_strategy_journal_archive", "update core_strategy_journal", "delete core_strategy_journal_archive",
+			"find core_strategies_archive", "update core_strategies", "delete core_strategies_archive",
+		}
+		if sent := writesSent(mt); strings.Join(sent, ", ") != strings.Join(expected, ", ") {
+			mt.Error("documents should be moved back, strategies last", sent)
+		}
+
+		mt.AddMockResponses(documents("core_strategies_archive"))
+		if _, err := sm.RestoreStrategy(&strategyId); err != mongodb.ErrNotArchived {
+			mt.Error("strategy not archived shouldn't be restored", err)
+		}
+	})
+}
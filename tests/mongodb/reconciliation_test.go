@@ -0,0 +1,86 @@
+package mongodb
+
+import (
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"gitlab.com/crypto_project/core/strategy_service/src/sources/mongodb"
+	"gitlab.com/crypto_project/core/strategy_service/src/sources/mongodb/models"
+	statsd_client "gitlab.com/crypto_project/core/strategy_service/src/statsd"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+// orderDoc returns the order document stored.
+func orderDoc(orderId string, initialOrderId string, status string, updatedAt time.Time) bson.D {
+	return bson.D{
+		{Key: "id", Value: orderId},
+		{Key: "postOnlyInitialOrderId", Value: initialOrderId},
+		{Key: "status", Value: status},
+		{Key: "updatedAt", Value: updatedAt},
+	}
+}
+
+// updates missed should be delivered once by the order id subscribed, callbacks of orders filled dropped
+func TestReconcileOrders(t *testing.T) {
+	os.Setenv("MONGODBNAME", "strategy_service")
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+
+	mt.Run("reconcile", func(mt *mtest.T) {
+		mongodb.SetMongoClient(mt.Client)
+		sm := &mongodb.StateMgmt{Statsd: &statsd_client.StatsdClient{}, OrderCallbacks: &sync.Map{}}
+		delivered := map[string][]string{}
+		var mux sync.Mutex
+		for _, orderId := range []string{"1", "2", "3"} {
+			orderId := orderId
+			sm.OrderCallbacks.Store(orderId, func(order *models.MongoOrder) {
+				mux.Lock()
+				defer mux.Unlock()
+				delivered[orderId] = append(delivered[orderId], order.OrderId+" "+order.Status)
+			})
+		}
+
+		updatedAt := time.Now().Truncate(time.Millisecond)
+		orders := mtest.CreateCursorResponse(0, "strategy_service.core_orders", mtest.FirstBatch,
+			orderDoc("1", "", "filled", updatedAt),
+			orderDoc("2", "", "canceled", updatedAt),
+			orderDoc("2a", "2", "canceled", updatedAt.Add(time.Second)),
+		)
+		mt.AddMockResponses(orders)
+		sm.ReconcileOrders()
+
+		if len(delivered["1"]) != 1 || delivered["1"][0] != "1 filled" {
+			mt.Error("order filled missed should be delivered", delivered["1"])
+		}
+		if len(delivered["2"]) != 1 || delivered["2"][0] != "2a canceled" {
+			mt.Error("maker-only order should be delivered with the last update by the initial id", delivered["2"])
+		}
+		if len(delivered["3"]) != 0 {
+			mt.Error("order not updated shouldn't be delivered", delivered["3"])
+		}
+		if _, ok := sm.OrderCallbacks.Load("1"); ok {
+			mt.Error("callback of the order filled should be dropped")
+		}
+
+		// the same updates read again
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "strategy_service.core_orders", mtest.FirstBatch,
+			orderDoc("2a", "2", "canceled", updatedAt.Add(time.Second)),
+		))
+		sm.ReconcileOrders()
+
+		if len(delivered["2"]) != 1 {
+			mt.Error("update delivered shouldn't be delivered again", delivered["2"])
+		}
+		finds := sentCommands(mt, "find")
+		if len(finds) != 2 {
+			mt.Fatal("orders should be read once per reconciliation", len(finds))
+		}
+		queried := orderIds(finds[1].Lookup("filter", "$or").Array().Index(0).Value().Document().Lookup("id", "$in"))
+		if len(queried) != 2 {
+			mt.Error("only orders subscribed should be read", queried)
+		}
+	})
+}
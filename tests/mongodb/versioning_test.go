@@ -0,0 +1,198 @@
+package mongodb
+
+import (
+	"os"
+	"testing"
+
+	"gitlab.com/crypto_project/core/strategy_service/src/sources/mongodb"
+	"gitlab.com/crypto_project/core/strategy_service/src/sources/mongodb/models"
+	"gitlab.com/crypto_project/core/strategy_service/src/sources/mongodb/schema"
+	statsd_client "gitlab.com/crypto_project/core/strategy_service/src/statsd"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+// updated is a reply to an update matched or not.
+func updated(n int32) bson.D {
+	return bson.D{{Key: "ok", Value: 1}, {Key: "n", Value: n}, {Key: "nModified", Value: n}}
+}
+
+// found is a reply to the strategy read.
+func found(strategy bson.D) bson.D {
+	return mtest.CreateCursorResponse(0, "strategy_service.core_strategies", mtest.FirstBatch, strategy)
+}
+
+// strategyDoc returns the strategy document stored at the version given.
+func strategyDoc(strategyId primitive.ObjectID, version int64, orders bson.A, conditions bson.D) bson.D {
+	return bson.D{
+		{Key: "_id", Value: strategyId},
+		{Key: "version", Value: version},
+		{Key: "state", Value: bson.D{{Key: "state", Value: "InEntry"}, {Key: "orders", Value: orders}}},
+		{Key: "conditions", Value: conditions},
+	}
+}
+
+// sentUpdates returns statements of update commands sent, each with the filter and the update.
+func sentUpdates(mt *mtest.T) []bson.Raw {
+	var updates []bson.Raw
+	for _, event := range mt.GetAllStartedEvents() {
+		if event.CommandName == "update" {
+			updates = append(updates, event.Command.Lookup("updates").Array().Index(0).Value().Document())
+		}
+	}
+	return updates
+}
+
+// commandsSent returns how many commands of the name given were sent.
+func commandsSent(mt *mtest.T, name string) int {
+	sent := 0
+	for _, event := range mt.GetAllStartedEvents() {
+		if event.CommandName == name {
+			sent++
+		}
+	}
+	return sent
+}
+
+// orderIds returns ids of the array value given.
+func orderIds(value bson.RawValue) []string {
+	var ids []string
+	values, _ := value.Array().Values()
+	for _, id := range values {
+		ids = append(ids, id.StringValue())
+	}
+	return ids
+}
+
+func TestMergeOrderIds(t *testing.T) {
+	base := &models.MongoStrategyState{Orders: []string{"1", "2"}}
+	current := &models.MongoStrategyState{Orders: []string{"1", "2", "3"}}
+	state := &models.MongoStrategyState{Orders: []string{"2", "4"}}
+	merged := models.MergeOrderIds(state, base, current)
+	if len(merged.Orders) != 3 || merged.Orders[0] != "2" || merged.Orders[1] != "4" || merged.Orders[2] != "3" {
+		t.Error("ids added concurrently should be added and ids removed by the writer not", merged.Orders)
+	}
+	if len(state.Orders) != 2 {
+		t.Error("state given shouldn't change", state.Orders)
+	}
+	if merged = models.MergeOrderIds(state, nil, current); len(merged.Orders) != 2 {
+		t.Error("state should be taken as is without the base", merged.Orders)
+	}
+}
+
+// strategy known should be updated without reading it and re-read on conflict only, the state saved as a whole merged
+// with ids added concurrently while ids the writer removed stay removed
+func TestVersionConflict(t *testing.T) {
+	os.Setenv("MONGODBNAME", "strategy_service")
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+
+	mt.Run("state", func(mt *mtest.T) {
+		mongodb.SetMongoClient(mt.Client)
+		sm := &mongodb.StateMgmt{Statsd: &statsd_client.StatsdClient{}}
+		strategyId := primitive.NewObjectID()
+		conditions := bson.D{{Key: "pair", Value: "BTC_USDT"}}
+
+		// not known yet, read once
+		mt.AddMockResponses(found(strategyDoc(strategyId, 3, bson.A{"1"}, conditions)), updated(1))
+		sm.UpdateStrategyState(&strategyId, &models.MongoStrategyState{State: "InEntry", Orders: []string{"1", "2"}})
+		// known, written at once
+		mt.AddMockResponses(updated(1))
+		sm.UpdateStrategyState(&strategyId, &models.MongoStrategyState{State: "InEntry", Orders: []string{"1", "2", "3"}})
+		if reads := commandsSent(mt, "find"); reads != 1 {
+			t.Fatal("strategy known shouldn't be read before writing, reads", reads)
+		}
+
+		// order 4 added by another writer while the writer removed 1 and 2 on a new iteration
+		mt.AddMockResponses(updated(0), found(strategyDoc(strategyId, 6, bson.A{"1", "2", "3", "4"}, conditions)), updated(1))
+		sm.UpdateStrategyState(&strategyId, &models.MongoStrategyState{State: "WaitForEntry", Orders: []string{"3", "5"}})
+
+		updates := sentUpdates(mt)
+		if len(updates) != 4 {
+			t.Fatal("conflicting update should be retried once, updates", len(updates))
+		}
+		if version := updates[1].Lookup("q", "version").Int64(); version != 4 {
+			t.Error("update should be conditional on the version written last", version)
+		}
+		if version := updates[3].Lookup("q", "version").Int64(); version != 6 {
+			t.Error("update retried should be conditional on the version read", version)
+		}
+		orders := orderIds(updates[3].Lookup("u", "$set", "state.orders"))
+		if len(orders) != 3 || orders[0] != "3" || orders[1] != "5" || orders[2] != "4" {
+			t.Error("order ids added concurrently should be merged, removed ones not", orders)
+		}
+		if state := updates[3].Lookup("u", "$set", "state.state").StringValue(); state != "WaitForEntry" {
+			t.Error("fields changed should be set", state)
+		}
+		if _, err := updates[3].LookupErr("u", "$set", "state.entryPrice"); err == nil {
+			t.Error("fields not changed shouldn't be set")
+		}
+	})
+
+	mt.Run("conditions", func(mt *mtest.T) {
+		mongodb.SetMongoClient(mt.Client)
+		sm := &mongodb.StateMgmt{Statsd: &statsd_client.StatsdClient{}}
+		strategyId := primitive.NewObjectID()
+		conditions := &models.MongoStrategyCondition{Pair: "BTC_USDT", Leverage: 5}
+
+		stored := bson.D{{Key: "pair", Value: "BTC_USDT"}, {Key: "leverage", Value: 5.0}, {Key: "takeProfitExternal", Value: false}}
+		mt.AddMockResponses(found(strategyDoc(strategyId, 1, bson.A{}, stored)), updated(1))
+		sm.UpdateConditions(&strategyId, conditions)
+
+		// take-profit made internal by another writer while leverage edited
+		edited := *conditions
+		edited.Leverage = 10
+		concurrent := bson.D{{Key: "pair", Value: "BTC_USDT"}, {Key: "leverage", Value: 5.0}, {Key: "takeProfitExternal", Value: true}}
+		mt.AddMockResponses(updated(0), found(strategyDoc(strategyId, 3, bson.A{}, concurrent)), updated(1))
+		sm.UpdateConditions(&strategyId, &edited)
+
+		updates := sentUpdates(mt)
+		if len(updates) != 3 {
+			t.Fatal("conflicting update should be retried once, updates", len(updates))
+		}
+		set, err := updates[2].Lookup("u", "$set").Document().Elements()
+		if err != nil || len(set) != 1 || set[0].Key() != "conditions.leverage" || set[0].Value().Double() != 10 {
+			t.Error("only conditions edited should be set", set, err)
+		}
+	})
+}
+
+// migration should set the fields upgraded only, leaving the ones changed by other writers as stored
+func TestMigrateStrategiesSetsChanges(t *testing.T) {
+	os.Setenv("MONGODBNAME", "strategy_service")
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+
+	mt.Run("migrate", func(mt *mtest.T) {
+		mongodb.SetMongoClient(mt.Client)
+		strategyId := primitive.NewObjectID()
+		conditions := bson.D{{Key: "pair", Value: "BTC_USDT"}, {Key: "leverage", Value: 0.0}}
+		mt.AddMockResponses(found(strategyDoc(strategyId, 2, bson.A{}, conditions)), updated(1))
+
+		sm := mongodb.StateMgmt{Statsd: &statsd_client.StatsdClient{}}
+		scanned, migrated, err := sm.MigrateStrategies(10)
+		if err != nil || scanned != 1 || migrated != 1 {
+			mt.Fatal("strategy should be migrated", scanned, migrated, err)
+		}
+		updates := sentUpdates(mt)
+		if len(updates) != 1 {
+			mt.Fatal("one update should be sent", len(updates))
+		}
+		if version := updates[0].Lookup("q", "version").Int64(); version != 2 {
+			mt.Error("update should match the version read", version)
+		}
+		set, ok := updates[0].Lookup("u", "$set").DocumentOK()
+		if !ok {
+			mt.Fatal("changes should be set, not the document replaced", updates[0])
+		}
+		if set.Lookup("conditions.leverage").Double() != 1 || set.Lookup("schemaVersion").Int64() != schema.CurrentVersion() ||
+			set.Lookup("version").Int64() != 3 {
+			mt.Error("upgraded fields and versions should be set", set)
+		}
+		elements, _ := set.Elements()
+		if len(elements) != 3 {
+			mt.Error("fields not upgraded shouldn't be set", set)
+		}
+	})
+}
@@ -0,0 +1,97 @@
+package mongodb
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"gitlab.com/crypto_project/core/strategy_service/src/sources/mongodb"
+	statsd_client "gitlab.com/crypto_project/core/strategy_service/src/statsd"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+// sentCommands returns commands of the name given sent.
+func sentCommands(mt *mtest.T, name string) []bson.Raw {
+	var commands []bson.Raw
+	for _, event := range mt.GetAllStartedEvents() {
+		if event.CommandName == name {
+			commands = append(commands, event.Command)
+		}
+	}
+	return commands
+}
+
+// the watch should resume after the token saved by the instance, or by any instance if shared, and save the token
+// of events handled
+func TestResumableWatch(t *testing.T) {
+	os.Setenv("MONGODBNAME", "strategy_service")
+	os.Setenv("INSTANCE_ID", "instance-1")
+	defer os.Unsetenv("INSTANCE_ID")
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+
+	for _, test := range []struct {
+		name    string
+		shared  bool
+		tokenId string
+	}{
+		{"per instance", false, "orders/instance-1"},
+		{"shared", true, "orders"},
+	} {
+		mt.Run(test.name, func(mt *mtest.T) {
+			mongodb.SetMongoClient(mt.Client)
+			saved := bson.D{{Key: "_data", Value: "saved"}}
+			event := bson.D{{Key: "_id", Value: bson.D{{Key: "_data", Value: "next"}}}, {Key: "operationType", Value: "update"}}
+			mt.AddMockResponses(
+				mtest.CreateCursorResponse(0, "strategy_service.core_resume_tokens", mtest.FirstBatch, bson.D{{Key: "_id", Value: test.tokenId}, {Key: "token", Value: saved}}),
+				mtest.CreateCursorResponse(1, "strategy_service.core_orders", mtest.FirstBatch, event),
+				mtest.CreateCursorResponse(0, "strategy_service.core_orders", mtest.NextBatch),
+				updated(1),
+			)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			handled := 0
+			watch := mongodb.ResumableWatch{
+				Name:       "orders",
+				Shared:     test.shared,
+				Collection: mongodb.GetCollection("core_orders"),
+				Pipeline:   mongo.Pipeline{},
+				Statsd:     &statsd_client.StatsdClient{},
+				Handle: func(cs *mongo.ChangeStream) {
+					handled++
+					cancel()
+				},
+			}
+			watch.RunUntil(ctx)
+
+			if handled != 1 {
+				mt.Fatal("event should be handled once, handled", handled)
+			}
+			finds := sentCommands(mt, "find")
+			if len(finds) != 1 || finds[0].Lookup("filter", "_id").StringValue() != test.tokenId {
+				mt.Fatal("token should be read by", test.tokenId, finds)
+			}
+			aggregates := sentCommands(mt, "aggregate")
+			if len(aggregates) == 0 {
+				mt.Fatal("stream should be opened")
+			}
+			stage, _ := aggregates[0].Lookup("pipeline").Array().Index(0).Value().Document().LookupErr("$changeStream", "resumeAfter", "_data")
+			if stage.StringValue() != "saved" {
+				mt.Error("stream should be resumed after the token saved", aggregates[0])
+			}
+			updates := sentUpdates(mt)
+			if len(updates) != 1 {
+				mt.Fatal("token of the event handled should be saved", updates)
+			}
+			if id := updates[0].Lookup("q", "_id").StringValue(); id != test.tokenId {
+				mt.Error("token should be saved by", test.tokenId, id)
+			}
+			if token := updates[0].Lookup("u", "$set", "token", "_data").StringValue(); token != "next" {
+				mt.Error("token of the event handled should be saved", token)
+			}
+		})
+	}
+}
@@ -0,0 +1,79 @@
+package mongodb
+
+import (
+	"os"
+	"testing"
+
+	"gitlab.com/crypto_project/core/strategy_service/src/sources/mongodb"
+	"gitlab.com/crypto_project/core/strategy_service/src/sources/mongodb/schema"
+	statsd_client "gitlab.com/crypto_project/core/strategy_service/src/statsd"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+// nonces should expire by TTL index created before the first nonce registered, replays should be rejected
+func TestRegisterWebhookNonce(t *testing.T) {
+	os.Setenv("MONGODBNAME", "strategy_service")
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+
+	// the index is created once before the first nonce registered in the process
+	mt.Run("index", func(mt *mtest.T) {
+		mongodb.SetMongoClient(mt.Client)
+		sm := &mongodb.StateMgmt{Statsd: &statsd_client.StatsdClient{}}
+		mt.AddMockResponses(mtest.CreateSuccessResponse(), mtest.CreateSuccessResponse())
+
+		if !sm.RegisterWebhookNonce("template:1") {
+			mt.Error("new nonce should be registered")
+		}
+		indexes := sentCommands(mt, "createIndexes")
+		if len(indexes) > 1 {
+			mt.Fatal("index should be created once", len(indexes))
+		}
+		for _, command := range indexes {
+			index := command.Lookup("indexes").Array().Index(0).Value().Document()
+			if _, ok := index.Lookup("key", "createdAt").AsInt64OK(); !ok {
+				mt.Error("index should be on createdAt", index)
+			}
+			if ttl, ok := index.Lookup("expireAfterSeconds").AsInt64OK(); !ok || ttl <= 0 {
+				mt.Error("nonces should expire", index)
+			}
+		}
+	})
+
+	mt.Run("replay", func(mt *mtest.T) {
+		mongodb.SetMongoClient(mt.Client)
+		sm := &mongodb.StateMgmt{Statsd: &statsd_client.StatsdClient{}}
+		mt.AddMockResponses(mtest.CreateWriteErrorsResponse(mtest.WriteError{Index: 0, Code: 11000, Message: "duplicate key"}))
+
+		if sm.RegisterWebhookNonce("template:1") {
+			mt.Error("nonce registered already should be rejected as a replay")
+		}
+		if indexes := sentCommands(mt, "createIndexes"); len(indexes) != 0 {
+			mt.Error("index shouldn't be created again", len(indexes))
+		}
+	})
+}
+
+// templates stored at an older schema version should be upgraded before strategies are created from them
+func TestGetTemplateByTokenUpgrades(t *testing.T) {
+	os.Setenv("MONGODBNAME", "strategy_service")
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+
+	mt.Run("upgrade", func(mt *mtest.T) {
+		mongodb.SetMongoClient(mt.Client)
+		sm := &mongodb.StateMgmt{Statsd: &statsd_client.StatsdClient{}}
+		conditions := bson.D{{Key: "templateToken", Value: "token"}, {Key: "leverage", Value: 0.0}}
+		mt.AddMockResponses(found(strategyDoc(primitive.NewObjectID(), 1, bson.A{}, conditions)))
+
+		template := sm.GetTemplateByToken("token")
+		if template == nil {
+			mt.Fatal("template should be found")
+		}
+		if template.Conditions.Leverage != 1 || template.SchemaVersion != schema.CurrentVersion() {
+			mt.Errorf("template should be upgraded %v %+v", template.SchemaVersion, template.Conditions)
+		}
+	})
+}
@@ -0,0 +1,175 @@
+package mongodb
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"gitlab.com/crypto_project/core/strategy_service/src/sources/mongodb"
+	statsd_client "gitlab.com/crypto_project/core/strategy_service/src/statsd"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type sink struct {
+	writes  []map[primitive.ObjectID]bson.D
+	err     error
+	written chan struct{} // receives once a write started if set, the write waits for it to be read
+	mux     sync.Mutex
+}
+
+func (s *sink) write(updates map[primitive.ObjectID]bson.D) error {
+	if s.written != nil {
+		s.written <- struct{}{}
+	}
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if s.err != nil {
+		return s.err
+	}
+	s.writes = append(s.writes, updates)
+	return nil
+}
+
+// setFields returns fields the update sets.
+func setFields(update bson.D) bson.D {
+	for _, operator := range update {
+		if operator.Key == "$set" {
+			return operator.Value.(bson.D)
+		}
+	}
+	return nil
+}
+
+func TestWriteBehindCoalescing(t *testing.T) {
+	s := &sink{}
+	wb := mongodb.NewWriteBehindTo(time.Second, &statsd_client.StatsdClient{}, s.write)
+	first, second := primitive.NewObjectID(), primitive.NewObjectID()
+	wb.Set(&first, bson.D{{Key: "state.state", Value: "TrailingEntry"}})
+	wb.Set(&first, bson.D{{Key: "state.state", Value: "InEntry"}, {Key: "state.msg", Value: "ok"}})
+	wb.Set(&second, bson.D{{Key: "state.state", Value: "WaitForEntry"}})
+	wb.Flush()
+
+	if len(s.writes) != 1 || len(s.writes[0]) != 2 {
+		t.Fatal("updates of all strategies should be written at once", s.writes)
+	}
+	fields := setFields(s.writes[0][first])
+	if len(fields) != 2 || fields[0].Value != "InEntry" || fields[1].Value != "ok" {
+		t.Error("updates of a strategy should be coalesced with the last values", fields)
+	}
+	wb.Flush()
+	if len(s.writes) != 1 {
+		t.Error("nothing should be written without updates")
+	}
+}
+
+func TestWriteBehindSync(t *testing.T) {
+	s := &sink{}
+	wb := mongodb.NewWriteBehindTo(time.Second, &statsd_client.StatsdClient{}, s.write)
+	synced, other := primitive.NewObjectID(), primitive.NewObjectID()
+	wb.Set(&synced, bson.D{{Key: "state.state", Value: "InEntry"}})
+	wb.Set(&other, bson.D{{Key: "state.state", Value: "InEntry"}})
+	written := 0
+	wb.Sync(&synced, func() {
+		written = len(s.writes)
+	})
+	if written != 1 || len(s.writes[0]) != 1 || s.writes[0][synced] == nil {
+		t.Error("only updates buffered for the strategy should be written before the write synced", s.writes)
+	}
+	wb.Flush()
+	if len(s.writes) != 2 || s.writes[1][other] == nil {
+		t.Error("other strategies updates should be left for the flush", s.writes)
+	}
+}
+
+func TestWriteBehindFailure(t *testing.T) {
+	s := &sink{err: errors.New("no primary")}
+	wb := mongodb.NewWriteBehindTo(time.Second, &statsd_client.StatsdClient{}, s.write)
+	strategyId := primitive.NewObjectID()
+	wb.Set(&strategyId, bson.D{{Key: "state.state", Value: "InEntry"}, {Key: "state.msg", Value: "old"}})
+	wb.Flush()
+	wb.Set(&strategyId, bson.D{{Key: "state.msg", Value: "new"}})
+	s.err = nil
+	wb.Flush()
+	if len(s.writes) != 1 {
+		t.Fatal("updates failed should be written on the next flush")
+	}
+	fields := setFields(s.writes[0][strategyId])
+	if len(fields) != 2 || fields[0].Value != "InEntry" || fields[1].Value != "new" {
+		t.Error("updates buffered after the failure should win", fields)
+	}
+}
+
+func TestWriteBehindAddToSet(t *testing.T) {
+	s := &sink{}
+	wb := mongodb.NewWriteBehindTo(time.Second, &statsd_client.StatsdClient{}, s.write)
+	strategyId := primitive.NewObjectID()
+	wb.AddToSet(&strategyId, "state.orders", []string{"1"})
+	wb.AddToSet(&strategyId, "state.executedOrders", []string{"1"})
+	wb.Set(&strategyId, bson.D{{Key: "state.executedOrders", Value: []string{}}})
+	wb.AddToSet(&strategyId, "state.orders", []string{"1", "2"})
+	wb.Write(&strategyId, bson.D{{Key: "state.entryPrice", Value: 7000.0}})
+
+	if len(s.writes) != 1 {
+		t.Fatal("updates buffered should be written at once with the write", s.writes)
+	}
+	update := s.writes[0][strategyId]
+	fields := setFields(update)
+	if len(fields) != 2 || fields[0].Key != "state.executedOrders" || len(fields[0].Value.([]string)) != 0 {
+		t.Error("ids set should replace ids added before", fields)
+	}
+	added := update[1].Value.(bson.D)
+	if update[1].Key != "$addToSet" || len(added) != 1 || added[0].Key != "state.orders" {
+		t.Fatal("ids should be added to the set", update)
+	}
+	if ids := added[0].Value.(bson.D)[0].Value.([]string); len(ids) != 2 {
+		t.Error("ids added should be coalesced", ids)
+	}
+}
+
+// writes of a strategy should wait for ones in progress, writes of other strategies shouldn't
+func TestWriteBehindLocksPerStrategy(t *testing.T) {
+	s := &sink{written: make(chan struct{})}
+	wb := mongodb.NewWriteBehindTo(time.Second, &statsd_client.StatsdClient{}, s.write)
+	synced, other := primitive.NewObjectID(), primitive.NewObjectID()
+	wb.Set(&synced, bson.D{{Key: "state.state", Value: "InEntry"}})
+
+	syncing, synced2 := make(chan struct{}), make(chan struct{})
+	go wb.Sync(&synced, func() {
+		close(syncing)
+		<-synced2
+	})
+	<-s.written // buffered fields flushed before the write synced
+	<-syncing
+
+	wb.Set(&synced, bson.D{{Key: "state.state", Value: "TakeProfit"}})
+	wb.Set(&other, bson.D{{Key: "state.state", Value: "InEntry"}})
+	flushed := make(chan struct{})
+	go func() {
+		wb.Flush()
+		close(flushed)
+	}()
+	<-s.written
+	<-flushed
+	if len(s.writes) != 2 || len(s.writes[1]) != 1 || s.writes[1][other] == nil {
+		t.Fatal("other strategies should be flushed while the strategy synced", s.writes)
+	}
+
+	written := make(chan struct{})
+	go func() {
+		wb.Write(&synced, bson.D{{Key: "state.msg", Value: "ok"}})
+		close(written)
+	}()
+	select {
+	case <-s.written:
+		t.Fatal("strategy synced shouldn't be written until the write synced done")
+	case <-time.After(100 * time.Millisecond):
+	}
+	close(synced2)
+	<-s.written
+	<-written
+	if len(s.writes) != 3 || len(setFields(s.writes[2][synced])) != 2 {
+		t.Error("updates buffered while synced should be written after", s.writes)
+	}
+}
@@ -0,0 +1,267 @@
+package mysql
+
+import (
+	"database/sql/driver"
+	"errors"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"gitlab.com/crypto_project/core/strategy_service/src/sources/eventDriven/mysql"
+	"gitlab.com/crypto_project/core/strategy_service/src/sources/mongodb/models"
+	statsd_client "gitlab.com/crypto_project/core/strategy_service/src/statsd"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// tables created by migrations by version
+var migrationTables = map[int64][]string{
+	1: {"strategies", "strategy_states", "strategy_state_history", "orders", "positions", "markets", "key_balances",
+		"template_pnl", "changes"},
+	2: {"strategy_journal"},
+}
+
+// columns added by migrations by version, by table
+var migrationColumns = map[int64][][2]string{
+	3: {{"changes", "enabled"}},
+}
+
+// containsArg matches a text argument containing all the parts given.
+type containsArg []string
+
+func (a containsArg) Match(value driver.Value) bool {
+	var text string
+	switch v := value.(type) {
+	case []byte:
+		text = string(v)
+	case string:
+		text = v
+	default:
+		return false
+	}
+	for _, part := range a {
+		if !strings.Contains(text, part) {
+			return false
+		}
+	}
+	return true
+}
+
+func newMock(t *testing.T) (*mysql.SQLConn, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal("sqlmock", err)
+	}
+	return mysql.NewSQLConn(db), mock
+}
+
+// expectSchemaVersion expects the schema version to be read as the one given.
+func expectSchemaVersion(mock sqlmock.Sqlmock, version int64) {
+	mock.ExpectExec(regexp.QuoteMeta("CREATE TABLE IF NOT EXISTS schema_migrations")).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT COALESCE(MAX(version), 0) FROM schema_migrations")).
+		WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(version))
+}
+
+// newStateMgmt returns state management over the mocked database migrated already.
+func newStateMgmt(t *testing.T) (*mysql.StateMgmt, sqlmock.Sqlmock) {
+	conn, mock := newMock(t)
+	expectSchemaVersion(mock, mysql.SchemaVersion())
+	return mysql.NewStateMgmt(conn, &statsd_client.StatsdClient{}), mock
+}
+
+// expectStrategy expects the strategy to be read with the documents given.
+func expectStrategy(mock sqlmock.Sqlmock, strategyId primitive.ObjectID, forUpdate bool, state string) {
+	query := "SELECT s.document, s.conditions, st.document FROM strategies s"
+	if forUpdate {
+		query = "SELECT s.document, s.conditions, st.document FROM strategies s .* FOR UPDATE"
+	}
+	mock.ExpectQuery(query).
+		WithArgs(strategyId.Hex()).
+		WillReturnRows(sqlmock.NewRows([]string{"document", "conditions", "document"}).AddRow(
+			[]byte(`{"_id":"`+strategyId.Hex()+`","type":1,"enabled":true,"version":4}`),
+			[]byte(`{"pair":"BTC_USDT","marketType":1}`),
+			[]byte(state),
+		))
+}
+
+// migrations not applied yet should be applied in order, each one in a transaction recording its version
+func TestMysqlMigrate(t *testing.T) {
+	conn, mock := newMock(t)
+	expectSchemaVersion(mock, 0)
+	for version := int64(1); version <= mysql.SchemaVersion(); version++ {
+		mock.ExpectBegin()
+		for _, table := range migrationTables[version] {
+			mock.ExpectExec(regexp.QuoteMeta("CREATE TABLE IF NOT EXISTS " + table + " (")).
+				WillReturnResult(sqlmock.NewResult(0, 0))
+		}
+		for _, column := range migrationColumns[version] {
+			mock.ExpectExec(regexp.QuoteMeta("ALTER TABLE " + column[0] + " ADD COLUMN " + column[1] + " ")).
+				WillReturnResult(sqlmock.NewResult(0, 0))
+		}
+		mock.ExpectExec(regexp.QuoteMeta("INSERT INTO schema_migrations (version, applied_at)")).
+			WithArgs(version, sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+	}
+	if err := conn.Migrate(); err != nil {
+		t.Fatal("migration failed", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+
+	conn, mock = newMock(t)
+	expectSchemaVersion(mock, mysql.SchemaVersion())
+	if err := conn.Migrate(); err != nil {
+		t.Fatal("migration of the latest schema failed", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error("nothing should be applied to the latest schema", err)
+	}
+}
+
+// migration failed should be rolled back without its version recorded
+func TestMysqlMigrateFailure(t *testing.T) {
+	conn, mock := newMock(t)
+	expectSchemaVersion(mock, 1)
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("CREATE TABLE IF NOT EXISTS strategy_journal")).
+		WillReturnError(errors.New("disk full"))
+	mock.ExpectRollback()
+	if err := conn.Migrate(); err == nil || !strings.Contains(err.Error(), "migration 2") {
+		t.Error("migration failure should be returned", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+// state update should change the state read in the transaction holding the strategy, keep the rest of it, increment
+// the version and record history and the change
+func TestMysqlUpdateState(t *testing.T) {
+	sm, mock := newStateMgmt(t)
+	strategyId := primitive.NewObjectID()
+	mock.ExpectBegin()
+	expectStrategy(mock, strategyId, true, `{"state":"WaitForEntry","entryPrice":7000,"orders":["1"]}`)
+	mock.ExpectExec("INSERT INTO strategies").
+		WithArgs(strategyId.Hex(), int64(1), true, nil, "BTC_USDT", int64(1),
+			containsArg{`"pair":"BTC_USDT"`}, containsArg{`"version":5`}, sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO strategy_states").
+		WithArgs(strategyId.Hex(), "InEntry", "", 7000.0, 0.0, 0.0, 0.0, 0.0,
+			containsArg{`"state":"InEntry"`, `"entryPrice":7000`, `"orders":["1"]`}, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO strategy_state_history").
+		WithArgs(strategyId.Hex(), "InEntry", containsArg{`"state":"InEntry"`}, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("INSERT INTO changes").
+		WithArgs("strategy", strategyId.Hex(), false, false, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	sm.UpdateState(&strategyId, &models.MongoStrategyState{State: "InEntry"})
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+// update enabling a disabled strategy should be recorded as enabling it, so watchers check quotas
+func TestMysqlEnableStrategy(t *testing.T) {
+	sm, mock := newStateMgmt(t)
+	strategyId := primitive.NewObjectID()
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT s.document, s.conditions, st.document FROM strategies s .* FOR UPDATE").
+		WithArgs(strategyId.Hex()).
+		WillReturnRows(sqlmock.NewRows([]string{"document", "conditions", "document"}).AddRow(
+			[]byte(`{"_id":"`+strategyId.Hex()+`","type":1,"enabled":false,"version":4}`),
+			[]byte(`{"pair":"BTC_USDT","marketType":1}`),
+			nil,
+		))
+	mock.ExpectExec("INSERT INTO strategies").
+		WithArgs(strategyId.Hex(), int64(1), true, nil, "BTC_USDT", int64(1),
+			sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO changes").
+		WithArgs("strategy", strategyId.Hex(), false, true, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	sm.EnableStrategy(&strategyId)
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+// update failed in the middle should be rolled back entirely
+func TestMysqlUpdateRollback(t *testing.T) {
+	sm, mock := newStateMgmt(t)
+	strategyId := primitive.NewObjectID()
+	mock.ExpectBegin()
+	expectStrategy(mock, strategyId, true, `{"state":"InEntry"}`)
+	mock.ExpectExec("INSERT INTO strategies").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO strategy_states").WillReturnError(errors.New("lock wait timeout"))
+	mock.ExpectRollback()
+
+	sm.UpdateExecutedAmount(&strategyId, &models.MongoStrategyState{ExecutedAmount: 0.1})
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+// changes polled should be delivered to order callbacks and strategy watchers once, changes old enough pruned
+func TestMysqlChangesPolling(t *testing.T) {
+	sm, mock := newStateMgmt(t)
+	strategyId := primitive.NewObjectID()
+	var ordersDelivered, strategiesDelivered int32
+	sm.OrderCallbacks.Store("o1", func(order *models.MongoOrder) {
+		if order.Status == "filled" && order.Filled == 0.1 {
+			atomic.AddInt32(&ordersDelivered, 1)
+		}
+	})
+	sm.WatchStrategies(func(strategy *models.MongoStrategy, enabled bool) {
+		if *strategy.ID == strategyId && enabled && strategy.State.State == "InEntry" {
+			atomic.AddInt32(&strategiesDelivered, 1)
+		}
+	})
+
+	changes := func() *sqlmock.Rows {
+		return sqlmock.NewRows([]string{"id", "entity", "entity_id", "enabled"}).
+			AddRow(1006, "order", "o1", false).
+			AddRow(1007, "strategy", strategyId.Hex(), true)
+	}
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT COALESCE(MAX(id), 0) FROM changes")).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1005))
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM changes WHERE id <= ? AND created_at < ?")).
+		WithArgs(int64(5), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 3))
+	mock.ExpectQuery("SELECT id, entity, entity_id, enabled FROM changes").
+		WithArgs(int64(5)).
+		WillReturnRows(changes())
+	mock.ExpectQuery("FROM orders WHERE order_id = ?").
+		WithArgs("o1").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "order_id", "post_only_initial_order_id", "symbol", "side", "type",
+			"status", "position_side", "reduce_only", "amount", "filled", "average", "price", "stop_price", "updated_at"}).
+			AddRow(primitive.NewObjectID().Hex(), "o1", "", "BTC_USDT", "buy", "market", "filled", "BOTH", false, 0.1,
+				0.1, 7000.0, 0.0, 0.0, time.Now().Unix()*1000))
+	expectStrategy(mock, strategyId, false, `{"state":"InEntry"}`)
+	// changes re-read by the look back shouldn't be delivered again
+	mock.ExpectQuery("SELECT id, entity, entity_id, enabled FROM changes").
+		WithArgs(int64(7)).
+		WillReturnRows(changes())
+
+	go sm.InitOrdersWatch()
+	time.Sleep(1500 * time.Millisecond)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+	if delivered := atomic.LoadInt32(&ordersDelivered); delivered != 1 {
+		t.Error("order filled should be delivered once, delivered", delivered)
+	}
+	if delivered := atomic.LoadInt32(&strategiesDelivered); delivered != 1 {
+		t.Error("strategy enabled should be delivered once, delivered", delivered)
+	}
+}
@@ -0,0 +1,266 @@
+package pairs_order
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-redsync/redsync/v4"
+	"gitlab.com/crypto_project/core/strategy_service/src/service/journal"
+	"gitlab.com/crypto_project/core/strategy_service/src/service/strategies"
+	"gitlab.com/crypto_project/core/strategy_service/src/service/strategies/legs"
+	"gitlab.com/crypto_project/core/strategy_service/src/service/strategies/pairs_order"
+	"gitlab.com/crypto_project/core/strategy_service/src/sources/memory"
+	"gitlab.com/crypto_project/core/strategy_service/src/sources/mongodb/models"
+	"gitlab.com/crypto_project/core/strategy_service/tests"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// newPairsOrder returns pairs order of 10 ETH against 0.5 BTC trading with the mock, its orders are filled through the store.
+func newPairsOrder() (*pairs_order.PairsOrder, *tests.MockLegsTrading, *memory.StateMgmt) {
+	id := primitive.NewObjectID()
+	model := &models.MongoStrategy{
+		ID:      &id,
+		Enabled: true,
+		Conditions: &models.MongoStrategyCondition{
+			Pair:       "ETH_USDT",
+			Exchange:   "binance",
+			MarketType: 1,
+			Pairs: &models.MongoPairsConditions{
+				SecondPair:     "BTC_USDT",
+				Amount:         10,
+				SecondAmount:   0.5,
+				Window:         3,
+				EntryDeviation: 2,
+				ExitDeviation:  0.5,
+				StopDeviation:  4,
+				LegTimeout:     1,
+			},
+		},
+		State: &models.MongoStrategyState{},
+	}
+	sm := memory.NewStateMgmt()
+	sm.SetMarketPrecision("ETH_USDT", 1, 2, 3)
+	sm.SetMarketPrecision("BTC_USDT", 1, 2, 3)
+	sm.CreateStrategy(model)
+	trading := tests.NewMockedLegsTrading(sm)
+	keyId := primitive.NewObjectID()
+	logger, stats := tests.GetLoggerStatsd()
+	strategy := strategies.Strategy{
+		Model:           model,
+		StateMgmt:       sm,
+		Log:             logger,
+		Statsd:          stats,
+		SettlementMutex: &redsync.Mutex{},
+		Journal:         journal.New(id, sm),
+	}
+	return pairs_order.New(&strategy, tests.NewMockedDataFeed(nil), trading, stats, &keyId, sm), trading, sm
+}
+
+// trade fires the ratio z-score given as the event loop does.
+func trade(po *pairs_order.PairsOrder, z float64) {
+	po.Lock()
+	defer po.Unlock()
+	_ = po.State.Fire(pairs_order.TriggerTrade, z)
+}
+
+// currentState reads the state serialized with order callbacks.
+func currentState(po *pairs_order.PairsOrder) string {
+	po.Lock()
+	defer po.Unlock()
+	return po.CurrentState()
+}
+
+func waitForState(t *testing.T, po *pairs_order.PairsOrder, state string) {
+	t.Helper()
+	if !tests.WaitFor(3*time.Second, func() bool { return currentState(po) == state }) {
+		t.Fatal("pairs order should reach state", state, "but it's", currentState(po))
+	}
+}
+
+// pairs order should enter both legs on deviation and close them on mean reversion
+func TestPairsOrderEntryAndExit(t *testing.T) {
+	po, trading, _ := newPairsOrder()
+	trade(po, 1)
+	if currentState(po) != pairs_order.WaitForEntry || len(trading.Orders()) != 0 {
+		t.Fatal("pairs order shouldn't enter below entry deviation")
+	}
+
+	trade(po, -2.5)
+	placed := trading.Orders()
+	if currentState(po) != pairs_order.WaitEntryLegs || len(placed) != 2 {
+		t.Fatal("pairs order should wait for both legs placed", currentState(po), len(placed))
+	}
+	if placed[0].KeyParams.Symbol != "ETH_USDT" || placed[0].KeyParams.Side != "buy" || placed[0].KeyParams.Amount != 10 ||
+		placed[1].KeyParams.Symbol != "BTC_USDT" || placed[1].KeyParams.Side != "sell" || placed[1].KeyParams.Amount != 0.5 {
+		t.Error("cheap leg should be bought and expensive one sold", placed)
+	}
+	trading.Fill(trading.OrderId(1), 10, 100)
+	trading.Fill(trading.OrderId(2), 0.5, 2000)
+	waitForState(t, po, pairs_order.InEntry)
+
+	trade(po, -1)
+	if currentState(po) != pairs_order.InEntry {
+		t.Fatal("pairs order shouldn't exit before reversion")
+	}
+	trade(po, 0)
+	placed = trading.Orders()
+	if currentState(po) != pairs_order.WaitExitLegs || len(placed) != 4 {
+		t.Fatal("pairs order should close both legs on reversion", currentState(po), len(placed))
+	}
+	if placed[2].KeyParams.Side != "sell" || !*placed[2].KeyParams.ReduceOnly || placed[3].KeyParams.Side != "buy" {
+		t.Error("legs should be closed with reduce-only orders of opposite sides", placed[2:])
+	}
+	trading.Fill(trading.OrderId(3), 10, 110)
+	trading.Fill(trading.OrderId(4), 0.5, 2000)
+	waitForState(t, po, pairs_order.End)
+
+	po.Lock()
+	defer po.Unlock()
+	if profit := po.Strategy.GetModel().State.ReceivedProfitAmount; profit != 100 {
+		t.Error("profit of closed legs should be received", profit)
+	}
+}
+
+// pairs order should journal its transitions, legs orders placed and filled, so its state can be rebuilt
+func TestPairsOrderJournal(t *testing.T) {
+	po, trading, sm := newPairsOrder()
+	trade(po, -2.5)
+	trading.Fill(trading.OrderId(1), 10, 100)
+	trading.Fill(trading.OrderId(2), 0.5, 2000)
+	waitForState(t, po, pairs_order.InEntry)
+
+	steps, updated := po.Strategy.GetJournal().OrderHistory()
+	if len(steps) != 2 || steps[trading.OrderId(1)] != pairs_order.WaitEntryLegs {
+		t.Error("legs orders placed should be journaled with the state placed in", steps)
+	}
+	if !updated[trading.OrderId(1)] || !updated[trading.OrderId(2)] {
+		t.Error("legs orders filled should be journaled", updated)
+	}
+	entries := sm.GetJournal(po.Strategy.GetModel().ID, 0)
+	state, _, err := journal.Rebuild(entries)
+	if err != nil || state.State != pairs_order.InEntry || len(state.Legs) != 2 || state.Legs[0].Filled != 10 {
+		t.Errorf("state should be rebuilt from the journal, got %+v, %v", state, err)
+	}
+}
+
+// pairs order should unwind the leg filled above the other one and stay in entry with balanced legs
+func TestPairsOrderUnwindsImbalance(t *testing.T) {
+	po, trading, _ := newPairsOrder()
+	trade(po, 3)
+	trading.Fill(trading.OrderId(1), 10, 100)
+	trading.Fill(trading.OrderId(2), 0.2, 2000)
+	waitForState(t, po, pairs_order.InEntry)
+
+	placed := trading.Orders()
+	if len(placed) != 3 {
+		t.Fatal("excess of the first leg should be unwound", len(placed))
+	}
+	if unwind := placed[2].KeyParams; unwind.Symbol != "ETH_USDT" || unwind.Side != "buy" || unwind.Amount != 6 {
+		t.Error("60% of the first leg should be bought back", unwind)
+	}
+	po.Lock()
+	first := po.Strategy.GetModel().State.Legs[0]
+	if first.Filled != 10 || first.Unwinding != 6 || first.UnwindOrderId != trading.OrderId(3) {
+		t.Errorf("excess should be subtracted once unwound, first leg %+v", first)
+	}
+	po.Unlock()
+
+	trading.Fill(trading.OrderId(3), 6, 101)
+	if !tests.WaitFor(time.Second, func() bool {
+		po.Lock()
+		defer po.Unlock()
+		return first.Filled == 4 && first.Unwinding == 0 && first.UnwindOrderId == ""
+	}) {
+		t.Error("balanced amount should be left in the first leg once unwound", first.Filled)
+	}
+	if currentState(po) != pairs_order.InEntry {
+		t.Error("unwind order filled shouldn't change the state", currentState(po))
+	}
+}
+
+// pairs order should stop with error keeping the excess once its unwind order rejected
+func TestPairsOrderUnwindRejected(t *testing.T) {
+	po, trading, _ := newPairsOrder()
+	trade(po, 3)
+	trading.Fail = true
+	trading.Fill(trading.OrderId(1), 10, 100)
+	trading.Fill(trading.OrderId(2), 0.2, 2000)
+	waitForState(t, po, pairs_order.Error)
+
+	po.Lock()
+	defer po.Unlock()
+	model := po.Strategy.GetModel()
+	if first := model.State.Legs[0]; first.Filled != 10 || first.Unwinding != 0 {
+		t.Errorf("excess not unwound should be left in the first leg %+v", first)
+	}
+	if !strings.Contains(model.State.Msg, "can't unwind") {
+		t.Error("error should explain the excess left", model.State.Msg)
+	}
+}
+
+// pairs order should cancel legs not filled in time and unwind the filled one
+func TestPairsOrderLegTimeout(t *testing.T) {
+	po, trading, _ := newPairsOrder()
+	trade(po, -3)
+	trading.Fill(trading.OrderId(1), 10, 100)
+	waitForState(t, po, pairs_order.WaitForEntry)
+
+	if len(trading.Canceled) != 1 || trading.Canceled[0] != trading.OrderId(2) {
+		t.Error("leg not filled in time should be canceled", trading.Canceled)
+	}
+	placed := trading.Orders()
+	if len(placed) != 3 || placed[2].KeyParams.Side != "sell" || placed[2].KeyParams.Amount != 10 {
+		t.Error("filled leg should be unwound completely", placed)
+	}
+	po.Lock()
+	defer po.Unlock()
+	if model := po.Strategy.GetModel(); model.State.Legs != nil || model.State.Msg != "legs not filled" {
+		t.Error("legs should be reset to wait for entry again", model.State.Legs, model.State.Msg)
+	}
+}
+
+// pairs order stopped in entry should close legs entered and disable the strategy
+func TestPairsOrderStopClosesLegs(t *testing.T) {
+	po, trading, sm := newPairsOrder()
+	trade(po, -2.5)
+	trading.Fill(trading.OrderId(1), 10, 100)
+	trading.Fill(trading.OrderId(2), 0.5, 2000)
+	waitForState(t, po, pairs_order.InEntry)
+
+	po.Stop()
+	placed := trading.Orders()
+	if len(placed) != 4 || placed[2].KeyParams.Side != "sell" || placed[3].KeyParams.Side != "buy" {
+		t.Error("legs entered should be closed on stop", placed)
+	}
+	if state := po.Strategy.GetModel().State.State; state != pairs_order.Canceled {
+		t.Error("stopped pairs order should be canceled", state)
+	}
+	if sm.GetStrategy(po.Strategy.GetModel().ID).Enabled {
+		t.Error("stopped pairs order should be disabled")
+	}
+}
+
+// pairs order should give up with error once legs orders rejected too many rounds in a row
+func TestPairsOrderFailedRounds(t *testing.T) {
+	po, trading, _ := newPairsOrder()
+	trading.Fail = true
+	for i := 1; i <= legs.MaxFailedRounds; i++ {
+		trade(po, 3)
+		if currentState(po) != pairs_order.WaitEntryLegs {
+			t.Fatal("pairs order should try to enter on round", i, currentState(po))
+		}
+		po.FireOrder(models.MongoOrder{}) // as the backoff does once passed
+		if i < legs.MaxFailedRounds && currentState(po) != pairs_order.WaitForEntry {
+			t.Fatal("pairs order should retry after round", i, currentState(po))
+		}
+	}
+	if currentState(po) != pairs_order.Error {
+		t.Fatal("pairs order should stop with error", currentState(po))
+	}
+	po.Lock()
+	defer po.Unlock()
+	if msg := po.Strategy.GetModel().State.Msg; !strings.Contains(msg, "insufficient balance") {
+		t.Error("error should tell the last order rejection", msg)
+	}
+}
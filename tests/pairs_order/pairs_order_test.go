@@ -0,0 +1,59 @@
+package pairs_order
+
+import (
+	"math"
+	"testing"
+
+	"gitlab.com/crypto_project/core/strategy_service/src/service/strategies/legs"
+	"gitlab.com/crypto_project/core/strategy_service/src/service/strategies/pairs_order"
+	"gitlab.com/crypto_project/core/strategy_service/src/sources/mongodb/models"
+)
+
+func TestPairsRollingStats(t *testing.T) {
+	stats := pairs_order.RollingStats{Window: 4}
+	for _, ratio := range []float64{100, 1, 2, 3, 4} {
+		stats.Add(ratio)
+	}
+	if !stats.Ready() || len(stats.Values) != 4 {
+		t.Fatal("window should keep the last 4 samples", stats.Values)
+	}
+	if stats.Mean() != 2.5 {
+		t.Error("wrong mean", stats.Mean())
+	}
+	if math.Abs(stats.Std()-math.Sqrt(1.25)) > 1e-9 {
+		t.Error("wrong std", stats.Std())
+	}
+	if z := stats.ZScore(2.5 + 2*math.Sqrt(1.25)); math.Abs(z-2) > 1e-9 {
+		t.Error("wrong z-score", z)
+	}
+}
+
+func TestPairsBalanceLegs(t *testing.T) {
+	mongoLegs := []*models.MongoLeg{
+		{Pair: "ETH_USDT", Side: "buy", Amount: 10, Filled: 10},
+		{Pair: "BTC_USDT", Side: "sell", Amount: 0.5, Filled: 0.2},
+	}
+	fraction, excess := legs.BalanceLegs(mongoLegs)
+	if fraction != 0.4 {
+		t.Error("wrong balanced fraction", fraction)
+	}
+	if math.Abs(excess[0]-6) > 1e-9 || math.Abs(excess[1]) > 1e-9 {
+		t.Error("wrong excess", excess)
+	}
+
+	mongoLegs[1].Filled = 0
+	fraction, excess = legs.BalanceLegs(mongoLegs)
+	if fraction != 0 || excess[0] != 10 {
+		t.Error("not filled leg should unwind the other one entirely", fraction, excess)
+	}
+}
+
+func TestPairsLegsPNL(t *testing.T) {
+	mongoLegs := []*models.MongoLeg{
+		{Side: "buy", Closed: 10, EntryPrice: 200, ExitPrice: 210},
+		{Side: "sell", Closed: 0.5, EntryPrice: 10000, ExitPrice: 10100},
+	}
+	if pnl := legs.PNL(mongoLegs); pnl != 50 {
+		t.Error("wrong pnl", pnl)
+	}
+}
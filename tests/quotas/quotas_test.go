@@ -0,0 +1,208 @@
+package quotas
+
+import (
+	"testing"
+
+	"gitlab.com/crypto_project/core/strategy_service/src/service/interfaces"
+	"gitlab.com/crypto_project/core/strategy_service/src/service/quotas"
+	"gitlab.com/crypto_project/core/strategy_service/src/sources/mongodb"
+	"gitlab.com/crypto_project/core/strategy_service/src/sources/mongodb/models"
+	"gitlab.com/crypto_project/core/strategy_service/src/trading/orders"
+	"gitlab.com/crypto_project/core/strategy_service/tests"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var _ interfaces.IQuotaStore = &mongodb.StateMgmt{}
+
+// store keeps quotas and enabled strategies in memory.
+type store struct {
+	quotas     map[primitive.ObjectID]*models.MongoQuota
+	strategies []*models.MongoStrategy
+}
+
+func (s *store) GetQuota(subjectId *primitive.ObjectID) *models.MongoQuota {
+	return s.quotas[*subjectId]
+}
+
+func (s *store) GetActiveStrategies(field string, subjectId *primitive.ObjectID) []*models.MongoStrategy {
+	var active []*models.MongoStrategy
+	for _, strategy := range s.strategies {
+		if (field == models.QuotaOwner && strategy.OwnerId == *subjectId) ||
+			(field == models.QuotaAccount && strategy.AccountId != nil && *strategy.AccountId == *subjectId) {
+			active = append(active, strategy)
+		}
+	}
+	return active
+}
+
+func newStrategy(ownerId primitive.ObjectID, accountId primitive.ObjectID, amount float64, price float64) *models.MongoStrategy {
+	id := primitive.NewObjectID()
+	return &models.MongoStrategy{
+		ID:        &id,
+		Enabled:   true,
+		OwnerId:   ownerId,
+		AccountId: &accountId,
+		Conditions: &models.MongoStrategyCondition{
+			Pair:       "BTC_USDT",
+			MarketType: 1,
+			EntryOrder: &models.MongoEntryPoint{Amount: amount, Price: price},
+		},
+		State: &models.MongoStrategyState{},
+	}
+}
+
+func TestActiveStrategiesQuota(t *testing.T) {
+	owner, account := primitive.NewObjectID(), primitive.NewObjectID()
+	s := &store{}
+	enforcer := quotas.NewEnforcer(s, models.MongoQuota{MaxActiveStrategies: 2}, nil, &tests.MockStatsdClient{})
+	for i := 0; i < 2; i++ {
+		strategy := newStrategy(owner, account, 1, 100)
+		if err := enforcer.CheckStrategy(strategy); err != nil {
+			t.Fatal("strategy within quota should be allowed", err)
+		}
+		s.strategies = append(s.strategies, strategy)
+	}
+	if err := enforcer.CheckStrategy(s.strategies[1]); err != nil {
+		t.Error("strategy enabled already shouldn't be counted twice", err)
+	}
+	err := enforcer.CheckStrategy(newStrategy(owner, primitive.NewObjectID(), 1, 100))
+	rejection, ok := err.(*quotas.Rejection)
+	if !ok || rejection.Subject != "owner" || rejection.Limit != quotas.LimitActiveStrategies {
+		t.Fatal("third strategy of the owner should be rejected", err)
+	}
+	if rejection.Error() != "owner quota exceeded: active strategies 3 of 2 allowed" {
+		t.Error("rejection should explain the limit", rejection.Error())
+	}
+	if err := enforcer.CheckStrategy(newStrategy(primitive.NilObjectID, account, 1, 100)); err == nil {
+		t.Error("third strategy of the account should be rejected")
+	}
+	if err := enforcer.CheckStrategy(newStrategy(primitive.NewObjectID(), primitive.NewObjectID(), 1, 100)); err != nil {
+		t.Error("strategies of others shouldn't be counted", err)
+	}
+}
+
+func TestNotionalQuota(t *testing.T) {
+	owner, account := primitive.NewObjectID(), primitive.NewObjectID()
+	entered := newStrategy(owner, account, 2, 0)
+	entered.State.EntryPrice = 100
+	s := &store{strategies: []*models.MongoStrategy{entered}}
+	dataFeed := tests.NewMockedDataFeed([]interfaces.OHLCV{{Open: 50, High: 50, Low: 50, Close: 50}})
+	enforcer := quotas.NewEnforcer(s, models.MongoQuota{MaxNotional: 500}, dataFeed, &tests.MockStatsdClient{})
+	if err := enforcer.CheckStrategy(newStrategy(owner, account, 3, 100)); err != nil {
+		t.Error("notional of 500 should be allowed", err)
+	}
+	if err := enforcer.CheckStrategy(newStrategy(owner, account, 6, 0)); err != nil {
+		t.Error("market entry of 300 priced by the data feed should be allowed", err)
+	}
+	err := enforcer.CheckStrategy(newStrategy(owner, account, 4, 100))
+	if rejection, ok := err.(*quotas.Rejection); !ok || rejection.Limit != quotas.LimitNotional || rejection.Value != 600 {
+		t.Error("notional of 600 should be rejected", err)
+	}
+	relative := newStrategy(owner, account, 10, 100)
+	relative.Conditions.EntryOrder.Type = 1
+	if err := enforcer.CheckStrategy(relative); err != nil {
+		t.Error("relative amounts shouldn't be counted", err)
+	}
+}
+
+func TestQuotaOverridesDefaults(t *testing.T) {
+	owner, account := primitive.NewObjectID(), primitive.NewObjectID()
+	s := &store{
+		quotas:     map[primitive.ObjectID]*models.MongoQuota{owner: {ID: owner, MaxActiveStrategies: 5}},
+		strategies: []*models.MongoStrategy{newStrategy(owner, account, 1, 1)},
+	}
+	enforcer := quotas.NewEnforcer(s, models.MongoQuota{MaxActiveStrategies: 1}, nil, &tests.MockStatsdClient{})
+	if err := enforcer.CheckStrategy(newStrategy(owner, primitive.NewObjectID(), 1, 1)); err != nil {
+		t.Error("quota of the owner should override defaults", err)
+	}
+	if err := enforcer.CheckStrategy(newStrategy(owner, account, 1, 1)); err == nil {
+		t.Error("defaults should apply to the account without quota")
+	}
+}
+
+func TestOrdersPerMinuteQuota(t *testing.T) {
+	owner, account := primitive.NewObjectID(), primitive.NewObjectID()
+	enforcer := quotas.NewEnforcer(nil, models.MongoQuota{MaxOrdersPerMinute: 2}, nil, &tests.MockStatsdClient{})
+	for i := 0; i < 2; i++ {
+		if err := enforcer.CheckOrder(&owner, &account); err != nil {
+			t.Fatal("orders within quota should be allowed", err)
+		}
+	}
+	err := enforcer.CheckOrder(&owner, nil)
+	if rejection, ok := err.(*quotas.Rejection); !ok || rejection.Limit != quotas.LimitOrdersPerMinute {
+		t.Error("third order of the owner should be rejected", err)
+	}
+	if err := enforcer.CheckOrder(nil, &account); err == nil {
+		t.Error("third order of the account should be rejected")
+	}
+	other := primitive.NewObjectID()
+	if err := enforcer.CheckOrder(&other, &account); err == nil {
+		t.Error("order should be rejected if the account exceeds its quota")
+	}
+	if err := enforcer.CheckOrder(&other, nil); err != nil {
+		t.Error("rejected orders shouldn't be counted", err)
+	}
+}
+
+// orders placed by a strategy should count against quotas of its owner, exit orders should be placed always
+func TestTradingOrdersPerMinuteQuota(t *testing.T) {
+	owner, account := primitive.NewObjectID(), primitive.NewObjectID()
+	enforcer := quotas.NewEnforcer(nil, models.MongoQuota{MaxOrdersPerMinute: 1}, nil, &tests.MockStatsdClient{})
+	tradingApi := tests.NewMockedTradingAPI()
+	trading := enforcer.Trading(tradingApi, newStrategy(owner, account, 1, 100))
+	reduceOnly := false
+	order := orders.CreateOrderRequest{
+		KeyId:     &account,
+		KeyParams: orders.Order{Symbol: "BTC_USDT", Side: "buy", Type: "market", Amount: 1, ReduceOnly: &reduceOnly},
+	}
+	if response := trading.CreateOrder(order); response.Status != "OK" {
+		t.Fatal("order within quota should be placed", response)
+	}
+	if response := trading.CreateOrder(order); response.Status != "ERR" || response.Data.Msg == "" {
+		t.Error("order exceeding quota should be rejected with the reason", response)
+	}
+	if err := enforcer.CheckOrder(&owner, nil); err == nil {
+		t.Error("orders of the strategy should be counted for its owner")
+	}
+	order.KeyParams.Side, order.Exit = "sell", true
+	if response := trading.CreateOrder(order); response.Status != "OK" {
+		t.Error("exit order should be placed", response)
+	}
+	if placed, _ := tradingApi.CallCount.Load("buy"); placed != 1 {
+		t.Error("order rejected shouldn't be placed, placed", placed)
+	}
+
+	var disabled *quotas.Enforcer
+	if disabled.Trading(tradingApi, newStrategy(owner, account, 1, 100)) != tradingApi {
+		t.Error("nil enforcer should leave trading as it is")
+	}
+}
+
+func TestNilEnforcerAllows(t *testing.T) {
+	var enforcer *quotas.Enforcer
+	owner := primitive.NewObjectID()
+	if enforcer.CheckStrategy(newStrategy(owner, owner, 1, 1)) != nil || enforcer.CheckOrder(&owner, nil) != nil {
+		t.Error("nil enforcer should allow everything")
+	}
+}
+
+func TestCanManage(t *testing.T) {
+	owner, account, other := primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()
+	strategy := newStrategy(owner, account, 1, 1)
+	strategy.Social.SharedWith = []primitive.ObjectID{other}
+	if !quotas.CanManage(strategy, &owner, nil) {
+		t.Error("owner should manage the strategy")
+	}
+	if quotas.CanManage(strategy, &other, &account) {
+		t.Error("user the strategy shared with shouldn't manage it")
+	}
+	if !quotas.CanManage(strategy, nil, &account) {
+		t.Error("request by the key of the strategy should manage it")
+	}
+	if quotas.CanManage(strategy, nil, &other) || quotas.CanManage(strategy, nil, nil) {
+		t.Error("request by another key or without any should be denied")
+	}
+	if quotas.CanManage(newStrategy(primitive.NilObjectID, account, 1, 1), &owner, &account) {
+		t.Error("strategy without owner shouldn't be managed by a user")
+	}
+}
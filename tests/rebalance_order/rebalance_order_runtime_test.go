@@ -0,0 +1,126 @@
+package rebalance_order
+
+import (
+	"testing"
+	"time"
+
+	"github.com/go-redsync/redsync/v4"
+	"gitlab.com/crypto_project/core/strategy_service/src/service/interfaces"
+	"gitlab.com/crypto_project/core/strategy_service/src/service/strategies"
+	"gitlab.com/crypto_project/core/strategy_service/src/service/strategies/rebalance_order"
+	"gitlab.com/crypto_project/core/strategy_service/src/sources/memory"
+	"gitlab.com/crypto_project/core/strategy_service/src/sources/mongodb/models"
+	"gitlab.com/crypto_project/core/strategy_service/tests"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// newRebalanceOrder returns rebalance order of 1.5 BTC and 10000 USDT at 20000 to 50/50 in two twap slices.
+func newRebalanceOrder() (*rebalance_order.RebalanceOrder, *tests.MockLegsTrading, *memory.StateMgmt) {
+	id := primitive.NewObjectID()
+	model := &models.MongoStrategy{
+		ID:      &id,
+		Enabled: true,
+		Conditions: &models.MongoStrategyCondition{
+			Pair:     "BTC_USDT",
+			Exchange: "binance",
+			Rebalance: &models.MongoRebalanceConditions{
+				Targets:    []*models.MongoRebalanceTarget{{Asset: "BTC", Weight: 50}, {Asset: "USDT", Weight: 50}},
+				Band:       5,
+				TwapSlices: 2,
+			},
+		},
+		State: &models.MongoStrategyState{},
+	}
+	keyId := primitive.NewObjectID()
+	sm := memory.NewStateMgmt()
+	sm.SetMarketPrecision("BTC_USDT", 0, 2, 3)
+	sm.SetKeyBalances(&keyId, map[string]float64{"BTC": 1.5, "USDT": 10000})
+	sm.CreateStrategy(model)
+	trading := tests.NewMockedLegsTrading(sm)
+	df := tests.NewMockedDataFeed([]interfaces.OHLCV{{Open: 20000, High: 20000, Low: 20000, Close: 20000}})
+	logger, stats := tests.GetLoggerStatsd()
+	strategy := strategies.Strategy{
+		Model:           model,
+		StateMgmt:       sm,
+		Log:             logger,
+		Statsd:          stats,
+		SettlementMutex: &redsync.Mutex{},
+	}
+	return rebalance_order.New(&strategy, df, trading, stats, &keyId, sm), trading, sm
+}
+
+// nextSlice makes the next twap slice due right away.
+func nextSlice(ro *rebalance_order.RebalanceOrder) {
+	ro.Lock()
+	defer ro.Unlock()
+	ro.Strategy.GetModel().State.RebalanceSliceAt = 0
+}
+
+func currentState(ro *rebalance_order.RebalanceOrder) string {
+	ro.Lock()
+	defer ro.Unlock()
+	return ro.CurrentState()
+}
+
+// rebalance order should sell the asset drifted above target weight in twap slices and finish the round
+func TestRebalanceOrderRound(t *testing.T) {
+	ro, trading, _ := newRebalanceOrder()
+	ro.Loop()
+	if currentState(ro) != rebalance_order.Rebalancing {
+		t.Fatal("drift above the band should start rebalance", currentState(ro))
+	}
+
+	ro.Loop()
+	placed := trading.Orders()
+	if len(placed) != 1 || placed[0].KeyParams.Side != "sell" || placed[0].KeyParams.Amount != 0.25 {
+		t.Fatal("the first half of BTC excess should be sold", placed)
+	}
+	ro.Loop()
+	if len(trading.Orders()) != 1 {
+		t.Fatal("the next slice shouldn't be placed before interval")
+	}
+	trading.Fill(trading.OrderId(1), 0.25, 20000)
+	if !tests.WaitFor(3*time.Second, func() bool {
+		ro.Lock()
+		defer ro.Unlock()
+		return !ro.IsOrderExistsInMap(trading.OrderId(1))
+	}) {
+		t.Fatal("fill should be accounted for the leg")
+	}
+	nextSlice(ro)
+	ro.Loop()
+	placed = trading.Orders()
+	if len(placed) != 2 || placed[1].KeyParams.Amount != 0.25 {
+		t.Fatal("the rest of BTC excess should be sold with the second slice", placed)
+	}
+	trading.Fill(trading.OrderId(2), 0.25, 20000)
+	if !tests.WaitFor(3*time.Second, func() bool {
+		ro.Loop()
+		return currentState(ro) == rebalance_order.WaitForRebalance
+	}) {
+		t.Fatal("rebalance round should be done once all the legs filled", currentState(ro))
+	}
+
+	ro.Lock()
+	defer ro.Unlock()
+	if state := ro.Strategy.GetModel().State; state.Iteration != 1 || state.RebalancedAt == 0 {
+		t.Error("rebalance round should be accounted", state.Iteration, state.RebalancedAt)
+	}
+}
+
+// rebalance order stopped while rebalancing should cancel the child order waited for
+func TestRebalanceOrderStopCancelsSlice(t *testing.T) {
+	ro, trading, sm := newRebalanceOrder()
+	ro.Loop()
+	ro.Loop()
+	if len(trading.Orders()) != 1 {
+		t.Fatal("the first slice should be placed")
+	}
+	ro.Stop()
+	if len(trading.Canceled) != 1 || trading.Canceled[0] != trading.OrderId(1) {
+		t.Error("child order should be canceled on stop", trading.Canceled)
+	}
+	if ro.Strategy.GetModel().State.State != rebalance_order.Canceled || sm.GetStrategy(ro.Strategy.GetModel().ID).Enabled {
+		t.Error("stopped rebalance order should be canceled and disabled")
+	}
+}
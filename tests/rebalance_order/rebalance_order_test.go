@@ -0,0 +1,106 @@
+package rebalance_order
+
+import (
+	"math"
+	"testing"
+
+	"gitlab.com/crypto_project/core/strategy_service/src/service/strategies/rebalance_order"
+	"gitlab.com/crypto_project/core/strategy_service/src/sources/mongodb/models"
+)
+
+func getTargets() []*models.MongoRebalanceTarget {
+	return []*models.MongoRebalanceTarget{
+		{Asset: "BTC", Weight: 50},
+		{Asset: "ETH", Weight: 30},
+		{Asset: "USDT", Weight: 20},
+	}
+}
+
+func TestRebalanceWeights(t *testing.T) {
+	balances := map[string]float64{"BTC": 1, "ETH": 10, "USDT": 0}
+	prices := map[string]float64{"BTC": 30000, "ETH": 2000}
+	weights, total := rebalance_order.Weights(getTargets(), "USDT", balances, prices)
+	if total != 50000 {
+		t.Error("wrong total value", total)
+	}
+	if math.Abs(weights["BTC"]-60) > 1e-9 || math.Abs(weights["ETH"]-40) > 1e-9 || weights["USDT"] != 0 {
+		t.Error("wrong weights", weights)
+	}
+	if drift := rebalance_order.Drift(getTargets(), weights); math.Abs(drift-20) > 1e-9 {
+		t.Error("drift should be the largest weight difference", drift)
+	}
+}
+
+func TestRebalancePlan(t *testing.T) {
+	balances := map[string]float64{"BTC": 1, "ETH": 10, "USDT": 0}
+	prices := map[string]float64{"BTC": 30000, "ETH": 2000}
+	plan := rebalance_order.Plan(getTargets(), "USDT", balances, prices, 50000, 10)
+	if len(plan) != 2 {
+		t.Fatal("quote asset shouldn't be traded, legs", len(plan))
+	}
+	for _, leg := range plan {
+		if leg.Side != "sell" {
+			t.Error("overweight assets should be sold", leg.Pair, leg.Side)
+		}
+	}
+	if plan[0].Pair != "BTC_USDT" || math.Abs(plan[0].Amount-5000.0/30000) > 1e-9 {
+		t.Error("wrong btc leg", plan[0].Pair, plan[0].Amount)
+	}
+	if plan[1].Pair != "ETH_USDT" || math.Abs(plan[1].Amount-2.5) > 1e-9 {
+		t.Error("wrong eth leg", plan[1].Pair, plan[1].Amount)
+	}
+
+	balances = map[string]float64{"BTC": 0.5, "ETH": 7.5, "USDT": 20000}
+	plan = rebalance_order.Plan(getTargets(), "USDT", balances, prices, 50000, 10)
+	if len(plan) != 1 || plan[0].Pair != "BTC_USDT" || plan[0].Side != "buy" {
+		t.Fatal("only underweight btc should be bought", len(plan))
+	}
+
+	balances = map[string]float64{"BTC": 0.9, "ETH": 7, "USDT": 9000}
+	plan = rebalance_order.Plan(getTargets(), "USDT", balances, prices, 50000, 10)
+	if len(plan) != 2 || plan[0].Side != "sell" || plan[1].Side != "buy" {
+		t.Fatal("sells should go before buys", len(plan))
+	}
+	plan = rebalance_order.Plan(getTargets(), "USDT", balances, prices, 50000, 3000)
+	if len(plan) != 0 {
+		t.Error("trades below min notional should be skipped", len(plan))
+	}
+}
+
+func TestRebalanceSliceAmount(t *testing.T) {
+	if amount := rebalance_order.SliceAmount(1, 4, 100, 10); amount != 0.25 {
+		t.Error("remaining amount should be split evenly", amount)
+	}
+	if amount := rebalance_order.SliceAmount(1, 1, 100, 10); amount != 1 {
+		t.Error("last slice should take the rest", amount)
+	}
+	if amount := rebalance_order.SliceAmount(1, 20, 100, 10); amount != 0.1 {
+		t.Error("slice shouldn't be less than min notional", amount)
+	}
+	if amount := rebalance_order.SliceAmount(1, 2, 100, 60); amount != 1 {
+		t.Error("slice should take the rest too small to trade", amount)
+	}
+	if amount := rebalance_order.SliceAmount(0.05, 3, 100, 10); amount != 0 {
+		t.Error("amount below min notional shouldn't be traded", amount)
+	}
+}
+
+func TestRebalanceValidateTargets(t *testing.T) {
+	if err := rebalance_order.ValidateTargets(getTargets()); err != nil {
+		t.Error("targets should be valid", err)
+	}
+	targets := append(getTargets(), &models.MongoRebalanceTarget{Asset: "btc", Weight: 0})
+	if err := rebalance_order.ValidateTargets(targets); err == nil {
+		t.Error("repeated asset should be rejected")
+	}
+	targets = getTargets()
+	targets[2].Weight = 10
+	if err := rebalance_order.ValidateTargets(targets); err == nil {
+		t.Error("weights not summing up to 100 should be rejected")
+	}
+	targets[2].Weight = -10
+	targets[1].Weight = 60
+	if err := rebalance_order.ValidateTargets(targets); err == nil {
+		t.Error("negative weight should be rejected")
+	}
+}
@@ -0,0 +1,180 @@
+package schema
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"gitlab.com/crypto_project/core/strategy_service/src/sources/mongodb/models"
+	"gitlab.com/crypto_project/core/strategy_service/src/sources/mongodb/schema"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// fixtures returns strategy documents in testdata by file name.
+func fixtures(t *testing.T) map[string]bson.Raw {
+	files, err := filepath.Glob("testdata/*.json")
+	if err != nil || len(files) == 0 {
+		t.Fatal("no fixtures", err)
+	}
+	docs := map[string]bson.Raw{}
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var raw bson.Raw
+		if err := bson.UnmarshalExtJSON(data, true, &raw); err != nil {
+			t.Fatal(file, err)
+		}
+		docs[filepath.Base(file)] = raw
+	}
+	return docs
+}
+
+func TestMigrationsOrder(t *testing.T) {
+	for i, migration := range schema.Migrations() {
+		if migration.Version != int64(i+1) {
+			t.Errorf("migration %v should have version %v", migration.Version, i+1)
+		}
+		if migration.Description == "" || migration.Up == nil {
+			t.Errorf("migration %v should be described and do something", migration.Version)
+		}
+	}
+	if schema.CurrentVersion() != int64(len(schema.Migrations())) {
+		t.Error("current version should be of the last migration")
+	}
+}
+
+// each migration applied to a document upgraded by it already should leave the document as it is
+func TestMigrationsIdempotent(t *testing.T) {
+	for name, raw := range fixtures(t) {
+		var doc bson.M
+		if err := bson.Unmarshal(raw, &doc); err != nil {
+			t.Fatal(name, err)
+		}
+		for _, migration := range schema.Migrations() {
+			if err := migration.Up(doc); err != nil {
+				t.Fatal(name, migration.Version, err)
+			}
+			saved, _ := bson.Marshal(doc)
+			var once bson.M
+			_ = bson.Unmarshal(saved, &once)
+			if err := migration.Up(doc); err != nil {
+				t.Fatal(name, migration.Version, err)
+			}
+			if !reflect.DeepEqual(once, doc) {
+				t.Errorf("migration %v applied twice changed %v", migration.Version, name)
+			}
+		}
+	}
+}
+
+func TestDecodeFixtures(t *testing.T) {
+	for name, raw := range fixtures(t) {
+		var strategy models.MongoStrategy
+		if err := schema.DecodeStrategy(raw, &strategy); err != nil {
+			t.Fatal(name, err)
+		}
+		if strategy.SchemaVersion != schema.CurrentVersion() {
+			t.Errorf("%v should be upgraded to the current version, got %v", name, strategy.SchemaVersion)
+		}
+		if strategy.ID == nil {
+			t.Errorf("%v fields should be decoded", name)
+		}
+		if strategy.Conditions != nil && strategy.Conditions.Leverage < 1 {
+			t.Errorf("%v leverage should be set, got %v", name, strategy.Conditions.Leverage)
+		}
+	}
+	var futures models.MongoStrategy
+	_ = schema.DecodeStrategy(fixtures(t)["futures_v0.json"], &futures)
+	if futures.Conditions.Leverage != 20 || futures.Version != 7 || futures.State.EntryPrice != 2000 {
+		t.Errorf("values set should be kept %+v", futures)
+	}
+}
+
+func TestUpgradeCurrentVersion(t *testing.T) {
+	doc := bson.M{"schemaVersion": schema.CurrentVersion(), "conditions": bson.M{"leverage": 0.0}}
+	upgraded, err := schema.Upgrade(doc)
+	if err != nil || upgraded {
+		t.Error("document of the current version shouldn't be upgraded", err)
+	}
+	if schema.Subdocument(doc, "conditions")["leverage"] != 0.0 {
+		t.Error("document of the current version shouldn't change")
+	}
+}
+
+func TestDecodeStrategyEvent(t *testing.T) {
+	raw, _ := bson.Marshal(bson.M{
+		"operationType": "insert",
+		"fullDocument":  bson.M{"enabled": true, "conditions": bson.M{"pair": "BTC_USDT"}},
+	})
+	var event models.MongoStrategyUpdateEvent
+	if err := schema.DecodeStrategyEvent(raw, &event); err != nil {
+		t.Fatal(err)
+	}
+	if !event.FullDocument.Enabled || event.FullDocument.Conditions.Leverage != 1 {
+		t.Errorf("event document should be upgraded %+v", event.FullDocument.Conditions)
+	}
+	if event.OperationType != "insert" {
+		t.Error("operation type should be decoded", event.OperationType)
+	}
+}
+
+func TestChanges(t *testing.T) {
+	raw, _ := bson.Marshal(bson.M{
+		"enabled":    true,
+		"conditions": bson.M{"pair": "BTC_USDT", "leverage": 0.0},
+		"state":      bson.M{"state": "InEntry"},
+	})
+	var before, doc bson.M
+	_ = bson.Unmarshal(raw, &before)
+	_ = bson.Unmarshal(raw, &doc)
+	if _, err := schema.Upgrade(doc); err != nil {
+		t.Fatal(err)
+	}
+	delete(doc, "enabled")
+
+	update := schema.Changes(before, doc)
+	expected := bson.D{
+		{Key: "$set", Value: bson.M{"conditions.leverage": 1.0, "schemaVersion": schema.CurrentVersion()}},
+		{Key: "$unset", Value: bson.M{"enabled": ""}},
+	}
+	if !reflect.DeepEqual(update, expected) {
+		t.Errorf("only fields changed should be updated %v", update)
+	}
+	if len(schema.Changes(before, before)) != 0 {
+		t.Error("document not changed shouldn't be updated")
+	}
+}
+
+func TestStrategyEventEnables(t *testing.T) {
+	for _, test := range []struct {
+		name    string
+		event   bson.M
+		enables bool
+	}{
+		{"insert enabled", bson.M{"operationType": "insert", "fullDocument": bson.M{"enabled": true}}, true},
+		{"insert disabled", bson.M{"operationType": "insert", "fullDocument": bson.M{"enabled": false}}, false},
+		{"update enabling", bson.M{
+			"operationType":     "update",
+			"fullDocument":      bson.M{"enabled": true},
+			"updateDescription": bson.M{"updatedFields": bson.M{"enabled": true}},
+		}, true},
+		{"update of enabled", bson.M{
+			"operationType":     "update",
+			"fullDocument":      bson.M{"enabled": true},
+			"updateDescription": bson.M{"updatedFields": bson.M{"state.state": "InEntry"}},
+		}, false},
+		{"replace", bson.M{"operationType": "replace", "fullDocument": bson.M{"enabled": true}}, false},
+	} {
+		raw, _ := bson.Marshal(test.event)
+		var event models.MongoStrategyUpdateEvent
+		if err := schema.DecodeStrategyEvent(raw, &event); err != nil {
+			t.Fatal(test.name, err)
+		}
+		if event.Enables() != test.enables {
+			t.Error(test.name, "should enable the strategy", test.enables)
+		}
+	}
+}
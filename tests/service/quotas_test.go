@@ -0,0 +1,107 @@
+package service
+
+import (
+	"os"
+	"sync"
+	"testing"
+
+	"gitlab.com/crypto_project/core/strategy_service/src/service"
+	"gitlab.com/crypto_project/core/strategy_service/src/service/interfaces"
+	"gitlab.com/crypto_project/core/strategy_service/src/sources/memory"
+	"gitlab.com/crypto_project/core/strategy_service/src/sources/mongodb/models"
+	statsd_client "gitlab.com/crypto_project/core/strategy_service/src/statsd"
+	"gitlab.com/crypto_project/core/strategy_service/src/trading/orders"
+	"gitlab.com/crypto_project/core/strategy_service/tests"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// maker-only orders placed by runtimes shouldn't be checked against quotas of requests
+func TestCreateOrderExemptsRuntimeOrders(t *testing.T) {
+	os.Setenv("QUOTA_MAX_ORDERS_PER_MINUTE", "1")
+	defer os.Unsetenv("QUOTA_MAX_ORDERS_PER_MINUTE")
+	logger, _ := tests.GetLoggerStatsd()
+	df := tests.NewMockedSpreadDataFeed(
+		[]interfaces.SpreadData{{BestAsk: 7001, BestBid: 7000, Close: 7000}},
+		[]interfaces.OHLCV{{Open: 7000, High: 7000, Low: 7000, Close: 7000, Volume: 1}},
+	)
+	ss := service.NewStrategyService(df, tests.NewMockedTradingAPIWithMarketAccess(df), memory.NewStateMgmt(), statsd_client.StatsdClient{}, logger)
+	owner, keyId, parentId := primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()
+	request := orders.CreateOrderRequest{
+		KeyId:     &keyId,
+		OwnerId:   &owner,
+		KeyParams: orders.Order{Symbol: "BTC_USDT", Side: "buy", Amount: 0.01, Type: "maker-only"},
+	}
+	if response := ss.CreateOrder(request); response.Status != "OK" {
+		t.Fatal("order within quota should be accepted", response)
+	}
+	if response := ss.CreateOrder(request); response.Status != "ERR" {
+		t.Error("order exceeding quota should be rejected", response)
+	}
+	request.ParentId = &parentId
+	if response := ss.CreateOrder(request); response.Status != "OK" {
+		t.Error("order placed by a runtime should be accepted", response)
+	}
+}
+
+// only the owner should cancel an order, whether its strategy runs in this instance or not
+func TestCancelOrderChecksOwner(t *testing.T) {
+	logger, _ := tests.GetLoggerStatsd()
+	store := memory.NewStateMgmt()
+	ss := service.NewStrategyService(tests.NewMockedDataFeed(nil), tests.NewMockedTradingAPI(), store, statsd_client.StatsdClient{}, logger)
+	owner, other, keyId, id := primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()
+	store.CreateStrategy(&models.MongoStrategy{
+		ID:         &id,
+		Type:       2,
+		OwnerId:    owner,
+		AccountId:  &keyId,
+		Conditions: &models.MongoStrategyCondition{Pair: "BTC_USDT"},
+		State:      &models.MongoStrategyState{},
+	})
+	store.SaveOrder(models.MongoOrder{ID: id, OrderId: id.Hex(), Status: "open", Type: "maker-only"}, &keyId, 0)
+
+	cancel := func(ownerId primitive.ObjectID) orders.OrderResponse {
+		return ss.CancelOrder(orders.CancelOrderRequest{
+			KeyId:     &keyId,
+			OwnerId:   &ownerId,
+			KeyParams: orders.CancelOrderRequestParams{OrderId: id.Hex(), Pair: "BTC_USDT"},
+		})
+	}
+	if response := cancel(other); response.Status != "ERR" || response.Data.Msg == "" {
+		t.Error("order of another owner shouldn't be canceled", response)
+	}
+	if response := cancel(owner); response.Status != "OK" {
+		t.Error("owner should cancel the order", response)
+	}
+}
+
+// strategy stored disabled and enabled by an update should be checked against quotas like one inserted enabled
+func TestEnablingStrategyChecksQuotas(t *testing.T) {
+	os.Setenv("QUOTA_MAX_NOTIONAL", "100")
+	defer os.Unsetenv("QUOTA_MAX_NOTIONAL")
+	fixture, err := memory.ReadFixture("testdata/fixture.json")
+	if err != nil {
+		t.Fatal("fixture read failed", err)
+	}
+	strategy := fixture.Strategies[0]
+	strategy.Enabled = false
+	strategy.Conditions.EntryOrder.Amount = 1 // 7000 at market
+	store := memory.NewStateMgmt()
+	if err := store.Load(fixture); err != nil {
+		t.Fatal("fixture load failed", err)
+	}
+
+	logger, _ := tests.GetLoggerStatsd()
+	df := tests.NewMockedDataFeed([]interfaces.OHLCV{{Open: 7000, High: 7000, Low: 7000, Close: 7000, Volume: 1}})
+	tradingApi := tests.NewMockedTradingAPIWithMarketAccess(df)
+	ss := service.NewStrategyService(df, tradingApi, store, statsd_client.StatsdClient{}, logger)
+	ss.Init(&sync.WaitGroup{}, false)
+	store.EnableStrategy(strategy.ID)
+
+	rejected := waitForState(store, strategy.ID, "Error")
+	if rejected.State.State != "Error" || rejected.Enabled || rejected.State.Msg == "" {
+		t.Errorf("strategy enabled beyond notional quota should be rejected, state %v enabled %v", rejected.State.State, rejected.Enabled)
+	}
+	if placed, _ := tradingApi.CallCount.Load("buy"); placed != nil {
+		t.Error("strategy rejected shouldn't trade, placed", placed)
+	}
+}
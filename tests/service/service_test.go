@@ -0,0 +1,128 @@
+package service
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"gitlab.com/crypto_project/core/strategy_service/src/service"
+	"gitlab.com/crypto_project/core/strategy_service/src/service/interfaces"
+	"gitlab.com/crypto_project/core/strategy_service/src/service/journal"
+	"gitlab.com/crypto_project/core/strategy_service/src/sources/memory"
+	"gitlab.com/crypto_project/core/strategy_service/src/sources/mongodb/models"
+	statsd_client "gitlab.com/crypto_project/core/strategy_service/src/statsd"
+	"gitlab.com/crypto_project/core/strategy_service/tests"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// fillOrders fills orders of the type placed on the side given in the store like an exchange would, at the price given
+// if set.
+func fillOrders(store *memory.StateMgmt, tradingApi *tests.MockTrading, keyId *primitive.ObjectID, side string, orderType string, price float64) int {
+	filled := 0
+	tradingApi.OrdersMap.Range(func(key, value interface{}) bool {
+		order := value.(models.MongoOrder)
+		if order.Side != side || order.Type != orderType || order.Status != "open" {
+			return true
+		}
+		order.Status = "filled"
+		if price > 0 {
+			order.Average = price
+		}
+		tradingApi.OrdersMap.Store(key, order)
+		store.SaveOrder(order, keyId, 1)
+		filled++
+		return true
+	})
+	return filled
+}
+
+// waitForState waits for the strategy stored to get to the state given.
+func waitForState(store *memory.StateMgmt, strategyId *primitive.ObjectID, state string) *models.MongoStrategy {
+	var strategy *models.MongoStrategy
+	for i := 0; i < 50; i++ {
+		strategy = store.GetStrategy(strategyId)
+		if strategy.State.State == state {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	return strategy
+}
+
+// smart trade seeded in the in-memory state should be settled by the service, entered and closed by its target
+// through the state store
+func TestServiceRunsStrategyFromFixture(t *testing.T) {
+	fixture, err := memory.ReadFixture("testdata/fixture.json")
+	if err != nil {
+		t.Fatal("fixture read failed", err)
+	}
+	store := memory.NewStateMgmt()
+	if err := store.Load(fixture); err != nil {
+		t.Fatal("fixture load failed", err)
+	}
+	strategyId := fixture.Strategies[0].ID
+	keyId := fixture.Strategies[0].AccountId
+	if balances := store.GetKeyBalances(keyId); balances["USDT"] != 1000 {
+		t.Error("balances should be seeded", balances)
+	}
+
+	logger, _ := tests.GetLoggerStatsd()
+	df := tests.NewMockedDataFeed([]interfaces.OHLCV{{Open: 7000, High: 7000, Low: 7000, Close: 7000, Volume: 1}})
+	tradingApi := tests.NewMockedTradingAPIWithMarketAccess(df)
+	ss := service.NewStrategyService(df, tradingApi, store, statsd_client.StatsdClient{}, logger)
+	ss.Init(&sync.WaitGroup{}, false)
+	time.Sleep(1000 * time.Millisecond)
+
+	if filled := fillOrders(store, tradingApi, keyId, "buy", "market", 0); filled != 1 {
+		t.Fatal("entry order should be placed once, placed", filled)
+	}
+	strategy := waitForState(store, strategyId, "InEntry")
+	if strategy.State.State != "InEntry" || strategy.State.EntryPrice != 7000 {
+		t.Fatalf("entry should be stored, state %v at %v", strategy.State.State, strategy.State.EntryPrice)
+	}
+
+	time.Sleep(500 * time.Millisecond)
+	if filled := fillOrders(store, tradingApi, keyId, "sell", "limit", 7070); filled != 1 {
+		t.Fatal("take-profit should be placed once, placed", filled)
+	}
+	strategy = waitForState(store, strategyId, "End")
+	if strategy.State.State != "End" || strategy.State.ExecutedAmount != 0.01 {
+		t.Errorf("strategy should end by take-profit, state %v executed %v", strategy.State.State, strategy.State.ExecutedAmount)
+	}
+	if strategy.State.ReceivedProfitAmount <= 0 {
+		t.Error("profit should be stored", strategy.State.ReceivedProfitAmount)
+	}
+}
+
+// journal should be applied only to strategies stored disabled, whether they run in this instance or not
+func TestServiceRebuildStateChecksEnabled(t *testing.T) {
+	store := memory.NewStateMgmt()
+	strategyId := primitive.NewObjectID()
+	store.CreateStrategy(&models.MongoStrategy{
+		ID:         &strategyId,
+		Enabled:    true,
+		Conditions: &models.MongoStrategyCondition{Pair: "BTC_USDT"},
+		State:      &models.MongoStrategyState{State: "WaitForEntry"},
+	})
+	j := journal.New(strategyId, store)
+	j.Transition("WaitForEntry", "InEntry", "TriggerTrade", 7000, &models.MongoStrategyState{State: "InEntry", EntryPrice: 7000})
+	j.Flush()
+
+	logger, _ := tests.GetLoggerStatsd()
+	df := tests.NewMockedDataFeed(nil)
+	ss := service.NewStrategyService(df, tests.NewMockedTradingAPI(), store, statsd_client.StatsdClient{}, logger)
+	if response := ss.RebuildState(strategyId.Hex(), true); response.Status != "ERR" || response.Applied {
+		t.Error("journal shouldn't be applied to strategy stored enabled", response.Msg)
+	}
+	if state := store.GetStrategy(&strategyId).State.State; state != "WaitForEntry" {
+		t.Error("state of strategy enabled shouldn't change", state)
+	}
+
+	store.DisableStrategy(&strategyId)
+	if response := ss.RebuildState(strategyId.Hex(), true); response.Status != "OK" || !response.Applied {
+		t.Error("journal should be applied to strategy disabled", response.Msg)
+	}
+	if state := store.GetStrategy(&strategyId).State; state.State != "InEntry" || state.EntryPrice != 7000 {
+		t.Error("state rebuilt should be stored", state.State, state.EntryPrice)
+	}
+}
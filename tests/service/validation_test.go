@@ -0,0 +1,39 @@
+package service
+
+import (
+	"testing"
+
+	"gitlab.com/crypto_project/core/strategy_service/src/service"
+	"gitlab.com/crypto_project/core/strategy_service/src/sources/memory"
+	"gitlab.com/crypto_project/core/strategy_service/src/sources/mongodb/models"
+	statsd_client "gitlab.com/crypto_project/core/strategy_service/src/statsd"
+	"gitlab.com/crypto_project/core/strategy_service/src/trading/orders"
+	"gitlab.com/crypto_project/core/strategy_service/tests"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// order with smart order conditions invalid should be rejected with the reason before anything is placed
+func TestCreateOrderRejectsInvalidExpression(t *testing.T) {
+	logger, _ := tests.GetLoggerStatsd()
+	tradingApi := tests.NewMockedTradingAPI()
+	ss := service.NewStrategyService(tests.NewMockedDataFeed(nil), tradingApi, memory.NewStateMgmt(), statsd_client.StatsdClient{}, logger)
+	keyId := primitive.NewObjectID()
+	response := ss.CreateOrder(orders.CreateOrderRequest{
+		KeyId: &keyId,
+		KeyParams: orders.Order{
+			Symbol: "BTC_USDT",
+			Side:   "buy",
+			Amount: 0.01,
+			Params: orders.OrderParams{SmartOrder: &models.MongoStrategyCondition{
+				Pair:            "BTC_USDT",
+				EntryExpression: "close > ema(50, 15m) &&",
+			}},
+		},
+	})
+	if response.Status != "ERR" || response.Data.Msg == "" {
+		t.Fatal("invalid expression should be rejected with the reason", response)
+	}
+	if _, ok := tradingApi.CallCount.Load("buy"); ok {
+		t.Error("nothing should be placed for the order rejected")
+	}
+}
@@ -0,0 +1,149 @@
+package signals
+
+import (
+	"testing"
+
+	"gitlab.com/crypto_project/core/strategy_service/src/service/interfaces"
+	"gitlab.com/crypto_project/core/strategy_service/src/service/signals"
+	"gitlab.com/crypto_project/core/strategy_service/src/sources/mongodb/models"
+	"gitlab.com/crypto_project/core/strategy_service/tests"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestSignalPriceCross(t *testing.T) {
+	df := tests.NewMockedDataFeed([]interfaces.OHLCV{{Close: 7000}, {Close: 7100}, {Close: 7250}, {Close: 7300}})
+	triggered := 0
+	engine := signals.NewEngine(df, func(signal *models.MongoSignal, price float64) {
+		triggered += 1
+		if price != 7250 {
+			t.Error("signal triggered at wrong price", price)
+		}
+	}, nil)
+	engine.Upsert(models.MongoSignal{
+		Id:        primitive.NewObjectID(),
+		Enabled:   true,
+		MonType:   models.MongoSignalType{SigType: models.SignalTypePrice},
+		Condition: models.MongoSignalCondition{Pair: "BTC_USDT", TargetPrice: 7200},
+	})
+	for i := int64(0); i < 4; i++ {
+		engine.Check(i)
+	}
+	if triggered != 1 {
+		t.Error("signal should trigger once, triggered", triggered)
+	}
+	if engine.Count() != 0 {
+		t.Error("not open ended signal should be removed after trigger")
+	}
+}
+
+func TestSignalPercentChangeOpenEnded(t *testing.T) {
+	df := tests.NewMockedDataFeed([]interfaces.OHLCV{{Close: 100}, {Close: 100}, {Close: 94}, {Close: 94}, {Close: 94}, {Close: 80}})
+	triggered := 0
+	engine := signals.NewEngine(df, func(signal *models.MongoSignal, price float64) {
+		triggered += 1
+	}, nil)
+	engine.Upsert(models.MongoSignal{
+		Id:          primitive.NewObjectID(),
+		Enabled:     true,
+		OpenEnded:   true,
+		MonType:     models.MongoSignalType{SigType: models.SignalTypePercentChange},
+		Condition:   models.MongoSignalCondition{Pair: "BTC_USDT", PercentChange: -5},
+		TriggerWhen: models.TriggerOptions{Period: 2},
+	})
+	for i := int64(0); i < 6; i++ {
+		engine.Check(i)
+	}
+	// triggers at 2, cools down at 3, triggers at 5 by 80 against 94
+	if triggered != 2 {
+		t.Error("open ended signal should trigger twice, triggered", triggered)
+	}
+	if engine.Count() != 1 {
+		t.Error("open ended signal should stay watched")
+	}
+}
+
+// percent change should be measured over the window regardless of the trigger period, signals without any ignored
+func TestSignalPercentChangeWindow(t *testing.T) {
+	df := tests.NewMockedDataFeed([]interfaces.OHLCV{{Close: 100}, {Close: 100}, {Close: 94}})
+	triggered := 0
+	engine := signals.NewEngine(df, func(signal *models.MongoSignal, price float64) {
+		triggered += 1
+	}, nil)
+	engine.Upsert(models.MongoSignal{
+		Id:        primitive.NewObjectID(),
+		Enabled:   true,
+		MonType:   models.MongoSignalType{SigType: models.SignalTypePercentChange},
+		Condition: models.MongoSignalCondition{Pair: "BTC_USDT", PercentChange: -5, Window: 2},
+	})
+	for i := int64(0); i < 3; i++ {
+		engine.Check(i)
+	}
+	if triggered != 1 {
+		t.Error("signal should trigger by the change over the window, triggered", triggered)
+	}
+
+	engine.Upsert(models.MongoSignal{
+		Id:        primitive.NewObjectID(),
+		Enabled:   true,
+		MonType:   models.MongoSignalType{SigType: models.SignalTypePercentChange},
+		Condition: models.MongoSignalCondition{Pair: "BTC_USDT", PercentChange: -5},
+	})
+	if engine.Count() != 0 {
+		t.Error("signal without window shouldn't be watched")
+	}
+}
+
+func TestSignalExpiration(t *testing.T) {
+	df := tests.NewMockedSpreadDataFeed([]interfaces.SpreadData{{BestBid: 100, BestAsk: 100.1}}, nil)
+	expired := false
+	engine := signals.NewEngine(df, func(signal *models.MongoSignal, price float64) {
+		t.Error("expired signal should not trigger")
+	}, func(signal *models.MongoSignal) {
+		expired = true
+	})
+	engine.Upsert(models.MongoSignal{
+		Id:         primitive.NewObjectID(),
+		Enabled:    true,
+		MonType:    models.MongoSignalType{SigType: models.SignalTypeSpread},
+		Condition:  models.MongoSignalCondition{Pair: "BTC_USDT", Spread: 1},
+		Expiration: models.ExpirationSchema{ExpirationTimestamp: 10},
+	})
+	engine.Check(5)
+	engine.Check(10)
+	if !expired || engine.Count() != 0 {
+		t.Error("signal should expire and be removed")
+	}
+}
+
+func TestSignalUpsertDuringCheck(t *testing.T) {
+	stream := make([]interfaces.OHLCV, 200)
+	for i := range stream {
+		stream[i] = interfaces.OHLCV{Close: float64(100 + i%3)}
+	}
+	df := tests.NewMockedDataFeed(stream)
+	engine := signals.NewEngine(df, func(signal *models.MongoSignal, price float64) {}, nil)
+	signal := models.MongoSignal{
+		Id:          primitive.NewObjectID(),
+		Enabled:     true,
+		OpenEnded:   true,
+		MonType:     models.MongoSignalType{SigType: models.SignalTypePercentChange},
+		Condition:   models.MongoSignalCondition{Pair: "BTC_USDT", PercentChange: 1},
+		TriggerWhen: models.TriggerOptions{Period: 2},
+	}
+	engine.Upsert(signal)
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 100; i++ {
+			signal.Condition.PercentChange = float64(1 + i%2)
+			engine.Upsert(signal)
+		}
+		close(done)
+	}()
+	for i := int64(0); i < 100; i++ {
+		engine.Check(i)
+	}
+	<-done
+	if engine.Count() != 1 {
+		t.Error("updated signal should stay watched")
+	}
+}
@@ -0,0 +1,88 @@
+package smart_order
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-redsync/redsync/v4"
+	"gitlab.com/crypto_project/core/strategy_service/src/service/interfaces"
+	"gitlab.com/crypto_project/core/strategy_service/src/service/strategies"
+	"gitlab.com/crypto_project/core/strategy_service/src/service/strategies/smart_order"
+	"gitlab.com/crypto_project/core/strategy_service/tests"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// smart order should stop the loss once stop-loss expression holds while percentage stop-loss is far
+func TestSmartOrderStopLossExpression(t *testing.T) {
+	fakeDataStream := []interfaces.OHLCV{
+		{Open: 7100, High: 7101, Low: 7000, Close: 7005, Volume: 30},
+		{Open: 7005, High: 7005, Low: 6900, Close: 6900, Volume: 30},
+		{Open: 6905, High: 6950, Low: 6880, Close: 6890, Volume: 30},
+	}
+	smartOrderModel := GetTestSmartOrderStrategy("stopLossMarket")
+	smartOrderModel.Conditions.StopLoss = 50
+	smartOrderModel.Conditions.StopLossExpression = "close < 6950 && profit_pct < -0.5"
+	df := tests.NewMockedDataFeed(fakeDataStream)
+	tradingApi := tests.NewMockedTradingAPI()
+	tradingApi.BuyDelay = 200
+	tradingApi.SellDelay = 200
+	keyId := primitive.NewObjectID()
+	sm := tests.NewMockedStateMgmt(tradingApi, df)
+	logger, stats := tests.GetLoggerStatsd()
+	strategy := strategies.Strategy{
+		Model:           &smartOrderModel,
+		StateMgmt:       &sm,
+		Log:             logger,
+		Statsd:          stats,
+		SettlementMutex: &redsync.Mutex{},
+	}
+	smartOrder := smart_order.New(&strategy, df, tradingApi, strategy.Statsd, &keyId, &sm)
+	go smartOrder.Start()
+	time.Sleep(5000 * time.Millisecond)
+
+	if isInState, _ := smartOrder.State.IsInState(smart_order.End); !isInState {
+		state, _ := smartOrder.State.State(context.Background())
+		t.Error("SmartOrder state is not End, state:", state)
+	}
+}
+
+// conditions with invalid expression should be rejected with the expression told
+func TestValidateConditions(t *testing.T) {
+	model := GetTestSmartOrderStrategy("stopLossMarket")
+	model.Conditions.EntryExpression = "close > ema(50, 15m)"
+	if err := smart_order.ValidateConditions(&model); err != nil {
+		t.Error("valid expression shouldn't be rejected", err)
+	}
+	model.Conditions.TakeProfitExpression = "profit_pct > unknown"
+	if err := smart_order.ValidateConditions(&model); err == nil || !strings.Contains(err.Error(), "profit_pct > unknown") {
+		t.Error("invalid expression should be told", err)
+	}
+}
+
+// smart order with invalid expression shouldn't start
+func TestSmartOrderInvalidExpression(t *testing.T) {
+	smartOrderModel := GetTestSmartOrderStrategy("stopLossMarket")
+	smartOrderModel.Conditions.EntryExpression = "close > ema(50, 15m) &&"
+	df := tests.NewMockedDataFeed(nil)
+	tradingApi := tests.NewMockedTradingAPI()
+	keyId := primitive.NewObjectID()
+	sm := tests.NewMockedStateMgmt(tradingApi, df)
+	logger, stats := tests.GetLoggerStatsd()
+	strategy := strategies.Strategy{
+		Model:           &smartOrderModel,
+		StateMgmt:       &sm,
+		Log:             logger,
+		Statsd:          stats,
+		SettlementMutex: &redsync.Mutex{},
+	}
+	smartOrder := smart_order.New(&strategy, df, tradingApi, strategy.Statsd, &keyId, &sm)
+
+	if smartOrderModel.Enabled || smartOrderModel.State.State != smart_order.Error || smartOrderModel.State.Msg == "" {
+		t.Error("smart order with invalid expression should be disabled with error", smartOrderModel.State.State, smartOrderModel.State.Msg)
+	}
+	if isInState, _ := smartOrder.State.IsInState(smart_order.Error); !isInState {
+		t.Error("state machine should be in error state")
+	}
+}
@@ -0,0 +1,23 @@
+package smart_order
+
+import (
+	"testing"
+
+	"gitlab.com/crypto_project/core/strategy_service/src/service/strategies/smart_order"
+	"gitlab.com/crypto_project/core/strategy_service/src/sources/mongodb/models"
+)
+
+func TestCompareIndicator(t *testing.T) {
+	condition := &models.MongoIndicatorCondition{Indicator: "rsi", Operator: "<", Value: 30}
+	if !smart_order.CompareIndicator(condition, 25) || smart_order.CompareIndicator(condition, 30) {
+		t.Error("wrong < comparison")
+	}
+	condition.Operator = ">="
+	if !smart_order.CompareIndicator(condition, 30) {
+		t.Error("wrong >= comparison")
+	}
+	condition.Operator = "=>"
+	if smart_order.CompareIndicator(condition, 30) {
+		t.Error("unknown operator shouldn't be met")
+	}
+}
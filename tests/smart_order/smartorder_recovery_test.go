@@ -0,0 +1,101 @@
+package smart_order
+
+import (
+	"testing"
+	"time"
+
+	"github.com/go-redsync/redsync/v4"
+	"gitlab.com/crypto_project/core/strategy_service/src/service/interfaces"
+	"gitlab.com/crypto_project/core/strategy_service/src/service/journal"
+	"gitlab.com/crypto_project/core/strategy_service/src/service/strategies"
+	"gitlab.com/crypto_project/core/strategy_service/src/service/strategies/smart_order"
+	"gitlab.com/crypto_project/core/strategy_service/src/sources/memory"
+	"gitlab.com/crypto_project/core/strategy_service/src/sources/mongodb/models"
+	"gitlab.com/crypto_project/core/strategy_service/tests"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// newRecoveredSmartOrder returns smart order in entry with stop-loss and take-profit orders placed before start,
+// journaled as placed if told so.
+func newRecoveredSmartOrder(model *models.MongoStrategy, sm *memory.StateMgmt, journaled bool) (*smart_order.SmartOrder, *journal.Journal) {
+	model.State.Orders = []string{"sl1", "tp1"}
+	model.State.StopLossOrderIds = []string{"sl1"}
+	model.State.TakeProfitOrderIds = []string{"tp1"}
+	j := journal.New(*model.ID, sm)
+	if journaled {
+		j.OrderPlaced("sl1", smart_order.Stoploss, "sell", "stop-market", 0.05, 6650)
+		j.OrderPlaced("tp1", smart_order.TakeProfit, "sell", "limit", 0.05, 7350)
+	}
+	sm.SaveOrder(models.MongoOrder{OrderId: "sl1", Status: "open", Side: "sell"}, nil, 1)
+	sm.SaveOrder(models.MongoOrder{OrderId: "tp1", Status: "filled", Side: "sell", Filled: 0.05, Average: 7350}, nil, 1)
+
+	df := tests.NewMockedDataFeed([]interfaces.OHLCV{{Open: 7005, High: 7010, Low: 7000, Close: 7005, Volume: 30}})
+	tradingApi := tests.NewMockedTradingAPI()
+	keyId := primitive.NewObjectID()
+	logger, stats := tests.GetLoggerStatsd()
+	strategy := strategies.Strategy{
+		Model:           model,
+		StateMgmt:       sm,
+		Log:             logger,
+		Statsd:          stats,
+		SettlementMutex: &redsync.Mutex{},
+		Journal:         j,
+	}
+	return smart_order.New(&strategy, df, tradingApi, strategy.Statsd, &keyId, sm), j
+}
+
+// smart order should apply fills happened while it wasn't running before trading
+func TestSmartOrderRecoveryAppliesMissedFill(t *testing.T) {
+	smartOrderModel := GetTestSmartOrderStrategy("stopLossMarket")
+	smartOrderModel.ID = &primitive.ObjectID{1}
+	sm := memory.NewStateMgmt()
+	smartOrder, _ := newRecoveredSmartOrder(&smartOrderModel, sm, true)
+	go smartOrder.Start()
+	time.Sleep(500 * time.Millisecond)
+
+	if smartOrderModel.State.State != smart_order.End || smartOrderModel.State.ExecutedAmount != 0.05 {
+		t.Error("take-profit filled before start should close the smart order", smartOrderModel.State.State, smartOrderModel.State.ExecutedAmount)
+	}
+	if _, updated := smartOrder.Strategy.GetJournal().OrderHistory(); !updated["tp1"] {
+		t.Error("fill applied should be journaled")
+	}
+}
+
+// smart order should keep waiting for open orders placed before start and skip fills applied already
+func TestSmartOrderRecoveryWaitsForOpenOrders(t *testing.T) {
+	smartOrderModel := GetTestSmartOrderStrategy("stopLossMarket")
+	smartOrderModel.ID = &primitive.ObjectID{2}
+	sm := memory.NewStateMgmt()
+	smartOrder, j := newRecoveredSmartOrder(&smartOrderModel, sm, true)
+	j.OrderUpdated(sm.GetOrder("tp1"))
+	go smartOrder.Start()
+	time.Sleep(300 * time.Millisecond)
+
+	if smartOrderModel.State.State != smart_order.InEntry || smartOrderModel.State.ExecutedAmount != 0 {
+		t.Error("fill applied before start shouldn't be applied again", smartOrderModel.State.State, smartOrderModel.State.ExecutedAmount)
+	}
+	if waiting, ok := smartOrder.IsWaitingForOrder.Load(smart_order.Stoploss); !ok || !waiting.(bool) {
+		t.Error("stop-loss order should be waited for")
+	}
+	sm.SaveOrder(models.MongoOrder{OrderId: "sl1", Status: "filled", Side: "sell", Filled: 0.05, Average: 6650}, nil, 1)
+	time.Sleep(300 * time.Millisecond)
+	if smartOrderModel.State.State != smart_order.End {
+		t.Error("stop-loss filled should close the smart order", smartOrderModel.State.State)
+	}
+}
+
+// smart order should apply fills of orders missing in the journal unless the state saved moved past their step
+func TestSmartOrderRecoveryWithoutJournal(t *testing.T) {
+	smartOrderModel := GetTestSmartOrderStrategy("stopLossMarket")
+	smartOrderModel.ID = &primitive.ObjectID{3}
+	sm := memory.NewStateMgmt()
+	smartOrder, _ := newRecoveredSmartOrder(&smartOrderModel, sm, false)
+	sm.SaveOrder(models.MongoOrder{OrderId: "sl1", Status: "filled", Side: "sell", Filled: 0.05, Average: 6650}, nil, 1)
+	sm.SaveOrder(models.MongoOrder{OrderId: "tp1", Status: "open", Side: "sell"}, nil, 1)
+	go smartOrder.Start()
+	time.Sleep(500 * time.Millisecond)
+
+	if smartOrderModel.State.State != smart_order.End || smartOrderModel.State.ExecutedAmount != 0.05 {
+		t.Error("stop-loss filled before start should close the smart order", smartOrderModel.State.State, smartOrderModel.State.ExecutedAmount)
+	}
+}
@@ -0,0 +1,164 @@
+package smart_order
+
+import (
+	"testing"
+	"time"
+
+	"gitlab.com/crypto_project/core/strategy_service/src/service/interfaces"
+	"gitlab.com/crypto_project/core/strategy_service/src/service/strategies/smart_order"
+	"gitlab.com/crypto_project/core/strategy_service/src/sources/mongodb/models"
+	"gitlab.com/crypto_project/core/strategy_service/tests"
+)
+
+func TestScheduleEntryWindows(t *testing.T) {
+	schedule, err := smart_order.NewSchedule(&models.MongoScheduleConditions{
+		EntryWindows:  []*models.MongoTimeWindow{{From: "08:00", To: "16:00"}, {From: "22:00", To: "01:30"}},
+		EntryWeekdays: []int64{1, 2, 3, 4, 5},
+	}, models.ExpirationSchema{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	monday := time.Date(2021, 3, 1, 0, 0, 0, 0, time.UTC)
+	for at, allowed := range map[time.Duration]bool{
+		8 * time.Hour:                 true,
+		16 * time.Hour:                false,
+		7*time.Hour + 59*time.Minute:  false,
+		23 * time.Hour:                true,
+		time.Hour:                     true,
+		time.Hour + 30*time.Minute:    false,
+		5*24*time.Hour + 10*time.Hour: false, // saturday
+		6*24*time.Hour + 23*time.Hour: false, // sunday
+		7*24*time.Hour + 10*time.Hour: true,
+		4*24*time.Hour + 15*time.Hour: true,  // friday
+		-30 * time.Minute:             false, // sunday night
+	} {
+		if schedule.EntryAllowed(monday.Add(at)) != allowed {
+			t.Error("wrong entry window check at", monday.Add(at))
+		}
+	}
+	if !schedule.RestrictsEntry() || schedule.ExitForced(monday) {
+		t.Error("windows restrict entry only")
+	}
+}
+
+func TestScheduleDeadlines(t *testing.T) {
+	schedule, err := smart_order.NewSchedule(&models.MongoScheduleConditions{CancelEntryAt: 100, ForceExitAt: 300},
+		models.ExpirationSchema{ExpirationTimestamp: 200})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if schedule.EntryCanceled(time.Unix(99, 0)) || !schedule.EntryCanceled(time.Unix(100, 0)) || schedule.EntryAllowed(time.Unix(100, 0)) {
+		t.Error("entry should be canceled at the cancel time")
+	}
+	if schedule.ExitForced(time.Unix(199, 0)) || !schedule.ExitForced(time.Unix(200, 0)) {
+		t.Error("exit should be forced at expiration preceding the exit time")
+	}
+	if schedule, _ := smart_order.NewSchedule(nil, models.ExpirationSchema{ExpirationTimestamp: 200, OpenEnded: true}); schedule != nil {
+		t.Error("open ended expiration shouldn't restrict")
+	}
+	for _, conditions := range []*models.MongoScheduleConditions{
+		{EntryWindows: []*models.MongoTimeWindow{{From: "8:00pm", To: "16:00"}}},
+		{EntryWindows: []*models.MongoTimeWindow{{From: "08:00", To: "24:00"}}},
+		{EntryWeekdays: []int64{7}},
+	} {
+		if _, err := smart_order.NewSchedule(conditions, models.ExpirationSchema{}); err == nil {
+			t.Error("invalid schedule should be rejected", conditions)
+		}
+	}
+}
+
+// smart order shouldn't place entry out of entry window
+func TestSmartOrderEntryOutOfWindow(t *testing.T) {
+	now := time.Now().UTC()
+	from := now.Add(time.Hour).Format("15:04")
+	to := now.Add(2 * time.Hour).Format("15:04")
+	smartOrderModel := GetTestSmartOrderStrategy("entryLong")
+	smartOrderModel.Conditions.Schedule = &models.MongoScheduleConditions{
+		EntryWindows: []*models.MongoTimeWindow{{From: from, To: to}},
+	}
+	tradingApi := tests.NewMockedTradingAPI()
+	smartOrder := newMockedSmartOrder(&smartOrderModel, tests.NewMockedDataFeed([]interfaces.OHLCV{{Open: 7100, High: 7101, Low: 6990, Close: 6995, Volume: 30}}), tradingApi)
+	go smartOrder.Start()
+	time.Sleep(1000 * time.Millisecond)
+	smartOrderModel.Enabled = false
+
+	if count, ok := tradingApi.CallCount.Load("buy"); ok && count.(int) > 0 {
+		t.Error("entry placed out of window")
+	}
+}
+
+// smart order in position should close it and stop once exit is forced
+func TestSmartOrderForceExit(t *testing.T) {
+	smartOrderModel := GetTestSmartOrderStrategy("stopLossMarket")
+	smartOrderModel.Conditions.Schedule = &models.MongoScheduleConditions{ForceExitAt: time.Now().Unix()}
+	tradingApi := tests.NewMockedTradingAPI()
+	smartOrder := newMockedSmartOrder(&smartOrderModel, tests.NewMockedDataFeed([]interfaces.OHLCV{{Open: 7100, High: 7101, Low: 7000, Close: 7005, Volume: 30}}), tradingApi)
+	go smartOrder.Start()
+	time.Sleep(1000 * time.Millisecond)
+
+	if smartOrderModel.Enabled {
+		t.Error("smart order should be disabled")
+	}
+	if count, ok := tradingApi.CallCount.Load("sell"); !ok || count.(int) == 0 {
+		t.Error("position should be closed")
+	}
+}
+
+// smart order waiting for entry after restart should be canceled once entry cancel time passed
+func TestSmartOrderCancelEntryAfterRestart(t *testing.T) {
+	smartOrderModel := GetTestSmartOrderStrategy("entryLong")
+	smartOrderModel.State.State = smart_order.WaitForEntry
+	smartOrderModel.Expiration = models.ExpirationSchema{ExpirationTimestamp: time.Now().Unix() - 60}
+	tradingApi := tests.NewMockedTradingAPI()
+	smartOrder := newMockedSmartOrder(&smartOrderModel, tests.NewMockedDataFeed([]interfaces.OHLCV{{Open: 7100, High: 7101, Low: 7050, Close: 7060, Volume: 30}}), tradingApi)
+	go smartOrder.Start()
+	time.Sleep(500 * time.Millisecond)
+
+	if smartOrderModel.Enabled || smartOrderModel.State.State != smart_order.Canceled {
+		t.Error("entry should be canceled", smartOrderModel.State.State)
+	}
+	if count, ok := tradingApi.CallCount.Load("buy"); ok && count.(int) > 0 {
+		t.Error("entry placed after expiration")
+	}
+}
+
+// smart order should cancel entry placed in the window once it closes and place entry again in the next window
+func TestSmartOrderCancelEntryOutOfWindow(t *testing.T) {
+	now := time.Now().UTC()
+	window := func(from, to time.Duration) *smart_order.Schedule {
+		schedule, err := smart_order.NewSchedule(&models.MongoScheduleConditions{
+			EntryWindows: []*models.MongoTimeWindow{{From: now.Add(from).Format("15:04"), To: now.Add(to).Format("15:04")}},
+		}, models.ExpirationSchema{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return schedule
+	}
+	smartOrderModel := GetTestSmartOrderStrategy("entryLong")
+	smartOrderModel.Conditions.Schedule = &models.MongoScheduleConditions{
+		EntryWindows: []*models.MongoTimeWindow{{From: now.Add(-time.Hour).Format("15:04"), To: now.Add(time.Hour).Format("15:04")}},
+	}
+	tradingApi := tests.NewMockedTradingAPI()
+	smartOrder := newMockedSmartOrder(&smartOrderModel, tests.NewMockedDataFeed([]interfaces.OHLCV{{Open: 7100, High: 7101, Low: 7050, Close: 7060, Volume: 30}}), tradingApi)
+	go smartOrder.Start()
+	time.Sleep(500 * time.Millisecond)
+	if count, ok := tradingApi.CallCount.Load("buy"); !ok || count.(int) != 1 {
+		t.Fatal("entry should be placed in window")
+	}
+
+	smartOrder.Schedule = window(time.Hour, 2*time.Hour)
+	time.Sleep(500 * time.Millisecond)
+	if count, ok := tradingApi.CanceledOrdersCount.Load("BTC_USDT"); !ok || count.(int) != 1 {
+		t.Fatal("entry should be canceled once the window closed")
+	}
+	if isInState, _ := smartOrder.State.IsInState(smart_order.WaitForEntry); !isInState || !smartOrderModel.Enabled {
+		t.Fatal("smart order should wait for the next window")
+	}
+
+	smartOrder.Schedule = window(-time.Hour, time.Hour)
+	time.Sleep(500 * time.Millisecond)
+	smartOrderModel.Enabled = false
+	if count, _ := tradingApi.CallCount.Load("buy"); count.(int) != 2 {
+		t.Error("entry should be placed again in the next window", count)
+	}
+}
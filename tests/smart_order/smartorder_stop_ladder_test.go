@@ -0,0 +1,81 @@
+package smart_order
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"gitlab.com/crypto_project/core/strategy_service/src/service/interfaces"
+	"gitlab.com/crypto_project/core/strategy_service/src/service/strategies/smart_order"
+	"gitlab.com/crypto_project/core/strategy_service/src/sources/mongodb/models"
+	"gitlab.com/crypto_project/core/strategy_service/tests"
+)
+
+func TestStopLadderStepReached(t *testing.T) {
+	byProfit := &models.MongoStopLadderStep{Profit: 2, Stop: 0}
+	if smart_order.StopLadderStepReached(byProfit, 1.9, 5) || !smart_order.StopLadderStepReached(byProfit, 2, 0) {
+		t.Error("step by profit should be reached by profit only")
+	}
+	byTarget := &models.MongoStopLadderStep{AfterTarget: 2, Stop: 1}
+	if smart_order.StopLadderStepReached(byTarget, 100, 1) || !smart_order.StopLadderStepReached(byTarget, 0, 2) {
+		t.Error("step by target should be reached by filled targets only")
+	}
+}
+
+// smart order should stop at the profit locked by the ladder while initial stop-loss is far
+func TestSmartOrderStopLadderLocksProfit(t *testing.T) {
+	fakeDataStream := []interfaces.OHLCV{
+		{Open: 7000, High: 7010, Low: 6995, Close: 7005, Volume: 30},
+		{Open: 7005, High: 7160, Low: 7005, Close: 7150, Volume: 30},
+		{Open: 7150, High: 7150, Low: 7020, Close: 7030, Volume: 30},
+	}
+	smartOrderModel := GetTestSmartOrderStrategy("stopLossMarket")
+	smartOrderModel.Conditions.StopLadder = []*models.MongoStopLadderStep{{Profit: 1, Stop: 0}, {Profit: 2, Stop: 0.5}, {Profit: 5, Stop: 3}}
+	tradingApi := tests.NewMockedTradingAPI()
+	smartOrder := newMockedSmartOrder(&smartOrderModel, tests.NewMockedDataFeed(fakeDataStream), tradingApi)
+	go smartOrder.Start()
+	time.Sleep(5000 * time.Millisecond)
+
+	if smartOrderModel.State.StopLadderStep != 2 {
+		t.Error("two ladder steps should be reached, reached", smartOrderModel.State.StopLadderStep)
+	}
+	if isInState, _ := smartOrder.State.IsInState(smart_order.End); !isInState {
+		state, _ := smartOrder.State.State(context.Background())
+		t.Error("SmartOrder state is not End, state:", state)
+	}
+	if count, ok := tradingApi.CallCount.Load("sell"); !ok || count.(int) == 0 {
+		t.Error("position should be closed")
+	}
+}
+
+// smart order on futures should replace stop-loss order placed with the one at the price locked by the ladder
+func TestSmartOrderStopLadderReplacesStopLoss(t *testing.T) {
+	fakeDataStream := []interfaces.OHLCV{
+		{Open: 7000, High: 7010, Low: 6995, Close: 7005, Volume: 30},
+		{Open: 7005, High: 7160, Low: 7005, Close: 7150, Volume: 30},
+	}
+	smartOrderModel := GetTestSmartOrderStrategy("stopLossMarket")
+	smartOrderModel.Conditions.MarketType = 1
+	smartOrderModel.Conditions.StopLadder = []*models.MongoStopLadderStep{{Profit: 2, Stop: 0.5}}
+	tradingApi := tests.NewMockedTradingAPI()
+	smartOrder := newMockedSmartOrder(&smartOrderModel, tests.NewMockedDataFeed(fakeDataStream), tradingApi)
+	smartOrder.PlaceOrder(0, 0.0, smart_order.Stoploss)
+	if len(smartOrderModel.State.StopLossOrderIds) != 1 {
+		t.Fatal("stop-loss order should be placed")
+	}
+	replacedOrderId := smartOrderModel.State.StopLossOrderIds[0]
+	go smartOrder.Start()
+	time.Sleep(2000 * time.Millisecond)
+	smartOrderModel.Enabled = false
+
+	if len(smartOrderModel.State.StopLossOrderIds) != 1 || smartOrderModel.State.StopLossOrderIds[0] == replacedOrderId {
+		t.Fatal("stop-loss order should be replaced", smartOrderModel.State.StopLossOrderIds)
+	}
+	order, _ := tradingApi.OrdersMap.Load(smartOrderModel.State.StopLossOrderIds[0])
+	if stopPrice := order.(models.MongoOrder).StopPrice; stopPrice != 7035 {
+		t.Error("stop-loss should lock 0.5% profit, stop price", stopPrice)
+	}
+	if order, _ := tradingApi.OrdersMap.Load(replacedOrderId); order.(models.MongoOrder).Status != "canceled" {
+		t.Error("replaced stop-loss order should be canceled")
+	}
+}
@@ -15,8 +15,10 @@ import (
 
 	"github.com/qmuntal/stateless"
 	"gitlab.com/crypto_project/core/strategy_service/src/service/interfaces"
+	"gitlab.com/crypto_project/core/strategy_service/src/service/quotas"
 	"gitlab.com/crypto_project/core/strategy_service/src/service/strategies"
 	"gitlab.com/crypto_project/core/strategy_service/src/service/strategies/smart_order"
+	"gitlab.com/crypto_project/core/strategy_service/src/sources/mongodb/models"
 	"gitlab.com/crypto_project/core/strategy_service/tests"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
@@ -86,6 +88,59 @@ func TestSmartExitOnStopMarket(t *testing.T) {
 	}
 }
 
+// stop-loss of a smart order in hedge mode, not reduce-only there, should be placed beyond orders per minute quota
+func TestSmartExitOnStopMarketBeyondOrdersQuota(t *testing.T) {
+	fakeDataStream := []interfaces.OHLCV{{
+		Open:   7100,
+		High:   7101,
+		Low:    7000,
+		Close:  7005,
+		Volume: 30,
+	}, {
+		Open:   7005,
+		High:   7005,
+		Low:    6900,
+		Close:  6900,
+		Volume: 30,
+	}, {
+		Open:   6905,
+		High:   7005,
+		Low:    6600,
+		Close:  6600,
+		Volume: 30,
+	}}
+	smartOrderModel := GetTestSmartOrderStrategy("stopLossMarket")
+	smartOrderModel.Conditions.HedgeMode = true
+	keyId, ownerId := primitive.NewObjectID(), primitive.NewObjectID()
+	smartOrderModel.AccountId, smartOrderModel.OwnerId = &keyId, ownerId
+	df := tests.NewMockedDataFeed(fakeDataStream)
+	tradingApi := tests.NewMockedTradingAPI()
+	sm := tests.NewMockedStateMgmt(tradingApi, df)
+	logger, stats := tests.GetLoggerStatsd()
+	enforcer := quotas.NewEnforcer(nil, models.MongoQuota{MaxOrdersPerMinute: 1}, nil, stats)
+	if err := enforcer.CheckOrder(&ownerId, &keyId); err != nil {
+		t.Fatal("first order should be within quota", err)
+	}
+	strategy := strategies.Strategy{
+		Model:           &smartOrderModel,
+		StateMgmt:       &sm,
+		Log:             logger,
+		Statsd:          stats,
+		SettlementMutex: &redsync.Mutex{},
+	}
+	smartOrder := smart_order.New(&strategy, df, enforcer.Trading(tradingApi, &smartOrderModel), strategy.Statsd, &keyId, &sm)
+	go smartOrder.Start()
+	time.Sleep(5000 * time.Millisecond)
+
+	if sellCallCount, _ := tradingApi.CallCount.Load("sell"); sellCallCount == nil || sellCallCount.(int) == 0 {
+		t.Error("stop-loss should be placed with orders quota exceeded")
+	}
+	if isInState, _ := smartOrder.State.IsInState(smart_order.End); !isInState {
+		state, _ := smartOrder.State.State(context.Background())
+		t.Error("smart order should end by stop-loss, state", state)
+	}
+}
+
 // smart order should wait for timeout if set
 func TestSmartExitOnStopMarketTimeout(t *testing.T) {
 	// price drops
@@ -1,11 +1,30 @@
 package smart_order
 
 import (
+	"github.com/go-redsync/redsync/v4"
+	"gitlab.com/crypto_project/core/strategy_service/src/service/strategies"
+	"gitlab.com/crypto_project/core/strategy_service/src/service/strategies/smart_order"
 	"gitlab.com/crypto_project/core/strategy_service/src/sources/mongodb/models"
+	"gitlab.com/crypto_project/core/strategy_service/tests"
 	//"gitlab.com/crypto_project/core/strategy_service/src/trading"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+// newMockedSmartOrder returns smart order of the model trading with the api given over the data feed mocked.
+func newMockedSmartOrder(model *models.MongoStrategy, df *tests.MockDataFeed, tradingApi *tests.MockTrading) *smart_order.SmartOrder {
+	keyId := primitive.NewObjectID()
+	sm := tests.NewMockedStateMgmt(tradingApi, df)
+	logger, stats := tests.GetLoggerStatsd()
+	strategy := strategies.Strategy{
+		Model:           model,
+		StateMgmt:       &sm,
+		Log:             logger,
+		Statsd:          stats,
+		SettlementMutex: &redsync.Mutex{},
+	}
+	return smart_order.New(&strategy, df, tradingApi, strategy.Statsd, &keyId, &sm)
+}
+
 // returns conditions of smart order depending on the scenario
 func GetTestSmartOrderStrategy(scenario string) models.MongoStrategy {
 	smartOrder := models.MongoStrategy{
@@ -74,6 +93,7 @@ func GetTestSmartOrderStrategy(scenario string) models.MongoStrategy {
 					Amount:    100,
 				},
 			},
+			StopLoss:          20, // below the lowest close after entry
 			EntrySpreadHunter: true,
 			EntryWaitingTime:  1000,
 		}
@@ -0,0 +1,109 @@
+package smart_order
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"gitlab.com/crypto_project/core/strategy_service/src/service/interfaces"
+	"gitlab.com/crypto_project/core/strategy_service/src/service/strategies/smart_order"
+	"gitlab.com/crypto_project/core/strategy_service/src/sources/mongodb/models"
+	"gitlab.com/crypto_project/core/strategy_service/tests"
+)
+
+// smart order should close parts of the position by time exits due and the rest at the deadline
+func TestSmartOrderTimeExits(t *testing.T) {
+	fakeDataStream := []interfaces.OHLCV{{Open: 7000, High: 7010, Low: 6995, Close: 7005, Volume: 30}}
+	smartOrderModel := GetTestSmartOrderStrategy("stopLossMarket")
+	smartOrderModel.Conditions.MarketType = 1
+	smartOrderModel.Conditions.EntryOrder.Amount = 0.2
+	smartOrderModel.State.EnteredAt = time.Now().Add(-5 * time.Hour).Unix()
+	smartOrderModel.Conditions.TimeExits = []*models.MongoTimeExit{
+		{After: 3600, Amount: 25},
+		{After: 4 * 3600, Amount: 25},
+		{At: time.Now().Add(time.Hour).Unix()},
+	}
+	df := tests.NewMockedDataFeed(fakeDataStream)
+	tradingApi := tests.NewMockedTradingAPIWithMarketAccess(df)
+	smartOrder := newMockedSmartOrder(&smartOrderModel, df, tradingApi)
+	go smartOrder.Start()
+	time.Sleep(2000 * time.Millisecond)
+
+	if smartOrderModel.State.TimeExitsDone != 2 {
+		t.Error("two time exits should be done, done", smartOrderModel.State.TimeExitsDone)
+	}
+	if amount, _ := tradingApi.AmountSum.Load("BTC_USDTsell"); math.Abs(amount.(float64)-0.1) > 1e-9 {
+		t.Error("half of the position should be closed, closed", amount)
+	}
+	if math.Abs(smartOrderModel.State.ExecutedAmount-0.1) > 1e-9 || smartOrderModel.State.ReceivedProfitAmount == 0 {
+		t.Error("partial exits should be accounted", smartOrderModel.State.ExecutedAmount, smartOrderModel.State.ReceivedProfitAmount)
+	}
+
+	smartOrderModel.Conditions.TimeExits[2].At = time.Now().Unix()
+	time.Sleep(2000 * time.Millisecond)
+	smartOrderModel.Enabled = false
+
+	if isInState, _ := smartOrder.State.IsInState(smart_order.End); !isInState {
+		state, _ := smartOrder.State.State(context.Background())
+		t.Error("SmartOrder state is not End, state:", state)
+	}
+}
+
+// smart order shouldn't exit by time exit conditioned on profit while the position is at loss
+func TestSmartOrderTimeExitIfProfitable(t *testing.T) {
+	fakeDataStream := []interfaces.OHLCV{{Open: 7000, High: 7000, Low: 6900, Close: 6950, Volume: 30}}
+	smartOrderModel := GetTestSmartOrderStrategy("stopLossMarket")
+	smartOrderModel.Conditions.MarketType = 1
+	smartOrderModel.State.EnteredAt = time.Now().Add(-2 * time.Hour).Unix()
+	smartOrderModel.Conditions.TimeExits = []*models.MongoTimeExit{{After: 3600, Amount: 50, IfProfitable: true}}
+	df := tests.NewMockedDataFeed(fakeDataStream)
+	tradingApi := tests.NewMockedTradingAPIWithMarketAccess(df)
+	smartOrder := newMockedSmartOrder(&smartOrderModel, df, tradingApi)
+	go smartOrder.Start()
+	time.Sleep(1000 * time.Millisecond)
+	smartOrderModel.Enabled = false
+
+	if smartOrderModel.State.TimeExitsDone != 0 {
+		t.Error("time exit shouldn't be done at loss")
+	}
+	if count, ok := tradingApi.CallCount.Load("sell"); ok && count.(int) > 0 {
+		t.Error("position shouldn't be closed at loss")
+	}
+}
+
+// smart order on spot should count targets closed by time exits as reached and replace take-profits for the rest
+func TestSmartOrderTimeExitReplacesTakeProfits(t *testing.T) {
+	fakeDataStream := []interfaces.OHLCV{{Open: 7000, High: 7010, Low: 6995, Close: 7005, Volume: 30}}
+	smartOrderModel := GetTestSmartOrderStrategy("stopLossMarket")
+	smartOrderModel.Conditions.EntryOrder.Amount = 0.2
+	smartOrderModel.Conditions.ExitLevels = []*models.MongoEntryPoint{
+		{Type: 1, OrderType: "limit", Price: 5, Amount: 50},
+		{Type: 1, OrderType: "limit", Price: 10, Amount: 50},
+	}
+	smartOrderModel.State.TakeProfitOrderIds = []string{"takeProfit1", "takeProfit2"}
+	smartOrderModel.State.EnteredAt = time.Now().Add(-2 * time.Hour).Unix()
+	smartOrderModel.Conditions.TimeExits = []*models.MongoTimeExit{
+		{After: 3600, Amount: 60},
+		{At: time.Now().Add(time.Hour).Unix()},
+	}
+	df := tests.NewMockedDataFeed(fakeDataStream)
+	tradingApi := tests.NewMockedTradingAPIWithMarketAccess(df)
+	smartOrder := newMockedSmartOrder(&smartOrderModel, df, tradingApi)
+	go smartOrder.Start()
+	time.Sleep(2000 * time.Millisecond)
+	smartOrderModel.Enabled = false
+
+	if smartOrderModel.State.ReachedTargetCount != 1 {
+		t.Error("first target should be reached by time exit, reached", smartOrderModel.State.ReachedTargetCount)
+	}
+	if count, _ := tradingApi.CallCount.Load("sell"); count == nil || count.(int) != 2 {
+		t.Error("time exit and take-profit of the second target should be placed, placed", count)
+	}
+	if amount, _ := tradingApi.AmountSum.Load("BTC_USDTsell"); amount == nil || math.Abs(amount.(float64)-0.2) > 1e-9 {
+		t.Error("take-profit should be replaced for the rest of the position, sold", amount)
+	}
+	if len(smartOrderModel.State.TakeProfitOrderIds) != 1 {
+		t.Error("replaced take-profit should be tracked", smartOrderModel.State.TakeProfitOrderIds)
+	}
+}
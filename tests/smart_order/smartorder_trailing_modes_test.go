@@ -0,0 +1,63 @@
+package smart_order
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-redsync/redsync/v4"
+	"gitlab.com/crypto_project/core/strategy_service/src/service/interfaces"
+	"gitlab.com/crypto_project/core/strategy_service/src/service/strategies"
+	"gitlab.com/crypto_project/core/strategy_service/src/service/strategies/smart_order"
+	"gitlab.com/crypto_project/core/strategy_service/src/sources/mongodb/models"
+	"gitlab.com/crypto_project/core/strategy_service/tests"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// smart order should exit by the give-back trailing once half of profit reached at the edge price is given back,
+// while it's farther than entry deviation from the edge
+func TestSmartOrderGiveBackTrailingExit(t *testing.T) {
+	fakeDataStream := []interfaces.OHLCV{
+		{Open: 7000, High: 7010, Low: 6995, Close: 7005, Volume: 30},
+		{Open: 7005, High: 7100, Low: 7005, Close: 7100, Volume: 30},
+		{Open: 7100, High: 7200, Low: 7100, Close: 7200, Volume: 30},
+		{Open: 7200, High: 7200, Low: 7150, Close: 7150, Volume: 30},
+		{Open: 7150, High: 7150, Low: 7090, Close: 7090, Volume: 30},
+	}
+	smartOrderModel := GetTestSmartOrderStrategy("stopLossMarket")
+	smartOrderModel.Conditions.ExitLevels = []*models.MongoEntryPoint{{
+		Type:               1,
+		OrderType:          "market",
+		ActivatePrice:      1,
+		EntryDeviation:     5,
+		Amount:             100,
+		TrailingMode:       "giveback",
+		TrailingMultiplier: 50,
+	}}
+	df := tests.NewMockedDataFeed(fakeDataStream)
+	tradingApi := tests.NewMockedTradingAPI()
+	keyId := primitive.NewObjectID()
+	sm := tests.NewMockedStateMgmt(tradingApi, df)
+	logger, stats := tests.GetLoggerStatsd()
+	strategy := strategies.Strategy{
+		Model:           &smartOrderModel,
+		StateMgmt:       &sm,
+		Log:             logger,
+		Statsd:          stats,
+		SettlementMutex: &redsync.Mutex{},
+	}
+	smartOrder := smart_order.New(&strategy, df, tradingApi, strategy.Statsd, &keyId, &sm)
+	go smartOrder.Start()
+	time.Sleep(3000 * time.Millisecond)
+
+	if stops := smartOrderModel.State.TrailingExitStops; len(stops) != 1 || stops[0] != 7100 {
+		t.Error("give-back stop should trail half of profit at the edge price", stops)
+	}
+	if isInState, _ := smartOrder.State.IsInState(smart_order.End); !isInState {
+		state, _ := smartOrder.State.State(context.Background())
+		t.Error("SmartOrder state is not End, state:", state)
+	}
+	if count, ok := tradingApi.CallCount.Load("sell"); !ok || count.(int) == 0 {
+		t.Error("position should be closed")
+	}
+}
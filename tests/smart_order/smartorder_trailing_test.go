@@ -292,3 +292,43 @@ func TestSmartOrderTrailingEntryAndFollowTrailingMaximumsWithoutEarlyExitWithHig
 		t.Error("SmartOrder trailingExitPrice " + fmt.Sprintf("%f", trailingExitPrice) + " != " + fmt.Sprintf("%f", expectedTrailingExitPrice) + "")
 	}
 }
+
+// smart order with leverage not set should trail take-profit as with leverage 1, e.g. after conditions reloaded
+func TestSmartOrderTrailingExitWithoutLeverage(t *testing.T) {
+	fakeDataStream := []interfaces.OHLCV{
+		{Open: 7400, High: 7400, Low: 7400, Close: 7400, Volume: 30}, // activates trailing at 5% profit
+		{Open: 7500, High: 7500, Low: 7500, Close: 7500, Volume: 30},
+		{Open: 7400, High: 7400, Low: 7400, Close: 7400, Volume: 30}, // 1% below the maximum
+	}
+	smartOrderModel := GetTestSmartOrderStrategy("stopLossMarket")
+	smartOrderModel.Conditions.Leverage = 0
+	smartOrderModel.Conditions.ExitLevels = []*models.MongoEntryPoint{{
+		Type:           1,
+		OrderType:      "market",
+		ActivatePrice:  5,
+		EntryDeviation: 1,
+		Amount:         100,
+	}}
+	df := tests.NewMockedDataFeed(fakeDataStream)
+	tradingApi := tests.NewMockedTradingAPI()
+	keyId := primitive.NewObjectID()
+	sm := tests.NewMockedStateMgmt(tradingApi, df)
+	logger, stats := tests.GetLoggerStatsd()
+	strategy := strategies.Strategy{
+		Model:           &smartOrderModel,
+		StateMgmt:       &sm,
+		Log:             logger,
+		Statsd:          stats,
+		SettlementMutex: &redsync.Mutex{},
+	}
+	smartOrder := smart_order.New(&strategy, df, tradingApi, strategy.Statsd, &keyId, &sm)
+	go smartOrder.Start()
+	time.Sleep(500 * time.Millisecond)
+
+	if prices := smartOrderModel.State.TrailingExitPrices; len(prices) != 1 || prices[0] != 7500 {
+		t.Error("trailing should be activated and follow the maximum", prices)
+	}
+	if state, _ := smartOrder.State.State(context.Background()); state != smart_order.TakeProfit && state != smart_order.End {
+		t.Error("take-profit should be placed once the price deviated from the maximum, state", state)
+	}
+}
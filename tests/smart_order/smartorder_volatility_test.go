@@ -0,0 +1,69 @@
+package smart_order
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"gitlab.com/crypto_project/core/strategy_service/src/service/interfaces"
+	"gitlab.com/crypto_project/core/strategy_service/src/service/strategies/smart_order"
+	"gitlab.com/crypto_project/core/strategy_service/src/sources/mongodb/models"
+	"gitlab.com/crypto_project/core/strategy_service/tests"
+)
+
+func TestVolatilityTrailStopPrice(t *testing.T) {
+	if stop := smart_order.TrailStopPrice("buy", 90, 100, 5); stop != 95 {
+		t.Error("long stop should move up", stop)
+	}
+	if stop := smart_order.TrailStopPrice("buy", 96, 100, 5); stop != 96 {
+		t.Error("long stop shouldn't move down", stop)
+	}
+	if stop := smart_order.TrailStopPrice("sell", 0, 100, 5); stop != 105 {
+		t.Error("short stop should be set", stop)
+	}
+	if stop := smart_order.TrailStopPrice("sell", 103, 100, 5); stop != 103 {
+		t.Error("short stop shouldn't move up", stop)
+	}
+}
+
+func TestVolatilityStopLossPercentage(t *testing.T) {
+	if p := smart_order.StopLossPercentage("buy", 100, 95, 10); math.Abs(p-50) > 1e-9 {
+		t.Error("wrong long stop-loss percentage with leverage", p)
+	}
+	if p := smart_order.StopLossPercentage("sell", 100, 98, 1); math.Abs(p+2) > 1e-9 {
+		t.Error("short stop below entry locks profit", p)
+	}
+}
+
+// smart order should convert stop-loss and exit levels in volatility units by ATR of candles at entry
+func TestSmartOrderVolatilityLevelsByATR(t *testing.T) {
+	fakeDataStream := []interfaces.OHLCV{{Open: 7000, High: 7005, Low: 6995, Close: 7000, Volume: 30}}
+	smartOrderModel := GetTestSmartOrderStrategy("entryLong")
+	smartOrderModel.Conditions.EntryOrder.OrderType = "market"
+	smartOrderModel.Conditions.Leverage = 2
+	smartOrderModel.Conditions.Volatility = &models.MongoVolatilityConditions{Period: 14, StopLoss: 2}
+	smartOrderModel.Conditions.ExitLevels = []*models.MongoEntryPoint{{Type: 2, OrderType: "limit", Price: 3, Amount: 100}}
+	df := tests.NewMockedDataFeed(fakeDataStream)
+	for i := 0; i < 43; i++ { // true range of 10 each
+		df.Candles = append(df.Candles, interfaces.Candle{Timestamp: int64(i) * 900, Open: 7000, High: 7005, Low: 6995, Close: 7000, Volume: 30})
+	}
+	smartOrder := newMockedSmartOrder(&smartOrderModel, df, tests.NewMockedTradingAPI())
+	go smartOrder.Start()
+	time.Sleep(2000 * time.Millisecond)
+
+	state := smartOrderModel.State
+	if isInState, _ := smartOrder.State.IsInState(smart_order.InEntry); !isInState || state.EntryPrice != 7000 {
+		t.Fatal("smart order should enter at 7000", state.State, state.EntryPrice)
+	}
+	if math.Abs(state.Volatility-10) > 1e-9 {
+		t.Error("volatility should be ATR of candles", state.Volatility)
+	}
+	toPercentage := func(units float64) float64 { return units * 10 / 7000 * 100 * 2 }
+	if stopLoss := smartOrderModel.Conditions.StopLoss; math.Abs(stopLoss-toPercentage(2)) > 1e-9 {
+		t.Error("stop-loss should be 2 ATRs from entry with leverage", stopLoss)
+	}
+	level := smartOrderModel.Conditions.ExitLevels[0]
+	if level.Type != 1 || level.VolatilityUnits != 3 || math.Abs(level.Price-toPercentage(3)) > 1e-9 {
+		t.Error("exit level should be 3 ATRs from entry with leverage", level.Type, level.VolatilityUnits, level.Price)
+	}
+}
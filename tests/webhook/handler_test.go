@@ -0,0 +1,165 @@
+package webhook
+
+import (
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	"gitlab.com/crypto_project/core/strategy_service/src/logging"
+	"gitlab.com/crypto_project/core/strategy_service/src/service"
+	"gitlab.com/crypto_project/core/strategy_service/src/sources/memory"
+	"gitlab.com/crypto_project/core/strategy_service/src/sources/mongodb/models"
+	statsd_client "gitlab.com/crypto_project/core/strategy_service/src/statsd"
+	"gitlab.com/crypto_project/core/strategy_service/tests"
+)
+
+// webhookStore keeps templates, nonces and the audit trail in memory next to the memory state management.
+type webhookStore struct {
+	*memory.StateMgmt
+	templates map[string]*models.MongoStrategy
+	nonces    map[string]bool
+	events    chan models.MongoWebhookEvent
+	mux       sync.Mutex
+}
+
+func (s *webhookStore) GetTemplateByToken(token string) *models.MongoStrategy {
+	return s.templates[token]
+}
+
+func (s *webhookStore) RegisterWebhookNonce(nonce string) bool {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if s.nonces[nonce] {
+		return false
+	}
+	s.nonces[nonce] = true
+	return true
+}
+
+func (s *webhookStore) SaveWebhookEvent(event models.MongoWebhookEvent) {
+	s.events <- event
+}
+
+// event returns the next audit trail record saved asynchronously.
+func (s *webhookStore) event(t *testing.T) models.MongoWebhookEvent {
+	select {
+	case event := <-s.events:
+		return event
+	case <-time.After(time.Second):
+		t.Fatal("webhook event not saved to the audit trail")
+	}
+	return models.MongoWebhookEvent{}
+}
+
+func newWebhookService(t *testing.T) (*service.StrategyService, *webhookStore) {
+	logger, err := logging.GetZapLogger()
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := &webhookStore{
+		StateMgmt: memory.NewStateMgmt(),
+		templates: map[string]*models.MongoStrategy{"secret": getTemplate()},
+		nonces:    map[string]bool{},
+		events:    make(chan models.MongoWebhookEvent, 10),
+	}
+	ss := service.NewStrategyService(tests.NewMockedDataFeed(nil), nil, store, statsd_client.StatsdClient{}, logger)
+	return ss, store
+}
+
+func body(t *testing.T, payload models.WebhookPayload) []byte {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestWebhookAccepted(t *testing.T) {
+	ss, store := newWebhookService(t)
+	response := ss.ProcessWebhook("secret", body(t, models.WebhookPayload{Id: "alert-1", Timestamp: time.Now().Unix(), Side: "sell"}), "10.0.0.1")
+	if response.Status != "OK" {
+		t.Fatal("webhook should be accepted", response.Data.Msg)
+	}
+	event := store.event(t)
+	if event.Status != models.WebhookAccepted || event.Nonce != "alert-1" || event.RemoteAddr != "10.0.0.1" ||
+		event.StrategyId == nil || event.StrategyId.Hex() != response.Data.OrderId {
+		t.Errorf("accepted webhook should be audited with the strategy spawned %+v", event)
+	}
+	strategy := store.GetStrategy(event.StrategyId)
+	if strategy == nil || !strategy.Enabled || strategy.Conditions.EntryOrder.Side != "sell" {
+		t.Errorf("strategy should be created from the template %+v", strategy)
+	}
+}
+
+func TestWebhookUnknownToken(t *testing.T) {
+	ss, store := newWebhookService(t)
+	for _, token := range []string{"", "guess"} {
+		response := ss.ProcessWebhook(token, body(t, models.WebhookPayload{Timestamp: time.Now().Unix(), Side: "buy"}), "10.0.0.2")
+		if response.Status != "ERR" {
+			t.Errorf("token %q should be rejected", token)
+		}
+		event := store.event(t)
+		if event.Status != models.WebhookRejected || event.Msg != "unknown token" || event.TemplateStrategyId != nil {
+			t.Errorf("rejection should be audited %+v", event)
+		}
+	}
+	if len(store.GetEnabledStrategies()) != 0 {
+		t.Error("rejected webhook shouldn't create strategies")
+	}
+}
+
+func TestWebhookReplayWindow(t *testing.T) {
+	ss, store := newWebhookService(t)
+	now := time.Now().Unix()
+	for _, timestamp := range []int64{0, now - service.WebhookMaxAge - 5, now + service.WebhookMaxAge + 5} {
+		response := ss.ProcessWebhook("secret", body(t, models.WebhookPayload{Timestamp: timestamp, Side: "buy"}), "10.0.0.3")
+		if response.Status != "ERR" || response.Data.Msg != "timestamp out of replay window" {
+			t.Errorf("timestamp %v should be out of the replay window, got %+v", timestamp, response)
+		}
+		if event := store.event(t); event.Status != models.WebhookRejected || event.TemplateStrategyId == nil {
+			t.Errorf("rejection should be audited with the template %+v", event)
+		}
+	}
+}
+
+func TestWebhookNonceDedup(t *testing.T) {
+	ss, store := newWebhookService(t)
+	now := time.Now().Unix()
+	withId := body(t, models.WebhookPayload{Id: "alert-2", Timestamp: now, Side: "buy"})
+	if response := ss.ProcessWebhook("secret", withId, "10.0.0.4"); response.Status != "OK" {
+		t.Fatal("first signal should be accepted", response.Data.Msg)
+	}
+	store.event(t)
+	if response := ss.ProcessWebhook("secret", withId, "10.0.0.4"); response.Status != "ERR" || response.Data.Msg != "replayed signal" {
+		t.Errorf("signal with the same id should be rejected as replayed %+v", response)
+	}
+	if event := store.event(t); event.Status != models.WebhookRejected || event.Nonce != "alert-2" {
+		t.Errorf("replay should be audited with its nonce %+v", event)
+	}
+
+	// without id the payload hash is the nonce
+	withoutId := body(t, models.WebhookPayload{Timestamp: now, Side: "buy", Amount: 0.01})
+	ss.ProcessWebhook("secret", withoutId, "10.0.0.4")
+	first := store.event(t)
+	ss.ProcessWebhook("secret", withoutId, "10.0.0.4")
+	second := store.event(t)
+	if first.Status != models.WebhookAccepted || second.Status != models.WebhookRejected || len(first.Nonce) != 64 || first.Nonce != second.Nonce {
+		t.Errorf("identical payload without id should be rejected by its hash %+v %+v", first, second)
+	}
+	if len(store.GetEnabledStrategies()) != 2 {
+		t.Error("only accepted signals should create strategies", len(store.GetEnabledStrategies()))
+	}
+}
+
+func TestWebhookMalformedPayload(t *testing.T) {
+	ss, store := newWebhookService(t)
+	for _, data := range [][]byte{[]byte("{"), body(t, models.WebhookPayload{Timestamp: time.Now().Unix(), Side: "long"})} {
+		if response := ss.ProcessWebhook("secret", data, "10.0.0.5"); response.Status != "ERR" {
+			t.Errorf("payload %s should be rejected", data)
+		}
+		if event := store.event(t); event.Status != models.WebhookRejected || event.Payload != string(data) {
+			t.Errorf("rejection should be audited with the payload %+v", event)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package webhook
+
+import (
+	"testing"
+
+	"gitlab.com/crypto_project/core/strategy_service/src/service"
+	"gitlab.com/crypto_project/core/strategy_service/src/sources/mongodb/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func getTemplate() *models.MongoStrategy {
+	id := primitive.NewObjectID()
+	return &models.MongoStrategy{
+		ID:      &id,
+		Type:    1,
+		Enabled: true,
+		Conditions: &models.MongoStrategyCondition{
+			TemplateToken: "secret",
+			Pair:          "BTC_USDT",
+			MarketType:    1,
+			Leverage:      20,
+			EntryOrder: &models.MongoEntryPoint{
+				Side:      "buy",
+				Amount:    0.05,
+				OrderType: "market",
+			},
+			ExitLevels: []*models.MongoEntryPoint{{Price: 5, Amount: 100, Type: 1, OrderType: "limit"}},
+		},
+	}
+}
+
+func TestWebhookPayloadMapping(t *testing.T) {
+	template := getTemplate()
+	strategy, err := service.NewStrategyFromTemplate(template, models.WebhookPayload{
+		Side:    "sell",
+		Amount:  0.1,
+		Price:   7000,
+		Stop:    7100,
+		Targets: []float64{6900, 6800},
+	}, 0)
+	if err != nil {
+		t.Fatal("mapping failed", err)
+	}
+	conditions := strategy.Conditions
+	if !conditions.CreatedByTemplate || conditions.TemplateStrategyId != template.ID || conditions.TemplateToken != "" {
+		t.Error("strategy not linked to template or token leaked", conditions.TemplateStrategyId, conditions.TemplateToken)
+	}
+	if conditions.EntryOrder.Side != "sell" || conditions.EntryOrder.Amount != 0.1 ||
+		conditions.EntryOrder.Price != 7000 || conditions.EntryOrder.OrderType != "limit" {
+		t.Errorf("wrong entry order %+v", conditions.EntryOrder)
+	}
+	if conditions.StopLossPrice != 7100 {
+		t.Error("wrong stop loss price", conditions.StopLossPrice)
+	}
+	if len(conditions.ExitLevels) != 2 || conditions.ExitLevels[1].Price != 6800 || conditions.ExitLevels[1].Type != 0 {
+		t.Errorf("wrong exit levels %+v", conditions.ExitLevels)
+	}
+	if template.Conditions.EntryOrder.Side != "buy" || template.Conditions.TemplateToken != "secret" {
+		t.Error("template conditions changed")
+	}
+}
+
+func TestWebhookPayloadValidation(t *testing.T) {
+	payloads := []models.WebhookPayload{
+		{Side: "long"},
+		{Side: "buy", Amount: -1},
+		{Side: "buy", Price: 7000, Stop: 7100},
+		{Side: "buy", Targets: []float64{0}},
+		{Side: "buy", Stop: 7100},
+		{Side: "sell", Stop: 6900},
+	}
+	for _, payload := range payloads {
+		if _, err := service.NewStrategyFromTemplate(getTemplate(), payload, 7000); err == nil {
+			t.Errorf("payload %+v should be rejected", payload)
+		}
+	}
+	if _, err := service.NewStrategyFromTemplate(getTemplate(), models.WebhookPayload{Side: "buy", Stop: 6900}, 7000); err != nil {
+		t.Error("stop of market entry below the last price should be accepted", err)
+	}
+	if _, err := service.NewStrategyFromTemplate(getTemplate(), models.WebhookPayload{Side: "buy", Stop: 6900}, 0); err == nil {
+		t.Error("stop of market entry should be rejected if the last price is unknown")
+	}
+}